@@ -0,0 +1,45 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+// Package bsd contains a FreeBSD and OpenBSD client for accessing the PKCS#11
+// APIs directly, bypassing the RPC-mechanism of the universal client. The
+// PKCS#11 implementation is shared with the linux package.
+package bsd
+
+import (
+	"github.com/googleapis/enterprise-certificate-proxy/linux"
+)
+
+// SecureKey is a public wrapper for the internal PKCS#11 implementation.
+type SecureKey = linux.SecureKey
+
+// NewSecureKey returns a handle to the first available certificate and private key pair in
+// the specified PKCS#11 Module matching the filters.
+func NewSecureKey(pkcs11Module string, slotUint32Str string, label string, userPin string) (*SecureKey, error) {
+	return linux.NewSecureKey(pkcs11Module, slotUint32Str, label, userPin)
+}
+
+// NewSecureKeyFromModules returns a handle to the first available certificate and private key pair
+// matching the filters, trying each of the specified PKCS#11 Modules in order.
+func NewSecureKeyFromModules(pkcs11Modules []string, slotUint32Str string, label string, userPin string) (*SecureKey, error) {
+	return linux.NewSecureKeyFromModules(pkcs11Modules, slotUint32Str, label, userPin)
+}
+
+// ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the
+// token in the specified slot of a PKCS#11 Module, under label. It requires pkcs11-tool from OpenSC.
+func ImportPKCS12Cred(credPath, password, pkcs11Module, slotUint32Str, label, userPin string) error {
+	return linux.ImportPKCS12Cred(credPath, password, pkcs11Module, slotUint32Str, label, userPin)
+}
@@ -16,6 +16,8 @@
 set -eux
 
 CURRENT_TAG=$(cat version.txt)
+VERSION_PACKAGE=github.com/googleapis/enterprise-certificate-proxy/internal/version
+LDFLAGS="-X=$VERSION_PACKAGE.Version=$CURRENT_TAG -X=$VERSION_PACKAGE.Commit=$(git rev-parse --short HEAD)"
 
 # Create a folder to hold the binaries
 rm -rf ./build/bin/darwin_amd64
@@ -23,10 +25,10 @@ mkdir -p ./build/bin/darwin_amd64
 
 # Build the signer binary
 cd ./internal/signer/darwin
-go build
+go build -ldflags="$LDFLAGS"
 mv darwin ./../../../build/bin/darwin_amd64/ecp
 cd ./../../..
 
 # Build the signer library
-go build -buildmode=c-shared -buildmode=c-shared -ldflags="-X=main.Version=$CURRENT_TAG" -o build/bin/darwin_amd64/libecp.dylib cshared/main.go
+go build -buildmode=c-shared -buildmode=c-shared -ldflags="$LDFLAGS" -o build/bin/darwin_amd64/libecp.dylib ./cshared
 rm build/bin/darwin_amd64/libecp.h
@@ -16,6 +16,8 @@
 set -eux
 
 CURRENT_TAG=$(cat version.txt)
+VERSION_PACKAGE=github.com/googleapis/enterprise-certificate-proxy/internal/version
+LDFLAGS="-X=$VERSION_PACKAGE.Version=$CURRENT_TAG -X=$VERSION_PACKAGE.Commit=$(git rev-parse --short HEAD)"
 
 # Create a folder to hold the binaries
 rm -rf ./build/bin/darwin_arm64
@@ -23,10 +25,10 @@ mkdir -p ./build/bin/darwin_arm64
 
 # Build the signer binary
 cd ./internal/signer/darwin
-CGO_ENABLED=1 GO111MODULE=on GOARCH=arm64 go build
+CGO_ENABLED=1 GO111MODULE=on GOARCH=arm64 go build -ldflags="$LDFLAGS"
 mv darwin ./../../../build/bin/darwin_arm64/ecp
 cd ./../../..
 
 # Build the signer library
-CGO_ENABLED=1 GO111MODULE=on GOARCH=arm64 go build -buildmode=c-shared -ldflags="-X=main.Version=$CURRENT_TAG" -o build/bin/darwin_arm64/libecp.dylib cshared/main.go
+CGO_ENABLED=1 GO111MODULE=on GOARCH=arm64 go build -buildmode=c-shared -ldflags="$LDFLAGS" -o build/bin/darwin_arm64/libecp.dylib ./cshared
 rm build/bin/darwin_arm64/libecp.h
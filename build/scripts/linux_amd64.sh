@@ -16,17 +16,19 @@
 set -eux
 
 CURRENT_TAG=$(cat version.txt)
+VERSION_PACKAGE=github.com/googleapis/enterprise-certificate-proxy/internal/version
+LDFLAGS="-X=$VERSION_PACKAGE.Version=$CURRENT_TAG -X=$VERSION_PACKAGE.Commit=$(git rev-parse --short HEAD)"
 
 # Create a folder to hold the binaries
 rm -rf ./build/bin/linux_amd64
 mkdir -p ./build/bin/linux_amd64
 
 # Build the signer library
-go build -buildmode=c-shared -ldflags="-X=main.Version=$CURRENT_TAG" -o build/bin/linux_amd64/libecp.so cshared/main.go
+go build -buildmode=c-shared -ldflags="$LDFLAGS" -o build/bin/linux_amd64/libecp.so ./cshared
 rm build/bin/linux_amd64/libecp.h
 
 # Build the signer binary
 cd ./internal/signer/linux
-go build
+go build -ldflags="$LDFLAGS"
 mv linux ./../../../build/bin/linux_amd64/ecp
 cd ./../../..
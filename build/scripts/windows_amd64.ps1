@@ -11,6 +11,11 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+$CurrentTag = Get-Content .\version.txt
+$Commit = git rev-parse --short HEAD
+$VersionPackage = "github.com/googleapis/enterprise-certificate-proxy/internal/version"
+$LdFlags = "-X=$VersionPackage.Version=$CurrentTag -X=$VersionPackage.Commit=$Commit"
+
 $OutputFolder = ".\build\bin\windows_amd64"
 If (Test-Path $OutputFolder) {
     # Remove existing binaries
@@ -22,13 +27,12 @@ If (Test-Path $OutputFolder) {
 
 # Build the signer binary
 Set-Location .\internal\signer\windows
-go build
+go build -ldflags="$LdFlags"
 Move-Item .\windows.exe ..\..\..\build\bin\windows_amd64\ecp.exe
 Set-Location ..\..\..\
 
 # Build the signer library
-# TODO: Add build version to shared DLL. https://github.com/googleapis/enterprise-certificate-proxy/issues/103
-go build -buildmode=c-shared -o .\build\bin\windows_amd64\libecp.dll .\cshared\main.go
-go build -buildmode=c-archive -o .\build\bin\windows_amd64\libecp.lib .\cshared\main.go
+go build -buildmode=c-shared -ldflags="$LdFlags" -o .\build\bin\windows_amd64\libecp.dll .\cshared
+go build -buildmode=c-archive -ldflags="$LdFlags" -o .\build\bin\windows_amd64\libecp.lib .\cshared
 
 Remove-Item .\build\bin\windows_amd64\libecp.h
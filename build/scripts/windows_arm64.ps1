@@ -0,0 +1,46 @@
+# Copyright 2024 Google LLC.
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     https://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+$CurrentTag = Get-Content .\version.txt
+$Commit = git rev-parse --short HEAD
+$VersionPackage = "github.com/googleapis/enterprise-certificate-proxy/internal/version"
+$LdFlags = "-X=$VersionPackage.Version=$CurrentTag -X=$VersionPackage.Commit=$Commit"
+
+$OutputFolder = ".\build\bin\windows_arm64"
+If (Test-Path $OutputFolder) {
+    # Remove existing binaries
+    Remove-Item -Path ".\build\bin\windows_arm64\*"
+} else {
+    # Create the folder to hold the binaries
+    New-Item -Path $OutputFolder -ItemType Directory -Force
+}
+
+# Target arm64 Windows. Set $env:CC to a C compiler targeting arm64, such as
+# aarch64-w64-mingw32-gcc from llvm-mingw, when building on another
+# architecture.
+$env:GOOS = "windows"
+$env:GOARCH = "arm64"
+
+# Build the signer binary, which does not need cgo
+Set-Location .\internal\signer\windows
+$env:CGO_ENABLED = "0"
+go build -ldflags="$LdFlags"
+Move-Item .\windows.exe ..\..\..\build\bin\windows_arm64\ecp.exe
+Set-Location ..\..\..\
+
+# Build the signer library
+$env:CGO_ENABLED = "1"
+go build -buildmode=c-shared -ldflags="$LdFlags" -o .\build\bin\windows_arm64\libecp.dll .\cshared
+go build -buildmode=c-archive -ldflags="$LdFlags" -o .\build\bin\windows_arm64\libecp.lib .\cshared
+
+Remove-Item .\build\bin\windows_arm64\libecp.h
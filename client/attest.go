@@ -0,0 +1,57 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAttestUnsupported is returned by Attest when the signer binary or the
+// keystore does not provide attestation data for the key.
+var ErrAttestUnsupported = errors.New("the keystore does not provide attestation data for the key")
+
+// Attestation is evidence from the keystore that the key was generated in and
+// cannot be exported from hardware, such as a TPM or a YubiKey. A relying
+// party verifies it against the roots of the hardware vendor named by Format.
+type Attestation struct {
+	// Format names the attestation format. "piv" attestations consist of a
+	// PIV key attestation certificate for the public key followed by the
+	// device attestation certificate, chaining to the Yubico PIV CA.
+	Format string
+	// Certificates is the DER encoded attestation certificate chain, leaf
+	// first.
+	Certificates [][]byte
+}
+
+// Attest returns the attestation of the key. Attestation is currently
+// available for keys held by a YubiKey through the PKCS#11 signer; other
+// keystores report ErrAttestUnsupported.
+func (k *Key) Attest() (*Attestation, error) {
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	var attestation Attestation
+	if err := k.invoke(attestAPI, struct{}{}, &attestation); err != nil {
+		// Older signer binaries do not implement the Attest API.
+		if isMethodNotFound(err) {
+			return nil, ErrAttestUnsupported
+		}
+		return nil, fmt.Errorf("failed to retrieve attestation: %w", err)
+	}
+	if attestation.Format == "" {
+		return nil, ErrAttestUnsupported
+	}
+	return &attestation, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_Attest(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	attestation, err := key.Attest()
+	if err != nil {
+		t.Fatalf("Attest: got %v, want nil err", err)
+	}
+	if got, want := attestation.Format, "test"; got != want {
+		t.Errorf("Attest: got format %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(attestation.Certificates, key.CertificateChain()) {
+		t.Error("Attest: got certificates differing from the mock attestation")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"log"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+)
+
+// ErrBackendUnavailable is returned by the private key operations of a Key
+// while its circuit breaker is open, after the signer failed repeatedly, so
+// that retrying callers do not overload the keystore. An operation probes the
+// signer again once the cooldown of the breaker has passed.
+var ErrBackendUnavailable = errors.New("enterprise certificate backend is unavailable")
+
+const (
+	defaultBreakerWindow   = time.Minute
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// breaker is a circuit breaker that opens after a number of consecutive
+// failures within a window, and lets a single operation probe the signer once
+// its cooldown has passed. A nil *breaker never opens.
+type breaker struct {
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex // Guards the fields below.
+	consecutive int        // Number of consecutive failures.
+	first       time.Time  // Time of the first of the consecutive failures.
+	openUntil   time.Time  // End of the cooldown if the breaker is open, or zero.
+	probing     bool       // Whether an operation is probing the signer.
+}
+
+// newBreaker returns the breaker configured by policy, or nil if it is
+// disabled.
+func newBreaker(policy config.Breaker) *breaker {
+	if policy.Failures < 1 {
+		return nil
+	}
+	b := &breaker{
+		failures: policy.Failures,
+		window:   defaultBreakerWindow,
+		cooldown: defaultBreakerCooldown,
+		now:      time.Now,
+	}
+	// The durations have already been validated when loading the config.
+	if policy.Window != "" {
+		b.window, _ = time.ParseDuration(policy.Window)
+	}
+	if policy.Cooldown != "" {
+		b.cooldown, _ = time.ParseDuration(policy.Cooldown)
+	}
+	return b
+}
+
+// allow returns ErrBackendUnavailable if the breaker is open. Once the
+// cooldown has passed, it lets one operation through to probe the signer.
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return ErrBackendUnavailable
+	}
+	b.probing = true
+	return nil
+}
+
+// record records the result of an operation let through by allow.
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !isBackendFailure(err) {
+		if b.probing {
+			log.Printf("Enterprise certificate signer recovered, closing circuit breaker")
+		}
+		b.consecutive, b.openUntil, b.probing = 0, time.Time{}, false
+		return
+	}
+	if b.probing {
+		b.openUntil, b.probing = now.Add(b.cooldown), false
+		return
+	}
+	if b.consecutive == 0 || now.Sub(b.first) > b.window {
+		b.consecutive, b.first = 0, now
+	}
+	b.consecutive++
+	if b.consecutive >= b.failures && b.openUntil.IsZero() {
+		log.Printf("Enterprise certificate signer failed %d times in a row, opening circuit breaker for %v: %v", b.consecutive, b.cooldown, err)
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// isBackendFailure reports whether err, returned by the signer, indicates a
+// failure of the signer or keystore: the signer could not be reached, or it
+// reported a transient failure of the keystore. Failures of the request, such
+// as a wrong PIN, unsupported options, methods that the signer does not
+// implement and security keys that were not touched, do not count.
+func isBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return true
+	}
+	return strings.HasPrefix(string(serverErr), wire.TransientErrorPrefix)
+}
+
+// call calls the signer method serving a private key operation through the
+// circuit breaker of k.
+func (k *Key) call(method string, args any, reply any) error {
+	if err := k.breaker.allow(); err != nil {
+		return err
+	}
+	p, release := k.acquire()
+	err := p.client.Call(method, args, reply)
+	release()
+	k.breaker.record(err)
+	k.countOperation(p)
+	return err
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(config.Breaker{Failures: 3, Window: "10s", Cooldown: "5s"})
+	b.now = func() time.Time { return now }
+	failure := rpc.ServerError(wire.TransientErrorPrefix + "CKR_DEVICE_ERROR")
+
+	// Failures outside of the window do not add up.
+	b.record(failure)
+	b.record(failure)
+	now = now.Add(11 * time.Second)
+	b.record(failure)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow: got %v after failures outside of the window, want nil", err)
+	}
+	// Missing methods and touches are not failures of the signer.
+	b.record(rpc.ServerError("rpc: can't find method EnterpriseCertSigner.Decrypt"))
+	b.record(rpc.ServerError(touchRequiredMessage))
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow: got %v after errors that are not failures, want nil", err)
+	}
+	b.record(failure)
+	b.record(failure)
+	b.record(failure)
+	if err := b.allow(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("allow: got %v after 3 consecutive failures, want ErrBackendUnavailable", err)
+	}
+
+	// After the cooldown, a single failed probe opens the breaker again.
+	now = now.Add(5 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow: got %v after the cooldown, want nil", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("allow: got %v while probing, want ErrBackendUnavailable", err)
+	}
+	b.record(failure)
+	if err := b.allow(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("allow: got %v after a failed probe, want ErrBackendUnavailable", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(5 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow: got %v after the cooldown, want nil", err)
+	}
+	b.record(nil)
+	b.record(failure)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow: got %v after a successful probe, want nil", err)
+	}
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: rpc.ErrShutdown, want: true},
+		{err: rpc.ServerError(wire.TransientErrorPrefix + "pkcs11: 0x32: CKR_DEVICE_REMOVED"), want: true},
+		{err: rpc.ServerError("pkcs11: 0xA0: CKR_PIN_INCORRECT"), want: false},
+		{err: rpc.ServerError("crypto/rsa: decryption error"), want: false},
+		{err: rpc.ServerError("unsupported opts type *rsa.PKCS1v15DecryptOptions"), want: false},
+		{err: rpc.ServerError("digest length is 20 bytes, want 32 bytes for SHA-256"), want: false},
+		{err: rpc.ServerError("rpc: can't find method EnterpriseCertSigner.Decrypt"), want: false},
+		{err: rpc.ServerError(touchRequiredMessage), want: false},
+	}
+	for _, test := range tests {
+		if got := isBackendFailure(test.err); got != test.want {
+			t.Errorf("isBackendFailure(%v): got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b := newBreaker(config.Breaker{})
+	if b != nil {
+		t.Fatalf("newBreaker: got %+v without failures, want nil", b)
+	}
+	b.record(rpc.ServerError(wire.TransientErrorPrefix + "CKR_DEVICE_ERROR"))
+	if err := b.allow(); err != nil {
+		t.Errorf("allow: got %v from a disabled breaker, want nil", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+)
+
+const capabilitiesAPI = "EnterpriseCertSigner.Capabilities"
+
+// Capabilities describes the algorithms that the keystore supports with a Key,
+// so that callers can pick a signature or encryption scheme up front rather
+// than by trial and error. It is the type that signers reply to the
+// Capabilities API with.
+type Capabilities util.Capabilities
+
+// CanSign reports whether the key signs with opts, which may be
+// *rsa.PSSOptions or *ECDSAOptions.
+func (c Capabilities) CanSign(opts crypto.SignerOpts) bool {
+	opts, ecdsaOpts := splitECDSAOptions(opts)
+	if ecdsaOpts != nil && ecdsaOpts.Deterministic {
+		return false
+	}
+	hash := opts.HashFunc()
+	if hash == 0 {
+		return c.RawSign
+	}
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		if !c.PSS {
+			return false
+		}
+	} else if c.PSS && !c.PKCS1v15 {
+		return false
+	}
+	return containsHash(c.Hashes, hash)
+}
+
+// MaxPlaintextSize returns the size of the largest message that can be
+// encrypted for the key with RSA-OAEP and hash, in bytes, or 0 if Decrypt does
+// not support hash.
+func (c Capabilities) MaxPlaintextSize(hash crypto.Hash) int {
+	if !c.Decrypt || !containsHash(c.DecryptHashes, hash) {
+		return 0
+	}
+	if size := c.MaxCiphertextSize - 2*hash.Size() - 2; size > 0 {
+		return size
+	}
+	return 0
+}
+
+func containsHash(hashes []crypto.Hash, hash crypto.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities returns the algorithms that the keystore supports with the key.
+// Decrypt is reported as unsupported if the certificate is not valid for
+// encryption. For signer binaries that predate the Capabilities API, only the
+// algorithms that every signer supports with the type of the public key are
+// reported, with SHA-256, and Decrypt is reported as unsupported.
+func (k *Key) Capabilities() (Capabilities, error) {
+	var c Capabilities
+	if err := k.checkOpen(); err != nil {
+		return c, err
+	}
+	err := k.invoke(capabilitiesAPI, struct{}{}, &c)
+	if isMethodNotFound(err) {
+		c, err = defaultCapabilities(k.Public()), nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to retrieve capabilities: %w", err)
+	}
+	if checkDecryptUsage(k.leafCert()) != nil {
+		c.Decrypt, c.DecryptHashes, c.MaxCiphertextSize = false, nil, 0
+	}
+	return c, nil
+}
+
+// defaultCapabilities returns the capabilities that every signer binary
+// supports with the public key pub.
+func defaultCapabilities(pub crypto.PublicKey) Capabilities {
+	var c Capabilities
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		c.Hashes = []crypto.Hash{crypto.SHA256}
+		c.PKCS1v15, c.PSS = true, true
+	case *ecdsa.PublicKey:
+		c.Hashes = []crypto.Hash{crypto.SHA256}
+	case ed25519.PublicKey:
+		c.RawSign = true
+	}
+	return c
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClient_Capabilities(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	got, err := key.Capabilities()
+	if err != nil {
+		t.Fatalf("Capabilities: got %v, want nil err", err)
+	}
+	want := Capabilities{
+		Hashes:            []crypto.Hash{crypto.SHA256},
+		PKCS1v15:          true,
+		SignMessage:       true,
+		Decrypt:           true,
+		DecryptHashes:     []crypto.Hash{crypto.SHA256},
+		MaxCiphertextSize: 256,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Capabilities: got %+v, want %+v", got, want)
+	}
+	key.Close()
+	if _, err := key.Capabilities(); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Capabilities after Close: got %v, want %v", err, ErrKeyClosed)
+	}
+}
+
+func TestCapabilitiesCanSign(t *testing.T) {
+	pkcs1 := Capabilities{Hashes: []crypto.Hash{crypto.SHA256}, PKCS1v15: true}
+	pss := Capabilities{Hashes: []crypto.Hash{crypto.SHA384}, PSS: true}
+	ecdsaCaps := defaultCapabilities(&ecdsa.PublicKey{})
+	tests := []struct {
+		name string
+		c    Capabilities
+		opts crypto.SignerOpts
+		want bool
+	}{
+		{name: "PKCS1v15-SHA256", c: pkcs1, opts: crypto.SHA256, want: true},
+		{name: "PKCS1v15-SHA384", c: pkcs1, opts: crypto.SHA384},
+		{name: "PKCS1v15-PSS", c: pkcs1, opts: &rsa.PSSOptions{Hash: crypto.SHA256}},
+		{name: "PSS-SHA384", c: pss, opts: &rsa.PSSOptions{Hash: crypto.SHA384}, want: true},
+		{name: "PSS-PKCS1v15", c: pss, opts: crypto.SHA384},
+		{name: "ECDSA-SHA256", c: ecdsaCaps, opts: &ECDSAOptions{Hash: crypto.SHA256}, want: true},
+		{name: "ECDSA-Deterministic", c: ecdsaCaps, opts: &ECDSAOptions{Hash: crypto.SHA256, Deterministic: true}},
+		{name: "ECDSA-Raw", c: ecdsaCaps, opts: crypto.Hash(0)},
+	}
+	for _, test := range tests {
+		if got := test.c.CanSign(test.opts); got != test.want {
+			t.Errorf("CanSign %s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCapabilitiesMaxPlaintextSize(t *testing.T) {
+	c := Capabilities{Decrypt: true, DecryptHashes: []crypto.Hash{crypto.SHA256}, MaxCiphertextSize: 256}
+	if got, want := c.MaxPlaintextSize(crypto.SHA256), 190; got != want {
+		t.Errorf("MaxPlaintextSize(SHA-256): got %d, want %d", got, want)
+	}
+	if got := c.MaxPlaintextSize(crypto.SHA512); got != 0 {
+		t.Errorf("MaxPlaintextSize(SHA-512): got %d, want 0", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate with the given common name and CRL distribution
+// points, signed by parent. A nil parent produces a self-signed certificate.
+func issue(t *testing.T, cn string, isCA bool, parent *testCA, crlDistributionPoints ...string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		CRLDistributionPoints: crlDistributionPoints,
+	}
+	signer, signerCert := key, template
+	if parent != nil {
+		signer, signerCert = parent.key, parent.cert
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func TestSplitChain(t *testing.T) {
+	root := issue(t, "root", true, nil)
+	intermediate := issue(t, "intermediate", true, root)
+	leaf := issue(t, "leaf", false, intermediate)
+
+	tests := []struct {
+		name              string
+		chain             []*x509.Certificate
+		wantIntermediates []string
+		wantRoot          string
+	}{
+		{"leaf only", []*x509.Certificate{leaf.cert}, nil, ""},
+		{"without root", []*x509.Certificate{leaf.cert, intermediate.cert}, []string{"intermediate"}, ""},
+		{"with root", []*x509.Certificate{leaf.cert, intermediate.cert, root.cert}, []string{"intermediate"}, "root"},
+		{"root only", []*x509.Certificate{leaf.cert, root.cert}, nil, "root"},
+	}
+	for _, test := range tests {
+		intermediates, gotRoot := splitChain(test.chain)
+		if len(intermediates) != len(test.wantIntermediates) {
+			t.Errorf("%s: got %d intermediates, want %d", test.name, len(intermediates), len(test.wantIntermediates))
+			continue
+		}
+		for i, cert := range intermediates {
+			if got, want := cert.Subject.CommonName, test.wantIntermediates[i]; got != want {
+				t.Errorf("%s: got intermediate %q, want %q", test.name, got, want)
+			}
+		}
+		var gotRootCN string
+		if gotRoot != nil {
+			gotRootCN = gotRoot.Subject.CommonName
+		}
+		if gotRootCN != test.wantRoot {
+			t.Errorf("%s: got root %q, want %q", test.name, gotRootCN, test.wantRoot)
+		}
+	}
+}
@@ -17,19 +17,30 @@
 package client
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
-	"encoding/gob"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/rpc"
-	"os"
-	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/googleapis/enterprise-certificate-proxy/client/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/cryptoopts"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/version"
 )
 
 const signAPI = "EnterpriseCertSigner.Sign"
@@ -37,6 +48,18 @@ const certificateChainAPI = "EnterpriseCertSigner.CertificateChain"
 const publicKeyAPI = "EnterpriseCertSigner.Public"
 const encryptAPI = "EnterpriseCertSigner.Encrypt"
 const decryptAPI = "EnterpriseCertSigner.Decrypt"
+const metadataAPI = "EnterpriseCertSigner.Metadata"
+const versionAPI = "EnterpriseCertSigner.Version"
+const wrapKeyAPI = "EnterpriseCertSigner.WrapKey"
+const unwrapKeyAPI = "EnterpriseCertSigner.UnwrapKey"
+const refreshCertificateChainAPI = "EnterpriseCertSigner.RefreshCertificateChain"
+const stageCertificateChainAPI = "EnterpriseCertSigner.StageCertificateChain"
+const commitCertificateChainAPI = "EnterpriseCertSigner.CommitCertificateChain"
+const attestAPI = "EnterpriseCertSigner.Attest"
+const keyAgreementAPI = "EnterpriseCertSigner.KeyAgreement"
+
+// Version is the version of this client library.
+const Version = version.Release
 
 // A Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
 type Connection struct {
@@ -54,18 +77,13 @@ func (c *Connection) Close() error {
 	return werr
 }
 
-func init() {
-	gob.Register(crypto.SHA256)
-	gob.Register(crypto.SHA384)
-	gob.Register(crypto.SHA512)
-	gob.Register(&rsa.PSSOptions{})
-	gob.Register(&rsa.OAEPOptions{})
-}
+var _ crypto.Decrypter = (*Key)(nil)
 
 // SignArgs contains arguments for a Sign API call.
 type SignArgs struct {
-	Digest []byte            // The content to sign.
-	Opts   crypto.SignerOpts // Options for signing. Must implement HashFunc().
+	Digest  []byte            // The content to sign.
+	Opts    crypto.SignerOpts // Options for signing. Must implement HashFunc().
+	Message []byte            // The full message to sign instead of Digest, if set. Hashed with Opts.HashFunc() unless it is zero.
 }
 
 // EncryptArgs contains arguments for an Encrypt API call.
@@ -80,62 +98,444 @@ type DecryptArgs struct {
 	Opts       crypto.DecrypterOpts // Options for decryption. Ex: an instance of *rsa.OAEPOptions.
 }
 
+// WrapKeyArgs contains arguments for a WrapKey API call.
+type WrapKeyArgs struct {
+	Key  []byte      // The symmetric key to wrap.
+	Hash crypto.Hash // The hash function used by RSA-OAEP.
+}
+
+// UnwrapKeyArgs contains arguments for an UnwrapKey API call.
+type UnwrapKeyArgs struct {
+	WrappedKey []byte      // The wrapped symmetric key.
+	Hash       crypto.Hash // The hash function used by RSA-OAEP.
+}
+
+// KeyAgreementArgs contains arguments for a KeyAgreement API call.
+type KeyAgreementArgs struct {
+	PeerPublicKey []byte // The peer's EC public key, in PKIX, ASN.1 DER form.
+}
+
+// StagedCredential is the credential returned by a StageCertificateChain API
+// call.
+type StagedCredential struct {
+	CertificateChain [][]byte // The DER encoded certificate chain, leaf first.
+	PublicKey        []byte   // The public key, in PKIX, ASN.1 DER form.
+}
+
+// Metadata describes the keystore backing a Key.
+type Metadata struct {
+	KeystoreType       string    // The type of keystore holding the key. Ex: "keychain", "pkcs11", "ncrypt" or "piv".
+	TokenLabel         string    // The label of the token holding the key, if applicable.
+	TokenSerial        string    // The serial number of the token holding the key, if applicable.
+	Module             string    // The path of the PKCS#11 module of the token, for the "pkcs11" keystore.
+	KeyStorageProvider string    // The CNG key storage provider of the key, for the "ncrypt" keystore.
+	StoreLocation      string    // The certificate store location, "current_user" or "local_machine", for the "ncrypt" keystore.
+	Keychain           string    // The keychains searched for the key, for the "keychain" keystore. Ex: "login", "system" or "all".
+	Endpoint           string    // The API endpoint of the key, for the "cloud_kms" keystore.
+	Backend            string    // The name of the remote signer backend, for the "remote" keystore.
+	Fingerprint        string    // The hex-encoded SHA-256 fingerprint of the leaf certificate.
+	TouchPolicy        string    // The touch policy of a key on a PIV security key: "never", "always" or "cached", if known.
+	NotAfter           time.Time // The expiry time of the leaf certificate.
+	ExpiresSoon        bool      // Whether the leaf certificate expires within the configured expiry warning window, or has expired.
+}
+
 // Key implements credential.Credential by holding the executed signer subprocess.
 type Key struct {
-	cmd       *exec.Cmd        // Pointer to the signer subprocess.
-	client    *rpc.Client      // Pointer to the rpc client that communicates with the signer subprocess.
-	publicKey crypto.PublicKey // Public key of loaded certificate.
-	chain     [][]byte         // Certificate chain of loaded certificate.
+	backend       string              // Backend served by the signer subprocess.
+	launcher      signerLauncher      // Starts the signer subprocess and its replacements.
+	recycle       recyclePolicy       // When the signer subprocess is replaced.
+	revocation    config.Revocation   // Revocation checking policy applied to loaded certificates.
+	deny          bool                // Whether private key operations fail with ErrPolicyDenied.
+	breaker       *breaker            // Circuit breaker around private key operations, or nil if disabled.
+	expiryWarning time.Duration       // Time before the expiry of the leaf certificate from which it is reported as expiring soon.
+	refreshMu     sync.Mutex          // Serializes RefreshCertificateChain calls, which stage and commit a credential in the signer.
+	mu            sync.RWMutex        // Guards the fields below, which RefreshCertificateChain and recycling replace.
+	proc          *signerProcess      // Running signer subprocess.
+	publicKey     crypto.PublicKey    // Public key of loaded certificate.
+	chain         [][]byte            // Certificate chain of loaded certificate.
+	leaf          *x509.Certificate   // Parsed leaf of the certificate chain.
+	intermediates []*x509.Certificate // Intermediate CA certificates of the chain.
+	root          *x509.Certificate   // Root CA certificate of the chain, if present.
+	metadata      Metadata            // Metadata of the keystore backing the loaded certificate.
+	capabilities  *Capabilities       // Capabilities of the loaded credential, or nil until requested by TLSCertificate.
+	generation    uint64              // Incremented each time the credential is replaced.
+	versionOnce   sync.Once           // Guards signerVersion.
+	signerVersion string              // Version reported by the signer subprocess, or empty if unavailable.
+	counters      handshakeCounters   // Counters reported by HandshakeStats.
+	events        keyEvents           // Subscribers of Events.
+	closeOnce     sync.Once           // Guards closeErr.
+	closeErr      error               // Result of the first call to Close.
+	closed        atomic.Bool         // Whether Close has been called.
 }
 
 // CertificateChain returns the credential as a raw X509 cert chain. This contains the public key.
 func (k *Key) CertificateChain() [][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	return k.chain
 }
 
-// Close closes the RPC connection and kills the signer subprocess.
+// Intermediates returns the intermediate CA certificates of the chain, ordered
+// from the issuer of the leaf upwards. The root is not included.
+func (k *Key) Intermediates() []*x509.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.intermediates
+}
+
+// Root returns the self-signed root CA certificate that terminates the chain,
+// or nil if the signer did not include it in the chain.
+func (k *Key) Root() *x509.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.root
+}
+
+// Metadata returns information about the keystore backing this Key. Fields that
+// are not reported by the signer binary are left empty.
+func (k *Key) Metadata() Metadata {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.metadata
+}
+
+// leafCert returns the parsed leaf of the certificate chain.
+func (k *Key) leafCert() *x509.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.leaf
+}
+
+// SignerVersion returns the version and build information reported by the
+// signer subprocess.
+func (k *Key) SignerVersion() (string, error) {
+	var v string
+	if err := k.invoke(versionAPI, struct{}{}, &v); err != nil {
+		if isMethodNotFound(err) {
+			return "", errors.New("signer binary predates the Version API")
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+// hasFeature reports whether the signer subprocess lists feature in its
+// version. The version is only requested once.
+func (k *Key) hasFeature(feature string) bool {
+	k.versionOnce.Do(func() {
+		k.signerVersion, _ = k.SignerVersion()
+	})
+	return version.HasFeature(k.signerVersion, feature)
+}
+
+// Close asks the signer subprocess to release its credential, and closes the
+// RPC connection once it has exited.
 // Call this to free up resources when the Key object is no longer needed.
+// It is safe to call more than once; later calls return the result of the
+// first one. Operations on a closed Key return ErrKeyClosed.
 func (k *Key) Close() error {
-	if err := k.cmd.Process.Kill(); err != nil {
-		return fmt.Errorf("failed to kill signer process: %w", err)
+	k.closeOnce.Do(func() {
+		k.closed.Store(true)
+		k.closeErr = k.close()
+		k.events.close()
+	})
+	return k.closeErr
+}
+
+// close stops the signer subprocess once the calls in flight on it have
+// completed. A subprocess replacing it meanwhile is stopped instead.
+func (k *Key) close() error {
+	for {
+		p := k.current()
+		p.mu.Lock()
+		if !p.stopped {
+			p.stopped = true
+			defer p.mu.Unlock()
+			return p.stop()
+		}
+		p.mu.Unlock()
+		if p == k.current() {
+			return nil
+		}
 	}
-	// Wait for cmd to exit and release resources. Since the process is forcefully killed, this
-	// will return a non-nil error (varies by OS), which we will ignore.
-	_ = k.cmd.Wait()
-	// The Pipes connecting the RPC client should have been closed when the signer subprocess was killed.
-	// Calling `k.client.Close()` before `k.cmd.Process.Kill()` or `k.cmd.Wait()` _will_ cause a segfault.
-	if err := k.client.Close(); err.Error() != "close |0: file already closed" {
-		return fmt.Errorf("failed to close RPC connection: %w", err)
+}
+
+// checkOpen returns ErrKeyClosed if k has been closed.
+func (k *Key) checkOpen() error {
+	if k.closed.Load() {
+		return ErrKeyClosed
 	}
 	return nil
 }
 
 // Public returns the public key for this Key.
 func (k *Key) Public() crypto.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	return k.publicKey
 }
 
 // Sign signs a message digest, using the specified signer opts. Implements crypto.Signer interface.
+// It returns an error wrapping ErrDigestLengthMismatch if the digest does not match the hash function
+// size, a *KeyUsageError if the certificate is not valid for client authentication, a *TouchRequiredError
+// if the security key holding the key was not touched in time, and ErrPolicyDenied in deny mode.
+// With *ECDSAOptions as opts, the signature is encoded as selected by them.
 func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (signed []byte, err error) {
+	done := k.startOperation(OperationSign)
+	defer func() { done(err) }()
+	return k.sign(digest, opts)
+}
+
+// sign implements Sign without reporting to Telemetry.
+func (k *Key) sign(digest []byte, opts crypto.SignerOpts) (signed []byte, err error) {
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
 	if opts != nil && opts.HashFunc() != 0 && len(digest) != opts.HashFunc().Size() {
-		return nil, fmt.Errorf("Digest length of %v bytes does not match Hash function size of %v bytes", len(digest), opts.HashFunc().Size())
+		return nil, fmt.Errorf("%w: digest length of %v bytes does not match hash function size of %v bytes", ErrDigestLengthMismatch, len(digest), opts.HashFunc().Size())
 	}
-	err = k.client.Call(signAPI, SignArgs{Digest: digest, Opts: opts}, &signed)
-	return
+	if err := checkSignUsage(k.leafCert()); err != nil {
+		return nil, err
+	}
+	opts, ecdsaOpts := splitECDSAOptions(opts)
+	if err := k.checkECDSAOptions(ecdsaOpts); err != nil {
+		return nil, err
+	}
+	args := SignArgs{Digest: digest, Opts: cryptoopts.WrapSignerOpts(opts)}
+	if opts != nil && opts.HashFunc() == 0 && k.hasFeature(version.FeatureSignMessage) {
+		// With crypto.Hash(0), digest is the full message.
+		args.Digest, args.Message = nil, digest
+	}
+	k.counters.signatures.Add(1)
+	if err := touchRequired(k.call(signAPI, args, &signed)); err != nil {
+		return nil, err
+	}
+	return k.encodeSignature(signed, ecdsaOpts)
+}
+
+// SignMessage signs the full message msg, using the specified signer opts. The
+// message is hashed with opts.HashFunc() by the signer, so that keystores that
+// hash on the card can do so, or signed as-is if it is crypto.Hash(0), as for
+// Ed25519 keys. Capabilities.SignMessage reports whether the keystore hashes
+// msg itself; otherwise the signer hashes it and signs the digest. For signer
+// binaries that predate message signing, msg is hashed by the client instead.
+// Nil opts are taken as crypto.Hash(0). *ECDSAOptions are honored as by Sign.
+func (k *Key) SignMessage(msg []byte, opts crypto.SignerOpts) (signed []byte, err error) {
+	done := k.startOperation(OperationSign)
+	defer func() { done(err) }()
+	if opts == nil {
+		opts = crypto.Hash(0)
+	}
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
+	if err := checkSignUsage(k.leafCert()); err != nil {
+		return nil, err
+	}
+	if k.hasFeature(version.FeatureSignMessage) {
+		inner, ecdsaOpts := splitECDSAOptions(opts)
+		if err := k.checkECDSAOptions(ecdsaOpts); err != nil {
+			return nil, err
+		}
+		k.counters.signatures.Add(1)
+		args := SignArgs{Message: msg, Opts: cryptoopts.WrapSignerOpts(inner)}
+		if err := touchRequired(k.call(signAPI, args, &signed)); err != nil {
+			return nil, err
+		}
+		return k.encodeSignature(signed, ecdsaOpts)
+	}
+	hash := opts.HashFunc()
+	if hash == 0 {
+		return k.sign(msg, opts)
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	h := hash.New()
+	h.Write(msg)
+	return k.sign(h.Sum(nil), opts)
 }
 
 // Encrypt encrypts a plaintext msg into ciphertext, using the specified encrypt opts.
+// RSA-OAEP is selected with the crypto.Hash to use, or with an *rsa.OAEPOptions
+// to also set a label. For signer binaries that predate the Encrypt API, the
+// encryption is performed by the client using the public key.
 func (k *Key) Encrypt(_ io.Reader, msg []byte, opts any) (ciphertext []byte, err error) {
-	err = k.client.Call(encryptAPI, EncryptArgs{Plaintext: msg, Opts: opts}, &ciphertext)
+	done := k.startOperation(OperationEncrypt)
+	defer func() { done(err) }()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	return k.encrypt(msg, opts)
+}
+
+// encrypt performs Encrypt once the Key is known to be open.
+func (k *Key) encrypt(msg []byte, opts any) (ciphertext []byte, err error) {
+	if o, ok := opts.(*rsa.OAEPOptions); ok && o != nil && len(o.Label) > 0 && !k.hasFeature(version.FeatureOAEPLabel) {
+		// Signer binaries that predate labels would ignore them, so encrypt locally.
+		return k.encryptLocally(msg, opts)
+	}
+	err = k.call(encryptAPI, EncryptArgs{Plaintext: msg, Opts: cryptoopts.Wrap(opts)}, &ciphertext)
+	if isMethodNotFound(err) {
+		return k.encryptLocally(msg, opts)
+	}
 	return
 }
 
+// encryptLocally encrypts msg with the public key using RSA-OAEP.
+func (k *Key) encryptLocally(msg []byte, opts any) ([]byte, error) {
+	var hash crypto.Hash
+	var label []byte
+	switch opts := opts.(type) {
+	case crypto.Hash:
+		hash = opts
+	case *rsa.OAEPOptions:
+		if opts == nil {
+			return nil, errors.New("nil *rsa.OAEPOptions")
+		}
+		if opts.MGFHash != 0 && opts.MGFHash != opts.Hash {
+			return nil, fmt.Errorf("unsupported OAEP MGF1 hash function %v, must be the same as the hash function %v", opts.MGFHash, opts.Hash)
+		}
+		hash, label = opts.Hash, opts.Label
+	default:
+		return nil, fmt.Errorf("unsupported encrypt opts: %v", opts)
+	}
+	pub, ok := k.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", k.Public())
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	return rsa.EncryptOAEP(hash.New(), rand.Reader, pub, msg, label)
+}
+
 // Decrypt decrypts a ciphertext msg into plaintext, using the specified decrypter opts. Implements crypto.Decrypter interface.
+// Only RSA-OAEP is supported, so opts must be an *rsa.OAEPOptions whose MGFHash, if set, is the same as
+// its Hash. A Label is only supported by signer binaries that list the oaep-label
+// feature. It returns a *KeyUsageError if the certificate is not valid for encryption,
+// ErrDecryptUnsupported if the signer binary predates the Decrypt API, and ErrPolicyDenied in deny mode.
 func (k *Key) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
-	err = k.client.Call(decryptAPI, DecryptArgs{Ciphertext: msg, Opts: opts}, &plaintext)
+	done := k.startOperation(OperationDecrypt)
+	defer func() { done(err) }()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
+	return k.decrypt(msg, opts)
+}
+
+// decrypt performs Decrypt once the Key is known to be open and allowed by
+// the policy.
+func (k *Key) decrypt(msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	oaepOpts, err := k.oaepOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDecryptUsage(k.leafCert()); err != nil {
+		return nil, err
+	}
+	err = k.call(decryptAPI, DecryptArgs{Ciphertext: msg, Opts: oaepOpts}, &plaintext)
+	if isMethodNotFound(err) {
+		return nil, ErrDecryptUnsupported
+	}
+	return
+}
+
+// oaepOptions checks that opts selects RSA-OAEP decryption as supported by the
+// signer, and returns the options to send over RPC.
+func (k *Key) oaepOptions(opts crypto.DecrypterOpts) (*rsa.OAEPOptions, error) {
+	switch opts := opts.(type) {
+	case *rsa.OAEPOptions:
+		if opts == nil {
+			return nil, errors.New("nil *rsa.OAEPOptions")
+		}
+		if !opts.Hash.Available() {
+			return nil, fmt.Errorf("unsupported OAEP hash function %v", opts.Hash)
+		}
+		if opts.MGFHash != 0 && opts.MGFHash != opts.Hash {
+			return nil, fmt.Errorf("unsupported OAEP MGF1 hash function %v, must be the same as the hash function %v", opts.MGFHash, opts.Hash)
+		}
+		if len(opts.Label) > 0 && !k.hasFeature(version.FeatureOAEPLabel) {
+			return nil, errors.New("OAEP labels are not supported by the signer binary")
+		}
+		// Only send the fields that signers understand.
+		return &rsa.OAEPOptions{Hash: opts.Hash, Label: opts.Label}, nil
+	case nil, *rsa.PKCS1v15DecryptOptions:
+		// As with rsa.PrivateKey, nil opts select PKCS #1 v1.5.
+		return nil, errors.New("PKCS #1 v1.5 decryption is not supported, use *rsa.OAEPOptions")
+	}
+	return nil, fmt.Errorf("unsupported decrypter opts %T", opts)
+}
+
+// WrapKey wraps a symmetric data key with the credential's RSA key using
+// RSA-OAEP and the given hash function, for envelope encryption. Signer
+// binaries that predate the WrapKey API fall back to Encrypt. It is reported
+// to Telemetry as OperationEncrypt, and returns ErrPolicyDenied in deny mode.
+func (k *Key) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	done := k.startOperation(OperationEncrypt)
+	defer func() { done(err) }()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
+	err = touchRequired(k.call(wrapKeyAPI, WrapKeyArgs{Key: key, Hash: hash}, &wrappedKey))
+	if isMethodNotFound(err) {
+		return k.encrypt(key, hash)
+	}
+	return
+}
+
+// UnwrapKey unwraps a data key wrapped by WrapKey using the credential's private
+// key. It returns a *KeyUsageError if the certificate is not valid for encryption.
+// Signer binaries that predate the UnwrapKey API fall back to Decrypt. It is
+// reported to Telemetry as OperationDecrypt, and returns ErrPolicyDenied in
+// deny mode.
+func (k *Key) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	done := k.startOperation(OperationDecrypt)
+	defer func() { done(err) }()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
+	if err := checkDecryptUsage(k.leafCert()); err != nil {
+		return nil, err
+	}
+	err = touchRequired(k.call(unwrapKeyAPI, UnwrapKeyArgs{WrappedKey: wrappedKey, Hash: hash}, &key))
+	if isMethodNotFound(err) {
+		return k.decrypt(wrappedKey, &rsa.OAEPOptions{Hash: hash})
+	}
 	return
 }
 
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// ErrDecryptUnsupported is returned by Decrypt and UnwrapKey when the signer
+// binary does not implement decryption.
+var ErrDecryptUnsupported = errors.New("signer binary does not support decryption")
+
+// ErrRefreshUnsupported is returned by RefreshCertificateChain when the signer
+// binary does not implement reloading its credential.
+var ErrRefreshUnsupported = errors.New("signer binary does not support refreshing the certificate chain")
+
+// ErrDigestLengthMismatch is returned by Sign when the length of the digest does
+// not match the size of the hash function named by the signer opts.
+var ErrDigestLengthMismatch = errors.New("digest length mismatch")
+
 // ErrCredUnavailable is a sentinel error that indicates ECP Cred is unavailable,
 // possibly due to missing config or missing binary path.
 var ErrCredUnavailable = errors.New("Cred is unavailable")
@@ -144,55 +544,147 @@ var ErrCredUnavailable = errors.New("Cred is unavailable")
 // related operations, including signing messages with the private key.
 //
 // The signer binary path is read from the specified configFilePath, if provided.
-// Otherwise, use the default config file path.
+// Otherwise, use the default config file path. When the config lists several
+// backends in cert_configs.priority, their signers are tried in order and the
+// first one that yields a credential is used.
 //
 // The config file also specifies which certificate the signer should use.
+//
+// Errors are returned as a *CredError, with a Diagnosis of the setup.
 func Cred(configFilePath string) (*Key, error) {
-	if configFilePath == "" {
-		envFilePath := util.GetConfigFilePathFromEnv()
-		if envFilePath != "" {
-			configFilePath = envFilePath
-		} else {
-			configFilePath = util.GetDefaultConfigFilePath()
-		}
+	configFilePath = resolveConfigFilePath(configFilePath)
+	k, err := cred(configFilePath)
+	if err != nil {
+		return nil, &CredError{Err: err, Diagnosis: Diagnose(configFilePath)}
 	}
-	enterpriseCertSignerPath, err := util.LoadSignerBinaryPath(configFilePath)
+	return k, nil
+}
+
+func cred(configFilePath string) (*Key, error) {
+	config, err := util.LoadConfig(configFilePath)
 	if err != nil {
 		if errors.Is(err, util.ErrConfigUnavailable) {
 			return nil, ErrCredUnavailable
 		}
 		return nil, err
 	}
-	k := &Key{
-		cmd: exec.Command(enterpriseCertSignerPath, configFilePath),
+	signers := config.Signers(runtime.GOOS)
+	if len(signers) == 0 {
+		return nil, ErrCredUnavailable
 	}
+	if len(signers) == 1 {
+		k, err := startSigner(signers[0].Backend, signers[0].Path, configFilePath, config)
+		signerStarted(signers[0].Backend, err)
+		return k, err
+	}
+	var lastErr error
+	for _, signer := range signers {
+		k, err := startSigner(signer.Backend, signer.Path, configFilePath, config)
+		signerStarted(signer.Backend, err)
+		if err == nil {
+			return k, nil
+		}
+		log.Printf("Enterprise certificate backend %q did not yield a credential: %v", signer.Backend, err)
+		lastErr = fmt.Errorf("%s: %w", signer.Backend, err)
+	}
+	return nil, fmt.Errorf("no enterprise certificate backend yielded a credential, last error from %w", lastErr)
+}
 
-	// Redirect errors from subprocess to parent process.
-	k.cmd.Stderr = os.Stderr
-
-	// RPC client will communicate with subprocess over stdin/stdout.
-	kin, err := k.cmd.StdinPipe()
-	if err != nil {
+// startSigner spawns the signer binary of backend at path and retrieves its
+// credential. The subprocess is stopped if that fails.
+func startSigner(backend, path, configFilePath string, config util.EnterpriseCertificateConfig) (*Key, error) {
+	k := &Key{
+		backend: backend,
+		launcher: signerLauncher{
+			path:           path,
+			configFilePath: configFilePath,
+			sandbox:        config.Libs.Sandbox,
+			wireFormat:     config.WireFormat,
+		},
+		recycle:       newRecyclePolicy(config.Recycle),
+		revocation:    config.Revocation,
+		deny:          denySigning(config),
+		expiryWarning: expiryWarning(config.Expiry),
+		breaker:       newBreaker(config.Breaker),
+	}
+	if err := k.launcher.checkWireFormat(); err != nil {
 		return nil, err
 	}
-	kout, err := k.cmd.StdoutPipe()
+	p, err := k.launcher.start("")
 	if err != nil {
 		return nil, err
 	}
-	k.client = rpc.NewClient(&Connection{kout, kin})
+	cred, metadata, err := k.load(p)
+	if err != nil {
+		p.kill()
+		return nil, p.stderr.startupError(err)
+	}
+	k.proc = p
+	k.metadata = metadata
+	k.setCredential(cred)
+	return k, nil
+}
 
-	if err := k.cmd.Start(); err != nil {
-		return nil, fmt.Errorf("starting enterprise cert signer subprocess: %w", err)
+// load retrieves the credential and metadata of the started signer p.
+func (k *Key) load(p *signerProcess) (*credential, Metadata, error) {
+	var metadata Metadata
+	cred, err := loadCredential(p.client, certificateChainAPI)
+	if err != nil {
+		return nil, metadata, err
+	}
+	if err := checkRevocation(cred.certs, k.revocation); err != nil {
+		return nil, metadata, err
 	}
 
-	if err := k.client.Call(certificateChainAPI, struct{}{}, &k.chain); err != nil {
-		return nil, fmt.Errorf("failed to retrieve certificate chain: %w", err)
+	// Older signer binaries do not implement the Metadata API.
+	if err := p.client.Call(metadataAPI, struct{}{}, &metadata); err != nil && !isMethodNotFound(err) {
+		return nil, metadata, fmt.Errorf("failed to retrieve metadata: %w", err)
 	}
+	return cred, metadata, nil
+}
 
+// credential is the certificate chain and public key reported by the signer.
+type credential struct {
+	chain     [][]byte
+	certs     []*x509.Certificate
+	publicKey crypto.PublicKey
+}
+
+// loadCredential retrieves the certificate chain from the signer with chainAPI,
+// and the public key, and parses them.
+func loadCredential(client *rpc.Client, chainAPI string) (*credential, error) {
+	var chain [][]byte
+	if err := client.Call(chainAPI, struct{}{}, &chain); err != nil {
+		return nil, fmt.Errorf("failed to retrieve certificate chain: %w", err)
+	}
 	var publicKeyBytes []byte
-	if err := k.client.Call(publicKeyAPI, struct{}{}, &publicKeyBytes); err != nil {
+	if err := client.Call(publicKeyAPI, struct{}{}, &publicKeyBytes); err != nil {
 		return nil, fmt.Errorf("failed to retrieve public key: %w", err)
 	}
+	return parseCredential(chain, publicKeyBytes)
+}
+
+// stageCredential asks the signer to load the credential that its config file
+// describes, without serving it until it is committed, and parses it.
+func stageCredential(client *rpc.Client) (*credential, error) {
+	var staged StagedCredential
+	if err := client.Call(stageCertificateChainAPI, struct{}{}, &staged); err != nil {
+		return nil, err
+	}
+	return parseCredential(staged.CertificateChain, staged.PublicKey)
+}
+
+// parseCredential parses the certificate chain and the PKIX, ASN.1 DER encoded
+// public key reported by the signer.
+func parseCredential(chain [][]byte, publicKeyBytes []byte) (*credential, error) {
+	cred := &credential{chain: chain}
+	cred.certs = make([]*x509.Certificate, len(cred.chain))
+	for i, der := range cred.chain {
+		var err error
+		if cred.certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("failed to parse certificate chain: %w", err)
+		}
+	}
 
 	publicKey, err := x509.ParsePKIXPublicKey(publicKeyBytes)
 	if err != nil {
@@ -200,20 +692,127 @@ func Cred(configFilePath string) (*Key, error) {
 	}
 
 	var ok bool
-	k.publicKey, ok = publicKey.(crypto.PublicKey)
+	cred.publicKey, ok = publicKey.(crypto.PublicKey)
 	if !ok {
 		return nil, fmt.Errorf("invalid public key type: %T", publicKey)
 	}
 
-	switch pub := k.publicKey.(type) {
+	switch pub := cred.publicKey.(type) {
 	case *rsa.PublicKey:
 		if pub.Size() < 256 {
 			return nil, fmt.Errorf("RSA modulus size is less than 2048 bits: %v", pub.Size()*8)
 		}
 	case *ecdsa.PublicKey:
+	case ed25519.PublicKey:
 	default:
 		return nil, fmt.Errorf("unsupported public key type: %v", pub)
 	}
+	return cred, nil
+}
 
-	return k, nil
+// setCredential makes cred the credential of k.
+func (k *Key) setCredential(cred *credential) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.setCredentialLocked(cred)
+}
+
+// setCredentialLocked makes cred the credential of k. k.mu must be held for
+// writing.
+func (k *Key) setCredentialLocked(cred *credential) {
+	if len(k.chain) > 0 && len(cred.chain) > 0 && !bytes.Equal(k.chain[0], cred.chain[0]) {
+		k.events.send(CertRotated)
+	}
+	k.chain = cred.chain
+	k.leaf = nil
+	if len(cred.certs) > 0 {
+		k.leaf = cred.certs[0]
+	}
+	k.intermediates, k.root = splitChain(cred.certs)
+	k.publicKey = cred.publicKey
+	k.capabilities = nil
+	k.generation++
+	k.metadata.Fingerprint = ""
+	if len(k.chain) > 0 {
+		fingerprint := sha256.Sum256(k.chain[0])
+		k.metadata.Fingerprint = hex.EncodeToString(fingerprint[:])
+	}
+	k.metadata.NotAfter = time.Time{}
+	if k.leaf != nil {
+		k.metadata.NotAfter = k.leaf.NotAfter
+	}
+	k.metadata.ExpiresSoon = checkExpiry(k.leaf, k.expiryWarning, time.Now())
+}
+
+// RefreshCertificateChain asks the signer to reload the config file and its
+// credential, so that a renewed certificate is used without restarting the
+// signer, and returns the new certificate chain. If loading the renewed
+// credential fails, or its certificate fails the revocation check, the signer
+// keeps the previous one. The signer cannot keep it if its keystore only allows
+// one open credential, such as a PIV card, or if the signer binary predates
+// the StageCertificateChain API: an error from the revocation check then
+// leaves the Key unusable, and it should be closed. It returns
+// ErrRefreshUnsupported if the signer binary predates the
+// RefreshCertificateChain API.
+func (k *Key) RefreshCertificateChain() ([][]byte, error) {
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	p, release := k.acquire()
+	defer release()
+	staged := true
+	cred, err := stageCredential(p.client)
+	if isMethodNotFound(err) {
+		staged = false
+		cred, err = loadCredential(p.client, refreshCertificateChainAPI)
+	}
+	if isMethodNotFound(err) {
+		return nil, ErrRefreshUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	revocationErr := checkRevocation(cred.certs, k.revocation)
+	if !staged {
+		if revocationErr != nil {
+			return nil, revocationErr
+		}
+		k.setCredential(cred)
+		return cred.chain, nil
+	}
+	if revocationErr != nil {
+		p.client.Call(commitCertificateChainAPI, false, &struct{}{})
+		return nil, revocationErr
+	}
+	// The credentials of the signer and of k are swapped together, so that
+	// new operations do not pair the chain of one with the key of the other.
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := p.client.Call(commitCertificateChainAPI, true, &struct{}{}); err != nil {
+		return nil, fmt.Errorf("failed to commit the certificate chain: %w", err)
+	}
+	k.setCredentialLocked(cred)
+	return cred.chain, nil
+}
+
+// splitChain splits a certificate chain, ordered from the leaf upwards, into its
+// intermediate CA certificates and its self-signed root, if present.
+func splitChain(certs []*x509.Certificate) (intermediates []*x509.Certificate, root *x509.Certificate) {
+	if len(certs) < 2 {
+		return nil, nil
+	}
+	cas := certs[1:]
+	if last := cas[len(cas)-1]; bytes.Equal(last.RawIssuer, last.RawSubject) && last.CheckSignatureFrom(last) == nil {
+		root, cas = last, cas[:len(cas)-1]
+	}
+	return cas, root
+}
+
+// isMethodNotFound reports whether err indicates that the signer binary does
+// not implement the called RPC method.
+func isMethodNotFound(err error) bool {
+	var serverErr rpc.ServerError
+	return errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "rpc: can't find method")
 }
@@ -17,15 +17,31 @@ package client
 import (
 	"bytes"
 	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"math/big"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/internal/testsigner"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
 )
 
 func TestClient_Cred_Success(t *testing.T) {
-	_, err := Cred("testdata/certificate_config.json")
+	_, err := Cred(testConfig)
 	if err != nil {
 		t.Errorf("Cred: got %v, want nil err", err)
 	}
@@ -46,7 +62,7 @@ func TestClient_Cred_BinaryPathMissing(t *testing.T) {
 }
 
 func TestClient_Cred_EnvOverride_ExplicitConfig(t *testing.T) {
-	configFilePath := "testdata/certificate_config.json"
+	configFilePath := testConfig
 	os.Setenv("GOOGLE_API_CERTIFICATE_CONFIG", "testdata/certificate_config_missing_path.json")
 	_, err := Cred(configFilePath)
 	if err != nil {
@@ -64,8 +80,36 @@ func TestClient_Cred_EnvOverride_EmptyConfig(t *testing.T) {
 	}
 }
 
+func TestClient_Cred_Priority(t *testing.T) {
+	configFilePath, err := testsigner.WriteConfigWith(t.TempDir(), testCertFile, func(cfg map[string]any) {
+		// The native signer does not exist, so the client must fall back to
+		// the PKCS#11 signer. Backends of other OSes are skipped.
+		libs := cfg["libs"].(map[string]any)
+		exe := libs["ecp"]
+		libs["ecp"] = filepath.Join(t.TempDir(), "missing-signer")
+		libs["signers"] = map[string]any{config.BackendPKCS11: exe}
+		priority := []string{config.BackendMacOSKeychain, config.BackendWindowsStore, config.BackendPKCS11}
+		if native := config.NativeBackend(runtime.GOOS); native != config.BackendPKCS11 {
+			libs["signers"].(map[string]any)[native] = libs["ecp"]
+		}
+		cfg["cert_configs"].(map[string]any)["priority"] = priority
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := Cred(configFilePath)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	if key.CertificateChain() == nil {
+		t.Error("CertificateChain: got nil, want non-nil Certificate Chain")
+	}
+}
+
 func TestClient_Public(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -75,7 +119,7 @@ func TestClient_Public(t *testing.T) {
 }
 
 func TestClient_CertificateChain(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,8 +128,80 @@ func TestClient_CertificateChain(t *testing.T) {
 	}
 }
 
+func TestClient_RefreshCertificateChain(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	fingerprint := key.Metadata().Fingerprint
+	chain, err := key.RefreshCertificateChain()
+	if err != nil {
+		t.Fatalf("RefreshCertificateChain: got %v, want nil err", err)
+	}
+	if !reflect.DeepEqual(chain, key.CertificateChain()) {
+		t.Error("RefreshCertificateChain: returned chain differs from CertificateChain")
+	}
+	if got := key.Metadata().Fingerprint; got != fingerprint {
+		t.Errorf("RefreshCertificateChain: got fingerprint %q, want %q", got, fingerprint)
+	}
+	if _, err := key.Sign(nil, make([]byte, 32), crypto.SHA256); err != nil {
+		t.Errorf("Sign after RefreshCertificateChain: got %v, want nil err", err)
+	}
+}
+
+func TestClient_IntermediatesAndRoot(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The mock signer serves a single self-signed leaf, which is not a root CA.
+	if got := key.Intermediates(); len(got) != 0 {
+		t.Errorf("Intermediates: got %d certificates, want 0", len(got))
+	}
+	if got := key.Root(); got != nil {
+		t.Errorf("Root: got %v, want nil", got.Subject)
+	}
+}
+
+func TestClient_Metadata(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := key.Metadata()
+	if got, want := metadata.KeystoreType, "test"; got != want {
+		t.Errorf("Metadata: got keystore type %q, want %q", got, want)
+	}
+	fingerprint := sha256.Sum256(key.CertificateChain()[0])
+	if got, want := metadata.Fingerprint, hex.EncodeToString(fingerprint[:]); got != want {
+		t.Errorf("Metadata: got fingerprint %q, want %q", got, want)
+	}
+	leaf, err := x509.ParseCertificate(key.CertificateChain()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.NotAfter.Equal(leaf.NotAfter) || metadata.ExpiresSoon {
+		t.Errorf("Metadata: got expiry %v (expires soon: %v), want %v", metadata.NotAfter, metadata.ExpiresSoon, leaf.NotAfter)
+	}
+}
+
+func TestClient_SignerVersion(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := key.SignerVersion()
+	if err != nil {
+		t.Errorf("SignerVersion: got %v, want nil err", err)
+	}
+	if want := "test (features: sign-message)"; got != want {
+		t.Errorf("SignerVersion: got %q, want %q", got, want)
+	}
+}
+
 func TestClient_Sign(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,8 +214,139 @@ func TestClient_Sign(t *testing.T) {
 	}
 }
 
+func TestClient_JSONWireFormat(t *testing.T) {
+	configFilePath, err := testsigner.WriteConfigWith(t.TempDir(), testCertFile, func(cfg map[string]any) {
+		cfg["wire_format"] = "json"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := Cred(configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	digest := make([]byte, 32)
+	for _, opts := range []crypto.SignerOpts{crypto.SHA256, &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash}} {
+		signed, err := key.Sign(nil, digest, opts)
+		if err != nil {
+			t.Errorf("Sign(%v): got %v, want nil err", opts, err)
+		}
+		if !bytes.Equal(signed, digest) {
+			t.Errorf("Sign(%v): got %x, want %x", opts, signed, digest)
+		}
+	}
+	plaintext, err := key.Decrypt(nil, []byte("ciphertext"), &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Errorf("Decrypt: got %v, want nil err", err)
+	}
+	if got, want := string(plaintext), "ciphertext"; got != want {
+		t.Errorf("Decrypt: got %q, want %q", got, want)
+	}
+	if got := key.Metadata().KeystoreType; got != "test" {
+		t.Errorf("Metadata: got keystore type %q, want %q", got, "test")
+	}
+}
+
+func TestClient_JSONWireFormatUnsupported(t *testing.T) {
+	t.Setenv(testsigner.LegacyEnv, "1")
+	configFilePath, err := testsigner.WriteConfigWith(t.TempDir(), testCertFile, func(cfg map[string]any) {
+		cfg["wire_format"] = "json"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := Cred(configFilePath)
+	if err == nil {
+		key.Close()
+		t.Fatal("Cred: got nil err for a signer without the json wire format")
+	}
+	if !strings.Contains(err.Error(), "does not support the \"json\" wire format") {
+		t.Errorf("Cred: got %v, want an unsupported wire format error", err)
+	}
+}
+
+func TestClient_SignMessage(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message to sign, longer than any digest")
+	for _, opts := range []crypto.SignerOpts{crypto.SHA256, crypto.Hash(0), nil} {
+		signed, err := key.SignMessage(msg, opts)
+		if err != nil {
+			t.Errorf("SignMessage(%v): got %v, want nil err", opts, err)
+		}
+		if !bytes.Equal(signed, msg) {
+			t.Errorf("SignMessage(%v): got %q, want message to be passed to the signer", opts, signed)
+		}
+	}
+	// With crypto.Hash(0), Sign passes the full message as well.
+	signed, err := key.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		t.Errorf("Sign: got %v, want nil err", err)
+	}
+	if !bytes.Equal(signed, msg) {
+		t.Errorf("Sign: got %q, want %q", signed, msg)
+	}
+}
+
+// writeEd25519Cred writes a self-signed Ed25519 certificate and its private
+// key to a PEM file for the mock signer.
+func writeEd25519Cred(t *testing.T) string {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ed25519"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	certFile := filepath.Join(t.TempDir(), "ed25519.pem")
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile
+}
+
+func TestClient_Ed25519SignMessage(t *testing.T) {
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", writeEd25519Cred(t))
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	if _, ok := key.Public().(ed25519.PublicKey); !ok {
+		t.Fatalf("Public: got %T, want ed25519.PublicKey", key.Public())
+	}
+	msg := []byte("message to sign")
+	signed, err := key.SignMessage(msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("SignMessage: got %v, want nil err", err)
+	}
+	if !bytes.Equal(signed, msg) {
+		t.Errorf("SignMessage: got %q, want message to be passed to the signer", signed)
+	}
+}
+
 func TestClientEncrypt(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,7 +359,7 @@ func TestClientEncrypt(t *testing.T) {
 }
 
 func TestClientDecrypt(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -128,19 +375,69 @@ func TestClientDecrypt(t *testing.T) {
 	}
 }
 
+func TestClient_DecrypterOpts(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	var decrypter crypto.Decrypter = key
+	tests := []struct {
+		name    string
+		opts    crypto.DecrypterOpts
+		wantErr bool
+	}{
+		{name: "OAEP", opts: &rsa.OAEPOptions{Hash: crypto.SHA256}},
+		{name: "OAEP with MGF1 hash", opts: &rsa.OAEPOptions{Hash: crypto.SHA384, MGFHash: crypto.SHA384}},
+		{name: "OAEP with different MGF1 hash", opts: &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1}, wantErr: true},
+		// The mock signer predates OAEP labels.
+		{name: "OAEP with label", opts: &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}, wantErr: true},
+		{name: "OAEP without hash", opts: &rsa.OAEPOptions{}, wantErr: true},
+		{name: "PKCS1v15", opts: &rsa.PKCS1v15DecryptOptions{}, wantErr: true},
+		{name: "nil", opts: nil, wantErr: true},
+	}
+	for _, test := range tests {
+		if _, err := decrypter.Decrypt(nil, []byte("ciphertext"), test.opts); (err != nil) != test.wantErr {
+			t.Errorf("%s: Decrypt got err %v, want err %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestClient_WrapUnwrapKey(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	wrappedKey, err := key.WrapKey(dataKey, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("WrapKey: got %v, want nil err", err)
+	}
+	unwrappedKey, err := key.UnwrapKey(wrappedKey, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("UnwrapKey: got %v, want nil err", err)
+	}
+	if !bytes.Equal(unwrappedKey, dataKey) {
+		t.Errorf("UnwrapKey: got %v, want %v", unwrappedKey, dataKey)
+	}
+}
+
 func TestClient_Sign_HashSizeMismatch(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
 	_, err = key.Sign(nil, []byte("testDigest"), crypto.SHA256)
-	if got, want := err.Error(), "Digest length of 10 bytes does not match Hash function size of 32 bytes"; got != want {
+	if got, want := err, ErrDigestLengthMismatch; !errors.Is(got, want) {
 		t.Errorf("Sign: got err %v, want err %v", got, want)
 	}
+	if got, want := err.Error(), "digest length mismatch: digest length of 10 bytes does not match hash function size of 32 bytes"; got != want {
+		t.Errorf("Sign: got err %q, want err %q", got, want)
+	}
 }
 
 func TestClient_Close(t *testing.T) {
-	key, err := Cred("testdata/certificate_config.json")
+	key, err := Cred(testConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -148,4 +445,47 @@ func TestClient_Close(t *testing.T) {
 	if err != nil {
 		t.Errorf("Close: got %v, want nil err", err)
 	}
+	if state := key.proc.cmd.ProcessState; state == nil || !state.Success() {
+		t.Errorf("Close: signer exited with %v, want it to exit after Shutdown", state)
+	}
+	if err := key.Close(); err != nil {
+		t.Errorf("Close: got %v on second call, want nil err", err)
+	}
+	if _, err := key.Sign(nil, make([]byte, 32), crypto.SHA256); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Sign: got %v after Close, want ErrKeyClosed", err)
+	}
+	if _, err := key.Encrypt(nil, []byte("plaintext"), crypto.SHA256); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Encrypt: got %v after Close, want ErrKeyClosed", err)
+	}
+}
+
+func TestClient_EncryptLocally(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{publicKey: &priv.PublicKey}
+	plaintext := []byte("Plain text to encrypt")
+	ciphertext, err := key.encryptLocally(plaintext, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("encryptLocally: got %v, want nil err", err)
+	}
+	got, err := priv.Decrypt(nil, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatalf("Decrypt: got %v, want nil err", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Decrypt: got %q, want %q", got, plaintext)
+	}
+	label := []byte("label")
+	ciphertext, err = key.encryptLocally(plaintext, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: label})
+	if err != nil {
+		t.Fatalf("encryptLocally with label: got %v, want nil err", err)
+	}
+	if got, err := priv.Decrypt(nil, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: label}); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("Decrypt with label: got %q, %v, want %q", got, err, plaintext)
+	}
+	if _, err := key.encryptLocally(plaintext, &rsa.PSSOptions{Hash: crypto.SHA256}); err == nil {
+		t.Error("encryptLocally: got nil err, want error for unsupported opts")
+	}
 }
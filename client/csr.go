@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+)
+
+// CertificateRequest returns a DER encoded PKCS#10 certificate signing request
+// for the key, signed by the key in the keystore, so that the certificate can
+// be renewed without extracting the private key. If template is nil, the
+// subject and subject alternative names of the current leaf certificate are
+// requested.
+func (k *Key) CertificateRequest(template *x509.CertificateRequest) ([]byte, error) {
+	return certificateRequest(template, k.leafCert(), k)
+}
+
+func certificateRequest(template *x509.CertificateRequest, leaf *x509.Certificate, signer crypto.Signer) ([]byte, error) {
+	if template == nil {
+		if leaf == nil {
+			return nil, errors.New("no leaf certificate to derive the certificate request from")
+		}
+		template = &x509.CertificateRequest{
+			Subject:        leaf.Subject,
+			DNSNames:       leaf.DNSNames,
+			EmailAddresses: leaf.EmailAddresses,
+			IPAddresses:    leaf.IPAddresses,
+			URIs:           leaf.URIs,
+		}
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, signer)
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCertificateRequest(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device", Organization: []string{"Example"}},
+		DNSNames:     []string{"device.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err = certificateRequest(nil, leaf, priv)
+	if err != nil {
+		t.Fatalf("certificateRequest: got %v, want nil err", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("ParseCertificateRequest: got %v, want nil err", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature: got %v, want nil err", err)
+	}
+	if got, want := csr.Subject.String(), leaf.Subject.String(); got != want {
+		t.Errorf("certificateRequest: got subject %q, want %q", got, want)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "device.example.com" {
+		t.Errorf("certificateRequest: got DNS names %v, want those of the leaf", csr.DNSNames)
+	}
+
+	der, err = certificateRequest(&x509.CertificateRequest{Subject: pkix.Name{CommonName: "renewed"}}, leaf, priv)
+	if err != nil {
+		t.Fatalf("certificateRequest: got %v, want nil err", err)
+	}
+	if csr, err = x509.ParseCertificateRequest(der); err != nil {
+		t.Fatalf("ParseCertificateRequest: got %v, want nil err", err)
+	}
+	if csr.Subject.CommonName != "renewed" || len(csr.DNSNames) != 0 {
+		t.Errorf("certificateRequest: got subject %q and DNS names %v, want the template's", csr.Subject, csr.DNSNames)
+	}
+
+	if _, err := certificateRequest(nil, nil, priv); err == nil {
+		t.Error("certificateRequest: got nil err, want error without leaf or template")
+	}
+}
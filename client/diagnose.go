@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/util"
+)
+
+// Problem is a problem with the setup of the enterprise certificate found by
+// Diagnose, together with guidance on fixing it.
+type Problem struct {
+	Description string // What is wrong. Ex: "signer binary /opt/ecp/ecp does not exist".
+	Fix         string // How to fix it.
+}
+
+// Diagnosis is the result of Diagnose.
+type Diagnosis struct {
+	ConfigFilePath string    // The path of the config file that was checked.
+	Backends       []string  // The keystore backends configured for the current OS, in the order they are tried.
+	Problems       []Problem // The problems found, if any.
+}
+
+// CredError is returned by Cred when it fails. It wraps the cause of the
+// failure together with a Diagnosis of the setup, so that callers can present
+// guidance on fixing it.
+type CredError struct {
+	Err       error
+	Diagnosis Diagnosis
+}
+
+func (e *CredError) Error() string {
+	if len(e.Diagnosis.Problems) == 0 {
+		return e.Err.Error()
+	}
+	problems := make([]string, len(e.Diagnosis.Problems))
+	for i, p := range e.Diagnosis.Problems {
+		problems[i] = p.Description
+	}
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(problems, "; "))
+}
+
+func (e *CredError) Unwrap() error {
+	return e.Err
+}
+
+// Diagnose checks that the config file at configFilePath is readable and valid,
+// which keystore backends it configures, and that their signer binaries exist
+// and are executable. If configFilePath is empty, the config file used by Cred
+// is checked.
+func Diagnose(configFilePath string) Diagnosis {
+	d := Diagnosis{ConfigFilePath: resolveConfigFilePath(configFilePath)}
+	f, err := os.Open(d.ConfigFilePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.add(fmt.Sprintf("config file %s does not exist", d.ConfigFilePath),
+			"Create it with \"gcloud auth enterprise-certificate-config create\", or set GOOGLE_API_CERTIFICATE_CONFIG to its path.")
+		return d
+	case err != nil:
+		d.add(fmt.Sprintf("config file %s is not readable: %v", d.ConfigFilePath, err),
+			"Grant the current user read access to the config file.")
+		return d
+	}
+	f.Close()
+
+	config, err := util.LoadConfig(d.ConfigFilePath)
+	if err != nil {
+		d.add(fmt.Sprintf("config file %s is invalid: %v", d.ConfigFilePath, err),
+			"Correct the config file, checking it with \"ecptool validate-config\".")
+		return d
+	}
+	signers := config.Signers(runtime.GOOS)
+	if len(signers) == 0 {
+		d.add(fmt.Sprintf("no keystore backend is configured for %s", runtime.GOOS),
+			"Add the cert_configs block of the keystore of this OS, and the path of its signer binary as libs.ecp.")
+		return d
+	}
+	for _, signer := range signers {
+		d.Backends = append(d.Backends, signer.Backend)
+		d.checkSigner(signer.Backend, signer.Path)
+	}
+	return d
+}
+
+// checkSigner checks that the signer binary at path exists and is executable.
+func (d *Diagnosis) checkSigner(backend, path string) {
+	fi, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.add(fmt.Sprintf("signer binary %s of backend %s does not exist", path, backend),
+			"Install the enterprise certificate proxy, or correct the signer path in the libs block of the config file.")
+	case err != nil:
+		d.add(fmt.Sprintf("signer binary %s of backend %s cannot be accessed: %v", path, backend, err),
+			"Grant the current user access to the signer binary and its directory.")
+	case fi.IsDir():
+		d.add(fmt.Sprintf("signer binary %s of backend %s is a directory", path, backend),
+			"Set the signer path in the libs block of the config file to the signer binary itself.")
+	case runtime.GOOS != "windows" && fi.Mode().Perm()&0111 == 0:
+		d.add(fmt.Sprintf("signer binary %s of backend %s is not executable", path, backend),
+			fmt.Sprintf("Make it executable with \"chmod +x %s\".", path))
+	}
+}
+
+func (d *Diagnosis) add(description, fix string) {
+	d.Problems = append(d.Problems, Problem{Description: description, Fix: fix})
+}
+
+// resolveConfigFilePath returns the path of the config file Cred uses for
+// configFilePath.
+func resolveConfigFilePath(configFilePath string) string {
+	if configFilePath != "" {
+		return configFilePath
+	}
+	if envFilePath := util.GetConfigFilePathFromEnv(); envFilePath != "" {
+		return envFilePath
+	}
+	return util.GetDefaultConfigFilePath()
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+func writeTestFile(t *testing.T, name, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiagnose(t *testing.T) {
+	missingSigner := filepath.Join(t.TempDir(), "missing-signer")
+	nonExecutable := writeTestFile(t, "signer", "", 0600)
+	tests := []struct {
+		name       string
+		configFile string
+		want       string // Substring of the single problem found, if any.
+	}{
+		{name: "valid", configFile: testConfig},
+		{name: "missing config", configFile: filepath.Join(t.TempDir(), "missing.json"), want: "does not exist"},
+		{name: "invalid config", configFile: writeTestFile(t, "invalid.json", "{", 0600), want: "is invalid"},
+		{name: "no backend", configFile: writeTestFile(t, "empty.json", "{}", 0600), want: "no keystore backend"},
+		{name: "missing signer", configFile: writeTestFile(t, "missing_signer.json", `{"libs": {"ecp": "`+filepath.ToSlash(missingSigner)+`"}}`, 0600), want: "missing-signer of backend"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name       string
+			configFile string
+			want       string
+		}{name: "non-executable signer", configFile: writeTestFile(t, "non_executable.json", `{"libs": {"ecp": "`+nonExecutable+`"}}`, 0600), want: "is not executable"})
+	}
+	for _, test := range tests {
+		d := Diagnose(test.configFile)
+		if test.want == "" {
+			if len(d.Problems) != 0 {
+				t.Errorf("%s: Diagnose() got problems %+v, want none", test.name, d.Problems)
+			}
+			if want := []string{config.NativeBackend(runtime.GOOS)}; !reflect.DeepEqual(d.Backends, want) {
+				t.Errorf("%s: Diagnose() got backends %q, want %q", test.name, d.Backends, want)
+			}
+			continue
+		}
+		if len(d.Problems) != 1 || !strings.Contains(d.Problems[0].Description, test.want) || d.Problems[0].Fix == "" {
+			t.Errorf("%s: Diagnose() got problems %+v, want one containing %q with a fix", test.name, d.Problems, test.want)
+		}
+	}
+}
+
+func TestClient_Cred_Diagnosis(t *testing.T) {
+	missingSigner := filepath.Join(t.TempDir(), "missing-signer")
+	configFile := writeTestFile(t, "certificate_config.json", `{"libs": {"ecp": "`+filepath.ToSlash(missingSigner)+`"}}`, 0600)
+	_, err := Cred(configFile)
+	var credErr *CredError
+	if !errors.As(err, &credErr) {
+		t.Fatalf("Cred: got %v, want CredError", err)
+	}
+	if len(credErr.Diagnosis.Problems) != 1 || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Cred: got %v, want a diagnosis of the missing signer", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrDeterministicECDSAUnsupported is wrapped by the error returned by Sign and
+// SignMessage when ECDSAOptions.Deterministic is set. None of the supported
+// keystores lets the caller choose how the nonce is generated, and smart cards
+// and security keys draw it from their own random number generator, so a
+// deterministic (RFC 6979) signature cannot be guaranteed.
+var ErrDeterministicECDSAUnsupported = errors.New("deterministic ECDSA signatures are not supported")
+
+// SignatureFormat is the encoding of the ECDSA signatures returned by Sign and
+// SignMessage.
+type SignatureFormat int
+
+const (
+	// SignatureFormatDER is an ASN.1 DER SEQUENCE of the integers r and s, as
+	// returned by crypto/ecdsa and expected by crypto/tls and crypto/x509.
+	SignatureFormatDER SignatureFormat = iota
+	// SignatureFormatRaw is r followed by s, each as a big-endian integer
+	// padded to the byte size of the curve order, as used by JWS (RFC 7518)
+	// and COSE.
+	SignatureFormatRaw
+)
+
+// ECDSAOptions are signer opts for ECDSA keys. Passing them to Sign or
+// SignMessage selects the encoding of the signature, so that callers such as
+// JOSE libraries do not need to re-encode it, and can require a deterministic
+// signature. Signatures are encoded by the client, the same way for every
+// keystore.
+type ECDSAOptions struct {
+	// Hash is the hash function of the digest, or used to hash the message.
+	Hash crypto.Hash
+	// Format is the encoding of the returned signature.
+	Format SignatureFormat
+	// Deterministic asks for a signature computed with a deterministic nonce,
+	// as described in RFC 6979. No keystore supports it, so signing fails
+	// with an error wrapping ErrDeterministicECDSAUnsupported rather than
+	// return a signature with a random nonce.
+	Deterministic bool
+}
+
+// HashFunc returns o.Hash. Implements crypto.SignerOpts.
+func (o *ECDSAOptions) HashFunc() crypto.Hash {
+	return o.Hash
+}
+
+// splitECDSAOptions returns the opts to send to the signer in place of opts,
+// and opts as an *ECDSAOptions if it is one, or nil.
+func splitECDSAOptions(opts crypto.SignerOpts) (crypto.SignerOpts, *ECDSAOptions) {
+	o, ok := opts.(*ECDSAOptions)
+	if !ok || o == nil {
+		return opts, nil
+	}
+	return o.Hash, o
+}
+
+// checkECDSAOptions returns an error if o, if not nil, cannot be honored for
+// the key.
+func (k *Key) checkECDSAOptions(o *ECDSAOptions) error {
+	if o == nil {
+		return nil
+	}
+	if _, ok := k.Public().(*ecdsa.PublicKey); !ok {
+		return fmt.Errorf("ECDSAOptions used with a %T key", k.Public())
+	}
+	if o.Format != SignatureFormatDER && o.Format != SignatureFormatRaw {
+		return fmt.Errorf("unknown ECDSA signature format %d", o.Format)
+	}
+	if o.Deterministic {
+		return ErrDeterministicECDSAUnsupported
+	}
+	return nil
+}
+
+// encodeSignature returns the DER signature returned by the signer in the
+// format selected by o, if not nil.
+func (k *Key) encodeSignature(signed []byte, o *ECDSAOptions) ([]byte, error) {
+	if o == nil || o.Format == SignatureFormatDER {
+		return signed, nil
+	}
+	pub, ok := k.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("ECDSAOptions used with a %T key", k.Public())
+	}
+	return rawECDSASignature(signed, (pub.Curve.Params().N.BitLen()+7)/8)
+}
+
+// rawECDSASignature converts the ASN.1 DER ECDSA signature der to r||s, where
+// r and s are padded to size bytes.
+func rawECDSASignature(der []byte, size int) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ECDSA signature: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("failed to parse ECDSA signature: trailing data")
+	}
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > size*8 || sig.S.BitLen() > size*8 {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRawECDSASignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	der, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := rawECDSASignature(der, 32)
+	if err != nil {
+		t.Fatalf("rawECDSASignature: got %v, want nil err", err)
+	}
+	if len(raw) != 64 {
+		t.Fatalf("rawECDSASignature: got %d bytes, want 64", len(raw))
+	}
+	r, s := new(big.Int).SetBytes(raw[:32]), new(big.Int).SetBytes(raw[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("rawECDSASignature: signature does not verify")
+	}
+
+	for _, bad := range [][]byte{
+		nil,
+		append(der, 0),
+		mustMarshal(t, struct{ R, S *big.Int }{big.NewInt(0), big.NewInt(1)}),
+		mustMarshal(t, struct{ R, S *big.Int }{new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)}),
+	} {
+		if _, err := rawECDSASignature(bad, 32); err == nil {
+			t.Errorf("rawECDSASignature(%x): got nil err, want error", bad)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestClient_Sign_ECDSAOptions(t *testing.T) {
+	ca := issue(t, "ecdsa", false, nil)
+	keyDER, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	certFile := filepath.Join(t.TempDir(), "ecdsa.pem")
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", certFile)
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	// The mock signer returns the digest as the signature, so pass a DER
+	// signature of the size of a SHA-256 digest: two 13-byte integers.
+	rBytes := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}
+	sBytes := []byte{21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33}
+	der := mustMarshal(t, struct{ R, S *big.Int }{new(big.Int).SetBytes(rBytes), new(big.Int).SetBytes(sBytes)})
+	if len(der) != sha256.Size {
+		t.Fatalf("test signature is %d bytes, want %d", len(der), sha256.Size)
+	}
+	raw := make([]byte, 64)
+	copy(raw[32-len(rBytes):], rBytes)
+	copy(raw[64-len(sBytes):], sBytes)
+
+	tests := []struct {
+		name string
+		opts crypto.SignerOpts
+		want []byte
+	}{
+		{name: "hash", opts: crypto.SHA256, want: der},
+		{name: "DER", opts: &ECDSAOptions{Hash: crypto.SHA256}, want: der},
+		{name: "raw", opts: &ECDSAOptions{Hash: crypto.SHA256, Format: SignatureFormatRaw}, want: raw},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signed, err := key.Sign(nil, der, tc.opts)
+			if err != nil {
+				t.Fatalf("Sign: got %v, want nil err", err)
+			}
+			if !bytes.Equal(signed, tc.want) {
+				t.Errorf("Sign: got %x, want %x", signed, tc.want)
+			}
+		})
+	}
+
+	// No keystore signs deterministically.
+	_, err = key.Sign(nil, der, &ECDSAOptions{Hash: crypto.SHA256, Deterministic: true})
+	if !errors.Is(err, ErrDeterministicECDSAUnsupported) {
+		t.Errorf("Sign with Deterministic: got %v, want %v", err, ErrDeterministicECDSAUnsupported)
+	}
+}
+
+func TestClient_Sign_ECDSAOptionsRSAKey(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	digest := sha256.Sum256([]byte("message"))
+	if _, err := key.Sign(nil, digest[:], &ECDSAOptions{Hash: crypto.SHA256, Format: SignatureFormatRaw}); err == nil {
+		t.Error("Sign: got nil err, want error for ECDSAOptions with an RSA key")
+	}
+}
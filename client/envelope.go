@@ -0,0 +1,228 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// Envelope encryption supports payloads of any size. The payload is encrypted
+// locally with a random AES-256-GCM data key in chunks, and only the data key
+// is wrapped with WrapKey, using RSA-OAEP and SHA-256.
+//
+// An envelope consists of a header followed by chunks:
+//
+//	header: "ECPE" | version (1 byte) | wrapped key length (2 bytes) | wrapped key | nonce prefix (7 bytes)
+//	chunk:  sealed length (4 bytes) | AES-GCM sealed chunk
+//
+// The nonce of a chunk is the nonce prefix, followed by the chunk index (4
+// bytes) and a byte set to 1 for the last chunk only, so that reordered,
+// dropped or truncated chunks are detected. All integers are big endian.
+const (
+	envelopeVersion   = 1
+	envelopeChunkSize = 64 << 10
+	dataKeySize       = 32
+	noncePrefixSize   = 7
+)
+
+var envelopeMagic = []byte("ECPE")
+
+// ErrInvalidEnvelope is returned when decrypting data that is not a complete,
+// authentic envelope produced by EncryptStream or EncryptEnvelope.
+var ErrInvalidEnvelope = errors.New("invalid or truncated envelope")
+
+// envelopeNonce returns the nonce of chunk i.
+func envelopeNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// EncryptStream encrypts src into an envelope written to dst.
+func (k *Key) EncryptStream(dst io.Writer, src io.Reader) error {
+	dataKey := make([]byte, dataKeySize)
+	defer zeroize.Bytes(dataKey)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrappedKey, err := k.WrapKey(dataKey, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("encrypting data key: %w", err)
+	}
+	if len(wrappedKey) > math.MaxUint16 {
+		return fmt.Errorf("encrypted data key of %d bytes is too large", len(wrappedKey))
+	}
+	aead, err := newEnvelopeAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return err
+	}
+
+	header := append([]byte{}, envelopeMagic...)
+	header = append(header, envelopeVersion)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+	header = append(header, noncePrefix...)
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(src, envelopeChunkSize)
+	chunk := make([]byte, envelopeChunkSize)
+	defer zeroize.Bytes(chunk)
+	for i := uint32(0); ; i++ {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := n < envelopeChunkSize
+		if !last {
+			// A full chunk is the last one if nothing follows it.
+			if _, err := r.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if !last && i == math.MaxUint32 {
+			return errors.New("payload is too large for an envelope")
+		}
+		sealed := aead.Seal(nil, envelopeNonce(noncePrefix, i, last), chunk[:n], nil)
+		record := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(sealed)), uint32(len(sealed)))
+		if _, err := dst.Write(append(record, sealed...)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// DecryptStream decrypts an envelope read from src into dst. Every chunk is
+// authenticated before it is written, but if the envelope turns out to be
+// truncated or corrupted, ErrInvalidEnvelope is returned after the preceding
+// chunks have been written.
+func (k *Key) DecryptStream(dst io.Writer, src io.Reader) error {
+	r := bufio.NewReader(src)
+	header := make([]byte, len(envelopeMagic)+3)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return ErrInvalidEnvelope
+	}
+	if !bytes.Equal(header[:len(envelopeMagic)], envelopeMagic) {
+		return ErrInvalidEnvelope
+	}
+	if version := header[len(envelopeMagic)]; version != envelopeVersion {
+		return fmt.Errorf("unsupported envelope version %d", version)
+	}
+	wrappedKey := make([]byte, binary.BigEndian.Uint16(header[len(envelopeMagic)+1:]))
+	if _, err := io.ReadFull(r, wrappedKey); err != nil {
+		return ErrInvalidEnvelope
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(r, noncePrefix); err != nil {
+		return ErrInvalidEnvelope
+	}
+	dataKey, err := k.UnwrapKey(wrappedKey, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("decrypting data key: %w", err)
+	}
+	defer zeroize.Bytes(dataKey)
+	aead, err := newEnvelopeAEAD(dataKey)
+	if err != nil {
+		return ErrInvalidEnvelope
+	}
+
+	length := make([]byte, 4)
+	sealed := make([]byte, envelopeChunkSize+aead.Overhead())
+	for i := uint32(0); ; i++ {
+		if _, err := io.ReadFull(r, length); err != nil {
+			return ErrInvalidEnvelope
+		}
+		n := binary.BigEndian.Uint32(length)
+		if n > uint32(len(sealed)) {
+			return ErrInvalidEnvelope
+		}
+		if _, err := io.ReadFull(r, sealed[:n]); err != nil {
+			return ErrInvalidEnvelope
+		}
+		last := false
+		plaintext, err := aead.Open(nil, envelopeNonce(noncePrefix, i, false), sealed[:n], nil)
+		if err != nil {
+			last = true
+			if plaintext, err = aead.Open(nil, envelopeNonce(noncePrefix, i, true), sealed[:n], nil); err != nil {
+				return ErrInvalidEnvelope
+			}
+		}
+		_, err = dst.Write(plaintext)
+		zeroize.Bytes(plaintext)
+		if err != nil {
+			return err
+		}
+		if last {
+			if _, err := r.ReadByte(); err != io.EOF {
+				return ErrInvalidEnvelope
+			}
+			return nil
+		}
+	}
+}
+
+// EncryptEnvelope encrypts plaintext of any size into an envelope.
+func (k *Key) EncryptEnvelope(plaintext []byte) ([]byte, error) {
+	var envelope bytes.Buffer
+	if err := k.EncryptStream(&envelope, bytes.NewReader(plaintext)); err != nil {
+		return nil, err
+	}
+	return envelope.Bytes(), nil
+}
+
+// DecryptEnvelope decrypts an envelope produced by EncryptEnvelope or EncryptStream.
+func (k *Key) DecryptEnvelope(envelope []byte) ([]byte, error) {
+	var plaintext bytes.Buffer
+	if err := k.DecryptStream(&plaintext, bytes.NewReader(envelope)); err != nil {
+		zeroize.Bytes(plaintext.Bytes())
+		return nil, err
+	}
+	return plaintext.Bytes(), nil
+}
+
+func newEnvelopeAEAD(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", dataKeySize, len(dataKey))
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
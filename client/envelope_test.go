@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestClient_EnvelopeRoundTrip(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	for _, size := range []int{0, 1, envelopeChunkSize, 2*envelopeChunkSize + 1} {
+		plaintext := bytes.Repeat([]byte{'a'}, size)
+		envelope, err := key.EncryptEnvelope(plaintext)
+		if err != nil {
+			t.Fatalf("EncryptEnvelope(%d bytes): got %v, want nil err", size, err)
+		}
+		got, err := key.DecryptEnvelope(envelope)
+		if err != nil {
+			t.Fatalf("DecryptEnvelope(%d bytes): got %v, want nil err", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("DecryptEnvelope(%d bytes): got %d bytes, want original plaintext", size, len(got))
+		}
+	}
+}
+
+func TestClient_EnvelopeTamperedOrTruncated(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	envelope, err := key.EncryptEnvelope(bytes.Repeat([]byte{'a'}, 2*envelopeChunkSize))
+	if err != nil {
+		t.Fatalf("EncryptEnvelope: got %v, want nil err", err)
+	}
+	tampered := append([]byte{}, envelope...)
+	tampered[len(tampered)-1] ^= 1
+	tests := map[string][]byte{
+		"tampered":           tampered,
+		"truncated":          envelope[:len(envelope)-1],
+		"missing last chunk": envelope[:len(envelope)-20],
+		"trailing data":      append(append([]byte{}, envelope...), 0),
+		"not an envelope":    []byte("ciphertext"),
+	}
+	for name, in := range tests {
+		if _, err := key.DecryptEnvelope(in); !errors.Is(err, ErrInvalidEnvelope) {
+			t.Errorf("DecryptEnvelope(%s): got %v, want %v", name, err, ErrInvalidEnvelope)
+		}
+	}
+}
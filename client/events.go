@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+const waitTokenChangeAPI = "EnterpriseCertSigner.WaitTokenChange"
+
+// Intervals of the token watch started by Events.
+const (
+	tokenWatchTimeout       = 30 * time.Second // Upper bound on a single WaitTokenChange call.
+	tokenWatchRetryInterval = time.Second      // Wait after a failed call, such as while the signer is replaced.
+)
+
+// eventBufferSize is the number of events buffered for each subscriber.
+// Events that do not fit are dropped.
+const eventBufferSize = 16
+
+// KeyEvent is a change of the token or certificate of a Key reported by
+// Events.
+type KeyEvent int
+
+const (
+	// TokenRemoved is sent when the smart card or token holding the key is
+	// removed.
+	TokenRemoved KeyEvent = iota + 1
+	// TokenInserted is sent when the smart card or token holding the key is
+	// present again. Call RefreshCertificateChain to use it again.
+	TokenInserted
+	// CertRotated is sent when the Key switches to a new certificate, after
+	// RefreshCertificateChain or when the signer subprocess is replaced.
+	CertRotated
+)
+
+func (e KeyEvent) String() string {
+	switch e {
+	case TokenRemoved:
+		return "TokenRemoved"
+	case TokenInserted:
+		return "TokenInserted"
+	case CertRotated:
+		return "CertRotated"
+	default:
+		return "KeyEvent(unknown)"
+	}
+}
+
+// waitTokenChangeArgs contains arguments for a WaitTokenChange API call.
+type waitTokenChangeArgs struct {
+	Present bool          // Whether the token was last seen present.
+	Timeout time.Duration // Upper bound on the wait.
+}
+
+// keyEvents holds the subscribers of the events of a Key.
+type keyEvents struct {
+	watchOnce sync.Once
+	mu        sync.Mutex
+	subs      []chan KeyEvent
+	done      chan struct{} // Closed by close.
+	closed    bool
+}
+
+// subscribe returns a new channel receiving the events, which is already
+// closed if the events have been closed.
+func (e *keyEvents) subscribe() <-chan KeyEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch := make(chan KeyEvent, eventBufferSize)
+	if e.closed {
+		close(ch)
+		return ch
+	}
+	e.subs = append(e.subs, ch)
+	return ch
+}
+
+// send sends event to every subscriber that has room for it.
+func (e *keyEvents) send(event KeyEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ch := range e.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// doneChan returns a channel closed by close.
+func (e *keyEvents) doneChan() chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done == nil {
+		e.done = make(chan struct{})
+		if e.closed {
+			close(e.done)
+		}
+	}
+	return e.done
+}
+
+// close closes the channels of the subscribers.
+func (e *keyEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	if e.done != nil {
+		close(e.done)
+	}
+	for _, ch := range e.subs {
+		close(ch)
+	}
+	e.subs = nil
+}
+
+// Events returns a channel receiving the changes of the token holding the key
+// and of its certificate, so that applications can react to them instead of
+// discovering them when a handshake fails. Each call returns a new channel,
+// which is closed when k is closed. Events are dropped for a subscriber that
+// does not keep up.
+//
+// Token events are reported by the PKCS#11, Windows and PIV signers. Signers
+// that predate them only report CertRotated.
+func (k *Key) Events() <-chan KeyEvent {
+	ch := k.events.subscribe()
+	k.events.watchOnce.Do(func() {
+		go k.watchToken(k.events.doneChan())
+	})
+	return ch
+}
+
+// watchToken sends TokenRemoved and TokenInserted events as reported by the
+// signer subprocess, until done is closed.
+func (k *Key) watchToken(done chan struct{}) {
+	present := true
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		p, release := k.acquire()
+		// The call is not waited for when p is replaced, since it can
+		// last up to tokenWatchTimeout.
+		release()
+		var now bool
+		err := p.client.Call(waitTokenChangeAPI, waitTokenChangeArgs{Present: present, Timeout: tokenWatchTimeout}, &now)
+		if isMethodNotFound(err) {
+			return
+		}
+		if err != nil {
+			select {
+			case <-done:
+				return
+			case <-time.After(tokenWatchRetryInterval):
+			}
+			continue
+		}
+		if now == present {
+			continue
+		}
+		present = now
+		if present {
+			k.events.send(TokenInserted)
+		} else {
+			k.events.send(TokenRemoved)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of events, failing the test if none is
+// received in time.
+func nextEvent(t *testing.T, events <-chan KeyEvent) KeyEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event received")
+		return 0
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	// The mock signer reports the token as removed when its certificate file
+	// is gone.
+	data, err := os.ReadFile("testdata/testcert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), "testcert.pem")
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", certFile)
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	events := key.Events()
+
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEvent(t, events); got != TokenRemoved {
+		t.Errorf("Events: got %v after removing the token, want %v", got, TokenRemoved)
+	}
+	// The token comes back with a renewed certificate.
+	renewed := issue(t, "renewed", false, nil)
+	keyDER, err := x509.MarshalECPrivateKey(renewed.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: renewed.cert.Raw})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEvent(t, events); got != TokenInserted {
+		t.Errorf("Events: got %v after inserting the token, want %v", got, TokenInserted)
+	}
+	if _, err := key.RefreshCertificateChain(); err != nil {
+		t.Fatalf("RefreshCertificateChain: %v", err)
+	}
+	if got := nextEvent(t, events); got != CertRotated {
+		t.Errorf("Events: got %v after refreshing the certificate, want %v", got, CertRotated)
+	}
+
+	key.Close()
+	if _, ok := <-events; ok {
+		t.Error("Events: channel not closed after Close")
+	}
+	if _, ok := <-key.Events(); ok {
+		t.Error("Events: got an open channel after Close")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/x509"
+	"log"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// expiryWarning returns the time before the expiry of a certificate from which
+// the client warns about it, as configured by policy.
+func expiryWarning(policy config.Expiry) time.Duration {
+	if policy.Warning == "" {
+		return defaultExpiryWarning
+	}
+	// The duration has already been validated when loading the config.
+	warning, _ := time.ParseDuration(policy.Warning)
+	return warning
+}
+
+// checkExpiry reports whether leaf expires within warning of now, and logs a
+// warning if so. A zero warning disables the check.
+func checkExpiry(leaf *x509.Certificate, warning time.Duration, now time.Time) bool {
+	if leaf == nil || warning <= 0 || now.Add(warning).Before(leaf.NotAfter) {
+		return false
+	}
+	if now.After(leaf.NotAfter) {
+		log.Printf("Enterprise certificate %q expired on %v", leaf.Subject, leaf.NotAfter)
+	} else {
+		log.Printf("Enterprise certificate %q expires on %v, in %v; it should be renewed", leaf.Subject, leaf.NotAfter, leaf.NotAfter.Sub(now).Round(time.Minute))
+	}
+	return true
+}
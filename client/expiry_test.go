@@ -0,0 +1,45 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Now()
+	leaf := &x509.Certificate{NotAfter: now.Add(7 * 24 * time.Hour)}
+	tests := []struct {
+		name    string
+		leaf    *x509.Certificate
+		warning string
+		want    bool
+	}{
+		{name: "default window", leaf: leaf, want: true},
+		{name: "narrow window", leaf: leaf, warning: "24h", want: false},
+		{name: "disabled", leaf: leaf, warning: "0s", want: false},
+		{name: "expired", leaf: &x509.Certificate{NotAfter: now.Add(-time.Hour)}, want: true},
+		{name: "no leaf", want: false},
+	}
+	for _, test := range tests {
+		warning := expiryWarning(config.Expiry{Warning: test.warning})
+		if got := checkExpiry(test.leaf, warning, now); got != test.want {
+			t.Errorf("%s: checkExpiry() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// HandshakeStats counts the TLS connections that used a Key, to quantify the
+// load on the keystore.
+type HandshakeStats struct {
+	Signatures      uint64 // Calls to Sign and SignMessage.
+	FullHandshakes  uint64 // Connections that performed a full handshake.
+	ResumedSessions uint64 // Connections that resumed a session and did not use the private key.
+}
+
+// handshakeCounters holds the counters behind HandshakeStats.
+type handshakeCounters struct {
+	signatures      atomic.Uint64
+	fullHandshakes  atomic.Uint64
+	resumedSessions atomic.Uint64
+}
+
+// VerifyConnection records whether a TLS connection performed a full handshake
+// or resumed a session, and logs it when ENABLE_ENTERPRISE_CERTIFICATE_LOGS is
+// set. It can be used as tls.Config.VerifyConnection, or be called from it, and
+// always returns nil.
+func (k *Key) VerifyConnection(cs tls.ConnectionState) error {
+	if cs.DidResume {
+		k.counters.resumedSessions.Add(1)
+	} else {
+		k.counters.fullHandshakes.Add(1)
+	}
+	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
+		if cs.DidResume {
+			log.Printf("TLS connection to %q resumed a session without using the private key", cs.ServerName)
+		} else {
+			log.Printf("TLS connection to %q performed a full handshake", cs.ServerName)
+		}
+	}
+	return nil
+}
+
+// HandshakeStats returns the TLS connections recorded by VerifyConnection and
+// the signatures made with this Key so far.
+func (k *Key) HandshakeStats() HandshakeStats {
+	return HandshakeStats{
+		Signatures:      k.counters.signatures.Load(),
+		FullHandshakes:  k.counters.fullHandshakes.Load(),
+		ResumedSessions: k.counters.resumedSessions.Load(),
+	}
+}
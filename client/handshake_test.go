@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestClient_HandshakeStats(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	if _, err := key.Sign(nil, []byte("testDigest"), nil); err != nil {
+		t.Fatal(err)
+	}
+	key.VerifyConnection(tls.ConnectionState{ServerName: "example.com"})
+	key.VerifyConnection(tls.ConnectionState{ServerName: "example.com", DidResume: true})
+	key.VerifyConnection(tls.ConnectionState{ServerName: "example.com", DidResume: true})
+	want := HandshakeStats{Signatures: 1, FullHandshakes: 1, ResumedSessions: 2}
+	if got := key.HandshakeStats(); got != want {
+		t.Errorf("HandshakeStats: got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2022 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testsigner provides a mock signer for testing the client. The mock
+// signer is a net/rpc server that listens on stdin/stdout, served by the test
+// binary itself, so that no signer binary needs to be built for the tests.
+package testsigner
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	_ "github.com/googleapis/enterprise-certificate-proxy/internal/cryptoopts" // Registers the opts types sent by the client.
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+)
+
+// certFileEnv names the environment variable that makes a test binary serve
+// the mock signer. Its value is the path of a PEM file holding the certificate
+// and private key of the signer.
+const certFileEnv = "ECP_TESTSIGNER_CERT_FILE"
+
+// LegacyEnv, when set, makes the mock signer report the features of a signer
+// predating the json wire format in --version.
+const LegacyEnv = "ECP_TESTSIGNER_LEGACY"
+
+// SignArgs encapsulate the parameters for the Sign method.
+type SignArgs struct {
+	Digest  []byte
+	Opts    crypto.SignerOpts
+	Message []byte
+}
+
+// EncryptArgs encapsulate the parameters for the Encrypt method.
+type EncryptArgs struct {
+	Plaintext []byte
+}
+
+// DecryptArgs encapsulate the parameters for the Decrypt method.
+type DecryptArgs struct {
+	Ciphertext []byte
+	Opts       crypto.DecrypterOpts
+}
+
+// WrapKeyArgs encapsulate the parameters for the WrapKey method.
+type WrapKeyArgs struct {
+	Key  []byte
+	Hash crypto.Hash
+}
+
+// UnwrapKeyArgs encapsulate the parameters for the UnwrapKey method.
+type UnwrapKeyArgs struct {
+	WrappedKey []byte
+	Hash       crypto.Hash
+}
+
+// KeyAgreementArgs encapsulate the parameters for the KeyAgreement method.
+type KeyAgreementArgs struct {
+	PeerPublicKey []byte
+}
+
+// StagedCredential is the credential returned by the StageCertificateChain
+// method.
+type StagedCredential struct {
+	CertificateChain [][]byte
+	PublicKey        []byte
+}
+
+// WaitTokenChangeArgs encapsulate the parameters for the WaitTokenChange method.
+type WaitTokenChangeArgs struct {
+	Present bool
+	Timeout time.Duration
+}
+
+// Attestation is evidence from the keystore that the key is bound to the
+// hardware.
+type Attestation struct {
+	Format       string
+	Certificates [][]byte
+}
+
+// Capabilities describes the algorithms that the signer supports.
+type Capabilities = util.Capabilities
+
+// EnterpriseCertSigner exports RPC methods for signing.
+type EnterpriseCertSigner struct {
+	certFile string
+	cert     *tls.Certificate
+	staged   *tls.Certificate
+}
+
+// Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
+type Connection struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+// Close closes c's underlying ReadCloser and WriteCloser.
+func (c *Connection) Close() error {
+	rerr := c.ReadCloser.Close()
+	werr := c.WriteCloser.Close()
+	if rerr != nil {
+		return rerr
+	}
+	return werr
+}
+
+// CertificateChain returns the credential as a raw X509 cert chain. This
+// contains the public key.
+func (k *EnterpriseCertSigner) CertificateChain(ignored struct{}, certificateChain *[][]byte) error {
+	*certificateChain = k.cert.Certificate
+	return nil
+}
+
+// RefreshCertificateChain reads the certificate file again and returns the
+// new certificate chain.
+func (k *EnterpriseCertSigner) RefreshCertificateChain(ignored struct{}, certificateChain *[][]byte) error {
+	data, err := os.ReadFile(k.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return err
+	}
+	k.cert = &cert
+	*certificateChain = k.cert.Certificate
+	return nil
+}
+
+// StageCertificateChain reads the certificate file again and returns the new
+// credential, which CommitCertificateChain makes the credential of the signer.
+func (k *EnterpriseCertSigner) StageCertificateChain(ignored struct{}, staged *StagedCredential) error {
+	data, err := os.ReadFile(k.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+	if err != nil {
+		return err
+	}
+	k.staged = &cert
+	*staged = StagedCredential{CertificateChain: cert.Certificate, PublicKey: publicKey}
+	return nil
+}
+
+// CommitCertificateChain makes the credential staged by StageCertificateChain
+// the credential of the signer if accept is true, and otherwise discards it.
+func (k *EnterpriseCertSigner) CommitCertificateChain(accept bool, ignored *struct{}) error {
+	if k.staged == nil {
+		return errors.New("no certificate chain is staged")
+	}
+	if accept {
+		k.cert = k.staged
+	}
+	k.staged = nil
+	return nil
+}
+
+// Public returns the first public key for this Key, in ASN.1 DER form.
+func (k *EnterpriseCertSigner) Public(ignored struct{}, publicKey *[]byte) (err error) {
+	if len(k.cert.Certificate) == 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(k.cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	*publicKey, err = x509.MarshalPKIXPublicKey(cert.PublicKey)
+	return err
+}
+
+// Sign signs a message digest or message. For testing, we return the input as-is.
+func (k *EnterpriseCertSigner) Sign(args SignArgs, resp *[]byte) (err error) {
+	if args.Message != nil {
+		*resp = args.Message
+		return nil
+	}
+	*resp = args.Digest
+	return nil
+}
+
+// Encrypt encrypts a plaintext msg. For testing, we return the input as-is.
+func (k *EnterpriseCertSigner) Encrypt(args EncryptArgs, plaintext *[]byte) (err error) {
+	*plaintext = args.Plaintext
+	return nil
+}
+
+// Decrypt decrypts a ciphertext msg. For testing, we return the input as-is.
+func (k *EnterpriseCertSigner) Decrypt(args DecryptArgs, ciphertext *[]byte) (err error) {
+	if _, ok := args.Opts.(*rsa.OAEPOptions); !ok {
+		return fmt.Errorf("unsupported decrypter opts %T", args.Opts)
+	}
+	*ciphertext = args.Ciphertext
+	return nil
+}
+
+// WrapKey wraps a symmetric key. For testing, we return the input as-is.
+func (k *EnterpriseCertSigner) WrapKey(args WrapKeyArgs, wrappedKey *[]byte) (err error) {
+	*wrappedKey = args.Key
+	return nil
+}
+
+// UnwrapKey unwraps a symmetric key. For testing, we return the input as-is.
+func (k *EnterpriseCertSigner) UnwrapKey(args UnwrapKeyArgs, key *[]byte) (err error) {
+	*key = args.WrappedKey
+	return nil
+}
+
+// KeyAgreement computes the ECDH shared secret of the EC private key of the
+// credential and the peer public key, so that protocols built on it can be
+// tested end to end.
+func (k *EnterpriseCertSigner) KeyAgreement(args KeyAgreementArgs, secret *[]byte) (err error) {
+	priv, ok := k.cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("key agreement is only supported with EC keys, got %T", k.cert.PrivateKey)
+	}
+	pub, err := x509.ParsePKIXPublicKey(args.PeerPublicKey)
+	if err != nil {
+		return err
+	}
+	peer, ok := pub.(*ecdsa.PublicKey)
+	if !ok || peer.Curve != priv.Curve {
+		return fmt.Errorf("the peer public key is not on the curve of the key")
+	}
+	x, _ := priv.Curve.ScalarMult(peer.X, peer.Y, priv.D.Bytes())
+	*secret = x.FillBytes(make([]byte, (priv.Curve.Params().BitSize+7)/8))
+	return nil
+}
+
+// Metadata returns a fixed description of the mock keystore.
+func (k *EnterpriseCertSigner) Metadata(ignored struct{}, metadata *server.Metadata) error {
+	*metadata = server.Metadata{KeystoreType: "test", TokenLabel: "mock"}
+	return nil
+}
+
+// Attest returns a mock attestation holding the certificate chain.
+func (k *EnterpriseCertSigner) Attest(ignored struct{}, attestation *Attestation) error {
+	*attestation = Attestation{Format: "test", Certificates: k.cert.Certificate}
+	return nil
+}
+
+// Capabilities returns fixed capabilities of the mock keystore, whose RSA key
+// only signs SHA-256 digests with PKCS #1 v1.5.
+func (k *EnterpriseCertSigner) Capabilities(ignored struct{}, capabilities *Capabilities) error {
+	*capabilities = Capabilities{
+		Hashes:            []crypto.Hash{crypto.SHA256},
+		PKCS1v15:          true,
+		SignMessage:       true,
+		Decrypt:           true,
+		DecryptHashes:     []crypto.Hash{crypto.SHA256},
+		MaxCiphertextSize: 256,
+	}
+	return nil
+}
+
+// Ping reports the mock token as removed when the certificate file is gone.
+func (k *EnterpriseCertSigner) Ping(ignored struct{}, ignored2 *struct{}) error {
+	if _, err := os.Stat(k.certFile); err != nil {
+		return fmt.Errorf("token is not present: %w", err)
+	}
+	return nil
+}
+
+// Shutdown is a no-op, since the mock credential holds no resources.
+func (k *EnterpriseCertSigner) Shutdown(ignored struct{}, ignored2 *struct{}) error {
+	return nil
+}
+
+// WaitTokenChange polls the certificate file, which stands for the mock token,
+// until its presence differs from args.Present or args.Timeout elapses.
+func (k *EnterpriseCertSigner) WaitTokenChange(args WaitTokenChangeArgs, present *bool) error {
+	deadline := time.Now().Add(args.Timeout)
+	for {
+		_, err := os.Stat(k.certFile)
+		*present = err == nil
+		if *present != args.Present || time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Version returns a fixed version of the mock signer.
+func (k *EnterpriseCertSigner) Version(ignored struct{}, v *string) error {
+	*v = "test (features: sign-message)"
+	return nil
+}
+
+// Main serves the mock signer on stdin/stdout and exits if the test binary was
+// started as the signer of a config written by WriteConfig. Otherwise it
+// returns immediately. It must be called from TestMain before m.Run.
+func Main() {
+	certFile := os.Getenv(certFileEnv)
+	if certFile == "" {
+		return
+	}
+	if len(os.Args) == 2 && os.Args[1] == "--version" {
+		if os.Getenv(LegacyEnv) != "" {
+			fmt.Println("test (features: sign-message)")
+		} else {
+			fmt.Println("test (features: sign-message wire-json)")
+		}
+		os.Exit(0)
+	}
+	// The client passes the path of the config as the last argument.
+	config, err := config.Load(os.Args[len(os.Args)-1])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	serve(certFile, config.WireFormat)
+	os.Exit(0)
+}
+
+// WriteConfig writes a certificate config into dir whose signer is the running
+// test binary, serving the certificate and private key in the PEM file
+// certFile, and returns the path of the config.
+func WriteConfig(dir string, certFile string) (string, error) {
+	return WriteConfigWith(dir, certFile, nil)
+}
+
+// WriteConfigWith is like WriteConfig, but passes the decoded config to
+// mutate, if not nil, before writing it. The nested objects of the config,
+// such as "libs" and "cert_configs", are map[string]any.
+func WriteConfigWith(dir string, certFile string, mutate func(config map[string]any)) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	certFile, err = filepath.Abs(certFile)
+	if err != nil {
+		return "", err
+	}
+	// The signer subprocess inherits the environment of the test.
+	if err := os.Setenv(certFileEnv, certFile); err != nil {
+		return "", err
+	}
+	config := map[string]any{
+		"cert_configs": map[string]any{
+			"macos_keychain": map[string]any{"issuer": "Test Issuer"},
+		},
+		"libs": map[string]any{"ecp": exe},
+	}
+	if mutate != nil {
+		mutate(config)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	configFilePath := filepath.Join(dir, "certificate_config.json")
+	if err := os.WriteFile(configFilePath, data, 0600); err != nil {
+		return "", err
+	}
+	return configFilePath, nil
+}
+
+func serve(certFile string, wireFormat string) {
+	enterpriseCertSigner := &EnterpriseCertSigner{certFile: certFile}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		startup.Fail(startup.CodeCredential, "Error reading certificate: %v", err)
+	}
+	cert, _ := tls.X509KeyPair(data, data)
+
+	enterpriseCertSigner.cert = &cert
+
+	if err := rpc.Register(enterpriseCertSigner); err != nil {
+		log.Fatalf("Error registering net/rpc: %v", err)
+	}
+
+	// If the parent process dies, we should exit.
+	// We can detect this by periodically checking if the PID of the parent
+	// process is 1 (https://stackoverflow.com/a/2035683).
+	go func() {
+		for {
+			if os.Getppid() == 1 {
+				log.Fatalln("Parent process died, exiting...")
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+
+	startup.Ready()
+	wire.ServeConn(&Connection{os.Stdin, os.Stdout}, wireFormat)
+}
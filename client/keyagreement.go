@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyAgreementUnsupported is returned by KeyAgreement when the signer
+// binary does not implement key agreement.
+var ErrKeyAgreementUnsupported = errors.New("signer binary does not support key agreement")
+
+// KeyAgreement performs an ECDH key agreement between the credential's EC
+// private key and peer, which must be on the same curve, and returns the shared
+// secret: the big-endian X coordinate of the shared point, as used by
+// crypto/ecdh. The secret must be passed through a KDF before use, as the hpke
+// package does.
+//
+// It returns a *KeyUsageError if the certificate is not valid for key
+// agreement, ErrKeyAgreementUnsupported if the signer binary predates the
+// KeyAgreement API, and ErrPolicyDenied in deny mode.
+func (k *Key) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	done := k.startOperation(OperationKeyAgreement)
+	defer func() { done(err) }()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := k.checkPolicy(); err != nil {
+		return nil, err
+	}
+	pub, ok := k.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key agreement is only supported with EC keys, got %T", k.Public())
+	}
+	if peer == nil || peer.X == nil || peer.Y == nil || peer.Curve != pub.Curve || !peer.Curve.IsOnCurve(peer.X, peer.Y) {
+		return nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	if err := checkKeyAgreementUsage(k.leafCert()); err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+	err = k.call(keyAgreementAPI, KeyAgreementArgs{PeerPublicKey: der}, &secret)
+	if isMethodNotFound(err) {
+		return nil, ErrKeyAgreementUnsupported
+	}
+	return
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/hpke"
+)
+
+// writeECCred writes a self-signed P-256 certificate with the given key usage
+// and its private key to a PEM file for the mock signer.
+func writeECCred(t *testing.T, usage x509.KeyUsage) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "key agreement"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     usage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	certFile := filepath.Join(t.TempDir(), "ecdh.pem")
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return priv, certFile
+}
+
+func TestClient_KeyAgreement(t *testing.T) {
+	priv, certFile := writeECCred(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement)
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", certFile)
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := key.KeyAgreement(&peer.PublicKey)
+	if err != nil {
+		t.Fatalf("KeyAgreement: got %v, want nil err", err)
+	}
+	x, _ := elliptic.P256().ScalarMult(priv.X, priv.Y, peer.D.Bytes())
+	if want := x.FillBytes(make([]byte, 32)); !bytes.Equal(secret, want) {
+		t.Errorf("KeyAgreement: got %x, want %x", secret, want)
+	}
+
+	// The key seals HPKE messages that the peer opens, authenticated with the
+	// public key of the certificate.
+	enc, ciphertext, err := hpke.Seal(key, &peer.PublicKey, nil, nil, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("hpke.Seal: got %v, want nil err", err)
+	}
+	if _, err := hpke.Open(hpke.PrivateKey{PrivateKey: peer}, &priv.PublicKey, enc, nil, nil, ciphertext); err != nil {
+		t.Errorf("hpke.Open: got %v, want nil err", err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.KeyAgreement(&other.PublicKey); err == nil {
+		t.Error("KeyAgreement with a P-384 peer: got nil err, want error")
+	}
+}
+
+func TestClient_KeyAgreementUsage(t *testing.T) {
+	_, certFile := writeECCred(t, x509.KeyUsageDigitalSignature)
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", certFile)
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usageErr *KeyUsageError
+	if _, err := key.KeyAgreement(&peer.PublicKey); !errors.As(err, &usageErr) {
+		t.Errorf("KeyAgreement: got %v, want *KeyUsageError", err)
+	}
+}
+
+func TestClient_KeyAgreementRSAKey(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := key.KeyAgreement(&peer.PublicKey); err == nil {
+		t.Error("KeyAgreement with an RSA key: got nil err, want error")
+	}
+}
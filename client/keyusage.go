@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// KeyUsageError is returned by Sign, Decrypt and KeyAgreement when the key
+// usage extensions of the leaf certificate do not permit the operation.
+type KeyUsageError struct {
+	Operation string // The rejected operation, "sign", "decrypt" or "key agreement".
+	Reason    string // The missing key usage.
+}
+
+func (e *KeyUsageError) Error() string {
+	return fmt.Sprintf("certificate does not permit %s: %s", e.Operation, e.Reason)
+}
+
+// checkSignUsage verifies that leaf may be used for TLS client authentication
+// signatures. Certificates without a KeyUsage or ExtKeyUsage extension are not
+// restricted.
+func checkSignUsage(leaf *x509.Certificate) error {
+	if leaf == nil {
+		return nil
+	}
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return &KeyUsageError{Operation: "sign", Reason: "missing digitalSignature key usage"}
+	}
+	if len(leaf.ExtKeyUsage) == 0 && len(leaf.UnknownExtKeyUsage) == 0 {
+		return nil
+	}
+	for _, usage := range leaf.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageClientAuth || usage == x509.ExtKeyUsageAny {
+			return nil
+		}
+	}
+	return &KeyUsageError{Operation: "sign", Reason: "missing clientAuth extended key usage"}
+}
+
+// checkDecryptUsage verifies that leaf may be used for decryption.
+// Certificates without a KeyUsage extension are not restricted.
+func checkDecryptUsage(leaf *x509.Certificate) error {
+	if leaf == nil || leaf.KeyUsage == 0 {
+		return nil
+	}
+	if leaf.KeyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) == 0 {
+		return &KeyUsageError{Operation: "decrypt", Reason: "missing keyEncipherment or dataEncipherment key usage"}
+	}
+	return nil
+}
+
+// checkKeyAgreementUsage verifies that leaf may be used for key agreement.
+// Certificates without a KeyUsage extension are not restricted.
+func checkKeyAgreementUsage(leaf *x509.Certificate) error {
+	if leaf == nil || leaf.KeyUsage == 0 {
+		return nil
+	}
+	if leaf.KeyUsage&x509.KeyUsageKeyAgreement == 0 {
+		return &KeyUsageError{Operation: "key agreement", Reason: "missing keyAgreement key usage"}
+	}
+	return nil
+}
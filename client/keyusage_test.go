@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func TestCheckSignUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{name: "unrestricted", cert: &x509.Certificate{}},
+		{name: "digital signature", cert: &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}},
+		{name: "encryption only", cert: &x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment}, wantErr: true},
+		{name: "client auth", cert: &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}},
+		{name: "any", cert: &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}},
+		{name: "email only", cert: &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}, wantErr: true},
+	}
+	for _, test := range tests {
+		err := checkSignUsage(test.cert)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: checkSignUsage() got err %v, want err %v", test.name, err, test.wantErr)
+		}
+		var usageErr *KeyUsageError
+		if err != nil && !errors.As(err, &usageErr) {
+			t.Errorf("%s: checkSignUsage() got err of type %T, want *KeyUsageError", test.name, err)
+		}
+	}
+}
+
+func TestCheckDecryptUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{name: "unrestricted", cert: &x509.Certificate{}},
+		{name: "key encipherment", cert: &x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment}},
+		{name: "data encipherment", cert: &x509.Certificate{KeyUsage: x509.KeyUsageDataEncipherment}},
+		{name: "signature only", cert: &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := checkDecryptUsage(test.cert); (err != nil) != test.wantErr {
+			t.Errorf("%s: checkDecryptUsage() got err %v, want err %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestCheckKeyAgreementUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		wantErr bool
+	}{
+		{name: "unrestricted", cert: &x509.Certificate{}},
+		{name: "key agreement", cert: &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement}},
+		{name: "signature only", cert: &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := checkKeyAgreementUsage(test.cert); (err != nil) != test.wantErr {
+			t.Errorf("%s: checkKeyAgreementUsage() got err %v, want err %v", test.name, err, test.wantErr)
+		}
+	}
+}
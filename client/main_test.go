@@ -0,0 +1,44 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/internal/testsigner"
+)
+
+// testCertFile is the PEM file of the certificate and key served by the mock
+// signer.
+const testCertFile = "testdata/testcert.pem"
+
+// testConfig is the path of a certificate config using the mock signer.
+var testConfig string
+
+func TestMain(m *testing.M) {
+	testsigner.Main()
+	dir, err := os.MkdirTemp("", "client_test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	testConfig, err = testsigner.WriteConfig(dir, testCertFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
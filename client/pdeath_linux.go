@@ -0,0 +1,40 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureParentDeath asks the kernel to kill the signer subprocess when the
+// thread that started it exits (PR_SET_PDEATHSIG). Unlike polling for a parent
+// PID of 1, this also works inside containers where orphans are reparented to
+// an init shim. The caller locks its goroutine to its thread while starting
+// cmd.
+func configureParentDeath(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
+
+// bindToParent is a no-op on Linux; the parent death signal is set up before
+// the subprocess starts.
+func bindToParent(cmd *exec.Cmd) error {
+	return nil
+}
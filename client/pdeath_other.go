@@ -0,0 +1,28 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package client
+
+import "os/exec"
+
+// configureParentDeath is a no-op on this platform. The signer watches its
+// parent process itself (e.g. with kqueue on macOS).
+func configureParentDeath(cmd *exec.Cmd) {}
+
+// bindToParent is a no-op on this platform.
+func bindToParent(cmd *exec.Cmd) error {
+	return nil
+}
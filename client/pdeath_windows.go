@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package client
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	jobOnce sync.Once
+	job     windows.Handle
+	jobErr  error
+)
+
+// signerJob returns a Job Object that kills all of its processes when its last
+// handle is closed. The handle is intentionally never closed, so that the
+// operating system closes it, and kills the signers, when this process exits.
+func signerJob() (windows.Handle, error) {
+	jobOnce.Do(func() {
+		job, jobErr = windows.CreateJobObject(nil, nil)
+		if jobErr != nil {
+			return
+		}
+		info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+			BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+				LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+			},
+		}
+		if _, jobErr = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); jobErr != nil {
+			windows.CloseHandle(job)
+		}
+	})
+	return job, jobErr
+}
+
+// configureParentDeath is a no-op on Windows; the subprocess is bound to the
+// parent by bindToParent once it has started.
+func configureParentDeath(cmd *exec.Cmd) {}
+
+// bindToParent assigns the signer subprocess to a kill-on-close Job Object so
+// that it is terminated when the client process exits, even abnormally.
+func bindToParent(cmd *exec.Cmd) error {
+	job, err := signerJob()
+	if err != nil {
+		return fmt.Errorf("creating job object: %w", err)
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		return fmt.Errorf("opening signer process: %w", err)
+	}
+	defer windows.CloseHandle(process)
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		return fmt.Errorf("assigning signer process to job object: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+)
+
+const pingAPI = "EnterpriseCertSigner.Ping"
+
+// ErrTokenUnavailable is wrapped by the error returned by Ping when the signer
+// is running but cannot use the key, for instance because the smart card or
+// token holding it has been removed.
+var ErrTokenUnavailable = errors.New("the token holding the key is unavailable")
+
+// Ping checks that the signer subprocess is alive and that the token holding
+// the key, if any, is still present. Long-lived servers can call it before
+// latency-sensitive handshakes, and call RefreshCertificateChain once a
+// removed token is back. Ping returns ctx.Err() if ctx is done first. Signers
+// of keystores without removable tokens only check that they are alive.
+func (k *Key) Ping(ctx context.Context) error {
+	if err := k.checkOpen(); err != nil {
+		return err
+	}
+	p, release := k.acquire()
+	defer release()
+	err := callContext(ctx, p.client, pingAPI, struct{}{}, &struct{}{})
+	if isMethodNotFound(err) {
+		// Older signer binaries do not implement the Ping API, but answering
+		// shows that they are alive.
+		var v string
+		err = callContext(ctx, p.client, versionAPI, struct{}{}, &v)
+		if isMethodNotFound(err) {
+			err = nil
+		}
+	}
+	var serverErr rpc.ServerError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ctx.Err()):
+		return err
+	case errors.As(err, &serverErr):
+		return fmt.Errorf("%w: %v", ErrTokenUnavailable, err)
+	default:
+		return fmt.Errorf("enterprise cert signer is not responding: %w", err)
+	}
+}
+
+// callContext calls method on client like client.Call, but returns ctx.Err()
+// as soon as ctx is done. The call then completes in the background.
+func callContext(ctx context.Context, client *rpc.Client, method string, args any, reply any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		return call.Error
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClient_Ping(t *testing.T) {
+	// The mock signer reports the token as removed when its certificate file
+	// is gone.
+	data, err := os.ReadFile("testdata/testcert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), "testcert.pem")
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", certFile)
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	if err := key.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := key.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping with canceled context: got %v, want %v", err, context.Canceled)
+	}
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Ping(context.Background()); !errors.Is(err, ErrTokenUnavailable) {
+		t.Errorf("Ping after removing the token: got %v, want %v", err, ErrTokenUnavailable)
+	}
+	key.close()
+	if err := key.Ping(context.Background()); err == nil || errors.Is(err, ErrTokenUnavailable) {
+		t.Errorf("Ping after killing the signer: got %v, want an error that the signer is not responding", err)
+	}
+	key.Close()
+	if err := key.Ping(context.Background()); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Ping after Close: got %v, want %v", err, ErrKeyClosed)
+	}
+}
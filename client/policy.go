@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"os"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+// ErrPolicyDenied is returned by the private key operations of a Key when use
+// of the enterprise certificate is administratively disabled, with the
+// deny_signing field of the config or the DENY_ENTERPRISE_CERTIFICATE_SIGNING
+// environment variable. Applications are expected to fall back to connecting
+// without mTLS.
+var ErrPolicyDenied = errors.New("use of the enterprise certificate is administratively disabled")
+
+// denySigningEnv is the environment variable that enables deny mode, like the
+// deny_signing field of the config.
+const denySigningEnv = "DENY_ENTERPRISE_CERTIFICATE_SIGNING"
+
+// denySigning reports whether deny mode is enabled for config.
+func denySigning(config config.EnterpriseCertificateConfig) bool {
+	return config.DenySigning || os.Getenv(denySigningEnv) != ""
+}
+
+// checkPolicy returns ErrPolicyDenied if private key operations of k are
+// denied.
+func (k *Key) checkPolicy() error {
+	if k.deny {
+		return ErrPolicyDenied
+	}
+	return nil
+}
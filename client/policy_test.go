@@ -0,0 +1,51 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestClient_DenySigning(t *testing.T) {
+	t.Setenv(denySigningEnv, "1")
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	if key.CertificateChain() == nil || key.Public() == nil {
+		t.Error("Cred: got a Key without certificate chain or public key, want a functioning Key")
+	}
+	if _, err := key.Sign(nil, make([]byte, 32), crypto.SHA256); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Sign: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := key.SignMessage([]byte("message"), crypto.SHA256); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("SignMessage: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := key.Decrypt(nil, []byte("ciphertext"), &rsa.OAEPOptions{Hash: crypto.SHA256}); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Decrypt: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := key.WrapKey([]byte("0123456789abcdef"), crypto.SHA256); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("WrapKey: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := key.UnwrapKey([]byte("wrapped"), crypto.SHA256); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("UnwrapKey: got %v, want ErrPolicyDenied", err)
+	}
+	if _, err := key.Encrypt(nil, []byte("plaintext"), crypto.SHA256); err != nil {
+		t.Errorf("Encrypt: got %v, want nil err", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/version"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+)
+
+// recycleRetryInterval is the time after which replacing a signer subprocess
+// is attempted again when starting its replacement failed.
+const recycleRetryInterval = time.Minute
+
+const shutdownAPI = "EnterpriseCertSigner.Shutdown"
+
+// shutdownTimeout bounds the time given to a signer subprocess to release its
+// credential and exit once it is stopped, after which it is killed.
+var shutdownTimeout = 5 * time.Second
+
+// signerProcess is a running signer subprocess and the RPC client connected to
+// it.
+type signerProcess struct {
+	cmd       *exec.Cmd     // Pointer to the signer subprocess.
+	client    *rpc.Client   // Pointer to the rpc client that communicates with the signer subprocess.
+	stdin     io.Closer     // The standard input of the subprocess, closed to make it exit.
+	stderr    *stderrFilter // Filter of the standard error of the subprocess.
+	started   time.Time     // Time the subprocess was started.
+	ops       atomic.Int64  // Number of private key operations sent to the subprocess.
+	replacing atomic.Bool   // Whether a replacement of the subprocess is being started.
+	mu        sync.RWMutex  // Held for reading by calls in flight, and for writing once the subprocess is being drained.
+	stopped   bool          // Whether the subprocess was drained to be stopped, guarded by mu.
+}
+
+// signerLauncher starts signer subprocesses serving a config.
+type signerLauncher struct {
+	path           string         // Path of the signer binary.
+	configFilePath string         // Path of the config file passed to the signer.
+	sandbox        config.Sandbox // Restrictions applied to the signer subprocess.
+	wireFormat     string         // Encoding of the RPC messages.
+}
+
+// checkWireFormat returns an error if the signer binary cannot use the wire
+// format of the config. A signer predating the json format would answer in
+// gob, so its support is checked in the features printed by --version first.
+func (l signerLauncher) checkWireFormat() error {
+	if l.wireFormat != wire.FormatJSON {
+		return nil
+	}
+	out, err := exec.Command(l.path, "--version").Output()
+	if err != nil || !version.HasFeature(strings.TrimSpace(string(out)), version.FeatureWireJSON) {
+		return fmt.Errorf("signer binary %s does not support the %q wire format", l.path, wire.FormatJSON)
+	}
+	return nil
+}
+
+// start spawns the signer binary. If selected is not empty, the signer
+// replaces one that served the certificate with this fingerprint, and serves
+// it again without asking the user to choose it, or to confirm its use.
+func (l signerLauncher) start(selected string) (*signerProcess, error) {
+	cmd, err := signerCommand(l.path, l.configFilePath, l.sandbox)
+	if err != nil {
+		return nil, err
+	}
+	if selected != "" {
+		cmd.Env = append(cmd.Env, startup.SelectedEnv+"="+selected)
+	}
+	p := &signerProcess{cmd: cmd}
+
+	// Redirect errors from subprocess to parent process, where the signer
+	// reports its startup status.
+	p.stderr = &stderrFilter{out: os.Stderr}
+	p.cmd.Stderr = p.stderr
+
+	// Make sure the subprocess does not outlive this process.
+	configureParentDeath(p.cmd)
+
+	// RPC client will communicate with subprocess over stdin/stdout.
+	kin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	kout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdin = kin
+	p.client = wire.NewClient(&Connection{kout, kin}, l.wireFormat)
+
+	// The parent death signal of Linux is sent when the thread that started
+	// the subprocess exits, rather than this process. Keep the goroutine on
+	// one thread while the subprocess is started, so that the signal is tied
+	// to that thread, which the runtime keeps running.
+	runtime.LockOSThread()
+	err = p.cmd.Start()
+	runtime.UnlockOSThread()
+	if err != nil {
+		return nil, fmt.Errorf("starting enterprise cert signer subprocess: %w", err)
+	}
+	if err := bindToParent(p.cmd); err != nil {
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+		return nil, fmt.Errorf("binding enterprise cert signer subprocess to parent: %w", err)
+	}
+	p.started = time.Now()
+	return p, nil
+}
+
+// stop asks the signer subprocess to release its credential, such as its
+// PKCS#11 session, with the Shutdown API, and closes its standard input so that
+// it exits. The subprocess is killed if it has not exited within
+// shutdownTimeout of the Shutdown call, or if it predates the Shutdown API.
+func (p *signerProcess) stop() error {
+	deadline := time.NewTimer(shutdownTimeout)
+	defer deadline.Stop()
+	call := p.client.Go(shutdownAPI, struct{}{}, &struct{}{}, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+	case <-deadline.C:
+		return p.kill()
+	}
+	if call.Error != nil {
+		if !isMethodNotFound(call.Error) {
+			log.Printf("Failed to shut down the enterprise cert signer: %v", call.Error)
+		}
+		return p.kill()
+	}
+	// The signer stops serving, and exits, at the end of its standard input.
+	_ = p.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		_ = p.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-deadline.C:
+		_ = p.cmd.Process.Kill()
+		<-exited
+	}
+	if err := p.client.Close(); err != nil && err.Error() != "close |0: file already closed" {
+		return fmt.Errorf("failed to close RPC connection: %w", err)
+	}
+	return nil
+}
+
+// kill kills the signer subprocess and closes the RPC connection.
+func (p *signerProcess) kill() error {
+	// The subprocess has exited already if it failed to start, and must still
+	// be waited on.
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill signer process: %w", err)
+	}
+	// Wait for cmd to exit and release resources. Since the process is forcefully killed, this
+	// will return a non-nil error (varies by OS), which we will ignore.
+	_ = p.cmd.Wait()
+	// The Pipes connecting the RPC client should have been closed when the signer subprocess was killed.
+	// Calling `p.client.Close()` before `p.cmd.Process.Kill()` or `p.cmd.Wait()` _will_ cause a segfault.
+	if err := p.client.Close(); err != nil && err.Error() != "close |0: file already closed" {
+		return fmt.Errorf("failed to close RPC connection: %w", err)
+	}
+	return nil
+}
+
+// acquire returns the running signer subprocess of k, which is not drained
+// until release is called. While a subprocess is drained to be replaced,
+// acquire waits for k to switch to the replacement.
+func (k *Key) acquire() (p *signerProcess, release func()) {
+	for {
+		p = k.current()
+		p.mu.RLock()
+		// A stopped subprocess that was not replaced is the one of a closed
+		// Key, on which calls fail.
+		if !p.stopped || p == k.current() {
+			return p, p.mu.RUnlock
+		}
+		p.mu.RUnlock()
+	}
+}
+
+// current returns the signer subprocess that k currently uses.
+func (k *Key) current() *signerProcess {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.proc
+}
+
+// invoke calls method on the running signer subprocess of k.
+func (k *Key) invoke(method string, args any, reply any) error {
+	p, release := k.acquire()
+	defer release()
+	return p.client.Call(method, args, reply)
+}
+
+// recyclePolicy describes when a signer subprocess is replaced.
+type recyclePolicy struct {
+	maxOperations int64         // Number of private key operations, or 0 for no limit.
+	maxLifetime   time.Duration // Age of the subprocess, or 0 for no limit.
+}
+
+// newRecyclePolicy returns the recycle policy configured by policy.
+func newRecyclePolicy(policy config.Recycle) recyclePolicy {
+	var r recyclePolicy
+	if policy.MaxOperations > 0 {
+		r.maxOperations = int64(policy.MaxOperations)
+	}
+	// The duration has already been validated when loading the config.
+	r.maxLifetime, _ = time.ParseDuration(policy.MaxLifetime)
+	return r
+}
+
+// due reports whether p should be replaced after it served ops operations.
+func (r recyclePolicy) due(p *signerProcess, ops int64) bool {
+	return (r.maxOperations > 0 && ops >= r.maxOperations) || (r.maxLifetime > 0 && time.Since(p.started) >= r.maxLifetime)
+}
+
+// countOperation counts a private key operation sent to p, and starts
+// replacing p in the background if it is due for recycling. The lifetime of
+// p is only checked when it serves an operation.
+func (k *Key) countOperation(p *signerProcess) {
+	if !k.recycle.due(p, p.ops.Add(1)) || !p.replacing.CompareAndSwap(false, true) {
+		return
+	}
+	go k.replace(p)
+}
+
+// replace starts a replacement of the signer subprocess old, waits for the
+// calls in flight on old to complete, switches k to the replacement, and stops
+// old. The replacement serves the certificate of old, so the user is not asked
+// to choose it again. If the replacement does not yield a credential, old is
+// kept.
+func (k *Key) replace(old *signerProcess) {
+	k.mu.RLock()
+	selected := k.metadata.Fingerprint
+	k.mu.RUnlock()
+	p, err := k.launcher.start(selected)
+	var cred *credential
+	var metadata Metadata
+	if err == nil {
+		if cred, metadata, err = k.load(p); err != nil {
+			p.kill()
+			err = p.stderr.startupError(err)
+		}
+	}
+	signerStarted(k.backend, err)
+	if err != nil {
+		log.Printf("Failed to start a replacement of the enterprise cert signer, retrying in %v: %v", recycleRetryInterval, err)
+		time.AfterFunc(recycleRetryInterval, func() { old.replacing.Store(false) })
+		return
+	}
+
+	// Drain old before switching, so that no operation on old completes
+	// after k reports the credential of p. Calls that acquire old meanwhile
+	// wait, and are then sent to p.
+	old.mu.Lock()
+	k.mu.Lock()
+	if k.closed.Load() {
+		k.mu.Unlock()
+		old.mu.Unlock()
+		p.kill()
+		return
+	}
+	k.proc = p
+	k.metadata = metadata
+	k.setCredentialLocked(cred)
+	k.mu.Unlock()
+	old.stopped = true
+	defer old.mu.Unlock()
+	if err := old.stop(); err != nil {
+		log.Printf("Failed to stop the replaced enterprise cert signer: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/internal/testsigner"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+func TestClient_Recycle(t *testing.T) {
+	configFilePath, err := testsigner.WriteConfigWith(t.TempDir(), testCertFile, func(cfg map[string]any) {
+		cfg["recycle"] = map[string]any{"max_operations": 2}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := Cred(configFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	first, _ := key.acquire()
+	first.mu.RUnlock()
+
+	digest := make([]byte, crypto.SHA256.Size())
+	for i := 0; i < 2; i++ {
+		if _, err := key.Sign(nil, digest, crypto.SHA256); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+	}
+	// The signer is replaced in the background.
+	deadline := time.Now().Add(10 * time.Second)
+	var p *signerProcess
+	for {
+		var release func()
+		p, release = key.acquire()
+		release()
+		if p != first {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("signer was not replaced after reaching max_operations")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := key.Sign(nil, digest, crypto.SHA256); err != nil {
+		t.Fatalf("Sign after recycling: %v", err)
+	}
+	// The replacement is asked to serve the certificate of the replaced signer.
+	selected := startup.SelectedEnv + "=" + key.Metadata().Fingerprint
+	if env := p.cmd.Env; len(env) == 0 || env[len(env)-1] != selected {
+		t.Errorf("replacement signer environment: got %q, want it to end with %q", env, selected)
+	}
+	if key.CertificateChain() == nil {
+		t.Error("CertificateChain: got nil after recycling, want the certificate chain")
+	}
+	// The replaced signer is killed once drained.
+	first.mu.RLock()
+	defer first.mu.RUnlock()
+	if first.cmd.ProcessState == nil {
+		t.Error("replaced signer subprocess was not stopped")
+	}
+}
+
+func TestSignerProcess_KillExited(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The signer exits at startup, since it cannot load its config.
+	l := signerLauncher{path: exe, configFilePath: filepath.Join(t.TempDir(), "missing.json")}
+	p, err := l.start("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain [][]byte
+	if err := p.client.Call(certificateChainAPI, struct{}{}, &chain); err == nil {
+		t.Fatal("CertificateChain: got nil err from a signer that failed to start")
+	}
+	if err := p.kill(); err != nil {
+		t.Errorf("kill: got %v, want nil err", err)
+	}
+	if p.cmd.ProcessState == nil {
+		t.Error("kill: the signer was not waited on")
+	}
+}
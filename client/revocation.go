@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/revocation"
+)
+
+// ErrCertificateRevoked is returned by Cred when the config enforces revocation
+// checking and the issuer of the leaf certificate reports it as revoked.
+var ErrCertificateRevoked = errors.New("enterprise certificate has been revoked")
+
+const defaultRevocationTimeout = 10 * time.Second
+
+// checkRevocation checks the revocation status of the leaf of certs according
+// to policy. Only a certificate positively reported as revoked fails the check;
+// an unavailable OCSP responder or CRL is logged and tolerated.
+func checkRevocation(certs []*x509.Certificate, policy config.Revocation) error {
+	if policy.Mode == "" || policy.Mode == config.RevocationOff || len(certs) == 0 {
+		return nil
+	}
+	if len(certs) < 2 {
+		log.Printf("Skipping revocation check: the certificate chain does not include the issuer of the leaf")
+		return nil
+	}
+	timeout := defaultRevocationTimeout
+	if policy.Timeout != "" {
+		// The timeout has already been validated when loading the config.
+		timeout, _ = time.ParseDuration(policy.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	status, err := revocation.Check(ctx, nil, certs[0], certs[1])
+	switch {
+	case err != nil:
+		log.Printf("Could not check revocation status of enterprise certificate: %v", err)
+	case status == revocation.Revoked && policy.Mode == config.RevocationEnforce:
+		return ErrCertificateRevoked
+	case status == revocation.Revoked:
+		log.Printf("Enterprise certificate %q has been revoked by its issuer", certs[0].Subject)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+func TestCheckRevocation(t *testing.T) {
+	ca := issue(t, "root", true, nil)
+	var crl []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(crl)
+	}))
+	defer server.Close()
+	leaf := issue(t, "leaf", false, ca, server.URL)
+
+	var err error
+	crl, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{SerialNumber: leaf.cert.SerialNumber, RevocationTime: time.Now().Add(-time.Minute)},
+		},
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := []*x509.Certificate{leaf.cert, ca.cert}
+	tests := []struct {
+		mode string
+		want error
+	}{
+		{mode: "", want: nil},
+		{mode: config.RevocationOff, want: nil},
+		{mode: config.RevocationWarn, want: nil},
+		{mode: config.RevocationEnforce, want: ErrCertificateRevoked},
+	}
+	for _, test := range tests {
+		if got := checkRevocation(chain, config.Revocation{Mode: test.mode}); !errors.Is(got, test.want) {
+			t.Errorf("checkRevocation with mode %q: got err %v, want %v", test.mode, got, test.want)
+		}
+	}
+	// Without the issuer in the chain the check is skipped.
+	if got := checkRevocation(chain[:1], config.Revocation{Mode: config.RevocationEnforce}); got != nil {
+		t.Errorf("checkRevocation without issuer: got err %v, want nil", got)
+	}
+}
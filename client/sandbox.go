@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+// sandboxExecPath is the MacOS tool that confines the signer to a sandbox
+// profile.
+const sandboxExecPath = "/usr/bin/sandbox-exec"
+
+// signerEnvAllowlist are the environment variables passed to a signer started
+// with a restricted environment, besides the configured ones. They are read by
+// the signers, or needed by the OS to load the keystore libraries.
+var signerEnvAllowlist = []string{
+	"ENABLE_ENTERPRISE_CERTIFICATE_LOGS",
+	startup.SystemLogEnv,
+	"HOME",
+	"TMPDIR",
+	// Windows.
+	"SystemRoot",
+	"USERPROFILE",
+	"TEMP",
+	"TMP",
+}
+
+// signerCommand returns the command that starts the signer binary at path
+// with configFilePath, restricted as configured by sandbox.
+func signerCommand(path, configFilePath string, sandbox config.Sandbox) (*exec.Cmd, error) {
+	if sandbox.WorkingDir != "" {
+		// Relative paths would be resolved against the working directory of
+		// the signer instead.
+		var err error
+		if path, err = absCommandPath(path); err != nil {
+			return nil, err
+		}
+		if configFilePath, err = filepath.Abs(configFilePath); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{path, configFilePath}
+	switch {
+	case sandbox.Profile != "":
+		if runtime.GOOS != "darwin" {
+			return nil, errors.New("sandbox profiles are only supported on MacOS, use a sandbox launcher instead")
+		}
+		args = append([]string{sandboxExecPath, "-f", sandbox.Profile}, args...)
+	case len(sandbox.Launcher) > 0:
+		args = append(append([]string(nil), sandbox.Launcher...), args...)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = sandbox.WorkingDir
+	cmd.Env = signerEnv(os.Environ(), sandbox)
+	return cmd, nil
+}
+
+// absCommandPath makes path absolute unless it is a bare command name that is
+// looked up in PATH.
+func absCommandPath(path string) (string, error) {
+	if !strings.ContainsRune(path, filepath.Separator) && !strings.ContainsRune(path, '/') {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// signerEnv returns the environment of the signer, given the environment of
+// the client, and asks the signer to report its startup status on stderr.
+func signerEnv(environ []string, sandbox config.Sandbox) []string {
+	var env []string
+	if !sandbox.RestrictEnv {
+		env = append(env, environ...)
+	} else {
+		allowed := append(append([]string(nil), signerEnvAllowlist...), sandbox.Env...)
+		for _, kv := range environ {
+			name, _, _ := strings.Cut(kv, "=")
+			if envAllowed(name, allowed) {
+				env = append(env, kv)
+			}
+		}
+	}
+	return append(env, startup.StatusEnv+"=stderr")
+}
+
+// envAllowed reports whether the environment variable name is in allowed.
+// Names are case-insensitive on Windows.
+func envAllowed(name string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == name || (runtime.GOOS == "windows" && strings.EqualFold(a, name)) {
+			return true
+		}
+	}
+	return false
+}
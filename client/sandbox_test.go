@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/internal/testsigner"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+func TestSignerEnv(t *testing.T) {
+	environ := []string{"HOME=/home/user", "SECRET=hunter2", "PKCS11_PROXY_SOCKET=tcp://localhost", "ENABLE_ENTERPRISE_CERTIFICATE_LOGS=1"}
+	status := startup.StatusEnv + "=stderr"
+	tests := []struct {
+		name    string
+		sandbox config.Sandbox
+		want    []string
+	}{
+		{
+			name: "inherited",
+			want: append(append([]string(nil), environ...), status),
+		},
+		{
+			name:    "restricted",
+			sandbox: config.Sandbox{RestrictEnv: true},
+			want:    []string{"HOME=/home/user", "ENABLE_ENTERPRISE_CERTIFICATE_LOGS=1", status},
+		},
+		{
+			name:    "restricted with allowlist",
+			sandbox: config.Sandbox{RestrictEnv: true, Env: []string{"PKCS11_PROXY_SOCKET"}},
+			want:    []string{"HOME=/home/user", "PKCS11_PROXY_SOCKET=tcp://localhost", "ENABLE_ENTERPRISE_CERTIFICATE_LOGS=1", status},
+		},
+	}
+	for _, test := range tests {
+		if got := signerEnv(environ, test.sandbox); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: signerEnv() got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSignerCommand(t *testing.T) {
+	dir := t.TempDir()
+	cmd, err := signerCommand(filepath.Join("bin", "ecp"), "config.json", config.Sandbox{
+		WorkingDir: dir,
+		Launcher:   []string{"firejail", "--seccomp"},
+	})
+	if err != nil {
+		t.Fatalf("signerCommand: got %v, want nil err", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"firejail", "--seccomp", filepath.Join(wd, "bin", "ecp"), filepath.Join(wd, "config.json")}
+	if !reflect.DeepEqual(cmd.Args, want) || cmd.Dir != dir {
+		t.Errorf("signerCommand: got args %q in %q, want %q in %q", cmd.Args, cmd.Dir, want, dir)
+	}
+
+	_, err = signerCommand("ecp", "config.json", config.Sandbox{Profile: "signer.sb"})
+	if gotErr, wantErr := err != nil, runtime.GOOS != "darwin"; gotErr != wantErr {
+		t.Errorf("signerCommand with profile: got err %v, want err %v", err, wantErr)
+	}
+}
+
+func TestClient_Cred_Sandbox(t *testing.T) {
+	configFilePath, err := testsigner.WriteConfigWith(t.TempDir(), testCertFile, func(cfg map[string]any) {
+		// The mock signer is only served while its certificate file is passed.
+		cfg["libs"].(map[string]any)["sandbox"] = map[string]any{
+			"restrict_env": true,
+			"env":          []string{"ECP_TESTSIGNER_CERT_FILE"},
+			"working_dir":  t.TempDir(),
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := Cred(configFilePath)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	if key.CertificateChain() == nil {
+		t.Error("Cred: got no certificate chain")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+// StartupError is returned by Cred when the signer reports that it failed to
+// start, for example because the keystore did not yield a credential.
+type StartupError struct {
+	Code    string // The error code reported by the signer, such as "credential_unavailable".
+	Message string // The description of the failure reported by the signer.
+	Err     error  // The error observed by the client, typically an unexpected EOF.
+}
+
+func (e *StartupError) Error() string {
+	return fmt.Sprintf("enterprise cert signer failed to start (%s): %s", e.Code, e.Message)
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// stderrFilter forwards the standard error of the signer to out, except for
+// the startup status record, which it keeps. Partial lines that cannot be the
+// status record, such as prompts, are forwarded without waiting for the end of
+// the line.
+type stderrFilter struct {
+	out io.Writer
+
+	mu          sync.Mutex
+	line        []byte // The start of a line that may be the status record.
+	passthrough bool   // Whether the rest of the current line is forwarded.
+	record      *startup.Record
+}
+
+func (f *stderrFilter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			chunk = p[:i+1]
+		}
+		p = p[len(chunk):]
+		complete := chunk[len(chunk)-1] == '\n'
+		if f.passthrough {
+			f.out.Write(chunk)
+			f.passthrough = !complete
+			continue
+		}
+		f.line = append(f.line, chunk...)
+		if !mayBeRecord(f.line) {
+			f.out.Write(f.line)
+			f.line = f.line[:0]
+			f.passthrough = !complete
+			continue
+		}
+		if complete {
+			if record, ok := startup.Parse(strings.TrimRight(string(f.line), "\r\n")); ok {
+				f.record = &record
+			} else {
+				f.out.Write(f.line)
+			}
+			f.line = f.line[:0]
+		}
+	}
+	return n, nil
+}
+
+// mayBeRecord reports whether line may be, or be the start of, a status
+// record.
+func mayBeRecord(line []byte) bool {
+	if len(line) <= len(startup.Prefix) {
+		return strings.HasPrefix(startup.Prefix, string(line))
+	}
+	return bytes.HasPrefix(line, []byte(startup.Prefix))
+}
+
+// startupError returns a StartupError wrapping err if the signer reported that
+// it failed to start, and err otherwise. It must be called after the signer
+// has exited.
+func (f *stderrFilter) startupError(err error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.record == nil || f.record.Status != startup.StatusError {
+		return err
+	}
+	return &StartupError{Code: f.record.Code, Message: f.record.Message, Err: err}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+func TestStderrFilter(t *testing.T) {
+	var out bytes.Buffer
+	f := &stderrFilter{out: &out}
+	for _, chunk := range []string{
+		"log line\n",
+		"Enter PIN: ",
+		"1234\nECP_STA",
+		`TUS {"status":"error","code":"credential_unavailable","message":"no identity"}` + "\n",
+		"ECP_STATUS not json\n",
+	} {
+		if _, err := f.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := out.String(), "log line\nEnter PIN: 1234\nECP_STATUS not json\n"; got != want {
+		t.Errorf("stderrFilter: got output %q, want %q", got, want)
+	}
+	cause := io.ErrUnexpectedEOF
+	var startupErr *StartupError
+	if err := f.startupError(cause); !errors.As(err, &startupErr) || !errors.Is(err, cause) {
+		t.Fatalf("startupError: got %v, want StartupError wrapping %v", err, cause)
+	}
+	if startupErr.Code != startup.CodeCredential || startupErr.Message != "no identity" {
+		t.Errorf("startupError: got %+v, want the reported code and message", startupErr)
+	}
+	if err := (&stderrFilter{out: io.Discard}).startupError(cause); err != cause {
+		t.Errorf("startupError: got %v, want %v without a status record", err, cause)
+	}
+}
+
+func TestClient_Cred_StartupError(t *testing.T) {
+	// The mock signer fails to start when its certificate is missing.
+	t.Setenv("ECP_TESTSIGNER_CERT_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	_, err := Cred(testConfig)
+	var startupErr *StartupError
+	if !errors.As(err, &startupErr) {
+		t.Fatalf("Cred: got %v, want StartupError", err)
+	}
+	if startupErr.Code != startup.CodeCredential {
+		t.Errorf("Cred: got code %q, want %q", startupErr.Code, startup.CodeCredential)
+	}
+}
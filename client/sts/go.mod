@@ -0,0 +1,19 @@
+module github.com/googleapis/enterprise-certificate-proxy/client/sts
+
+go 1.19
+
+require (
+	github.com/googleapis/enterprise-certificate-proxy v0.0.0-00010101000000-000000000000
+	golang.org/x/oauth2 v0.15.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/crypto v0.16.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
+
+replace github.com/googleapis/enterprise-certificate-proxy => ../..
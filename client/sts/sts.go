@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sts exchanges the certificate of an ECP Key for Google Cloud access
+// tokens with workload identity federation, and calls Google APIs with them.
+//
+// The exchange is made over mTLS with the Key, and the tokens are bound to its
+// certificate, so they are only accepted on mTLS connections presenting the
+// same certificate. NewClient returns an HTTP client doing both.
+package sts
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultEndpoint is the mTLS endpoint of the Security Token Service.
+const DefaultEndpoint = "https://sts.mtls.googleapis.com/v1/token"
+
+// DefaultScope is the scope of the access tokens when Config has none.
+const DefaultScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// defaultEarlyExpiry is how long before their expiry cached tokens are
+// replaced, when Config does not set it.
+const defaultEarlyExpiry = time.Minute
+
+// Token exchange parameters from RFC 8693, and the subject token type of
+// X.509 workload identity federation.
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeMTLS          = "urn:ietf:params:oauth:token-type:mtls"
+)
+
+// Key is a private key and its certificate chain, such as a *client.Key.
+type Key interface {
+	crypto.Signer
+	CertificateChain() [][]byte
+}
+
+// Config describes the token exchange.
+type Config struct {
+	// Audience is the full resource name of the workload identity pool
+	// provider, of the form "//iam.googleapis.com/projects/NUMBER/locations/
+	// global/workloadIdentityPools/POOL/providers/PROVIDER".
+	Audience string
+	// Scopes are the scopes of the access tokens. Defaults to DefaultScope.
+	Scopes []string
+	// Endpoint is the token endpoint. Defaults to DefaultEndpoint.
+	Endpoint string
+	// EarlyExpiry is how long before their expiry cached tokens are replaced.
+	// Defaults to one minute.
+	EarlyExpiry time.Duration
+	// RootCAs optionally replaces the system roots used to verify the servers.
+	RootCAs *x509.CertPool
+}
+
+// Transport returns an HTTP transport whose connections present the
+// certificate chain of key, and use key to sign the TLS handshakes. Keys that
+// implement GetClientCertificate, such as a *client.Key, select the signature
+// schemes that their keystore supports, and keys that implement TLSConfig,
+// such as a *client.Key, also limit the TLS version to one that they can sign
+// handshakes of.
+func Transport(key Key, rootCAs *x509.CertPool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			// The chain is read on every handshake to pick up renewals.
+			return &tls.Certificate{Certificate: key.CertificateChain(), PrivateKey: key}, nil
+		},
+	}
+	if key, ok := key.(interface {
+		GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	}); ok {
+		transport.TLSClientConfig.GetClientCertificate = key.GetClientCertificate
+	}
+	if key, ok := key.(interface{ TLSConfig() (*tls.Config, error) }); ok {
+		if config, err := key.TLSConfig(); err == nil {
+			transport.TLSClientConfig = config
+		}
+	}
+	transport.TLSClientConfig.RootCAs = rootCAs
+	return transport
+}
+
+// NewTokenSource returns a token source exchanging the certificate chain of
+// key for access tokens as described by config. The tokens are cached until
+// shortly before they expire. It is safe for concurrent use.
+func NewTokenSource(key Key, config Config) (oauth2.TokenSource, error) {
+	if config.Audience == "" {
+		return nil, errors.New("sts: the audience of the token exchange is required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = DefaultEndpoint
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{DefaultScope}
+	}
+	if config.EarlyExpiry == 0 {
+		config.EarlyExpiry = defaultEarlyExpiry
+	}
+	exchanger := &exchanger{
+		key:    key,
+		config: config,
+		client: &http.Client{Transport: Transport(key, config.RootCAs), Timeout: 30 * time.Second},
+	}
+	return oauth2.ReuseTokenSourceWithExpiry(nil, exchanger, config.EarlyExpiry), nil
+}
+
+// NewClient returns an HTTP client that authenticates its requests with
+// access tokens exchanged as described by config, over mTLS connections
+// presenting the certificate of key, as certificate-bound tokens require.
+func NewClient(key Key, config Config) (*http.Client, error) {
+	source, err := NewTokenSource(key, config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: &oauth2.Transport{Source: source, Base: Transport(key, config.RootCAs)}}, nil
+}
+
+// exchanger is an oauth2.TokenSource making a token exchange for every token.
+type exchanger struct {
+	key    Key
+	config Config
+	client *http.Client
+}
+
+// subjectToken returns the subject token of X.509 workload identity
+// federation: a JSON array of the base64 encoded certificates of key, leaf
+// first.
+func subjectToken(key Key) (string, error) {
+	var certs []string
+	for _, der := range key.CertificateChain() {
+		certs = append(certs, base64.StdEncoding.EncodeToString(der))
+	}
+	if len(certs) == 0 {
+		return "", errors.New("sts: the key has no certificate")
+	}
+	token, err := json.Marshal(certs)
+	return string(token), err
+}
+
+// Token makes a token exchange.
+func (e *exchanger) Token() (*oauth2.Token, error) {
+	subject, err := subjectToken(e.key)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":           {grantTypeTokenExchange},
+		"audience":             {e.config.Audience},
+		"scope":                {strings.Join(e.config.Scopes, " ")},
+		"requested_token_type": {tokenTypeAccessToken},
+		"subject_token_type":   {tokenTypeMTLS},
+		"subject_token":        {subject},
+	}
+	resp, err := e.client.PostForm(e.config.Endpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("sts: token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("sts: token exchange failed: %w", err)
+	}
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("sts: invalid token exchange response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return nil, fmt.Errorf("sts: token exchange failed with %s: %s: %s", resp.Status, result.Error, result.ErrorDescription)
+		}
+		return nil, fmt.Errorf("sts: token exchange failed with %s", resp.Status)
+	}
+	if result.AccessToken == "" {
+		return nil, errors.New("sts: the token exchange response has no access token")
+	}
+	token := &oauth2.Token{AccessToken: result.AccessToken, TokenType: result.TokenType}
+	if result.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sts
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+)
+
+// Check that a client.Key can be used for the exchange.
+var _ Key = (*client.Key)(nil)
+
+const testAudience = "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/x509"
+
+// testKey is a Key backed by a key in memory.
+type testKey struct {
+	crypto.Signer
+	chain [][]byte
+}
+
+func (k *testKey) CertificateChain() [][]byte { return k.chain }
+
+func newTestKey(t *testing.T) *testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Workload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKey{Signer: key, chain: [][]byte{der}}
+}
+
+// newFakeSTS returns an mTLS server issuing a token for every exchange of
+// key's certificate, and API requests authenticated with it, and the number
+// of exchanges it made.
+func newFakeSTS(t *testing.T, key *testKey) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var exchanges atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || !bytes.Equal(r.TLS.PeerCertificates[0].Raw, key.chain[0]) {
+			http.Error(w, `{"error":"invalid_request","error_description":"missing client certificate"}`, http.StatusBadRequest)
+			return
+		}
+		var subject []string
+		if err := json.Unmarshal([]byte(r.PostFormValue("subject_token")), &subject); err != nil || len(subject) != 1 || subject[0] != base64.StdEncoding.EncodeToString(key.chain[0]) {
+			http.Error(w, `{"error":"invalid_grant","error_description":"bad subject token"}`, http.StatusBadRequest)
+			return
+		}
+		if r.PostFormValue("audience") != testAudience || r.PostFormValue("subject_token_type") != tokenTypeMTLS || r.PostFormValue("grant_type") != grantTypeTokenExchange {
+			http.Error(w, `{"error":"invalid_request","error_description":"bad parameters"}`, http.StatusBadRequest)
+			return
+		}
+		exchanges.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		}
+	})
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, &exchanges
+}
+
+func testConfig(server *httptest.Server) Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return Config{Audience: testAudience, Endpoint: server.URL + "/v1/token", RootCAs: roots}
+}
+
+func TestNewClient(t *testing.T) {
+	key := newTestKey(t)
+	server, exchanges := newFakeSTS(t, key)
+	c, err := NewClient(key, testConfig(server))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(server.URL + "/api")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Get: got status %s, want 200 OK", resp.Status)
+		}
+	}
+	if got := exchanges.Load(); got != 1 {
+		t.Errorf("got %d token exchanges, want 1 with the token cached", got)
+	}
+}
+
+func TestTokenSourceError(t *testing.T) {
+	key := newTestKey(t)
+	server, _ := newFakeSTS(t, key)
+	config := testConfig(server)
+	config.Audience = "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/other/providers/x509"
+	source, err := NewTokenSource(key, config)
+	if err != nil {
+		t.Fatalf("NewTokenSource: %v", err)
+	}
+	if _, err := source.Token(); err == nil || !strings.Contains(err.Error(), "bad parameters") {
+		t.Errorf("Token: got %v, want the error description of the server", err)
+	}
+	if _, err := NewTokenSource(key, Config{}); err == nil {
+		t.Error("NewTokenSource: got nil error without an audience")
+	}
+}
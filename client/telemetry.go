@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "sync/atomic"
+
+// Names of the operations reported to Telemetry.
+const (
+	OperationSign         = "Sign"
+	OperationEncrypt      = "Encrypt"
+	OperationDecrypt      = "Decrypt"
+	OperationKeyAgreement = "KeyAgreement"
+)
+
+// Telemetry receives instrumentation events from Keys, so that services can
+// record the latency of key operations in their traces and count signer starts
+// in their metrics, for example with OpenTelemetry. It must be safe for
+// concurrent use.
+type Telemetry interface {
+	// StartOperation is called when a Key starts the operation op, one of
+	// OperationSign, OperationEncrypt, OperationDecrypt and
+	// OperationKeyAgreement, with the metadata of the Key. WrapKey and
+	// UnwrapKey are reported as OperationEncrypt and OperationDecrypt. It
+	// returns a function that is called with the result of the operation once
+	// it completes, such as one that ends a span.
+	StartOperation(op string, metadata Metadata) func(err error)
+
+	// SignerStarted is called each time a signer subprocess is started, with
+	// the backend of the signer and the error if it did not yield a
+	// credential. A signer that is started again counts once more.
+	SignerStarted(backend string, err error)
+}
+
+// telemetryHolder allows storing a nil Telemetry in an atomic.Value.
+type telemetryHolder struct {
+	t Telemetry
+}
+
+var telemetry atomic.Value
+
+// SetTelemetry registers t to receive instrumentation events from all Keys.
+// Passing nil unregisters it.
+func SetTelemetry(t Telemetry) {
+	telemetry.Store(telemetryHolder{t})
+}
+
+// currentTelemetry returns the registered Telemetry, or nil.
+func currentTelemetry() Telemetry {
+	h, _ := telemetry.Load().(telemetryHolder)
+	return h.t
+}
+
+// startOperation reports the start of op to the registered Telemetry, and
+// returns the function that reports its result.
+func (k *Key) startOperation(op string) func(err error) {
+	t := currentTelemetry()
+	if t == nil {
+		return func(error) {}
+	}
+	return t.StartOperation(op, k.Metadata())
+}
+
+// signerStarted reports the start of the signer of backend to the registered
+// Telemetry.
+func signerStarted(backend string, err error) {
+	if t := currentTelemetry(); t != nil {
+		t.SignerStarted(backend, err)
+	}
+}
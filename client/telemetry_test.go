@@ -0,0 +1,92 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"errors"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+type fakeTelemetry struct {
+	mu         sync.Mutex
+	operations []string
+	results    []error
+	backends   []string
+}
+
+func (f *fakeTelemetry) StartOperation(op string, metadata Metadata) func(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.operations = append(f.operations, op+"/"+metadata.KeystoreType)
+	return func(err error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.results = append(f.results, err)
+	}
+}
+
+func (f *fakeTelemetry) SignerStarted(backend string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.backends = append(f.backends, backend)
+}
+
+func TestClient_Telemetry(t *testing.T) {
+	f := &fakeTelemetry{}
+	SetTelemetry(f)
+	defer SetTelemetry(nil)
+
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	if _, err := key.Sign(nil, make([]byte, 32), crypto.SHA256); err != nil {
+		t.Fatalf("Sign: got %v, want nil err", err)
+	}
+	if _, err := key.SignMessage([]byte("message"), crypto.SHA256); err != nil {
+		t.Fatalf("SignMessage: got %v, want nil err", err)
+	}
+	wantErr := ErrDigestLengthMismatch
+	if _, err := key.Sign(nil, []byte("short"), crypto.SHA256); !errors.Is(err, wantErr) {
+		t.Fatalf("Sign: got %v, want %v", err, wantErr)
+	}
+	if _, err := key.Encrypt(nil, []byte("plaintext"), crypto.SHA256); err != nil {
+		t.Fatalf("Encrypt: got %v, want nil err", err)
+	}
+	wrappedKey, err := key.WrapKey([]byte("0123456789abcdef"), crypto.SHA256)
+	if err != nil {
+		t.Fatalf("WrapKey: got %v, want nil err", err)
+	}
+	if _, err := key.UnwrapKey(wrappedKey, crypto.SHA256); err != nil {
+		t.Fatalf("UnwrapKey: got %v, want nil err", err)
+	}
+
+	if want := []string{config.NativeBackend(runtime.GOOS)}; !reflect.DeepEqual(f.backends, want) {
+		t.Errorf("SignerStarted: got backends %q, want %q", f.backends, want)
+	}
+	want := []string{"Sign/test", "Sign/test", "Sign/test", "Encrypt/test", "Encrypt/test", "Decrypt/test"}
+	if !reflect.DeepEqual(f.operations, want) {
+		t.Errorf("StartOperation: got %q, want %q", f.operations, want)
+	}
+	if len(f.results) != len(want) || !errors.Is(f.results[2], wantErr) {
+		t.Errorf("StartOperation: got results %v, want the error of the third operation", f.results)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// ErrNoSignatureScheme is wrapped by the error returned by
+// GetClientCertificate when the server accepts none of the TLS signature
+// schemes that the keystore supports with the key.
+var ErrNoSignatureScheme = errors.New("the server accepts no signature scheme supported by the key")
+
+// rsaSchemes maps the hash functions of RSA signatures to their TLS signature
+// schemes, PKCS #1 v1.5 first and RSASSA-PSS second.
+var rsaSchemes = []struct {
+	hash     crypto.Hash
+	pkcs1v15 tls.SignatureScheme
+	pss      tls.SignatureScheme
+}{
+	{crypto.SHA256, tls.PKCS1WithSHA256, tls.PSSWithSHA256},
+	{crypto.SHA384, tls.PKCS1WithSHA384, tls.PSSWithSHA384},
+	{crypto.SHA512, tls.PKCS1WithSHA512, tls.PSSWithSHA512},
+}
+
+// SignatureSchemes returns the TLS signature schemes that the keystore supports
+// with the key whose public key is pub, PSS schemes first for RSA keys. ECDSA
+// schemes are bound to the curve of the key, as in TLS 1.3.
+func (c Capabilities) SignatureSchemes(pub crypto.PublicKey) []tls.SignatureScheme {
+	var schemes []tls.SignatureScheme
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if c.PSS {
+			for _, s := range rsaSchemes {
+				if containsHash(c.Hashes, s.hash) {
+					schemes = append(schemes, s.pss)
+				}
+			}
+		}
+		if c.PKCS1v15 {
+			for _, s := range rsaSchemes {
+				if containsHash(c.Hashes, s.hash) {
+					schemes = append(schemes, s.pkcs1v15)
+				}
+			}
+		}
+	case *ecdsa.PublicKey:
+		var hash crypto.Hash
+		var scheme tls.SignatureScheme
+		switch pub.Curve {
+		case elliptic.P256():
+			hash, scheme = crypto.SHA256, tls.ECDSAWithP256AndSHA256
+		case elliptic.P384():
+			hash, scheme = crypto.SHA384, tls.ECDSAWithP384AndSHA384
+		case elliptic.P521():
+			hash, scheme = crypto.SHA512, tls.ECDSAWithP521AndSHA512
+		}
+		if hash != 0 && containsHash(c.Hashes, hash) {
+			schemes = append(schemes, scheme)
+		}
+	case ed25519.PublicKey:
+		if c.RawSign {
+			schemes = append(schemes, tls.Ed25519)
+		}
+	}
+	return schemes
+}
+
+// MaxTLSVersion returns the highest TLS version in which the keystore can sign
+// handshakes with the key whose public key is pub: TLS 1.2 for RSA keys
+// without RSASSA-PSS, such as keys held by some HSMs, since TLS 1.3 only
+// allows RSASSA-PSS, and TLS 1.3 otherwise.
+func (c Capabilities) MaxTLSVersion(pub crypto.PublicKey) uint16 {
+	if _, ok := pub.(*rsa.PublicKey); ok && !c.PSS {
+		return tls.VersionTLS12
+	}
+	return tls.VersionTLS13
+}
+
+// TLSCertificate returns the certificate chain of the key as a
+// tls.Certificate using the key to sign, restricted to the signature schemes
+// that the keystore supports. crypto/tls then picks the scheme from those that
+// the peer accepts, for instance PKCS #1 v1.5 with a TLS 1.2 server if the key
+// is held by an HSM that does not implement RSASSA-PSS.
+func (k *Key) TLSCertificate() (*tls.Certificate, error) {
+	for {
+		c, generation, err := k.cachedCapabilities()
+		if err != nil {
+			return nil, err
+		}
+		k.mu.RLock()
+		if k.generation != generation {
+			// The credential was replaced while its capabilities were
+			// requested.
+			k.mu.RUnlock()
+			continue
+		}
+		cert := &tls.Certificate{
+			Certificate:                  k.chain,
+			PrivateKey:                   k,
+			Leaf:                         k.leaf,
+			SupportedSignatureAlgorithms: c.SignatureSchemes(k.publicKey),
+		}
+		k.mu.RUnlock()
+		return cert, nil
+	}
+}
+
+// GetClientCertificate returns the certificate of TLSCertificate, and can be
+// used as tls.Config.GetClientCertificate. It returns an error wrapping
+// ErrNoSignatureScheme rather than start a handshake that would fail if the
+// server accepts none of the signature schemes that the keystore supports,
+// such as with TLS 1.3 for RSA keys without RSASSA-PSS. TLSConfig avoids the
+// latter by not offering TLS 1.3 for these keys.
+func (k *Key) GetClientCertificate(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := k.TLSCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if err := cri.SupportsCertificate(cert); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoSignatureScheme, err)
+	}
+	return cert, nil
+}
+
+// TLSConfig returns a TLS client config presenting the certificate of the key
+// with GetClientCertificate. Its MaxVersion is the MaxTLSVersion of the
+// capabilities of the key, so that a key that cannot sign TLS 1.3 handshakes
+// negotiates TLS 1.2 instead of failing. Callers may set the other fields,
+// such as RootCAs.
+func (k *Key) TLSConfig() (*tls.Config, error) {
+	c, _, err := k.cachedCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetClientCertificate: k.GetClientCertificate,
+		MaxVersion:           c.MaxTLSVersion(k.Public()),
+	}, nil
+}
+
+// cachedCapabilities returns the capabilities of the key, which are only
+// requested from the signer once per credential, and the generation of the
+// credential that they were cached for.
+func (k *Key) cachedCapabilities() (Capabilities, uint64, error) {
+	k.mu.RLock()
+	c, generation := k.capabilities, k.generation
+	k.mu.RUnlock()
+	if c != nil {
+		return *c, generation, nil
+	}
+	capabilities, err := k.Capabilities()
+	if err != nil {
+		return capabilities, 0, err
+	}
+	k.mu.Lock()
+	// Capabilities requested before the credential was replaced must not be
+	// cached for the new one.
+	if k.generation == generation {
+		k.capabilities = &capabilities
+	}
+	k.mu.Unlock()
+	return capabilities, generation, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSignatureSchemes(t *testing.T) {
+	sha256 := []crypto.Hash{crypto.SHA256}
+	tests := []struct {
+		name string
+		c    Capabilities
+		pub  crypto.PublicKey
+		want []tls.SignatureScheme
+	}{
+		{
+			name: "RSA",
+			c:    Capabilities{Hashes: []crypto.Hash{crypto.SHA256, crypto.SHA384}, PKCS1v15: true, PSS: true},
+			pub:  &rsa.PublicKey{},
+			want: []tls.SignatureScheme{tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PKCS1WithSHA256, tls.PKCS1WithSHA384},
+		},
+		{
+			name: "RSA-PKCS1v15",
+			c:    Capabilities{Hashes: sha256, PKCS1v15: true},
+			pub:  &rsa.PublicKey{},
+			want: []tls.SignatureScheme{tls.PKCS1WithSHA256},
+		},
+		{
+			name: "ECDSA-P384",
+			c:    Capabilities{Hashes: []crypto.Hash{crypto.SHA256, crypto.SHA384}},
+			pub:  &ecdsa.PublicKey{Curve: elliptic.P384()},
+			want: []tls.SignatureScheme{tls.ECDSAWithP384AndSHA384},
+		},
+		{
+			name: "ECDSA-P384-SHA256",
+			c:    Capabilities{Hashes: sha256},
+			pub:  &ecdsa.PublicKey{Curve: elliptic.P384()},
+		},
+		{
+			name: "Ed25519",
+			c:    Capabilities{RawSign: true},
+			pub:  ed25519.PublicKey{},
+			want: []tls.SignatureScheme{tls.Ed25519},
+		},
+	}
+	for _, test := range tests {
+		if got := test.c.SignatureSchemes(test.pub); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SignatureSchemes %s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClient_GetClientCertificate(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	// The mock keystore only signs SHA-256 digests with PKCS #1 v1.5.
+	cert, err := key.GetClientCertificate(&tls.CertificateRequestInfo{
+		SignatureSchemes: []tls.SignatureScheme{tls.PSSWithSHA256, tls.PKCS1WithSHA256},
+		Version:          tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatalf("GetClientCertificate with TLS 1.2: got %v, want nil err", err)
+	}
+	if want := []tls.SignatureScheme{tls.PKCS1WithSHA256}; !reflect.DeepEqual(cert.SupportedSignatureAlgorithms, want) {
+		t.Errorf("GetClientCertificate: got signature schemes %v, want %v", cert.SupportedSignatureAlgorithms, want)
+	}
+	if !reflect.DeepEqual(cert.Certificate, key.CertificateChain()) {
+		t.Error("GetClientCertificate: got a certificate chain differing from CertificateChain")
+	}
+
+	// TLS 1.3 requires RSASSA-PSS.
+	_, err = key.GetClientCertificate(&tls.CertificateRequestInfo{
+		SignatureSchemes: []tls.SignatureScheme{tls.PSSWithSHA256, tls.PKCS1WithSHA256},
+		Version:          tls.VersionTLS13,
+	})
+	if !errors.Is(err, ErrNoSignatureScheme) {
+		t.Errorf("GetClientCertificate with TLS 1.3: got %v, want %v", err, ErrNoSignatureScheme)
+	}
+}
+
+func TestMaxTLSVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Capabilities
+		pub  crypto.PublicKey
+		want uint16
+	}{
+		{name: "RSA", c: Capabilities{PKCS1v15: true, PSS: true}, pub: &rsa.PublicKey{}, want: tls.VersionTLS13},
+		{name: "RSA-PKCS1v15", c: Capabilities{PKCS1v15: true}, pub: &rsa.PublicKey{}, want: tls.VersionTLS12},
+		{name: "ECDSA", c: Capabilities{}, pub: &ecdsa.PublicKey{Curve: elliptic.P256()}, want: tls.VersionTLS13},
+		{name: "Ed25519", c: Capabilities{RawSign: true}, pub: ed25519.PublicKey{}, want: tls.VersionTLS13},
+	}
+	for _, test := range tests {
+		if got := test.c.MaxTLSVersion(test.pub); got != test.want {
+			t.Errorf("MaxTLSVersion %s: got %x, want %x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClient_TLSConfig(t *testing.T) {
+	key, err := Cred(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	config, err := key.TLSConfig()
+	if err != nil {
+		t.Fatalf("TLSConfig: got %v, want nil err", err)
+	}
+	// The mock keystore cannot sign with RSASSA-PSS, which TLS 1.3 requires.
+	if config.MaxVersion != tls.VersionTLS12 {
+		t.Errorf("TLSConfig: got MaxVersion %x, want %x", config.MaxVersion, tls.VersionTLS12)
+	}
+	if config.GetClientCertificate == nil {
+		t.Error("TLSConfig: got nil GetClientCertificate")
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "strings"
+
+// touchRequiredMessage is the message of the error returned by the PIV signer
+// when the security key was not touched in time. It must match the message of
+// yubikey.ErrTouchRequired.
+const touchRequiredMessage = "security key touch required"
+
+// TouchRequiredError is returned by Sign and SignMessage when the key is on a
+// security key whose touch policy requires a touch, and the security key was
+// not touched in time. Applications can prompt the user to touch the security
+// key and retry.
+type TouchRequiredError struct {
+	Err error // The error returned by the signer.
+}
+
+func (e *TouchRequiredError) Error() string {
+	return "touch the security key holding the enterprise certificate: " + e.Err.Error()
+}
+
+func (e *TouchRequiredError) Unwrap() error {
+	return e.Err
+}
+
+// touchRequired returns a *TouchRequiredError wrapping err if err reports a
+// missing touch of the security key. Otherwise it returns err.
+func touchRequired(err error) error {
+	if err != nil && strings.Contains(err.Error(), touchRequiredMessage) {
+		return &TouchRequiredError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+)
+
+func TestTouchRequired(t *testing.T) {
+	if err := touchRequired(nil); err != nil {
+		t.Errorf("touchRequired(nil): got %v, want nil", err)
+	}
+	other := rpc.ServerError("smart card error 6a80")
+	if err := touchRequired(other); err != other {
+		t.Errorf("touchRequired(%v): got %v, want the error unchanged", other, err)
+	}
+	touch := rpc.ServerError("security key touch required: smart card error 6982: security status not satisfied")
+	var touchErr *TouchRequiredError
+	if err := touchRequired(touch); !errors.As(err, &touchErr) || !errors.Is(err, touch) {
+		t.Errorf("touchRequired(%v): got %v, want TouchRequiredError wrapping it", touch, err)
+	}
+}
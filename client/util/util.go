@@ -15,78 +15,55 @@
 package util
 
 import (
-	"encoding/json"
 	"errors"
-	"io"
 	"os"
-	"os/user"
 	"path/filepath"
 	"runtime"
-	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
 )
 
 const configFileName = "certificate_config.json"
 
 // EnterpriseCertificateConfig contains parameters for initializing signer.
-type EnterpriseCertificateConfig struct {
-	Libs Libs `json:"libs"`
-}
+type EnterpriseCertificateConfig = config.EnterpriseCertificateConfig
 
 // Libs specifies the locations of helper libraries.
-type Libs struct {
-	ECP string `json:"ecp"`
-}
+type Libs = config.Libs
 
 // ErrConfigUnavailable is a sentinel error that indicates ECP config is unavailable,
 // possibly due to entire config missing or missing binary path.
 var ErrConfigUnavailable = errors.New("Config is unavailable")
 
-// LoadSignerBinaryPath retrieves the path of the signer binary from the config file.
-func LoadSignerBinaryPath(configFilePath string) (path string, err error) {
-	jsonFile, err := os.Open(configFilePath)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return "", ErrConfigUnavailable
-		}
-		return "", err
+// LoadConfig reads and validates the config file.
+func LoadConfig(configFilePath string) (EnterpriseCertificateConfig, error) {
+	config, err := config.Load(configFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, ErrConfigUnavailable
 	}
+	return config, err
+}
 
-	byteValue, err := io.ReadAll(jsonFile)
-	if err != nil {
-		return "", err
-	}
-	var config EnterpriseCertificateConfig
-	err = json.Unmarshal(byteValue, &config)
+// LoadSignerBinaryPath retrieves the path of the signer binary from the config
+// file. If the config lists several backends, it is the path of the signer of
+// the first one available on the current OS.
+func LoadSignerBinaryPath(configFilePath string) (path string, err error) {
+	config, err := LoadConfig(configFilePath)
 	if err != nil {
 		return "", err
 	}
-	signerBinaryPath := config.Libs.ECP
-	if signerBinaryPath == "" {
+	signers := config.Signers(runtime.GOOS)
+	if len(signers) == 0 {
 		return "", ErrConfigUnavailable
 	}
-
-	signerBinaryPath = strings.ReplaceAll(signerBinaryPath, "~", guessHomeDir())
-	signerBinaryPath = strings.ReplaceAll(signerBinaryPath, "$HOME", guessHomeDir())
-	return signerBinaryPath, nil
-}
-
-func guessHomeDir() string {
-	// Prefer $HOME over user.Current due to glibc bug: golang.org/issue/13470
-	if v := os.Getenv("HOME"); v != "" {
-		return v
-	}
-	// Else, fall back to user.Current:
-	if u, err := user.Current(); err == nil {
-		return u.HomeDir
-	}
-	return ""
+	return signers[0].Path, nil
 }
 
 func getDefaultConfigFileDirectory() (directory string) {
 	if runtime.GOOS == "windows" {
 		return filepath.Join(os.Getenv("APPDATA"), "gcloud")
 	}
-	return filepath.Join(guessHomeDir(), ".config/gcloud")
+	return filepath.Join(config.HomeDir(), ".config/gcloud")
 }
 
 // GetDefaultConfigFilePath returns the default path of the enterprise certificate config file created by gCloud.
@@ -15,7 +15,10 @@ package util
 
 import (
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
 )
 
 func TestLoadSignerBinaryPath(t *testing.T) {
@@ -34,7 +37,7 @@ func TestLoadSignerBinaryPathHome(t *testing.T) {
 	if err != nil {
 		t.Errorf("LoadSignerBinaryPath error: %q", err)
 	}
-	want := guessHomeDir() + "/ecp/signer"
+	want := config.HomeDir() + "/ecp/signer"
 	if path != want {
 		t.Errorf("Expected path is %q, got: %q", want, path)
 	}
@@ -45,12 +48,29 @@ func TestLoadSignerBinaryPathTilde(t *testing.T) {
 	if err != nil {
 		t.Errorf("LoadSignerBinaryPath error: %q", err)
 	}
-	want := guessHomeDir() + "/ecp/signer"
+	want := config.HomeDir() + "/ecp/signer"
 	if path != want {
 		t.Errorf("Expected path is %q, got: %q", want, path)
 	}
 }
 
+func TestLoadSignerBinaryPathUnknownField(t *testing.T) {
+	_, err := LoadSignerBinaryPath("./test_data/certificate_config_unknown_field.json")
+	if err == nil {
+		t.Fatal("Expected error but got nil")
+	}
+	if !strings.Contains(err.Error(), `did you mean "ecp"`) {
+		t.Errorf("Expected error to name the unknown field, got: %q", err)
+	}
+}
+
+func TestLoadSignerBinaryPathFutureVersion(t *testing.T) {
+	_, err := LoadSignerBinaryPath("./test_data/certificate_config_future_version.json")
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
 func TestGetConfigFilePathFromEnv(t *testing.T) {
 	want := "/testpath"
 	os.Setenv("GOOGLE_API_CERTIFICATE_CONFIG", want)
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+)
+
+// bench signs digests with the configured key and reports the latency
+// distribution and throughput of the keystore.
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	ops := fs.Int("ops", 100, "number of Sign operations to perform")
+	concurrency := fs.Int("concurrency", 1, "number of Sign operations in flight at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ops < 1 || *concurrency < 1 {
+		return fmt.Errorf("-ops and -concurrency must be positive")
+	}
+	path := configFilePath(fs.Arg(0))
+
+	key, err := client.Cred(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer key.Close()
+	fmt.Printf("keystore:    %s\n", key.Metadata().KeystoreType)
+
+	// Sign once outside of the measurement, so that one-time costs such as
+	// a PIN prompt are not counted.
+	digest := make([]byte, crypto.SHA256.Size())
+	if _, err := rand.Read(digest); err != nil {
+		return err
+	}
+	if _, err := key.Sign(nil, digest, crypto.SHA256); err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+
+	latencies := make([]time.Duration, *ops)
+	errs := make(chan error, *concurrency)
+	var wg sync.WaitGroup
+	next := make(chan int)
+	start := time.Now()
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				opStart := time.Now()
+				if _, err := key.Sign(nil, digest, crypto.SHA256); err != nil {
+					errs <- err
+					return
+				}
+				latencies[i] = time.Since(opStart)
+			}
+		}()
+	}
+	var benchErr error
+feed:
+	for i := 0; i < *ops; i++ {
+		select {
+		case next <- i:
+		case benchErr = <-errs:
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	elapsed := time.Since(start)
+	if benchErr == nil {
+		select {
+		case benchErr = <-errs:
+		default:
+		}
+	}
+	if benchErr != nil {
+		return fmt.Errorf("sign: %w", benchErr)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	fmt.Printf("operations:  %d (concurrency %d)\n", *ops, *concurrency)
+	fmt.Printf("latency:     min %v, mean %v, p50 %v, p90 %v, p99 %v, max %v\n",
+		latencies[0], total/time.Duration(len(latencies)), percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+	fmt.Printf("throughput:  %.1f ops/s\n", float64(*ops)/elapsed.Seconds())
+	return nil
+}
+
+// percentile returns the p-th percentile of the sorted latencies, using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
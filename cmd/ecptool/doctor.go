@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/revocation"
+)
+
+// doctor loads the configured certificate through the signer and reports
+// problems with it, such as expiry or revocation.
+func doctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "upper bound on the time spent checking revocation status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := configFilePath(fs.Arg(0))
+
+	key, err := client.Cred(path)
+	if err != nil {
+		var credErr *client.CredError
+		if errors.As(err, &credErr) {
+			printDiagnosis(credErr.Diagnosis)
+			err = credErr.Err
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer key.Close()
+	metadata := key.Metadata()
+	fmt.Printf("signer:      OK (keystore %q)\n", metadata.KeystoreType)
+	if signerVersion, err := key.SignerVersion(); err == nil {
+		fmt.Printf("version:     %s\n", signerVersion)
+	}
+
+	leaf, err := x509.ParseCertificate(key.CertificateChain()[0])
+	if err != nil {
+		return fmt.Errorf("parsing leaf certificate: %w", err)
+	}
+	fmt.Printf("certificate: %s\n", leaf.Subject)
+	fmt.Printf("issuer:      %s\n", leaf.Issuer)
+	fmt.Printf("expires:     %s\n", leaf.NotAfter.Format(time.RFC3339))
+	if time.Now().After(leaf.NotAfter) {
+		return errors.New("certificate has expired")
+	}
+
+	issuer := key.Root()
+	if intermediates := key.Intermediates(); len(intermediates) > 0 {
+		issuer = intermediates[0]
+	}
+	if issuer == nil {
+		fmt.Println("revocation:  not checked, the chain does not include the issuer")
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	status, err := revocation.Check(ctx, nil, leaf, issuer)
+	if err != nil {
+		fmt.Printf("revocation:  %v (%v)\n", status, err)
+		return nil
+	}
+	fmt.Printf("revocation:  %v\n", status)
+	if status == revocation.Revoked {
+		return errors.New("certificate has been revoked")
+	}
+	return nil
+}
+
+// printDiagnosis prints the configured backends and the problems found with
+// the setup, with guidance on fixing them.
+func printDiagnosis(d client.Diagnosis) {
+	if len(d.Backends) > 0 {
+		fmt.Printf("backends:    %s\n", strings.Join(d.Backends, ", "))
+	}
+	for _, p := range d.Problems {
+		fmt.Printf("problem:     %s\n", p.Description)
+		fmt.Printf("fix:         %s\n", p.Fix)
+	}
+}
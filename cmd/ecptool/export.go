@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf16"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// export writes the certificate chain of the configured credential, without
+// its private key, as a trust bundle for tools that cannot use the keystore.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "pem", "output format: pem, pkcs7 (DER encoded, as in .p7b files) or jks")
+	out := fs.String("out", "", "file to write the bundle to, instead of standard output")
+	alias := fs.String("alias", "ecp", "alias of the leaf certificate in a jks bundle; issuers get the alias followed by -ca1, -ca2, ...")
+	storepass := fs.String("storepass", "", "password protecting the integrity of a jks bundle, required with -format jks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "jks" && *storepass == "" {
+		return errors.New("-storepass is required with -format jks")
+	}
+	path := configFilePath(fs.Arg(0))
+
+	key, err := client.Cred(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer key.Close()
+	chain := key.CertificateChain()
+
+	var data []byte
+	switch *format {
+	case "pem":
+		data = encodePEMChain(chain)
+	case "pkcs7":
+		data, err = encodePKCS7Chain(chain)
+	case "jks":
+		data, err = encodeJKSChain(chain, *alias, *storepass, time.Now())
+	default:
+		return fmt.Errorf("format must be pem, pkcs7 or jks, got %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0644)
+}
+
+// encodePEMChain encodes chain as concatenated PEM CERTIFICATE blocks.
+func encodePEMChain(chain [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, der := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	return buf.Bytes()
+}
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// encodePKCS7Chain encodes chain as a degenerate, certificates-only PKCS #7
+// SignedData without signers (RFC 2315, section 9), as written by "openssl
+// crl2pkcs7 -nocrl".
+func encodePKCS7Chain(chain [][]byte) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // ContentInfo
+		b.AddASN1ObjectIdentifier(oidSignedData)
+		b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // SignedData
+				b.AddASN1Int64(1)                                        // version
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {})    // digestAlgorithms
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) { // contentInfo
+					b.AddASN1ObjectIdentifier(oidData)
+				})
+				b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) { // certificates
+					for _, der := range chain {
+						b.AddBytes(der)
+					}
+				})
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {}) // signerInfos
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// jksMagic and jksVersion start a Java KeyStore file, and jksTrustedCert tags
+// its trusted certificate entries.
+const (
+	jksMagic       = 0xfeedfeed
+	jksVersion     = 2
+	jksTrustedCert = 2
+)
+
+// encodeJKSChain encodes chain as a Java KeyStore holding one trusted
+// certificate entry per certificate, which keytool and Java accept as a trust
+// store. The leaf is stored under alias, and its issuers under alias-ca1,
+// alias-ca2, and so on. The file ends with the keyed SHA-1 digest that Java
+// uses to check its integrity with storepass.
+func encodeJKSChain(chain [][]byte, alias, storepass string, created time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, v := range []uint32{jksMagic, jksVersion, uint32(len(chain))} {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	for i, der := range chain {
+		name := alias
+		if i > 0 {
+			name = fmt.Sprintf("%s-ca%d", alias, i)
+		}
+		if err := binary.Write(&buf, binary.BigEndian, uint32(jksTrustedCert)); err != nil {
+			return nil, err
+		}
+		if err := writeJavaUTF(&buf, name); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, binary.BigEndian, uint64(created.UnixMilli())); err != nil {
+			return nil, err
+		}
+		if err := writeJavaUTF(&buf, "X.509"); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, binary.BigEndian, uint32(len(der))); err != nil {
+			return nil, err
+		}
+		buf.Write(der)
+	}
+
+	// The digest covers the password as UTF-16BE, a fixed salt and the
+	// entries.
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(storepass)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// writeJavaUTF writes s as by DataOutputStream.writeUTF: a 16-bit length
+// followed by the modified UTF-8 encoding of s, in which NUL is encoded with
+// two bytes.
+func writeJavaUTF(buf *bytes.Buffer, s string) error {
+	var encoded []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		switch {
+		case c != 0 && c < 0x80:
+			encoded = append(encoded, byte(c))
+		case c < 0x800:
+			encoded = append(encoded, byte(0xc0|c>>6), byte(0x80|c&0x3f))
+		default:
+			encoded = append(encoded, byte(0xe0|c>>12), byte(0x80|(c>>6)&0x3f), byte(0x80|c&0x3f))
+		}
+	}
+	if len(encoded) > 0xffff {
+		return fmt.Errorf("%q is too long to encode", s)
+	}
+	if err := binary.Write(buf, binary.BigEndian, uint16(len(encoded))); err != nil {
+		return err
+	}
+	buf.Write(encoded)
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// testChain returns a DER encoded chain of a leaf and n issuers.
+func testChain(t *testing.T, n int) [][]byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chain [][]byte
+	for i := 0; i <= n; i++ {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: "Test " + string(rune('A'+i))},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, der)
+	}
+	return chain
+}
+
+func TestEncodePEMChain(t *testing.T) {
+	chain := testChain(t, 2)
+	rest := encodePEMChain(chain)
+	var got [][]byte
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			t.Errorf("got a %s block, want CERTIFICATE", block.Type)
+		}
+		got = append(got, block.Bytes)
+	}
+	if len(rest) != 0 || !reflect.DeepEqual(got, chain) {
+		t.Errorf("encodePEMChain: got %d certificates and %d trailing bytes, want the %d certificates of the chain", len(got), len(rest), len(chain))
+	}
+}
+
+func TestEncodePKCS7Chain(t *testing.T) {
+	for _, n := range []int{0, 2} {
+		chain := testChain(t, n)
+		data, err := encodePKCS7Chain(chain)
+		if err != nil {
+			t.Fatalf("encodePKCS7Chain: %v", err)
+		}
+
+		var contentInfo struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue `asn1:"explicit,tag:0"`
+		}
+		if rest, err := asn1.Unmarshal(data, &contentInfo); err != nil || len(rest) != 0 {
+			t.Fatalf("parsing ContentInfo: %v, %d trailing bytes", err, len(rest))
+		}
+		if !contentInfo.ContentType.Equal(oidSignedData) {
+			t.Errorf("content type: got %v, want %v", contentInfo.ContentType, oidSignedData)
+		}
+		var signedData struct {
+			Version          int
+			DigestAlgorithms asn1.RawValue `asn1:"set"`
+			ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+			Certificates     asn1.RawValue `asn1:"tag:0"`
+			SignerInfos      asn1.RawValue `asn1:"set"`
+		}
+		if rest, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil || len(rest) != 0 {
+			t.Fatalf("parsing SignedData: %v, %d trailing bytes", err, len(rest))
+		}
+		if signedData.Version != 1 || !signedData.ContentInfo.ContentType.Equal(oidData) || len(signedData.SignerInfos.Bytes) != 0 {
+			t.Errorf("SignedData: got version %d, content type %v and %d bytes of signer infos, want a version 1 degenerate SignedData", signedData.Version, signedData.ContentInfo.ContentType, len(signedData.SignerInfos.Bytes))
+		}
+		certs, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+		if err != nil {
+			t.Fatalf("parsing the certificates: %v", err)
+		}
+		var got [][]byte
+		for _, cert := range certs {
+			got = append(got, cert.Raw)
+		}
+		if !reflect.DeepEqual(got, chain) {
+			t.Errorf("certificates: got %d, want the %d certificates of the chain", len(got), len(chain))
+		}
+	}
+}
+
+// jksEntry is a trusted certificate entry decoded from a Java KeyStore.
+type jksEntry struct {
+	alias   string
+	created int64
+	der     []byte
+}
+
+// decodeJKS decodes the trusted certificate entries of a Java KeyStore, as
+// by KeyStore.load, and checks its digest with storepass.
+func decodeJKS(t *testing.T, data []byte, storepass string) []jksEntry {
+	t.Helper()
+	if len(data) < sha1.Size {
+		t.Fatalf("keystore of %d bytes is too short", len(data))
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(storepass)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		t.Fatalf("keystore digest does not match password %q", storepass)
+	}
+
+	r := bytes.NewReader(body)
+	read := func(v any) {
+		t.Helper()
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			t.Fatalf("reading the keystore: %v", err)
+		}
+	}
+	readUTF := func() string {
+		t.Helper()
+		var n uint16
+		read(&n)
+		s := make([]byte, n)
+		read(s)
+		return string(s)
+	}
+	var magic, version, count uint32
+	read(&magic)
+	read(&version)
+	read(&count)
+	if magic != jksMagic || version != jksVersion {
+		t.Fatalf("got magic %#x and version %d, want %#x and %d", magic, version, uint32(jksMagic), jksVersion)
+	}
+	var entries []jksEntry
+	for i := uint32(0); i < count; i++ {
+		var tag, n uint32
+		var e jksEntry
+		read(&tag)
+		if tag != jksTrustedCert {
+			t.Fatalf("entry %d: got tag %d, want %d", i, tag, jksTrustedCert)
+		}
+		e.alias = readUTF()
+		read(&e.created)
+		if certType := readUTF(); certType != "X.509" {
+			t.Fatalf("entry %d: got certificate type %q, want X.509", i, certType)
+		}
+		read(&n)
+		e.der = make([]byte, n)
+		read(e.der)
+		entries = append(entries, e)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("%d trailing bytes after the entries", r.Len())
+	}
+	return entries
+}
+
+func TestEncodeJKSChain(t *testing.T) {
+	chain := testChain(t, 2)
+	created := time.UnixMilli(1700000000123)
+	data, err := encodeJKSChain(chain, "ecp", "secret", created)
+	if err != nil {
+		t.Fatalf("encodeJKSChain: %v", err)
+	}
+	want := []jksEntry{
+		{alias: "ecp", created: created.UnixMilli(), der: chain[0]},
+		{alias: "ecp-ca1", created: created.UnixMilli(), der: chain[1]},
+		{alias: "ecp-ca2", created: created.UnixMilli(), der: chain[2]},
+	}
+	if got := decodeJKS(t, data, "secret"); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries: got %+v, want %+v", got, want)
+	}
+
+	// The digest is keyed with the password.
+	other, err := encodeJKSChain(chain, "ecp", "other", created)
+	if err != nil {
+		t.Fatalf("encodeJKSChain: %v", err)
+	}
+	if bytes.Equal(data[len(data)-sha1.Size:], other[len(other)-sha1.Size:]) {
+		t.Error("keystores with different passwords have the same digest")
+	}
+}
+
+func TestWriteJavaUTF(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []byte
+	}{
+		{s: "ecp", want: []byte{0, 3, 'e', 'c', 'p'}},
+		{s: "a\x00b", want: []byte{0, 4, 'a', 0xc0, 0x80, 'b'}},
+		{s: "é", want: []byte{0, 2, 0xc3, 0xa9}},
+		{s: "€", want: []byte{0, 3, 0xe2, 0x82, 0xac}},
+		// Characters outside the BMP are encoded as surrogate pairs.
+		{s: "😀", want: []byte{0, 6, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeJavaUTF(&buf, test.s); err != nil {
+			t.Errorf("writeJavaUTF(%q): %v", test.s, err)
+		} else if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Errorf("writeJavaUTF(%q): got %x, want %x", test.s, buf.Bytes(), test.want)
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeJavaUTF(&buf, string(make([]byte, 0x8000))); err == nil {
+		t.Error("writeJavaUTF: got no error for a string encoded in more than 65535 bytes")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+)
+
+// genCSR writes a PEM encoded certificate signing request signed by the
+// configured key, for renewing its certificate without extracting the key.
+func genCSR(args []string) error {
+	fs := flag.NewFlagSet("gen-csr", flag.ExitOnError)
+	out := fs.String("out", "", "file to write the PEM encoded request to, instead of standard output")
+	cn := fs.String("cn", "", "common name to request, instead of the subject of the current certificate")
+	dns := fs.String("dns", "", "comma separated DNS names to request, instead of those of the current certificate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := configFilePath(fs.Arg(0))
+
+	key, err := client.Cred(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer key.Close()
+
+	var template *x509.CertificateRequest
+	if *cn != "" || *dns != "" {
+		leaf, err := x509.ParseCertificate(key.CertificateChain()[0])
+		if err != nil {
+			return fmt.Errorf("parsing leaf certificate: %w", err)
+		}
+		template = &x509.CertificateRequest{
+			Subject:        leaf.Subject,
+			DNSNames:       leaf.DNSNames,
+			EmailAddresses: leaf.EmailAddresses,
+			IPAddresses:    leaf.IPAddresses,
+			URIs:           leaf.URIs,
+		}
+		if *cn != "" {
+			template.Subject = pkix.Name{CommonName: *cn}
+		}
+		if *dns != "" {
+			template.DNSNames = strings.Split(*dns, ",")
+		}
+	}
+	der, err := key.CertificateRequest(template)
+	if err != nil {
+		return fmt.Errorf("creating certificate request: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*out, data, 0644)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// passwordEnv is the environment variable holding the PKCS#12 password. If it
+// is not set, the password is read from the first line of standard input.
+// Either may hold a secret URI, such as keychain://<service>/<account>,
+// referencing the password in the OS secret store.
+const passwordEnv = "ECP_PKCS12_PASSWORD"
+
+// importCred imports a PKCS#12 file into the keystore selected by the
+// platform block of the certificate config.
+func importCred(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New("usage: ecptool import <pkcs12 file> [config file path]")
+	}
+	credPath := fs.Arg(0)
+	path := configFilePath(fs.Arg(1))
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	password, ok := os.LookupEnv(passwordEnv)
+	if !ok {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading PKCS#12 password from standard input: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	secret, err := config.ResolveSecret(password)
+	if err != nil {
+		return fmt.Errorf("PKCS#12 password: %w", err)
+	}
+	defer zeroize.Bytes(secret)
+	if err := importPKCS12(credPath, secret, cfg.CertConfigs); err != nil {
+		return err
+	}
+	fmt.Printf("%s: imported\n", credPath)
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package main
+
+import (
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/keychain"
+)
+
+// importPKCS12 imports the PKCS#12 file into the default keychain, or, with
+// legacy_keychain, into the keychain selected by the keychain_type of the
+// macos_keychain block.
+func importPKCS12(credPath string, password []byte, certConfigs config.CertConfigs) error {
+	opts := keychain.ImportOptions{Legacy: certConfigs.MacOSKeychain.LegacyKeychain}
+	switch keychainType := certConfigs.MacOSKeychain.KeychainType; keychainType {
+	case "login", "system":
+		opts.Keychain = keychainType
+	}
+	return keychain.ImportPKCS12CredWithOptions(credPath, password, opts)
+}
@@ -0,0 +1,29 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !((darwin || linux || freebsd || openbsd) && cgo) && !(linux && (amd64 || arm64))
+// +build !windows
+// +build !darwin,!linux,!freebsd,!openbsd !cgo
+// +build !linux !amd64,!arm64
+
+package main
+
+import (
+	"errors"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+func importPKCS12(string, []byte, config.CertConfigs) error {
+	return errors.New("import is not supported on this platform")
+}
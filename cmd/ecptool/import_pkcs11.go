@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build (linux && cgo) || (freebsd && cgo) || (openbsd && cgo) || (linux && amd64) || (linux && arm64)
+// +build linux,cgo freebsd,cgo openbsd,cgo linux,amd64 linux,arm64
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// importPKCS12 imports the PKCS#12 file into the token selected by the pkcs11
+// block, using its first module.
+func importPKCS12(credPath string, password []byte, certConfigs config.CertConfigs) error {
+	p := certConfigs.PKCS11
+	if len(p.PKCS11Module) == 0 {
+		return errors.New("cert_configs.pkcs11.module must be set")
+	}
+	pin, err := config.ResolveSecret(p.UserPin)
+	if err != nil {
+		return fmt.Errorf("pkcs11 user_pin: %w", err)
+	}
+	defer zeroize.Bytes(pin)
+	return pkcs11.ImportPKCS12Cred(credPath, password, p.PKCS11Module[0], p.Slot, p.Label, pin)
+}
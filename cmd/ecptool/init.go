@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+// A candidate is a certificate found in a keystore, together with the
+// cert_configs block that selects it.
+type candidate struct {
+	backend string            // The backend of the block, such as config.BackendPKCS11.
+	block   map[string]string // The fields of the cert_configs block.
+	cert    *x509.Certificate // The certificate, or nil if it was not probed.
+	where   string            // Where the certificate was found, for display.
+}
+
+// initConfig writes a certificate config file for the keystore of the current
+// OS, selecting a certificate found in it by the flags, or interactively.
+func initConfig(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	libs := fs.String("libs", "", "directory holding the signer binary and libraries, instead of the directory of ecptool")
+	issuer := fs.String("issuer", "", "issuer common name of the certificate, instead of probing the keychain or certificate store (MacOS and Windows)")
+	store := fs.String("store", "MY", "Windows certificate store to search")
+	provider := fs.String("provider", "current_user", "Windows certificate store location of the certificate, used with -issuer: current_user or local_machine")
+	module := fs.String("module", "", "PKCS#11 module to probe, instead of the p11-kit proxy module (Linux)")
+	slot := fs.String("slot", "", "hexadecimal PKCS#11 slot ID of the certificate, used with -label")
+	label := fs.String("label", "", "PKCS#11 label of the certificate, instead of probing the tokens (Linux)")
+	choice := fs.Int("select", 0, "number of the probed certificate to use, instead of asking")
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := configFilePath(fs.Arg(0))
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("%s already exists, pass -force to overwrite it", path)
+	}
+
+	backend := config.NativeBackend(runtime.GOOS)
+	var selected *candidate
+	switch {
+	case backend == config.BackendMacOSKeychain && *issuer != "":
+		selected = &candidate{backend: backend, block: map[string]string{"issuer": *issuer}}
+	case backend == config.BackendWindowsStore && *issuer != "":
+		selected = &candidate{backend: backend, block: map[string]string{"issuer": *issuer, "store": *store, "provider": *provider}}
+	case backend == config.BackendPKCS11 && *label != "":
+		selected = &candidate{backend: backend, block: map[string]string{"label": *label, "slot": *slot, "module": *module}}
+	default:
+		candidates, err := probeCandidates(*store, *module)
+		if err != nil {
+			return fmt.Errorf("probing the keystore: %w", err)
+		}
+		if len(candidates) == 0 {
+			return errors.New("no certificate with a private key was found, import one with ecptool import or pass its location with flags")
+		}
+		disambiguate(candidates)
+		if selected, err = chooseCandidate(candidates, *choice, os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	if *libs == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("locating the signer binary: %w", err)
+		}
+		*libs = filepath.Dir(exe)
+	}
+	data, err := encodeConfig(selected, signerLibs(*libs))
+	if err != nil {
+		return err
+	}
+	var cfg config.EnterpriseCertificateConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("the generated config is invalid: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%s: written\n", path)
+	return nil
+}
+
+// disambiguate adds the SHA-256 fingerprint of the certificate to the blocks of
+// candidates whose block would also select another candidate, since the
+// signer uses the first match.
+func disambiguate(candidates []candidate) {
+	blocks := make(map[string]int)
+	for _, c := range candidates {
+		blocks[blockKey(c)]++
+	}
+	for _, c := range candidates {
+		if blocks[blockKey(c)] > 1 && c.cert != nil {
+			sum := sha256.Sum256(c.cert.Raw)
+			c.block["sha256_fingerprint"] = hex.EncodeToString(sum[:])
+		}
+	}
+}
+
+// blockKey returns a key identifying the cert_configs block of c.
+func blockKey(c candidate) string {
+	b, _ := json.Marshal(c.block)
+	return c.backend + string(b)
+}
+
+// chooseCandidate returns candidates[choice-1], or if choice is 0, lists the
+// candidates and reads the number of the one to use from in.
+func chooseCandidate(candidates []candidate, choice int, in io.Reader) (*candidate, error) {
+	if choice == 0 {
+		fmt.Println("Certificates found:")
+		for i, c := range candidates {
+			fmt.Printf("  %d) %s\n     issuer: %s, expires: %s, in: %s\n", i+1, c.cert.Subject, c.cert.Issuer, c.cert.NotAfter.Format(time.RFC3339), c.where)
+		}
+		fmt.Printf("Certificate to use [1-%d]: ", len(candidates))
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("reading the choice from standard input: %w", err)
+		}
+		if choice, err = strconv.Atoi(strings.TrimSpace(line)); err != nil {
+			return nil, fmt.Errorf("invalid choice %q", strings.TrimSpace(line))
+		}
+	}
+	if choice < 1 || choice > len(candidates) {
+		return nil, fmt.Errorf("choice must be between 1 and %d, got %d", len(candidates), choice)
+	}
+	return &candidates[choice-1], nil
+}
+
+// signerLibs returns the libs block for the signer binary and libraries in
+// dir, named as in the release archives. The libraries are only listed if
+// they exist.
+func signerLibs(dir string) map[string]string {
+	exe, lib := "", ".so"
+	switch runtime.GOOS {
+	case "windows":
+		exe, lib = ".exe", ".dll"
+	case "darwin":
+		lib = ".dylib"
+	}
+	libs := map[string]string{"ecp": filepath.Join(dir, "ecp"+exe)}
+	if _, err := os.Stat(libs["ecp"]); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: signer binary %s not found, pass its directory with -libs\n", libs["ecp"])
+	}
+	for name, file := range map[string]string{"ecp_client": "libecp" + lib, "tls_offload": "libtls_offload" + lib} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			libs[name] = filepath.Join(dir, file)
+		}
+	}
+	return libs
+}
+
+// encodeConfig returns the config file selecting c, with only the fields that
+// are set, as gcloud writes it.
+func encodeConfig(c *candidate, libs map[string]string) ([]byte, error) {
+	block := make(map[string]string)
+	for k, v := range c.block {
+		if v != "" {
+			block[k] = v
+		}
+	}
+	data, err := json.MarshalIndent(map[string]any{
+		"cert_configs": map[string]any{c.backend: block},
+		"libs":         libs,
+		"version":      config.CurrentVersion,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
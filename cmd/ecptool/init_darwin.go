@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/security"
+)
+
+// probeCandidates lists the identities of the file-based keychains in the
+// search list of the user, found with the security command line tool.
+func probeCandidates(_, _ string) ([]candidate, error) {
+	identities, err := security.Identities(nil)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []candidate
+	for _, xc := range identities {
+		candidates = append(candidates, candidate{
+			backend: config.BackendMacOSKeychain,
+			block:   map[string]string{"issuer": xc.Issuer.CommonName},
+			cert:    xc,
+			where:   "keychain",
+		})
+	}
+	return candidates, nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !darwin && !windows && !((linux || freebsd || openbsd) && cgo) && !(linux && (amd64 || arm64))
+// +build !darwin
+// +build !windows
+// +build !linux,!freebsd,!openbsd !cgo
+// +build !linux !amd64,!arm64
+
+package main
+
+import "errors"
+
+func probeCandidates(string, string) ([]candidate, error) {
+	return nil, errors.New("probing keystores is not supported on this platform, pass the location of the certificate with flags")
+}
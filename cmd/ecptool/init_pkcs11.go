@@ -0,0 +1,52 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build (linux && cgo) || (freebsd && cgo) || (openbsd && cgo) || (linux && amd64) || (linux && arm64)
+// +build linux,cgo freebsd,cgo openbsd,cgo linux,amd64 linux,arm64
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11"
+)
+
+// probeCandidates lists the certificate objects of module, or of the p11-kit
+// proxy module if module is empty. The blocks select the certificates by label
+// rather than slot, since slot IDs may change when tokens are reinserted.
+func probeCandidates(_, module string) ([]candidate, error) {
+	path := module
+	if path == "" {
+		modules, err := pkcs11.DiscoverModules()
+		if err != nil {
+			return nil, fmt.Errorf("%w, pass one with -module", err)
+		}
+		path = modules[0]
+	}
+	certs, err := pkcs11.Certificates(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var candidates []candidate
+	for _, c := range certs {
+		candidates = append(candidates, candidate{
+			backend: config.BackendPKCS11,
+			block:   map[string]string{"label": c.Label, "module": module},
+			cert:    c.Cert,
+			where:   fmt.Sprintf("token %q in slot 0x%x of %s", c.TokenLabel, c.Slot, path),
+		})
+	}
+	return candidates, nil
+}
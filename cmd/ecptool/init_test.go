@@ -0,0 +1,217 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+func testCert(name string) *x509.Certificate {
+	return &x509.Certificate{Raw: []byte(name), Subject: pkix.Name{CommonName: name}, Issuer: pkix.Name{CommonName: "Test CA"}}
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDisambiguate(t *testing.T) {
+	a, b, c := testCert("a"), testCert("b"), testCert("c")
+	tests := []struct {
+		name       string
+		candidates []candidate
+		want       []map[string]string
+	}{
+		{
+			name: "distinct blocks",
+			candidates: []candidate{
+				{backend: config.BackendPKCS11, block: map[string]string{"label": "a"}, cert: a},
+				{backend: config.BackendPKCS11, block: map[string]string{"label": "b"}, cert: b},
+			},
+			want: []map[string]string{{"label": "a"}, {"label": "b"}},
+		},
+		{
+			name: "same block",
+			candidates: []candidate{
+				{backend: config.BackendMacOSKeychain, block: map[string]string{"issuer": "Test CA"}, cert: a},
+				{backend: config.BackendMacOSKeychain, block: map[string]string{"issuer": "Test CA"}, cert: b},
+				{backend: config.BackendMacOSKeychain, block: map[string]string{"issuer": "Other CA"}, cert: c},
+			},
+			want: []map[string]string{
+				{"issuer": "Test CA", "sha256_fingerprint": fingerprint(a)},
+				{"issuer": "Test CA", "sha256_fingerprint": fingerprint(b)},
+				{"issuer": "Other CA"},
+			},
+		},
+		{
+			name: "same block of other backends",
+			candidates: []candidate{
+				{backend: config.BackendMacOSKeychain, block: map[string]string{"issuer": "Test CA"}, cert: a},
+				{backend: config.BackendWindowsStore, block: map[string]string{"issuer": "Test CA"}, cert: b},
+			},
+			want: []map[string]string{{"issuer": "Test CA"}, {"issuer": "Test CA"}},
+		},
+		{
+			name: "unprobed certificate",
+			candidates: []candidate{
+				{backend: config.BackendPKCS11, block: map[string]string{"label": "a"}},
+				{backend: config.BackendPKCS11, block: map[string]string{"label": "a"}, cert: a},
+			},
+			want: []map[string]string{{"label": "a"}, {"label": "a", "sha256_fingerprint": fingerprint(a)}},
+		},
+	}
+	for _, test := range tests {
+		disambiguate(test.candidates)
+		for i, c := range test.candidates {
+			if !reflect.DeepEqual(c.block, test.want[i]) {
+				t.Errorf("%s: block %d: got %v, want %v", test.name, i, c.block, test.want[i])
+			}
+		}
+	}
+}
+
+func TestChooseCandidate(t *testing.T) {
+	candidates := []candidate{
+		{backend: config.BackendPKCS11, cert: testCert("a"), where: "token a"},
+		{backend: config.BackendPKCS11, cert: testCert("b"), where: "token b"},
+	}
+	tests := []struct {
+		name    string
+		choice  int
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{name: "flag", choice: 2, want: 1},
+		{name: "flag out of range", choice: 3, wantErr: true},
+		{name: "negative flag", choice: -1, wantErr: true},
+		{name: "input", input: "1\n", want: 0},
+		{name: "input without newline", input: " 2 ", want: 1},
+		{name: "input out of range", input: "0\n", wantErr: true},
+		{name: "invalid input", input: "b\n", wantErr: true},
+		{name: "no input", input: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := chooseCandidate(candidates, test.choice, strings.NewReader(test.input))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", test.name, got.where)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got != &candidates[test.want] {
+			t.Errorf("%s: got %v, want %v", test.name, got.where, candidates[test.want].where)
+		}
+	}
+}
+
+func TestEncodeConfig(t *testing.T) {
+	libs := map[string]string{"ecp": "/opt/ecp/ecp"}
+	tests := []struct {
+		candidate candidate
+		want      string
+	}{
+		{
+			candidate: candidate{backend: config.BackendPKCS11, block: map[string]string{"label": "cert", "slot": "", "module": ""}},
+			want: `{
+  "cert_configs": {
+    "pkcs11": {
+      "label": "cert"
+    }
+  },
+  "libs": {
+    "ecp": "/opt/ecp/ecp"
+  },
+  "version": 1
+}
+`,
+		},
+		{
+			candidate: candidate{backend: config.BackendWindowsStore, block: map[string]string{"issuer": "Test CA", "store": "MY", "provider": "current_user"}},
+			want: `{
+  "cert_configs": {
+    "windows_store": {
+      "issuer": "Test CA",
+      "provider": "current_user",
+      "store": "MY"
+    }
+  },
+  "libs": {
+    "ecp": "/opt/ecp/ecp"
+  },
+  "version": 1
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		data, err := encodeConfig(&test.candidate, libs)
+		if err != nil {
+			t.Errorf("encodeConfig(%v): %v", test.candidate.block, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("encodeConfig(%v): got\n%s\nwant\n%s", test.candidate.block, data, test.want)
+		}
+	}
+}
+
+func TestSignerLibs(t *testing.T) {
+	exe, lib := "", ".so"
+	switch runtime.GOOS {
+	case "windows":
+		exe, lib = ".exe", ".dll"
+	case "darwin":
+		lib = ".dylib"
+	}
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{name: "empty", want: []string{"ecp"}},
+		{name: "binary", files: []string{"ecp" + exe}, want: []string{"ecp"}},
+		{name: "all", files: []string{"ecp" + exe, "libecp" + lib, "libtls_offload" + lib}, want: []string{"ecp", "ecp_client", "tls_offload"}},
+		{name: "other libraries", files: []string{"libecp.a", "libtls_offload" + lib + ".1"}, want: []string{"ecp"}},
+	}
+	names := map[string]string{"ecp": "ecp" + exe, "ecp_client": "libecp" + lib, "tls_offload": "libtls_offload" + lib}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, file := range test.files {
+			if err := os.WriteFile(filepath.Join(dir, file), nil, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := make(map[string]string)
+		for _, name := range test.want {
+			want[name] = filepath.Join(dir, names[name])
+		}
+		if got := signerLibs(dir); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, want)
+		}
+	}
+}
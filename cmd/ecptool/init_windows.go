@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/windows/ncrypt"
+)
+
+// probeCandidates lists the certificates with a usable private key in store,
+// for the current user and then for the local machine. The local machine store
+// is skipped if it cannot be opened, such as without administrator rights.
+func probeCandidates(store, _ string) ([]candidate, error) {
+	var candidates []candidate
+	for _, provider := range []string{"current_user", "local_machine"} {
+		identities, err := ncrypt.Identities(store, provider)
+		if err != nil {
+			if provider == "current_user" {
+				return nil, err
+			}
+			continue
+		}
+		for _, xc := range identities {
+			candidates = append(candidates, candidate{
+				backend: config.BackendWindowsStore,
+				block:   map[string]string{"issuer": xc.Issuer.CommonName, "store": store, "provider": provider},
+				cert:    xc,
+				where:   fmt.Sprintf("%s store of %s", store, provider),
+			})
+		}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ecptool is a command line tool for administrators to set up and troubleshoot
+// enterprise certificate proxy configurations.
+//
+// Usage:
+//
+//	ecptool <command> [flags] [config file path]
+//
+// If no config file path is given, the path is read from the
+// GOOGLE_API_CERTIFICATE_CONFIG environment variable, falling back to the
+// default gcloud location.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/version"
+)
+
+// A command is an ecptool subcommand.
+type command struct {
+	name  string                    // The name used to invoke the command.
+	short string                    // A one line description of the command.
+	run   func(args []string) error // Runs the command with the arguments following its name.
+}
+
+var commands = []command{
+	{name: "init", short: "write a certificate config file for a certificate found in the keystore", run: initConfig},
+	{name: "validate-config", short: "check a certificate config file for errors", run: validateConfig},
+	{name: "doctor", short: "load the certificate and check its expiry and revocation status", run: doctor},
+	{name: "import", short: "import a PKCS#12 file into the configured keystore", run: importCred},
+	{name: "fix-partition-list", short: "allow the signer to use keychain keys deployed by MDM (MacOS)", run: fixPartitionList},
+	{name: "protect-pin", short: "encrypt a smart card PIN with DPAPI for use in the config (Windows)", run: protectPIN},
+	{name: "gen-csr", short: "create a certificate signing request signed by the configured key", run: genCSR},
+	{name: "export", short: "write the certificate chain as a PEM, PKCS#7 or JKS trust bundle", run: export},
+	{name: "bench", short: "measure Sign latency and throughput of the configured keystore", run: bench},
+	{name: "watch", short: "check the certificate expiry periodically and notify before it lapses", run: watch},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ecptool <command> [flags] [config file path]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", c.name, c.short)
+	}
+}
+
+// configFilePath resolves the config file path the same way client.Cred does.
+func configFilePath(path string) string {
+	if path != "" {
+		return path
+	}
+	if envFilePath := util.GetConfigFilePathFromEnv(); envFilePath != "" {
+		return envFilePath
+	}
+	return util.GetDefaultConfigFilePath()
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	if os.Args[1] == "--version" {
+		fmt.Println(version.String())
+		return
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "ecptool %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "ecptool: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+// fixPartitionList adds the signer to the partition list of the signing keys
+// in the configured MacOS keychain, so that identities deployed by MDM can be
+// used without prompts. It is the equivalent of running
+// "security set-key-partition-list" by hand.
+func fixPartitionList(args []string) error {
+	fs := flag.NewFlagSet("fix-partition-list", flag.ExitOnError)
+	keychain := fs.String("keychain", "", "path of the keychain holding the key, instead of the one selected by keychain_type")
+	partitions := fs.String("partitions", "", "comma separated partition IDs to allow, instead of Apple tools and the team of the signer binary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := configFilePath(fs.Arg(0))
+
+	config, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return setKeyPartitionList(config, *keychain, *partitions)
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+// setKeyPartitionList runs "security set-key-partition-list" on the signing
+// keys of the keychain. security prompts for the keychain password.
+func setKeyPartitionList(cfg config.EnterpriseCertificateConfig, keychain, partitions string) error {
+	if keychain == "" {
+		keychain = defaultKeychainPath(cfg.CertConfigs.MacOSKeychain.KeychainType)
+	}
+	if partitions == "" {
+		signers := cfg.Signers(runtime.GOOS)
+		if len(signers) == 0 {
+			return fmt.Errorf("libs.ecp must be set to the path of the signer binary, or -partitions given")
+		}
+		partitions = "apple-tool:,apple:," + partitionID(signers[0].Path)
+	}
+	fmt.Printf("Allowing partitions %s for the signing keys in %s\n", partitions, keychain)
+	cmd := exec.Command("security", "set-key-partition-list", "-S", partitions, "-s", keychain)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("security set-key-partition-list: %w", err)
+	}
+	return nil
+}
+
+// defaultKeychainPath returns the path of the keychain selected by
+// keychainType. The login keychain is used unless the system keychain is
+// selected.
+func defaultKeychainPath(keychainType string) string {
+	if keychainType == "system" {
+		return "/Library/Keychains/System.keychain"
+	}
+	return filepath.Join(config.HomeDir(), "Library/Keychains/login.keychain-db")
+}
+
+// partitionID returns the partition ID of the code signature of the binary at
+// path: "teamid:" followed by its team identifier, or "unsigned:".
+func partitionID(path string) string {
+	// codesign writes the details of the signature to standard error.
+	var stderr bytes.Buffer
+	cmd := exec.Command("codesign", "-dv", path)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		for _, line := range strings.Split(stderr.String(), "\n") {
+			if !strings.HasPrefix(line, "TeamIdentifier=") {
+				continue
+			}
+			if team := strings.TrimSpace(strings.TrimPrefix(line, "TeamIdentifier=")); team != "not set" {
+				return "teamid:" + team
+			}
+		}
+	}
+	return "unsigned:"
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// protectPIN encrypts a smart card PIN read from standard input with the
+// Windows DPAPI, writes it to a file and prints the secret URI referencing it,
+// to be used as the pin of the config instead of the PIN itself.
+func protectPIN(args []string) error {
+	fs := flag.NewFlagSet("protect-pin", flag.ExitOnError)
+	out := fs.String("out", "", "path of the file to write the protected PIN to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("usage: ecptool protect-pin -out <file>")
+	}
+	path, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("reading PIN from standard input: %w", err)
+	}
+	pin := []byte(strings.TrimRight(line, "\r\n"))
+	defer zeroize.Bytes(pin)
+	if len(pin) == 0 {
+		return errors.New("empty PIN")
+	}
+	blob, err := config.ProtectSecret(pin)
+	if err != nil {
+		return fmt.Errorf("protecting PIN: %w", err)
+	}
+	if err := os.WriteFile(path, blob, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("pin: %s://%s\n", config.DPAPIScheme, filepath.ToSlash(path))
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+// validateConfig checks that a certificate config file is valid and names a
+// signer binary.
+func validateConfig(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := configFilePath(fs.Arg(0))
+
+	config, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if config.Libs.ECP == "" && len(config.Libs.Signers) == 0 {
+		return fmt.Errorf("%s: libs.ecp must be set to the path of the signer binary", path)
+	}
+	fmt.Printf("%s: OK (version %d)\n", path, config.Version)
+	return nil
+}
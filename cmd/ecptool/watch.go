@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+)
+
+// errExpiresSoon is returned by watch when the certificate expires within the
+// warning window and no notification command is configured.
+var errExpiresSoon = errors.New("certificate expires soon")
+
+// watch checks the expiry of the configured certificate, once or
+// periodically, and runs a notification command or fails when it is about to
+// expire.
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", 0, "time between checks; 0 checks once, for running from cron")
+	within := fs.Duration("within", 0, "warning window before expiry; defaults to the expiry warning of the config (720h)")
+	notify := fs.String("notify", "", "command run through the shell when the certificate expires soon, instead of exiting with an error")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval < 0 || *within < 0 {
+		return fmt.Errorf("-interval and -within must not be negative")
+	}
+	path := configFilePath(fs.Arg(0))
+
+	for {
+		err := watchOnce(path, *within, *notify)
+		if *interval == 0 {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", time.Now().Format(time.RFC3339), err)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// watchOnce loads the configured certificate and checks its expiry.
+func watchOnce(path string, within time.Duration, notify string) error {
+	key, err := client.Cred(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	leaf, err := x509.ParseCertificate(key.CertificateChain()[0])
+	metadata := key.Metadata()
+	key.Close()
+	if err != nil {
+		return fmt.Errorf("parsing leaf certificate: %w", err)
+	}
+
+	expiresSoon := metadata.ExpiresSoon
+	if within > 0 {
+		expiresSoon = !time.Now().Add(within).Before(leaf.NotAfter)
+	}
+	fmt.Printf("%s: certificate %s expires %s\n", time.Now().Format(time.RFC3339), leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+	if !expiresSoon {
+		return nil
+	}
+	if notify == "" {
+		return errExpiresSoon
+	}
+	cmd := shellCommand(notify)
+	cmd.Env = append(os.Environ(),
+		"ECP_CONFIG_FILE="+path,
+		"ECP_CERT_SUBJECT="+leaf.Subject.String(),
+		"ECP_CERT_NOT_AFTER="+leaf.NotAfter.Format(time.RFC3339),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running notification command: %w", err)
+	}
+	return nil
+}
+
+// shellCommand returns a command running command line through the shell of
+// the OS.
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("/bin/sh", "-c", line)
+}
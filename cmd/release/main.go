@@ -0,0 +1,188 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Release builds the signer binary and the shared library for a release
+// target, embedding the version from version.txt and the current git commit.
+//
+// Usage, from the root of the repository:
+//
+//	go run ./cmd/release [-target darwin_universal] [-out dir] [-sign identity]
+//
+// The darwin_universal target builds both darwin architectures and merges them
+// with lipo. When -sign is given, the darwin binaries are signed with codesign
+// using the hardened runtime.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const versionPackage = "github.com/googleapis/enterprise-certificate-proxy/internal/version"
+
+// A target is a platform the release tooling can build for.
+type target struct {
+	goos     string
+	goarchs  []string // More than one architecture produces a universal binary.
+	library  string   // File name of the shared library.
+	signer   string   // File name of the signer binary.
+	archives bool     // Whether to also build a static archive of the library.
+	signerOS string   // The OS whose signer is built, if not goos.
+}
+
+var targets = map[string]target{
+	"darwin_amd64":     {goos: "darwin", goarchs: []string{"amd64"}, library: "libecp.dylib", signer: "ecp"},
+	"darwin_arm64":     {goos: "darwin", goarchs: []string{"arm64"}, library: "libecp.dylib", signer: "ecp"},
+	"darwin_universal": {goos: "darwin", goarchs: []string{"amd64", "arm64"}, library: "libecp.dylib", signer: "ecp"},
+	"linux_amd64":      {goos: "linux", goarchs: []string{"amd64"}, library: "libecp.so", signer: "ecp"},
+	"linux_386":        {goos: "linux", goarchs: []string{"386"}, library: "libecp.so", signer: "ecp"},
+	"freebsd_amd64":    {goos: "freebsd", goarchs: []string{"amd64"}, library: "libecp.so", signer: "ecp", signerOS: "linux"},
+	"openbsd_amd64":    {goos: "openbsd", goarchs: []string{"amd64"}, library: "libecp.so", signer: "ecp", signerOS: "linux"},
+	"windows_amd64":    {goos: "windows", goarchs: []string{"amd64"}, library: "libecp.dll", signer: "ecp.exe", archives: true},
+	"windows_arm64":    {goos: "windows", goarchs: []string{"arm64"}, library: "libecp.dll", signer: "ecp.exe", archives: true},
+}
+
+// ldflags returns the linker flags that embed version and commit.
+func ldflags(version, commit string) string {
+	return fmt.Sprintf("-X=%s.Version=%s -X=%s.Commit=%s", versionPackage, version, versionPackage, commit)
+}
+
+// run runs a command, forwarding its output, with extra environment variables.
+func run(env []string, name string, args ...string) error {
+	log.Printf("%s %s", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.Run()
+}
+
+// buildArch builds the signer binary and the shared library of t for a single
+// architecture into dir.
+func buildArch(t target, goarch, flags, dir string) error {
+	env := []string{"GOOS=" + t.goos, "GOARCH=" + goarch, "CGO_ENABLED=1", "GO111MODULE=on"}
+	signerOS := t.signerOS
+	if signerOS == "" {
+		signerOS = t.goos
+	}
+	signer := "./internal/signer/" + signerOS
+	if err := run(env, "go", "build", "-ldflags="+flags, "-o", filepath.Join(dir, t.signer), signer); err != nil {
+		return err
+	}
+	if err := run(env, "go", "build", "-buildmode=c-shared", "-ldflags="+flags, "-o", filepath.Join(dir, t.library), "./cshared"); err != nil {
+		return err
+	}
+	if t.archives {
+		if err := run(env, "go", "build", "-buildmode=c-archive", "-ldflags="+flags, "-o", filepath.Join(dir, "libecp.lib"), "./cshared"); err != nil {
+			return err
+		}
+	}
+	// The generated C header is not shipped.
+	if err := os.Remove(filepath.Join(dir, "libecp.h")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// build builds t into out, merging architectures with lipo when needed.
+func build(t target, flags, out string) error {
+	if len(t.goarchs) == 1 {
+		return buildArch(t, t.goarchs[0], flags, out)
+	}
+	tmp, err := os.MkdirTemp("", "ecp-release")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for _, goarch := range t.goarchs {
+		if err := buildArch(t, goarch, flags, filepath.Join(tmp, goarch)); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{t.signer, t.library} {
+		args := []string{"-create", "-output", filepath.Join(out, name)}
+		for _, goarch := range t.goarchs {
+			args = append(args, filepath.Join(tmp, goarch, name))
+		}
+		if err := run(nil, "lipo", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sign signs the darwin binaries of t in out with the given identity.
+func sign(t target, identity, out string) error {
+	for _, name := range []string{t.signer, t.library} {
+		if err := run(nil, "codesign", "--force", "--timestamp", "--options", "runtime", "--sign", identity, filepath.Join(out, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gitCommit() string {
+	commit, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(commit))
+}
+
+func main() {
+	targetName := flag.String("target", runtime.GOOS+"_"+runtime.GOARCH, "release target, one of darwin_amd64, darwin_arm64, darwin_universal, linux_amd64, linux_386, freebsd_amd64, openbsd_amd64, windows_amd64 or windows_arm64")
+	out := flag.String("out", "", "output directory (default build/bin/<target>)")
+	identity := flag.String("sign", "", "codesign identity used to sign darwin binaries")
+	commit := flag.String("commit", "", "commit embedded in the binaries (default: git HEAD)")
+	flag.Parse()
+
+	t, ok := targets[*targetName]
+	if !ok {
+		log.Fatalf("Unknown target %q", *targetName)
+	}
+	if *identity != "" && t.goos != "darwin" {
+		log.Fatalf("-sign is only supported for darwin targets")
+	}
+	if *out == "" {
+		*out = filepath.Join("build", "bin", *targetName)
+	}
+	if *commit == "" {
+		*commit = gitCommit()
+	}
+	version, err := os.ReadFile("version.txt")
+	if err != nil {
+		log.Fatalf("Failed to read version: %v", err)
+	}
+
+	if err := os.RemoveAll(*out); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := build(t, ldflags(strings.TrimSpace(string(version)), *commit), *out); err != nil {
+		log.Fatalf("Failed to build %s: %v", *targetName, err)
+	}
+	if *identity != "" {
+		if err := sign(t, *identity, *out); err != nil {
+			log.Fatalf("Failed to sign %s: %v", *targetName, err)
+		}
+	}
+	log.Printf("Built %s into %s", *targetName, *out)
+}
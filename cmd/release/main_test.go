@@ -0,0 +1,38 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLdflags builds ecptool with the release linker flags to make sure they
+// reference the right symbols.
+func TestLdflags(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "ecptool")
+	build := exec.Command("go", "build", "-ldflags="+ldflags("v1.2.3", "abc1234"), "-o", binary, "../ecptool")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v: %s", err, out)
+	}
+	out, err := exec.Command(binary, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "v1.2.3 (commit abc1234, "; !strings.HasPrefix(got, want) {
+		t.Errorf("Expected version to start with %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// cancelToken is a cancellation token handed out by NewCancelToken.
+type cancelToken struct {
+	once sync.Once
+	done chan struct{}
+}
+
+var (
+	cancelTokensMu  sync.Mutex
+	cancelTokens    = make(map[int]*cancelToken)
+	nextCancelToken = 1
+)
+
+// NewCancelToken returns a cancellation token, to be passed to the
+// WithTimeout variants of the exports and canceled with CancelToken from
+// another thread. Release it with ReleaseCancelToken once it is no longer
+// needed.
+//
+//export NewCancelToken
+func NewCancelToken() int {
+	cancelTokensMu.Lock()
+	defer cancelTokensMu.Unlock()
+	token := nextCancelToken
+	nextCancelToken++
+	cancelTokens[token] = &cancelToken{done: make(chan struct{})}
+	return token
+}
+
+// CancelToken cancels the operations that were passed token. Operations that
+// are passed it afterwards fail immediately.
+//
+//export CancelToken
+func CancelToken(token int) {
+	cancelTokensMu.Lock()
+	t := cancelTokens[token]
+	cancelTokensMu.Unlock()
+	if t != nil {
+		t.once.Do(func() { close(t.done) })
+	}
+}
+
+// ReleaseCancelToken releases a token returned by NewCancelToken.
+//
+//export ReleaseCancelToken
+func ReleaseCancelToken(token int) {
+	cancelTokensMu.Lock()
+	defer cancelTokensMu.Unlock()
+	delete(cancelTokens, token)
+}
+
+// cancelChannel returns the channel closed when token is canceled, or nil for
+// the zero token and unknown tokens.
+func cancelChannel(token int) <-chan struct{} {
+	cancelTokensMu.Lock()
+	defer cancelTokensMu.Unlock()
+	if t := cancelTokens[token]; t != nil {
+		return t.done
+	}
+	return nil
+}
+
+// keyCall tracks the Key of an operation run by runWithKey, so that it can be
+// closed when the operation is abandoned.
+type keyCall struct {
+	mu        sync.Mutex
+	key       *client.Key
+	abandoned bool
+}
+
+// start records key, and reports whether the operation should proceed.
+func (c *keyCall) start(key *client.Key) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.key = key
+	return !c.abandoned
+}
+
+// abandon closes the Key of the operation, which stops the signer subprocess
+// and fails a pending operation on it.
+func (c *keyCall) abandon() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.abandoned = true
+	if c.key != nil {
+		closeKey(c.key)
+	}
+}
+
+func closeKey(key *client.Key) {
+	if err := key.Close(); err != nil {
+		log.Printf("Failed to clean up key. %v", err)
+	}
+}
+
+// runWithKey runs op with the Key of configFilePath and returns its result. It
+// gives up when timeout elapses, if it is positive, or when done is closed.
+// On failure, it returns nil and a negative ECP_ERR_* code. Since op may still
+// be running in the background, it must not access memory owned by the
+// caller.
+func runWithKey(configFilePath string, timeout time.Duration, done <-chan struct{}, op func(*client.Key) ([]byte, error)) ([]byte, int) {
+	type result struct {
+		output []byte
+		err    error
+	}
+	c := new(keyCall)
+	results := make(chan result, 1)
+	go func() {
+		key, err := client.Cred(configFilePath)
+		if err != nil {
+			results <- result{err: fmt.Errorf("could not create client using config %s: %w", configFilePath, err)}
+			return
+		}
+		defer closeKey(key)
+		if !c.start(key) {
+			return
+		}
+		output, err := op(key)
+		results <- result{output, err}
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case r := <-results:
+		if r.err != nil {
+			return nil, failErr(r.err, "Operation failed")
+		}
+		return r.output, 0
+	case <-timer:
+		c.abandon()
+		return nil, fail(codeTimeout, "Operation timed out after %v", timeout)
+	case <-done:
+		c.abandon()
+		return nil, fail(codeCanceled, "Operation was canceled")
+	}
+}
+
+// SignWithTimeout is SignWithErrorCode, bounded by timeoutMillis and by
+// cancelToken. The time spent starting the signer, such as waiting for a smart
+// card, counts towards the timeout. A timeoutMillis of 0 or less disables the
+// timeout, and a cancelToken of 0 disables cancellation. It returns ECP_ERR_TIMEOUT or
+// ECP_ERR_CANCELED when the operation times out or is canceled, after
+// stopping the signer subprocess.
+//
+//export SignWithTimeout
+func SignWithTimeout(configFilePath *C.char, digest *byte, digestLen int, sigHolder *byte, sigHolderLen int, timeoutMillis int, cancelToken int) int {
+	enableECPLogging()
+	if !validBuffer(digest, digestLen) || !validBuffer(sigHolder, sigHolderLen) {
+		return errInvalidArgument()
+	}
+	// The operation may outlive this call, so it works on a copy of the digest.
+	digestCopy := append([]byte(nil), unsafe.Slice(digest, digestLen)...)
+	signature, code := runWithKey(C.GoString(configFilePath), time.Duration(timeoutMillis)*time.Millisecond, cancelChannel(cancelToken), func(key *client.Key) ([]byte, error) {
+		defer zeroize.Bytes(digestCopy)
+		return signDigest(key, digestCopy)
+	})
+	if signature == nil {
+		return code
+	}
+	if sigHolderLen < len(signature) {
+		return errBufferTooSmall("sigHolder", sigHolderLen, len(signature))
+	}
+	copy(unsafe.Slice(sigHolder, sigHolderLen), signature)
+	return succeed(len(signature))
+}
+
+// SignForPythonWithTimeout is SignWithTimeout, for Python callers.
+//
+//export SignForPythonWithTimeout
+func SignForPythonWithTimeout(configFilePath *C.char, digest *byte, digestLen int, sigHolder *byte, sigHolderLen int, timeoutMillis int, cancelToken int) int {
+	return SignWithTimeout(configFilePath, digest, digestLen, sigHolder, sigHolderLen, timeoutMillis, cancelToken)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+/*
+#include <stdint.h>
+
+#ifdef _WIN32
+#include <windows.h>
+static inline uintptr_t ecp_thread_id(void) { return (uintptr_t)GetCurrentThreadId(); }
+#else
+#include <pthread.h>
+static inline uintptr_t ecp_thread_id(void) { return (uintptr_t)pthread_self(); }
+#endif
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+// lastErrors holds, like errno, the message of the last failed call of each
+// calling thread. Exported functions run on the thread of their caller.
+var (
+	lastErrorsMu sync.Mutex
+	lastErrors   = make(map[C.uintptr_t]string)
+)
+
+// fail logs the failure described by format, records it as the last error of
+// the calling thread, and returns code.
+func fail(code int, format string, v ...any) int {
+	msg := fmt.Sprintf(format, v...)
+	log.Print(msg)
+	lastErrorsMu.Lock()
+	lastErrors[C.ecp_thread_id()] = msg
+	lastErrorsMu.Unlock()
+	return code
+}
+
+// failErr is fail with the code that classifies err.
+func failErr(err error, format string, v ...any) int {
+	return fail(errorCode(err), "%s: %v", fmt.Sprintf(format, v...), err)
+}
+
+// succeed clears the last error of the calling thread and returns n.
+func succeed(n int) int {
+	lastErrorsMu.Lock()
+	delete(lastErrors, C.ecp_thread_id())
+	lastErrorsMu.Unlock()
+	return n
+}
+
+// lastError returns the last error of the calling thread, or an empty string
+// if its last call succeeded.
+func lastError() string {
+	lastErrorsMu.Lock()
+	defer lastErrorsMu.Unlock()
+	return lastErrors[C.ecp_thread_id()]
+}
+
+// userDeclinedMarkers are found in the errors that keystores report when the
+// user dismisses a PIN or consent prompt.
+var userDeclinedMarkers = []string{
+	"canceled by the user",  // Windows NTE_USER_CANCELLED and SCARD_W_CANCELLED_BY_USER.
+	"cancelled by the user", // Windows, British spelling.
+	"user canceled",         // MacOS errSecUserCanceled.
+	"ckr_function_canceled", // PKCS#11.
+}
+
+// errorCode returns the ECP_ERR_* code that classifies err.
+func errorCode(err error) int {
+	var startupErr *client.StartupError
+	switch {
+	case errors.Is(err, client.ErrCredUnavailable), errors.Is(err, fs.ErrNotExist):
+		return codeConfigMissing
+	case errors.As(err, &startupErr) && startupErr.Code == startup.CodeCredential:
+		return codeKeyNotFound
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range userDeclinedMarkers {
+		if strings.Contains(msg, marker) {
+			return codeUserDeclined
+		}
+	}
+	return codeFailed
+}
@@ -18,35 +18,100 @@
 // client APIs.
 //
 // Example compilation command:
-// go build -buildmode=c-shared -o signer.dylib main.go
+// go build -buildmode=c-shared -o signer.dylib ./cshared
 package main
 
 /*
 #include <stdlib.h>
+
+typedef void (*ecp_log_callback)(const char *line);
+
+static inline void call_log_callback(ecp_log_callback cb, const char *line) {
+	cb(line);
+}
+
+// Negative return codes of the exports. GetLastErrorMessage describes the
+// failure. See README.md.
+enum {
+	ECP_ERR_INVALID_ARGUMENT = -1, // A buffer is NULL while its length is positive, or a length is negative.
+	ECP_ERR_BUFFER_TOO_SMALL = -2, // The output buffer is smaller than the output.
+	ECP_ERR_CONFIG_MISSING   = -3, // The certificate config file or the signer binary it names is missing.
+	ECP_ERR_KEY_NOT_FOUND    = -4, // The keystore holds no certificate and private key matching the config.
+	ECP_ERR_USER_DECLINED    = -5, // The user dismissed a PIN or consent prompt.
+	ECP_ERR_TIMEOUT          = -6, // The timeout elapsed before the operation completed.
+	ECP_ERR_CANCELED         = -7, // The operation was canceled with CancelToken.
+	ECP_ERR_FAILED           = -8, // Any other failure.
+};
 */
 import "C"
 
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/version"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// Negative return codes of the exports, defined in the preamble for C callers.
+const (
+	codeInvalidArgument = C.ECP_ERR_INVALID_ARGUMENT
+	codeBufferTooSmall  = C.ECP_ERR_BUFFER_TOO_SMALL
+	codeConfigMissing   = C.ECP_ERR_CONFIG_MISSING
+	codeKeyNotFound     = C.ECP_ERR_KEY_NOT_FOUND
+	codeUserDeclined    = C.ECP_ERR_USER_DECLINED
+	codeTimeout         = C.ECP_ERR_TIMEOUT
+	codeCanceled        = C.ECP_ERR_CANCELED
+	codeFailed          = C.ECP_ERR_FAILED
+)
+
+var (
+	logCallbackMu sync.Mutex
+	logCallback   C.ecp_log_callback
 )
 
-// Version is generally set by the build command. Releases of ECP must have a specific version set.
-// The version can be set when running `go build` like so `-ldflags="-X=main.Version=$CURRENT_TAG" `.
-var Version = "dev"
+// logCallbackWriter forwards each log line to the registered log callback.
+type logCallbackWriter struct{}
+
+func (logCallbackWriter) Write(p []byte) (int, error) {
+	logCallbackMu.Lock()
+	defer logCallbackMu.Unlock()
+	if logCallback == nil {
+		return len(p), nil
+	}
+	line := C.CString(strings.TrimSuffix(string(p), "\n"))
+	defer C.free(unsafe.Pointer(line))
+	C.call_log_callback(logCallback, line)
+	return len(p), nil
+}
+
+func hasLogCallback() bool {
+	logCallbackMu.Lock()
+	defer logCallbackMu.Unlock()
+	return logCallback != nil
+}
 
 // If ECP Logging is enabled return true
 // Otherwise return false
 func enableECPLogging() bool {
+	if hasLogCallback() {
+		log.SetOutput(logCallbackWriter{})
+		return true
+	}
 	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
+		log.SetOutput(os.Stderr)
 		return true
 	}
 
@@ -54,18 +119,41 @@ func enableECPLogging() bool {
 	return false
 }
 
-func getCertPem(configFilePath string) []byte {
+// validBuffer reports whether the buffer p of length n can be accessed.
+func validBuffer(p *byte, n int) bool {
+	return n >= 0 && (p != nil || n == 0)
+}
+
+// errInvalidArgument fails with ECP_ERR_INVALID_ARGUMENT.
+func errInvalidArgument() int {
+	return fail(codeInvalidArgument, "Invalid buffer argument: NULL buffer or negative length")
+}
+
+// errBufferTooSmall fails with ECP_ERR_BUFFER_TOO_SMALL.
+func errBufferTooSmall(name string, size, needed int) int {
+	return fail(codeBufferTooSmall, "The %s buffer size %d is smaller than the %d bytes needed", name, size, needed)
+}
+
+// legacyResult returns the result n of an export for the exports that predate
+// the ECP_ERR_* codes, which return 0 on failure. GetLastErrorMessage still
+// describes the failure.
+func legacyResult(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// openKey returns the Key of configFilePath, or fails with a negative code.
+func openKey(configFilePath string) (*client.Key, int) {
 	key, err := client.Cred(configFilePath)
 	if err != nil {
-		log.Printf("Could not create client using config %s: %v", configFilePath, err)
-		return nil
+		return nil, failErr(err, "Could not create client using config %s", configFilePath)
 	}
-	defer func() {
-		if err = key.Close(); err != nil {
-			log.Printf("Failed to clean up key. %v", err)
-		}
-	}()
+	return key, 0
+}
 
+func getCertPem(key *client.Key) []byte {
 	certChain := key.CertificateChain()
 	certChainPem := []byte{}
 	for i := 0; i < len(certChain); i++ {
@@ -79,7 +167,47 @@ func getCertPem(configFilePath string) []byte {
 //
 //export ECPVersion
 func ECPVersion() *C.char {
-	return C.CString(Version)
+	return C.CString(version.Version)
+}
+
+// GetVersion returns ECP's version number together with the commit and Go
+// toolchain it was built with, for inclusion in bug reports.
+//
+//export GetVersion
+func GetVersion() *C.char {
+	return C.CString(version.String())
+}
+
+// GetLastErrorMessage returns the description of the failure of the last call
+// to an export from the calling thread, or an empty string if that call
+// succeeded. Like errno, it is only meaningful right after an export returned
+// a negative error code.
+//
+//export GetLastErrorMessage
+func GetLastErrorMessage() *C.char {
+	return C.CString(lastError())
+}
+
+// GetLastErrorForPython is GetLastErrorMessage, for Python callers.
+//
+//export GetLastErrorForPython
+func GetLastErrorForPython() *C.char {
+	return GetLastErrorMessage()
+}
+
+// SetLogCallbackForPython registers fn to receive ECP log lines, without the
+// trailing newline, instead of writing them to stderr. Registering a callback
+// enables logging regardless of ENABLE_ENTERPRISE_CERTIFICATE_LOGS. The line is
+// only valid for the duration of the call. Pass NULL to unregister the callback.
+//
+// Logs written by the signer subprocess still go to stderr.
+//
+//export SetLogCallbackForPython
+func SetLogCallbackForPython(fn C.ecp_log_callback) {
+	logCallbackMu.Lock()
+	logCallback = fn
+	logCallbackMu.Unlock()
+	enableECPLogging()
 }
 
 // GetCertPem reads the contents of the certificate specified by configFilePath,
@@ -87,17 +215,37 @@ func ECPVersion() *C.char {
 //
 // We must call it twice to get the cert. First time use nil for certHolder to get
 // the cert length. Second time we pre-create an array of the cert length and
-// call this function again to load the cert into the array.
+// call this function again to load the cert into the array. It returns 0 on
+// failure. GetCertPemWithErrorCode returns the cause of the failure instead.
 //
 //export GetCertPem
 func GetCertPem(configFilePath *C.char, certHolder *byte, certHolderLen int) int {
+	return legacyResult(GetCertPemWithErrorCode(configFilePath, certHolder, certHolderLen))
+}
+
+// GetCertPemWithErrorCode is GetCertPem, but returns a negative ECP_ERR_* code
+// on failure.
+//
+//export GetCertPemWithErrorCode
+func GetCertPemWithErrorCode(configFilePath *C.char, certHolder *byte, certHolderLen int) int {
 	enableECPLogging()
-	pemBytes := getCertPem(C.GoString(configFilePath))
+	if certHolder != nil && certHolderLen < 0 {
+		return errInvalidArgument()
+	}
+	key, code := openKey(C.GoString(configFilePath))
+	if key == nil {
+		return code
+	}
+	defer closeKey(key)
+	pemBytes := getCertPem(key)
 	if certHolder != nil {
+		if certHolderLen < len(pemBytes) {
+			return errBufferTooSmall("certHolder", certHolderLen, len(pemBytes))
+		}
 		cert := unsafe.Slice(certHolder, certHolderLen)
 		copy(cert, pemBytes)
 	}
-	return len(pemBytes)
+	return succeed(len(pemBytes))
 }
 
 // GetCertPemForPython reads the contents of the certificate specified by configFilePath,
@@ -105,7 +253,8 @@ func GetCertPem(configFilePath *C.char, certHolder *byte, certHolderLen int) int
 //
 // We must call it twice to get the cert. First time use nil for certHolder to get
 // the cert length. Second time we pre-create an array in Python of the cert length and
-// call this function again to load the cert into the array.
+// call this function again to load the cert into the array. It returns 0 on
+// failure.
 //
 // Deprecated: This API is deprecated in favor of GetCertPem and will be removed in future versions.
 //
@@ -116,66 +265,149 @@ func GetCertPemForPython(configFilePath *C.char, certHolder *byte, certHolderLen
 
 // Sign signs a message digest of length digestLen using a certificate private key
 // specified by configFilePath, storing the result inside a sigHolder byte array of size sigHolderLen.
+// It returns the length of the signature, or 0 on failure. SignWithErrorCode returns the cause
+// of the failure instead.
 //
 //export Sign
 func Sign(configFilePath *C.char, digest *byte, digestLen int, sigHolder *byte, sigHolderLen int) int {
-	// First create a handle around the specified certificate and private key.
+	return legacyResult(SignWithErrorCode(configFilePath, digest, digestLen, sigHolder, sigHolderLen))
+}
+
+// SignWithErrorCode is Sign, but returns a negative ECP_ERR_* code on failure.
+//
+//export SignWithErrorCode
+func SignWithErrorCode(configFilePath *C.char, digest *byte, digestLen int, sigHolder *byte, sigHolderLen int) int {
 	enableECPLogging()
-	key, err := client.Cred(C.GoString(configFilePath))
+	if !validBuffer(digest, digestLen) || !validBuffer(sigHolder, sigHolderLen) {
+		return errInvalidArgument()
+	}
+	// First create a handle around the specified certificate and private key.
+	key, code := openKey(C.GoString(configFilePath))
+	if key == nil {
+		return code
+	}
+	defer closeKey(key)
+	// Sign a copy of the digest, which is scrubbed once signed, rather than
+	// the buffer of the caller.
+	digestCopy := append([]byte(nil), unsafe.Slice(digest, digestLen)...)
+	defer zeroize.Bytes(digestCopy)
+	signature, err := signDigest(key, digestCopy)
 	if err != nil {
-		log.Printf("Could not create client using config %s: %v", C.GoString(configFilePath), err)
-		return 0
+		return failErr(err, "Failed to sign")
 	}
-	defer func() {
-		if err = key.Close(); err != nil {
-			log.Printf("Failed to clean up key. %v", err)
-		}
-	}()
-	var isRsa bool
+	if sigHolderLen < len(signature) {
+		return errBufferTooSmall("sigHolder", sigHolderLen, len(signature))
+	}
+
+	// Create a Go buffer around the output buffer and copy the signature into the buffer
+	outBytes := unsafe.Slice(sigHolder, sigHolderLen)
+	copy(outBytes, signature)
+	return succeed(len(signature))
+}
+
+// signDigest signs digest with key, using RSASSA-PSS with SHA-256 for RSA keys
+// and ECDSA with SHA-256 for EC keys.
+func signDigest(key *client.Key, digest []byte) ([]byte, error) {
+	var opts crypto.SignerOpts
 	switch key.Public().(type) {
 	case *ecdsa.PublicKey:
-		isRsa = false
 		log.Print("the key is ecdsa key")
+		opts = crypto.SHA256
 	case *rsa.PublicKey:
-		isRsa = true
 		log.Print("the key is rsa key")
-	default:
-		log.Printf("unsupported key type")
-		return 0
-	}
-
-	// Compute the signature
-	digestSlice := unsafe.Slice(digest, digestLen)
-	var signature []byte
-	var signErr error
-	if isRsa {
 		// For RSA key, we need to create the padding and flags for RSASSA-SHA256
-		opts := rsa.PSSOptions{
-			SaltLength: digestLen,
+		opts = &rsa.PSSOptions{
+			SaltLength: len(digest),
 			Hash:       crypto.SHA256,
 		}
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	signature, err := key.Sign(nil, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign hash: %w", err)
+	}
+	return signature, nil
+}
+
+// Encrypt encrypts a plaintext of length plaintextLen with RSA-OAEP and SHA-256,
+// using the certificate public key specified by configFilePath, storing the
+// result inside a ciphertextHolder byte array of size ciphertextHolderLen. It
+// returns the length of the ciphertext, or 0 on failure. EncryptWithErrorCode
+// returns the cause of the failure instead.
+//
+//export Encrypt
+func Encrypt(configFilePath *C.char, plaintext *byte, plaintextLen int, ciphertextHolder *byte, ciphertextHolderLen int) int {
+	return legacyResult(EncryptWithErrorCode(configFilePath, plaintext, plaintextLen, ciphertextHolder, ciphertextHolderLen))
+}
 
-		signature, signErr = key.Sign(nil, digestSlice, &opts)
-	} else {
-		signature, signErr = key.Sign(nil, digestSlice, crypto.SHA256)
+// EncryptWithErrorCode is Encrypt, but returns a negative ECP_ERR_* code on
+// failure.
+//
+//export EncryptWithErrorCode
+func EncryptWithErrorCode(configFilePath *C.char, plaintext *byte, plaintextLen int, ciphertextHolder *byte, ciphertextHolderLen int) int {
+	enableECPLogging()
+	if !validBuffer(plaintext, plaintextLen) || !validBuffer(ciphertextHolder, ciphertextHolderLen) {
+		return errInvalidArgument()
 	}
-	if signErr != nil {
-		log.Printf("failed to sign hash: %v", signErr)
-		return 0
+	key, code := openKey(C.GoString(configFilePath))
+	if key == nil {
+		return code
 	}
-	if sigHolderLen < len(signature) {
-		log.Printf("The sigHolder buffer size %d is smaller than the signature size %d", sigHolderLen, len(signature))
-		return 0
+	defer closeKey(key)
+	ciphertext, err := key.Encrypt(nil, unsafe.Slice(plaintext, plaintextLen), crypto.SHA256)
+	if err != nil {
+		return failErr(err, "Failed to encrypt")
+	}
+	if ciphertextHolderLen < len(ciphertext) {
+		return errBufferTooSmall("ciphertextHolder", ciphertextHolderLen, len(ciphertext))
 	}
+	copy(unsafe.Slice(ciphertextHolder, ciphertextHolderLen), ciphertext)
+	return succeed(len(ciphertext))
+}
 
-	// Create a Go buffer around the output buffer and copy the signature into the buffer
-	outBytes := unsafe.Slice(sigHolder, sigHolderLen)
-	copy(outBytes, signature)
-	return len(signature)
+// Decrypt decrypts a ciphertext of length ciphertextLen encrypted with RSA-OAEP
+// and SHA-256, using the certificate private key specified by configFilePath,
+// storing the result inside a plaintextHolder byte array of size
+// plaintextHolderLen. It returns the length of the plaintext, or 0 on failure,
+// including when the signer binary does not support decryption.
+// DecryptWithErrorCode returns the cause of the failure instead.
+//
+//export Decrypt
+func Decrypt(configFilePath *C.char, ciphertext *byte, ciphertextLen int, plaintextHolder *byte, plaintextHolderLen int) int {
+	return legacyResult(DecryptWithErrorCode(configFilePath, ciphertext, ciphertextLen, plaintextHolder, plaintextHolderLen))
+}
+
+// DecryptWithErrorCode is Decrypt, but returns a negative ECP_ERR_* code on
+// failure, including ECP_ERR_FAILED when the signer binary does not support
+// decryption.
+//
+//export DecryptWithErrorCode
+func DecryptWithErrorCode(configFilePath *C.char, ciphertext *byte, ciphertextLen int, plaintextHolder *byte, plaintextHolderLen int) int {
+	enableECPLogging()
+	if !validBuffer(ciphertext, ciphertextLen) || !validBuffer(plaintextHolder, plaintextHolderLen) {
+		return errInvalidArgument()
+	}
+	key, code := openKey(C.GoString(configFilePath))
+	if key == nil {
+		return code
+	}
+	defer closeKey(key)
+	plaintext, err := key.Decrypt(nil, unsafe.Slice(ciphertext, ciphertextLen), &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return failErr(err, "Failed to decrypt")
+	}
+	defer zeroize.Bytes(plaintext)
+	if plaintextHolderLen < len(plaintext) {
+		return errBufferTooSmall("plaintextHolder", plaintextHolderLen, len(plaintext))
+	}
+	copy(unsafe.Slice(plaintextHolder, plaintextHolderLen), plaintext)
+	return succeed(len(plaintext))
 }
 
 // SignForPython signs a message digest of length digestLen using a certificate private key
 // specified by configFilePath, storing the result inside a sigHolder byte array of size sigHolderLen.
+// It returns the length of the signature, or 0 on failure.
 //
 // Deprecated: This API is deprecated in favor of Sign and will be removed in future versions.
 //
@@ -185,28 +417,74 @@ func SignForPython(configFilePath *C.char, digest *byte, digestLen int, sigHolde
 }
 
 // GetKeyType returns a string representing ECP's key type.
-// The key is derived from the ECP configuration.
+// The key is derived from the ECP configuration. It returns "unknown" on
+// failure, which GetLastErrorMessage then describes.
 //
 //export GetKeyType
 func GetKeyType(configFilePath *C.char) *C.char {
-	key, err := client.Cred(C.GoString(configFilePath))
-	if err != nil {
-		log.Printf("Could not create client using config %s: %v", C.GoString(configFilePath), err)
+	key, _ := openKey(C.GoString(configFilePath))
+	if key == nil {
 		return C.CString("unknown")
 	}
-	defer func() {
-		if err = key.Close(); err != nil {
-			log.Printf("Failed to clean up key. %v", err)
-		}
-	}()
+	defer closeKey(key)
 	switch key.Public().(type) {
 	case *ecdsa.PublicKey:
+		succeed(0)
 		return C.CString("EC")
 	case *rsa.PublicKey:
+		succeed(0)
 		return C.CString("RSA")
 	default:
+		fail(codeFailed, "Unsupported key type %T", key.Public())
 		return C.CString("unknown")
 	}
 }
 
+// GetMaxSignatureLen returns the maximum length of a signature made by Sign
+// with the certificate private key specified by configFilePath, so that callers
+// can allocate sigHolder. It returns a negative ECP_ERR_* code on failure.
+//
+//export GetMaxSignatureLen
+func GetMaxSignatureLen(configFilePath *C.char) int {
+	enableECPLogging()
+	key, code := openKey(C.GoString(configFilePath))
+	if key == nil {
+		return code
+	}
+	defer closeKey(key)
+	n := maxSignatureLen(key.Public())
+	if n == 0 {
+		return fail(codeFailed, "Unsupported key type %T", key.Public())
+	}
+	return succeed(n)
+}
+
+// GetMaxSignatureLenForPython is GetMaxSignatureLen, for Python callers.
+//
+//export GetMaxSignatureLenForPython
+func GetMaxSignatureLenForPython(configFilePath *C.char) int {
+	return GetMaxSignatureLen(configFilePath)
+}
+
+// maxSignatureLen returns the maximum length of a signature made with the
+// private key of pub, or 0 for unsupported key types.
+func maxSignatureLen(pub crypto.PublicKey) int {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return pub.Size()
+	case *ecdsa.PublicKey:
+		// An ASN.1 SEQUENCE of two INTEGERs, each of which may need a leading
+		// zero byte.
+		intLen := 2 + (pub.Curve.Params().BitSize+7)/8 + 1
+		contentLen := 2 * intLen
+		if contentLen < 128 {
+			return 2 + contentLen
+		}
+		return 3 + contentLen
+	case ed25519.PublicKey:
+		return ed25519.SignatureSize
+	}
+	return 0
+}
+
 func main() {}
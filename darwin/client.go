@@ -20,6 +20,7 @@ package darwin
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"io"
 
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/keychain"
@@ -55,16 +56,39 @@ func (sk *SecureKey) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts)
 	return sk.key.Decrypt(msg, opts)
 }
 
-// Close frees up resources associated with the underlying key.
-func (sk *SecureKey) Close() {
-	sk.key.Close()
+// WrapKey wraps a symmetric key with the public key using RSA-OAEP and the specified hash.
+func (sk *SecureKey) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	return sk.key.WrapKey(key, hash)
 }
 
-// NewSecureKey returns a handle to the first available certificate and private key pair in
-// the MacOS Keychain matching the issuer CN filter. This includes both the current login keychain
-// for the user as well as the system keychain.
-func NewSecureKey(issuerCN string) (*SecureKey, error) {
-	k, err := keychain.Cred(issuerCN)
+// UnwrapKey unwraps a symmetric key wrapped by WrapKey, using the private key.
+func (sk *SecureKey) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	return sk.key.UnwrapKey(wrappedKey, hash)
+}
+
+// KeyAgreement returns the ECDH shared secret of the EC private key and peer.
+func (sk *SecureKey) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	return sk.key.KeyAgreement(peer)
+}
+
+// Close frees up resources associated with the underlying key. It is safe to
+// call more than once. Operations on a closed SecureKey return an error.
+func (sk *SecureKey) Close() error {
+	return sk.key.Close()
+}
+
+// NewSecureKeyWithOptions returns a handle to the first available certificate and private key pair in
+// the MacOS Keychain matching the filters in opts.
+func NewSecureKeyWithOptions(opts SecureKeyOptions) (*SecureKey, error) {
+	keychainType, err := keychain.ParseKeychainType(opts.KeychainType)
+	if err != nil {
+		return nil, err
+	}
+	k, err := keychain.CredWithOptions(opts.IssuerCN, keychainType, opts.EKU, keychain.SearchOptions{
+		AccessGroup: opts.AccessGroup,
+		Legacy:      opts.LegacyKeychain,
+		Fingerprint: opts.Fingerprint,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -73,5 +97,17 @@ func NewSecureKey(issuerCN string) (*SecureKey, error) {
 
 // ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the keychain
 func ImportPKCS12Cred(credPath, password string) error {
-	return keychain.ImportPKCS12Cred(credPath, password)
+	return keychain.ImportPKCS12Cred(credPath, []byte(password))
+}
+
+// ImportPKCS12CredWithOptions imports a PKCS12 file containing a client certificate and private key
+// into the keychain selected by opts.
+func ImportPKCS12CredWithOptions(credPath, password string, opts ImportOptions) error {
+	return keychain.ImportPKCS12CredWithOptions(credPath, []byte(password), keychain.ImportOptions{
+		Keychain:            opts.Keychain,
+		NonExtractable:      opts.NonExtractable,
+		TrustedApplications: opts.TrustedApplications,
+		TrustIssuer:         opts.TrustIssuer,
+		Legacy:              opts.LegacyKeychain,
+	})
 }
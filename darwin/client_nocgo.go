@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && !cgo
+// +build darwin,!cgo
+
+package darwin
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/security"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+)
+
+// SecureKey is a certificate chain found in the keychain with the security
+// command line tool. Without cgo, the private key cannot be used, and the
+// operations that need it return ErrUnsupportedWithoutCGO.
+type SecureKey struct {
+	chain [][]byte
+	pub   crypto.PublicKey
+}
+
+// CertificateChain returns the SecureKey's raw X509 cert chain. This contains the public key.
+func (sk *SecureKey) CertificateChain() [][]byte {
+	return sk.chain
+}
+
+// Public returns the public key for this SecureKey.
+func (sk *SecureKey) Public() crypto.PublicKey {
+	return sk.pub
+}
+
+// Sign returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (signed []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// Encrypt returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) Encrypt(_ io.Reader, msg []byte, opts any) (ciphertext []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// Decrypt returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// WrapKey returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// UnwrapKey returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// KeyAgreement returns ErrUnsupportedWithoutCGO.
+func (sk *SecureKey) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	return nil, ErrUnsupportedWithoutCGO
+}
+
+// Close is a no-op, since the SecureKey holds no keychain reference.
+func (sk *SecureKey) Close() error {
+	return nil
+}
+
+// NewSecureKeyWithOptions returns the certificate chain of the first identity in
+// the file-based keychains matching the filters in opts, found with the security
+// command line tool. The data protection keychain cannot be searched without
+// cgo, so the file-based keychains are searched as with opts.LegacyKeychain,
+// and opts.AccessGroup must be empty.
+func NewSecureKeyWithOptions(opts SecureKeyOptions) (*SecureKey, error) {
+	if opts.AccessGroup != "" {
+		return nil, fmt.Errorf("searching the data protection keychain: %w", ErrUnsupportedWithoutCGO)
+	}
+	keychains, err := security.Keychains(opts.KeychainType)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := security.Identities(keychains)
+	if err != nil {
+		return nil, err
+	}
+	for _, xc := range identities {
+		issuerMatches := xc.Issuer.CommonName == opts.IssuerCN || (opts.IssuerCN == "" && opts.Fingerprint != "")
+		if !issuerMatches || !config.MatchesEKU(xc, opts.EKU) || !config.MatchesFingerprint(xc, opts.Fingerprint) {
+			continue
+		}
+		// Intermediates are looked up in the default search list, which holds
+		// the system roots and intermediates, as with cgo.
+		pool, err := security.Certificates(nil)
+		if err != nil {
+			return nil, err
+		}
+		var chain [][]byte
+		for _, c := range util.BuildChain(xc, pool) {
+			chain = append(chain, c.Raw)
+		}
+		return &SecureKey{chain: chain, pub: xc.PublicKey}, nil
+	}
+	return nil, fmt.Errorf("no key found with issuer common name %q", opts.IssuerCN)
+}
+
+// ImportPKCS12Cred returns ErrUnsupportedWithoutCGO.
+func ImportPKCS12Cred(credPath, password string) error {
+	return ErrUnsupportedWithoutCGO
+}
+
+// ImportPKCS12CredWithOptions returns ErrUnsupportedWithoutCGO.
+func ImportPKCS12CredWithOptions(credPath, password string, opts ImportOptions) error {
+	return ErrUnsupportedWithoutCGO
+}
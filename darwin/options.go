@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package darwin
+
+import "errors"
+
+// ErrUnsupportedPlatform is returned by the functions of the package on
+// platforms other than MacOS.
+var ErrUnsupportedPlatform = errors.New("darwin: the platform is not supported")
+
+// ErrUnsupportedWithoutCGO is returned by the operations that need the
+// Security framework, such as signing, when the package is built without cgo.
+var ErrUnsupportedWithoutCGO = errors.New("darwin: the operation requires a build with cgo enabled")
+
+// NewSecureKey returns a handle to the first available certificate and private key pair in
+// the MacOS Keychain matching the issuer CN filter. This includes both the current login keychain
+// for the user as well as the system keychain.
+func NewSecureKey(issuerCN string) (*SecureKey, error) {
+	return NewSecureKeyWithOptions(SecureKeyOptions{IssuerCN: issuerCN, LegacyKeychain: true})
+}
+
+// SecureKeyOptions contains the filters used by NewSecureKeyWithOptions to select a certificate.
+type SecureKeyOptions struct {
+	// IssuerCN is the common name of the issuer of the certificate.
+	IssuerCN string
+	// KeychainType selects the keychains to search: "login", "system" or "all".
+	// If empty, all keychains are searched.
+	KeychainType string
+	// EKU is the extended key usage the certificate must allow, e.g. "clientAuth".
+	// If empty, the extended key usage is not checked.
+	EKU string
+	// Fingerprint is the hex-encoded SHA-256 fingerprint of the DER encoded
+	// certificate. If set, IssuerCN may be empty.
+	Fingerprint string
+	// AccessGroup restricts the data protection keychain search to the named
+	// keychain access group.
+	AccessGroup string
+	// LegacyKeychain searches only the file-based keychains, instead of the
+	// data protection keychain first. It is required for the "login" and
+	// "system" keychain types.
+	LegacyKeychain bool
+}
+
+// ImportOptions controls where and how ImportPKCS12CredWithOptions stores the imported identity.
+type ImportOptions struct {
+	// Keychain is the target keychain: "login", "system", or the path of a keychain file.
+	// If empty, the default keychain is used. It requires LegacyKeychain.
+	Keychain string
+	// NonExtractable imports the private key so that it cannot be exported from the keychain.
+	// It requires LegacyKeychain.
+	NonExtractable bool
+	// TrustedApplications are paths of applications that may use the private key without
+	// prompting, in addition to the importing application. It requires LegacyKeychain.
+	TrustedApplications []string
+	// TrustIssuer marks the CA certificates contained in the PKCS12 file as trusted roots.
+	TrustIssuer bool
+	// LegacyKeychain imports into a file-based keychain selected with the deprecated
+	// SecKeychain APIs, instead of with SecPKCS12Import.
+	LegacyKeychain bool
+}
@@ -3,7 +3,9 @@ module github.com/googleapis/enterprise-certificate-proxy
 go 1.19
 
 require (
-	github.com/google/go-pkcs11 v0.3.0
+	github.com/ebitengine/purego v0.8.4
+	github.com/go-piv/piv-go v1.11.0
+	github.com/miekg/pkcs11 v1.1.2
 	golang.org/x/crypto v0.16.0
 	golang.org/x/sys v0.15.0
 )
@@ -0,0 +1,279 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hpke implements the authenticated mode of Hybrid Public Key
+// Encryption (HPKE, RFC 9180) with EC keys held in an enterprise keystore. The
+// sender seals a message to the recipient's public key with its own private
+// key, so that the recipient learns which credential sent the message, and
+// neither private key leaves its keystore: only ECDH key agreements are
+// requested from them, such as with the KeyAgreement method of client.Key.
+//
+// The cipher suite is chosen by the curve of the keys, which must be the same
+// for the sender and the recipient:
+//
+//   - P-256: DHKEM(P-256, HKDF-SHA256), HKDF-SHA256 and AES-128-GCM
+//   - P-384: DHKEM(P-384, HKDF-SHA384), HKDF-SHA384 and AES-256-GCM
+//   - P-521: DHKEM(P-521, HKDF-SHA512), HKDF-SHA512 and AES-256-GCM
+//
+// Seal and Open encrypt a single message per encapsulated key, as with the
+// single-shot APIs of RFC 9180.
+package hpke
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// modeAuth is the HPKE mode in which the sender authenticates with its KEM
+// private key.
+const modeAuth = 0x02
+
+// ErrOpen is returned by Open when the ciphertext cannot be authenticated,
+// such as when it was modified, or sealed by another sender or for another
+// recipient.
+var ErrOpen = errors.New("HPKE message authentication failed")
+
+// KeyAgreer is an EC private key that performs ECDH key agreements. It is
+// implemented by the keys of the client, linux, darwin and windows packages.
+type KeyAgreer interface {
+	// Public returns the *ecdsa.PublicKey of the private key.
+	Public() crypto.PublicKey
+	// KeyAgreement returns the big-endian X coordinate of the product of the
+	// private key and peer.
+	KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error)
+}
+
+// PrivateKey adapts an *ecdsa.PrivateKey held in memory to KeyAgreer, such as
+// for a service sending messages to or receiving messages from keystore keys.
+type PrivateKey struct {
+	*ecdsa.PrivateKey
+}
+
+// KeyAgreement returns the ECDH shared secret of k and peer.
+func (k PrivateKey) KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error) {
+	if peer.Curve != k.Curve {
+		return nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	return dh(k.PrivateKey, peer)
+}
+
+// suite is an HPKE cipher suite.
+type suite struct {
+	curve   elliptic.Curve
+	kemID   uint16
+	kemHash func() hash.Hash
+	nSecret int
+	kdfID   uint16
+	kdfHash func() hash.Hash
+	aeadID  uint16
+	nk      int
+}
+
+var suites = []suite{
+	{curve: elliptic.P256(), kemID: 0x0010, kemHash: sha256.New, nSecret: 32, kdfID: 0x0001, kdfHash: sha256.New, aeadID: 0x0001, nk: 16},
+	{curve: elliptic.P384(), kemID: 0x0011, kemHash: sha512.New384, nSecret: 48, kdfID: 0x0002, kdfHash: sha512.New384, aeadID: 0x0002, nk: 32},
+	{curve: elliptic.P521(), kemID: 0x0012, kemHash: sha512.New, nSecret: 64, kdfID: 0x0003, kdfHash: sha512.New, aeadID: 0x0002, nk: 32},
+}
+
+// suiteFor returns the suite of the curve of key, which must be the curve of
+// peer.
+func suiteFor(key KeyAgreer, peer *ecdsa.PublicKey) (*suite, *ecdsa.PublicKey, error) {
+	pub, ok := key.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("HPKE requires an EC key, got %T", key.Public())
+	}
+	if peer == nil || peer.Curve != pub.Curve {
+		return nil, nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	for i := range suites {
+		if suites[i].curve == pub.Curve {
+			return &suites[i], pub, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unsupported curve %v", pub.Curve.Params().Name)
+}
+
+// Seal encrypts and authenticates plaintext and aad for recipient, and
+// authenticates the sender with its private key. info binds the message to an
+// application context and must be passed to Open as well. It returns the
+// encapsulated key and the ciphertext, which are both needed to open the
+// message.
+func Seal(sender KeyAgreer, recipient *ecdsa.PublicKey, info, aad, plaintext []byte) (enc, ciphertext []byte, err error) {
+	s, pkS, err := suiteFor(sender, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := ecdsa.GenerateKey(s.curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.seal(sender, pkS, recipient, ephemeral, info, aad, plaintext)
+}
+
+// seal is Seal with the ephemeral key of the encapsulation, which the tests
+// set to that of the RFC 9180 test vectors.
+func (s *suite) seal(sender KeyAgreer, pkS, recipient *ecdsa.PublicKey, ephemeral *ecdsa.PrivateKey, info, aad, plaintext []byte) (enc, ciphertext []byte, err error) {
+	dhE, err := dh(ephemeral, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	dhS, err := s.keyAgreement(sender, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc = s.serialize(&ephemeral.PublicKey)
+	aead, nonce, err := s.setup(dhE, dhS, enc, s.serialize(recipient), s.serialize(pkS), info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// Open decrypts ciphertext sealed by Seal for recipient with the encapsulated
+// key enc, and checks that it was sealed by sender with the same info and aad.
+// It returns ErrOpen if the ciphertext cannot be authenticated. The recipient
+// key performs two key agreements, which for keys with a touch policy may
+// require two touches.
+func Open(recipient KeyAgreer, sender *ecdsa.PublicKey, enc, info, aad, ciphertext []byte) ([]byte, error) {
+	s, pkR, err := suiteFor(recipient, sender)
+	if err != nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(s.curve, enc)
+	if x == nil {
+		return nil, errors.New("invalid HPKE encapsulated key")
+	}
+	dhE, err := s.keyAgreement(recipient, &ecdsa.PublicKey{Curve: s.curve, X: x, Y: y})
+	if err != nil {
+		return nil, err
+	}
+	dhS, err := s.keyAgreement(recipient, sender)
+	if err != nil {
+		return nil, err
+	}
+	aead, nonce, err := s.setup(dhE, dhS, enc, s.serialize(pkR), s.serialize(sender), info)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrOpen
+	}
+	return plaintext, nil
+}
+
+// keyAgreement returns the shared secret of key and peer, checking its size.
+func (s *suite) keyAgreement(key KeyAgreer, peer *ecdsa.PublicKey) ([]byte, error) {
+	secret, err := key.KeyAgreement(peer)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != s.nDH() {
+		return nil, fmt.Errorf("key agreement returned %d bytes, want %d", len(secret), s.nDH())
+	}
+	return secret, nil
+}
+
+// setup runs AuthEncap or AuthDecap from the results of the two key agreements
+// and the serialized public keys, followed by the key schedule, and returns
+// the AEAD and nonce of the single message of the context.
+func (s *suite) setup(dhE, dhS, enc, pkRm, pkSm, info []byte) (cipher.AEAD, []byte, error) {
+	kemSuiteID := binary.BigEndian.AppendUint16([]byte("KEM"), s.kemID)
+	dh := append(append([]byte{}, dhE...), dhS...)
+	kemContext := append(append(append([]byte{}, enc...), pkRm...), pkSm...)
+	eaePRK := labeledExtract(s.kemHash, kemSuiteID, nil, "eae_prk", dh)
+	sharedSecret, err := labeledExpand(s.kemHash, kemSuiteID, eaePRK, "shared_secret", kemContext, s.nSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	suiteID := []byte("HPKE")
+	suiteID = binary.BigEndian.AppendUint16(suiteID, s.kemID)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, s.kdfID)
+	suiteID = binary.BigEndian.AppendUint16(suiteID, s.aeadID)
+	// The authenticated mode uses the default, empty PSK and PSK ID.
+	pskIDHash := labeledExtract(s.kdfHash, suiteID, nil, "psk_id_hash", nil)
+	infoHash := labeledExtract(s.kdfHash, suiteID, nil, "info_hash", info)
+	keyScheduleContext := append(append([]byte{modeAuth}, pskIDHash...), infoHash...)
+	secret := labeledExtract(s.kdfHash, suiteID, sharedSecret, "secret", nil)
+	key, err := labeledExpand(s.kdfHash, suiteID, secret, "key", keyScheduleContext, s.nk)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The nonce of the first message is the base nonce.
+	nonce, err := labeledExpand(s.kdfHash, suiteID, secret, "base_nonce", keyScheduleContext, 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nonce, nil
+}
+
+// nDH returns the size of the shared secrets of the curve.
+func (s *suite) nDH() int {
+	return (s.curve.Params().BitSize + 7) / 8
+}
+
+// serialize returns the uncompressed encoding of pub.
+func (s *suite) serialize(pub *ecdsa.PublicKey) []byte {
+	return elliptic.Marshal(s.curve, pub.X, pub.Y)
+}
+
+// dh returns the X coordinate of the product of priv and peer.
+func dh(priv *ecdsa.PrivateKey, peer *ecdsa.PublicKey) ([]byte, error) {
+	if !priv.Curve.IsOnCurve(peer.X, peer.Y) {
+		return nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	x, _ := priv.Curve.ScalarMult(peer.X, peer.Y, priv.D.Bytes())
+	if x.Sign() == 0 {
+		return nil, errors.New("invalid ECDH shared secret")
+	}
+	return x.FillBytes(make([]byte, (priv.Curve.Params().BitSize+7)/8)), nil
+}
+
+// labeledExtract is LabeledExtract of RFC 9180, section 4.
+func labeledExtract(h func() hash.Hash, suiteID, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := append(append(append([]byte("HPKE-v1"), suiteID...), label...), ikm...)
+	return hkdf.Extract(h, labeledIKM, salt)
+}
+
+// labeledExpand is LabeledExpand of RFC 9180, section 4.
+func labeledExpand(h func() hash.Hash, suiteID, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeledInfo := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeledInfo = append(append(append(append(labeledInfo, "HPKE-v1"...), suiteID...), label...), info...)
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(h, prk, labeledInfo), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
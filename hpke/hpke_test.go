@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hpke
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func generateKey(t *testing.T, curve elliptic.Curve) PrivateKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PrivateKey{priv}
+}
+
+// vectorKey returns the private key of curve with the hex encoded scalar d.
+func vectorKey(t *testing.T, curve elliptic.Curve, d string) *ecdsa.PrivateKey {
+	t.Helper()
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(unhex(t, d))}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(priv.D.Bytes())
+	return priv
+}
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestVectors checks Seal and Open against the test vectors of the
+// authenticated mode in RFC 9180, appendix A, using the first encryption of
+// each, which is the single-shot one.
+func TestVectors(t *testing.T) {
+	tests := []struct {
+		name                          string
+		curve                         elliptic.Curve
+		skEm, skRm, skSm, pkRm, pkSm  string
+		info, enc, baseNonce, aad, pt string
+		ct                            string
+	}{
+		{
+			name:      "A.3.3 DHKEM(P-256, HKDF-SHA256), HKDF-SHA256, AES-128-GCM",
+			curve:     elliptic.P256(),
+			skEm:      "6b8de0873aed0c1b2d09b8c7ed54cbf24fdf1dfc7a47fa501f918810642d7b91",
+			skRm:      "d929ab4be2e59f6954d6bedd93e638f02d4046cef21115b00cdda2acb2a4440e",
+			skSm:      "1120ac99fb1fccc1e8230502d245719d1b217fe20505c7648795139d177f0de9",
+			pkRm:      "04423e363e1cd54ce7b7573110ac121399acbc9ed815fae03b72ffbd4c18b01836835c5a09513f28fc971b7266cfde2e96afe84bb0f266920e82c4f53b36e1a78d",
+			pkSm:      "04a817a0902bf28e036d66add5d544cc3a0457eab150f104285df1e293b5c10eef8651213e43d9cd9086c80b309df22cf37609f58c1127f7607e85f210b2804f73",
+			info:      "4f6465206f6e2061204772656369616e2055726e",
+			enc:       "042224f3ea800f7ec55c03f29fc9865f6ee27004f818fcbdc6dc68932c1e52e15b79e264a98f2c535ef06745f3d308624414153b22c7332bc1e691cb4af4d53454",
+			baseNonce: "b390052d26b67a5b8a8fcaa4",
+			aad:       "436f756e742d30",
+			pt:        "4265617574792069732074727574682c20747275746820626561757479",
+			ct:        "82ffc8c44760db691a07c5627e5fc2c08e7a86979ee79b494a17cc3405446ac2bdb8f265db4a099ed3289ffe19",
+		},
+		{
+			name:      "A.6.3 DHKEM(P-521, HKDF-SHA512), HKDF-SHA512, AES-256-GCM",
+			curve:     elliptic.P521(),
+			skEm:      "0185f03560de87bb2c543ef03607f3c33ac09980000de25eabe3b224312946330d2e65d192d3b4aa46ca92fc5ca50736b624402d95f6a80dc04d1f10ae9517137261",
+			skRm:      "013ef326940998544a899e15e1726548ff43bbdb23a8587aa3bef9d1b857338d87287df5667037b519d6a14661e9503cfc95a154d93566d8c84e95ce93ad05293a0b",
+			skSm:      "001018584599625ff9953b9305849850d5e34bd789d4b81101139662fbea8b6508ddb9d019b0d692e737f66beae3f1f783e744202aaf6fea01506c27287e359fe776",
+			pkRm:      "04007d419b8834e7513d0e7cc66424a136ec5e11395ab353da324e3586673ee73d53ab34f30a0b42a92d054d0db321b80f6217e655e304f72793767c4231785c4a4a6e008f31b93b7a4f2b8cd12e5fe5a0523dc71353c66cbdad51c86b9e0bdfcd9a45698f2dab1809ab1b0f88f54227232c858accc44d9a8d41775ac026341564a2d749f4",
+			pkSm:      "04015cc3636632ea9a3879e43240beae5d15a44fba819282fac26a19c989fafdd0f330b8521dff7dc393101b018c1e65b07be9f5fc9a28a1f450d6a541ee0d76221133001e8f0f6a05ab79f9b9bb9ccce142a453d59c5abebb5674839d935a3ca1a3fbc328539a60b3bc3c05fed22838584a726b9c176796cad0169ba4093332cbd2dc3a9f",
+			info:      "4f6465206f6e2061204772656369616e2055726e",
+			enc:       "04017de12ede7f72cb101dab36a111265c97b3654816dcd6183f809d4b3d111fe759497f8aefdc5dbb40d3e6d21db15bdc60f15f2a420761bcaeef73b891c2b117e9cf01e29320b799bbc86afdc5ea97d941ea1c5bd5ebeeac7a784b3bab524746f3e640ec26ee1bd91255f9330d974f845084637ee0e6fe9f505c5b87c86a4e1a6c3096dd",
+			baseNonce: "9752b85fe8c73eda183f9e80",
+			aad:       "436f756e742d30",
+			pt:        "4265617574792069732074727574682c20747275746820626561757479",
+			ct:        "0116aeb3a1c405c61b1ce47600b7ecd11d89b9c08c408b7e2d1e00a4d64696d12e6881dc61688209a8207427f9",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ephemeral := vectorKey(t, tc.curve, tc.skEm)
+			sender := PrivateKey{vectorKey(t, tc.curve, tc.skSm)}
+			recipient := PrivateKey{vectorKey(t, tc.curve, tc.skRm)}
+			s, pkS, err := suiteFor(sender, &recipient.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(s.serialize(pkS)); got != tc.pkSm {
+				t.Errorf("pkSm: got %s, want %s", got, tc.pkSm)
+			}
+			if got := hex.EncodeToString(s.serialize(&recipient.PublicKey)); got != tc.pkRm {
+				t.Errorf("pkRm: got %s, want %s", got, tc.pkRm)
+			}
+
+			enc, ct, err := s.seal(sender, pkS, &recipient.PublicKey, ephemeral, unhex(t, tc.info), unhex(t, tc.aad), unhex(t, tc.pt))
+			if err != nil {
+				t.Fatalf("seal: got %v, want nil err", err)
+			}
+			if got := hex.EncodeToString(enc); got != tc.enc {
+				t.Errorf("enc: got %s, want %s", got, tc.enc)
+			}
+			if got := hex.EncodeToString(ct); got != tc.ct {
+				t.Errorf("ct: got %s, want %s", got, tc.ct)
+			}
+
+			pt, err := Open(recipient, pkS, unhex(t, tc.enc), unhex(t, tc.info), unhex(t, tc.aad), unhex(t, tc.ct))
+			if err != nil {
+				t.Fatalf("Open: got %v, want nil err", err)
+			}
+			if got := hex.EncodeToString(pt); got != tc.pt {
+				t.Errorf("Open: got %s, want %s", got, tc.pt)
+			}
+
+			dhE, _ := dh(ephemeral, &recipient.PublicKey)
+			dhS, _ := dh(sender.PrivateKey, &recipient.PublicKey)
+			_, nonce, err := s.setup(dhE, dhS, enc, unhex(t, tc.pkRm), unhex(t, tc.pkSm), unhex(t, tc.info))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(nonce); got != tc.baseNonce {
+				t.Errorf("base_nonce: got %s, want %s", got, tc.baseNonce)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		t.Run(curve.Params().Name, func(t *testing.T) {
+			sender, recipient := generateKey(t, curve), generateKey(t, curve)
+			info, aad, plaintext := []byte("info"), []byte("aad"), []byte("plaintext")
+			enc, ciphertext, err := Seal(sender, &recipient.PublicKey, info, aad, plaintext)
+			if err != nil {
+				t.Fatalf("Seal: got %v, want nil err", err)
+			}
+			got, err := Open(recipient, &sender.PublicKey, enc, info, aad, ciphertext)
+			if err != nil {
+				t.Fatalf("Open: got %v, want nil err", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("Open: got %q, want %q", got, plaintext)
+			}
+		})
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	sender, recipient, other := generateKey(t, elliptic.P256()), generateKey(t, elliptic.P256()), generateKey(t, elliptic.P256())
+	info, aad := []byte("info"), []byte("aad")
+	enc, ciphertext, err := Seal(sender, &recipient.PublicKey, info, aad, []byte("plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, ciphertext...)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name       string
+		recipient  PrivateKey
+		sender     *ecdsa.PublicKey
+		info, aad  []byte
+		ciphertext []byte
+	}{
+		{name: "wrong sender", recipient: recipient, sender: &other.PublicKey, info: info, aad: aad, ciphertext: ciphertext},
+		{name: "wrong recipient", recipient: other, sender: &sender.PublicKey, info: info, aad: aad, ciphertext: ciphertext},
+		{name: "wrong info", recipient: recipient, sender: &sender.PublicKey, info: []byte("other"), aad: aad, ciphertext: ciphertext},
+		{name: "wrong aad", recipient: recipient, sender: &sender.PublicKey, info: info, aad: []byte("other"), ciphertext: ciphertext},
+		{name: "tampered", recipient: recipient, sender: &sender.PublicKey, info: info, aad: aad, ciphertext: tampered},
+	}
+	for _, tc := range tests {
+		if _, err := Open(tc.recipient, tc.sender, enc, tc.info, tc.aad, tc.ciphertext); !errors.Is(err, ErrOpen) {
+			t.Errorf("%s: Open got %v, want %v", tc.name, err, ErrOpen)
+		}
+	}
+}
+
+func TestSealMismatchedCurves(t *testing.T) {
+	sender, recipient := generateKey(t, elliptic.P256()), generateKey(t, elliptic.P384())
+	if _, _, err := Seal(sender, &recipient.PublicKey, nil, nil, nil); err == nil {
+		t.Error("Seal with mismatched curves: got nil err, want error")
+	}
+}
+
+func TestOpenInvalidEncapsulatedKey(t *testing.T) {
+	sender, recipient := generateKey(t, elliptic.P256()), generateKey(t, elliptic.P256())
+	if _, err := Open(recipient, &sender.PublicKey, []byte{4, 1, 2}, nil, nil, nil); err == nil {
+		t.Error("Open with an invalid encapsulated key: got nil err, want error")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "fmt"
+
+// Names of the keystore backends, as used in CertConfigs.Priority and
+// Libs.Signers. They match the JSON names of the blocks in CertConfigs.
+const (
+	BackendMacOSKeychain = "macos_keychain"
+	BackendWindowsStore  = "windows_store"
+	BackendPKCS11        = "pkcs11"
+	BackendPIV           = "piv"
+	BackendCloudKMS      = "cloud_kms"
+	BackendRemote        = "remote"
+)
+
+// backends lists the names of every backend.
+var backends = []string{BackendMacOSKeychain, BackendWindowsStore, BackendPKCS11, BackendPIV, BackendCloudKMS, BackendRemote}
+
+// NativeBackend returns the backend served by the signer built for goos, whose
+// path is Libs.ECP.
+func NativeBackend(goos string) string {
+	switch goos {
+	case "darwin":
+		return BackendMacOSKeychain
+	case "windows":
+		return BackendWindowsStore
+	default:
+		return BackendPKCS11
+	}
+}
+
+// A Signer is a signer binary together with the backend it serves.
+type Signer struct {
+	Backend string
+	Path    string
+}
+
+// Signers returns the signers to try on goos, in the order of
+// CertConfigs.Priority. Without a priority, only the native backend is used.
+// Backends that are not available on goos, and backends without a signer
+// binary, are skipped.
+func (config EnterpriseCertificateConfig) Signers(goos string) []Signer {
+	native := NativeBackend(goos)
+	priority := config.CertConfigs.Priority
+	if len(priority) == 0 {
+		priority = []string{native}
+	}
+	var signers []Signer
+	for _, backend := range priority {
+		if (backend == BackendMacOSKeychain && goos != "darwin") || (backend == BackendWindowsStore && goos != "windows") {
+			continue
+		}
+		path := config.Libs.Signers[backend]
+		if path == "" && backend == native {
+			path = config.Libs.ECP
+		}
+		if path == "" {
+			continue
+		}
+		signers = append(signers, Signer{Backend: backend, Path: path})
+	}
+	return signers
+}
+
+// validateBackends checks the backend names used in the priority and the
+// signer paths.
+func validateBackends(config EnterpriseCertificateConfig) error {
+	seen := make(map[string]bool)
+	for _, backend := range config.CertConfigs.Priority {
+		if !isBackend(backend) {
+			return fmt.Errorf("invalid cert_configs priority entry %q, must be one of %q", backend, backends)
+		}
+		if seen[backend] {
+			return fmt.Errorf("duplicate cert_configs priority entry %q", backend)
+		}
+		seen[backend] = true
+	}
+	for backend := range config.Libs.Signers {
+		if !isBackend(backend) {
+			return fmt.Errorf("invalid libs signers key %q, must be one of %q", backend, backends)
+		}
+	}
+	return nil
+}
+
+func isBackend(name string) bool {
+	for _, backend := range backends {
+		if name == backend {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSigners(t *testing.T) {
+	config := EnterpriseCertificateConfig{
+		CertConfigs: CertConfigs{Priority: []string{BackendPIV, BackendWindowsStore, BackendMacOSKeychain, BackendPKCS11}},
+		Libs: Libs{
+			ECP:     "ecp",
+			Signers: map[string]string{BackendPKCS11: "ecp-pkcs11", BackendPIV: "ecp-piv"},
+		},
+	}
+	tests := []struct {
+		goos string
+		want []Signer
+	}{
+		{goos: "windows", want: []Signer{{BackendPIV, "ecp-piv"}, {BackendWindowsStore, "ecp"}, {BackendPKCS11, "ecp-pkcs11"}}},
+		{goos: "darwin", want: []Signer{{BackendPIV, "ecp-piv"}, {BackendMacOSKeychain, "ecp"}, {BackendPKCS11, "ecp-pkcs11"}}},
+		{goos: "linux", want: []Signer{{BackendPIV, "ecp-piv"}, {BackendPKCS11, "ecp-pkcs11"}}},
+		{goos: "freebsd", want: []Signer{{BackendPIV, "ecp-piv"}, {BackendPKCS11, "ecp-pkcs11"}}},
+	}
+	for _, test := range tests {
+		if got := config.Signers(test.goos); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Signers(%q): got %v, want %v", test.goos, got, test.want)
+		}
+	}
+
+	// Without a priority, the native signer is used.
+	config = EnterpriseCertificateConfig{Libs: Libs{ECP: "ecp"}}
+	for _, goos := range []string{"linux", "freebsd", "openbsd"} {
+		if got, want := config.Signers(goos), []Signer{{BackendPKCS11, "ecp"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Signers(%q): got %v, want %v", goos, got, want)
+		}
+	}
+	if got := (EnterpriseCertificateConfig{}).Signers("linux"); len(got) != 0 {
+		t.Errorf("Signers: got %v, want none without signer paths", got)
+	}
+}
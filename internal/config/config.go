@@ -0,0 +1,306 @@
+// Copyright 2022 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config defines the schema of the enterprise certificate config file
+// shared by the client and the signers, and loads it.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// EnterpriseCertificateConfig contains parameters for initializing the client and signer.
+type EnterpriseCertificateConfig struct {
+	CertConfigs CertConfigs `json:"cert_configs"`
+	Libs        Libs        `json:"libs"`
+	Retry       Retry       `json:"retry"`
+	Revocation  Revocation  `json:"revocation"`
+	Expiry      Expiry      `json:"expiry"`
+	Breaker     Breaker     `json:"circuit_breaker"`
+	Recycle     Recycle     `json:"recycle"`
+	WireFormat  string      `json:"wire_format"`  // Optional encoding of the RPC messages: "gob" (default) or "json".
+	SystemLog   bool        `json:"system_log"`   // Optional switch to also report signer failures to the system log: the Windows Event Log, the MacOS unified log or the systemd journal.
+	DenySigning bool        `json:"deny_signing"` // Optional switch to make private key operations of the client fail, for testing fallback to non-mTLS.
+	Version     int         `json:"version"`
+}
+
+// Revocation modes accepted by Revocation.Mode.
+const (
+	RevocationOff     = "off"     // Revocation status is not checked. This is the default.
+	RevocationWarn    = "warn"    // A revoked certificate is logged but still used.
+	RevocationEnforce = "enforce" // A revoked certificate is rejected.
+)
+
+// Revocation configures an optional OCSP/CRL revocation check of the leaf
+// certificate when the client loads it.
+type Revocation struct {
+	Mode    string `json:"mode"`    // One of "off" (default), "warn" or "enforce".
+	Timeout string `json:"timeout"` // Optional upper bound on the time spent checking as a Go duration (ex: "5s"). Defaults to 10s.
+}
+
+// Expiry configures the warning the client logs when it loads a certificate
+// that is about to expire.
+type Expiry struct {
+	Warning string `json:"warning"` // Optional time before the certificate expires from which the client warns, as a Go duration (ex: "168h"). Defaults to 720h (30 days). "0s" disables the warning.
+}
+
+// Breaker configures the circuit breaker of the client around the private key
+// operations of the signer, which fails fast while the keystore keeps failing.
+type Breaker struct {
+	Failures int    `json:"failures"` // Number of consecutive failures that open the breaker. Values below 1 disable it.
+	Window   string `json:"window"`   // Optional time within which the failures must occur, as a Go duration (ex: "30s"). Defaults to 1m.
+	Cooldown string `json:"cooldown"` // Optional time the breaker stays open before an operation probes the signer again, as a Go duration (ex: "10s"). Defaults to 30s.
+}
+
+// Recycle configures the periodic replacement of the signer subprocess by the
+// client, for keystore modules that leak resources over time.
+type Recycle struct {
+	MaxOperations int    `json:"max_operations"` // Optional number of private key operations after which the signer is replaced. Values below 1 disable the limit.
+	MaxLifetime   string `json:"max_lifetime"`   // Optional time after which the signer is replaced, as a Go duration (ex: "24h").
+}
+
+// Retry configures retries of transient keystore errors while the signer starts up.
+type Retry struct {
+	Attempts int    `json:"attempts"` // Maximum number of attempts. Values below 2 disable retries.
+	Interval string `json:"interval"` // Initial delay between attempts as a Go duration (ex: "500ms"). Doubled after every attempt. Defaults to 1s.
+	Deadline string `json:"deadline"` // Optional upper bound on the total time spent retrying as a Go duration (ex: "30s").
+}
+
+// Libs specifies the locations of helper libraries.
+type Libs struct {
+	ECP        string `json:"ecp"`
+	ECPClient  string `json:"ecp_client"`
+	TLSOffload string `json:"tls_offload"`
+
+	// Signers optionally maps backends to the signer binaries serving them,
+	// for backends other than the native one of the current OS (ex: a PKCS#11
+	// signer used as a fallback on MacOS, or a PIV signer). Libs.ECP serves the
+	// native one.
+	Signers map[string]string `json:"signers"`
+
+	// Sandbox optionally restricts the signer subprocesses started by the
+	// client.
+	Sandbox Sandbox `json:"sandbox"`
+}
+
+// Sandbox restricts the environment in which the client starts a signer, to
+// reduce the attack surface of the process holding the private key.
+type Sandbox struct {
+	RestrictEnv bool     `json:"restrict_env"` // Optional switch to only pass the variables listed in Env, and those the signer and the OS need, to the signer.
+	Env         []string `json:"env"`          // Optional names of additional environment variables passed to the signer when RestrictEnv is set.
+	WorkingDir  string   `json:"working_dir"`  // Optional working directory of the signer. Defaults to the working directory of the client.
+	Profile     string   `json:"profile"`      // Optional sandbox-exec profile the signer is confined by. MacOS only.
+	Launcher    []string `json:"launcher"`     // Optional command, with its arguments, that the signer binary and its arguments are appended to (ex: a bwrap or firejail invocation applying a seccomp profile).
+}
+
+// CertConfigs is a container for various OS-specific ECP Configs.
+type CertConfigs struct {
+	// Priority optionally lists backends ("macos_keychain", "windows_store",
+	// "pkcs11", "piv", "cloud_kms", "remote") in the order the client should try them. The first one
+	// available on the current OS that yields a credential is used.
+	Priority []string `json:"priority"`
+
+	MacOSKeychain MacOSKeychain `json:"macos_keychain"`
+	WindowsStore  WindowsStore  `json:"windows_store"`
+	PKCS11        PKCS11        `json:"pkcs11"`
+	PIV           PIV           `json:"piv"`
+	CloudKMS      CloudKMS      `json:"cloud_kms"`
+	Remote        Remote        `json:"remote"`
+}
+
+// MacOSKeychain contains keychain parameters describing the certificate to use.
+type MacOSKeychain struct {
+	Issuer         string `json:"issuer"`
+	KeychainType   string `json:"keychain_type"`      // Optional keychains to search: "login" or "system", which require legacy_keychain, or "all" (default).
+	EKU            string `json:"eku"`                // Optional extended key usage the certificate must allow (ex: "clientAuth").
+	Fingerprint    string `json:"sha256_fingerprint"` // Optional hex-encoded SHA-256 fingerprint of the DER encoded certificate to use. Issuer may then be empty.
+	AccessGroup    string `json:"access_group"`       // Optional keychain access group to search in the data protection keychain.
+	LegacyKeychain bool   `json:"legacy_keychain"`    // Optional switch to only search the file-based keychains, with the deprecated SecKeychain APIs.
+	Selection      string `json:"selection"`          // Optional way to choose between several matching identities: "first" (default) or "prompt".
+	UserPresence   bool   `json:"user_presence"`      // Optional switch to ask for Touch ID, or the login password, before the first use of the private key.
+}
+
+// WindowsStore contains Windows key store parameters describing the certificate to use.
+type WindowsStore struct {
+	Issuer             string `json:"issuer"`
+	Store              string `json:"store"`
+	Provider           string `json:"provider"`
+	EKU                string `json:"eku"`                  // Optional extended key usage the certificate must allow (ex: "clientAuth").
+	Fingerprint        string `json:"sha256_fingerprint"`   // Optional hex-encoded SHA-256 fingerprint of the DER encoded certificate to use. Issuer may then be empty.
+	KeyStorageProvider string `json:"key_storage_provider"` // Optional CNG key storage provider holding the private key, or "auto" (default).
+	SmartCardWait      string `json:"smart_card_wait"`      // Optional time to wait for a smart card when KeyStorageProvider is the smart card KSP (ex: "30s", default). "0s" disables waiting.
+	PIN                string `json:"pin"`                  // Optional PIN of the smart card holding the key, preferably as a dpapi://<path> secret URI written by "ecptool protect-pin".
+	Selection          string `json:"selection"`            // Optional way to choose between several matching certificates: "first" (default) or "prompt".
+}
+
+// Selection modes accepted by WindowsStore.Selection and MacOSKeychain.Selection.
+const (
+	SelectionFirst  = "first"  // The first matching certificate is used. This is the default.
+	SelectionPrompt = "prompt" // The user chooses between several matching certificates in a dialog, for desktop use.
+)
+
+// PKCS11 contains PKCS#11 parameters describing the certificate to use.
+type PKCS11 struct {
+	Slot         string        `json:"slot"`               // The hexadecimal representation of the uint36 slot ID. (ex:0x1739427) If empty, every slot is searched.
+	Label        string        `json:"label"`              // The token label (ex: gecc)
+	PKCS11Module PKCS11Modules `json:"module"`             // The path(s) to the pkcs11 module (shared lib), tried in order. If empty, the p11-kit proxy module is used.
+	UserPin      string        `json:"user_pin"`           // Optional user pin to unlock the PKCS #11 module. If it is not defined or empty C_Login will not be called.
+	EKU          string        `json:"eku"`                // Optional extended key usage the certificate must allow (ex: "clientAuth").
+	Fingerprint  string        `json:"sha256_fingerprint"` // Optional hex-encoded SHA-256 fingerprint of the DER encoded certificate to use.
+	PINCache     string        `json:"pin_cache"`          // Optional policy for the user pin of keys that require it before each signature: "memory" (default) or "none".
+}
+
+// PIN cache policies accepted by PKCS11.PINCache. They only apply to keys whose
+// CKA_ALWAYS_AUTHENTICATE attribute is set, such as PIV keys in "PIN always"
+// mode, for which the token requires the user pin before each signature.
+const (
+	PINCacheMemory = "memory" // The signer keeps the user pin in memory. This is the default.
+	PINCacheNone   = "none"   // The signer looks the user pin up in the secret store that user_pin references before each signature.
+)
+
+// PIV contains the parameters of a certificate and key on a PIV security key,
+// such as a YubiKey, which the PIV signer uses directly over PC/SC instead of
+// through the vendor's PKCS#11 module.
+type PIV struct {
+	Slot string `json:"slot"` // Optional PIV slot holding the certificate and key: "9a" (default), "9c", "9d" or "9e".
+	Card string `json:"card"` // Optional substring of the name of the smart card to use. If empty, every card is searched.
+	PIN  string `json:"pin"`  // Optional PIN of the card, needed if the PIN policy of the key requires it.
+}
+
+// CloudKMS contains the parameters of a key held in Google Cloud KMS, or in
+// Cloud HSM through Cloud KMS, which the Cloud KMS signer signs with using
+// Application Default Credentials.
+type CloudKMS struct {
+	KeyVersion      string `json:"key_version"`      // The resource name of the key version (ex: "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1").
+	CertificateFile string `json:"certificate_file"` // The path of the PEM encoded certificate chain of the key, leaf first.
+	Endpoint        string `json:"endpoint"`         // Optional Cloud KMS endpoint. Defaults to "https://cloudkms.googleapis.com".
+}
+
+// Remote selects a backend compiled into a remote signer binary built with
+// the remote package, such as a signer for another key management system.
+type Remote struct {
+	Backend string          `json:"backend"` // The name the backend is registered under.
+	Config  json.RawMessage `json:"config"`  // Optional config of the backend, passed to it as is.
+}
+
+// PKCS11Modules is an ordered list of PKCS#11 module paths. In the config file
+// it may be written either as a single string or as a list of strings.
+type PKCS11Modules []string
+
+// UnmarshalJSON accepts either a JSON string or a JSON array of strings.
+func (m *PKCS11Modules) UnmarshalJSON(data []byte) error {
+	var module string
+	if err := json.Unmarshal(data, &module); err == nil {
+		*m = PKCS11Modules{module}
+		return nil
+	}
+	var modules []string
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return fmt.Errorf("pkcs11 module must be a string or a list of strings: %w", err)
+	}
+	*m = modules
+	return nil
+}
+
+// Reading a config file that is being rewritten is retried up to loadAttempts
+// times, loadRetryInterval apart.
+const (
+	loadAttempts      = 5
+	loadRetryInterval = 50 * time.Millisecond
+)
+
+// errConfigReplaced is returned by readFile when the config file changed while
+// it was read.
+var errConfigReplaced = errors.New("config file changed while reading it")
+
+// Load reads, decodes and validates the ECP config file. The file is read
+// under a shared lock, and reading is retried when the file is replaced during
+// the read or does not hold complete JSON, as happens while gcloud rewrites it.
+func Load(configFilePath string) (config EnterpriseCertificateConfig, err error) {
+	for attempt := 1; ; attempt++ {
+		config, err = load(configFilePath)
+		if err == nil || attempt == loadAttempts || !isPartialRead(err) {
+			return config, err
+		}
+		time.Sleep(loadRetryInterval)
+	}
+}
+
+// isPartialRead reports whether err may be caused by reading the config file
+// while it was being written.
+func isPartialRead(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.Is(err, errConfigReplaced) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &syntaxErr)
+}
+
+// readFile reads the config file under a shared lock. It returns
+// errConfigReplaced if the file was renamed over or resized during the read.
+func readFile(configFilePath string) ([]byte, error) {
+	f, err := os.Open(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := lockShared(f); err != nil {
+		return nil, fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		zeroize.Bytes(data)
+		return nil, err
+	}
+	current, err := os.Stat(configFilePath)
+	if err != nil || !os.SameFile(opened, current) || opened.Size() != int64(len(data)) {
+		zeroize.Bytes(data)
+		return nil, errConfigReplaced
+	}
+	return data, nil
+}
+
+func load(configFilePath string) (config EnterpriseCertificateConfig, err error) {
+	byteValue, err := readFile(configFilePath)
+	if err != nil {
+		return EnterpriseCertificateConfig{}, err
+	}
+	// The raw config may contain secrets such as the PKCS#11 user PIN.
+	defer zeroize.Bytes(byteValue)
+	err = json.Unmarshal(byteValue, &config)
+	if err != nil {
+		return EnterpriseCertificateConfig{}, err
+	}
+	// Decode again, this time rejecting fields that are not part of the schema.
+	decoder := json.NewDecoder(bytes.NewReader(byteValue))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&EnterpriseCertificateConfig{}); err != nil {
+		return EnterpriseCertificateConfig{}, unknownFieldError(err)
+	}
+	if err := config.Validate(); err != nil {
+		return EnterpriseCertificateConfig{}, err
+	}
+	config.expandPaths()
+	return config, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	config, err := Load("./test_data/certificate_config.json")
+	// darwin
+	if err != nil {
+		t.Fatalf("Load error: %q", err)
+	}
+	want := "Google Endpoint Verification"
+	if config.CertConfigs.MacOSKeychain.Issuer != want {
+		t.Errorf("Expected issuer is %q, got: %q", want, config.CertConfigs.MacOSKeychain.Issuer)
+	}
+	want = "login"
+	if config.CertConfigs.MacOSKeychain.KeychainType != want {
+		t.Errorf("Expected keychain type is %q, got: %q", want, config.CertConfigs.MacOSKeychain.KeychainType)
+	}
+	if !config.CertConfigs.MacOSKeychain.LegacyKeychain {
+		t.Error("Expected legacy keychain to be set")
+	}
+	want = SelectionPrompt
+	if config.CertConfigs.MacOSKeychain.Selection != want {
+		t.Errorf("Expected selection is %q, got: %q", want, config.CertConfigs.MacOSKeychain.Selection)
+	}
+
+	// windows
+	want = "enterprise_v1_corp_client"
+	if config.CertConfigs.WindowsStore.Issuer != want {
+		t.Errorf("Expected issuer is %q, got: %q", want, config.CertConfigs.WindowsStore.Issuer)
+	}
+	want = "MY"
+	if config.CertConfigs.WindowsStore.Store != want {
+		t.Errorf("Expected store is %q, got: %q", want, config.CertConfigs.WindowsStore.Store)
+	}
+	want = "current_user"
+	if config.CertConfigs.WindowsStore.Provider != want {
+		t.Errorf("Expected provider is %q, got: %q", want, config.CertConfigs.WindowsStore.Provider)
+	}
+
+	// pkcs11
+	want = "0x1739427"
+	if config.CertConfigs.PKCS11.Slot != want {
+		t.Errorf("Expected slot is %v, got: %v", want, config.CertConfigs.PKCS11.Slot)
+	}
+	want = "gecc"
+	if config.CertConfigs.PKCS11.Label != want {
+		t.Errorf("Expected label is %v, got: %v", want, config.CertConfigs.PKCS11.Label)
+	}
+	wantModules := PKCS11Modules{"pkcs11_module.so"}
+	if !reflect.DeepEqual(config.CertConfigs.PKCS11.PKCS11Module, wantModules) {
+		t.Errorf("Expected pkcs11_module is %v, got: %v", wantModules, config.CertConfigs.PKCS11.PKCS11Module)
+	}
+	want = "0000"
+	if config.CertConfigs.PKCS11.UserPin != want {
+		t.Errorf("Expected user pin is %v, got: %v", want, config.CertConfigs.PKCS11.UserPin)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	_, err := Load("./test_data/certificate_config_missing.json")
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+// TestLoadNewerFields loads a config holding fields that a newer version of
+// gcloud writes, which this version rejects rather than silently ignoring.
+func TestLoadNewerFields(t *testing.T) {
+	_, err := Load("./test_data/certificate_config_newer_fields.json")
+	if err == nil {
+		t.Fatal("Expected error but got nil")
+	}
+	want := `unknown field "new_option" in certificate config`
+	if err.Error() != want {
+		t.Errorf("Expected error is %q, got: %q", want, err.Error())
+	}
+}
+
+func TestLoadModuleList(t *testing.T) {
+	config, err := Load("./test_data/certificate_config_module_list.json")
+	if err != nil {
+		t.Fatalf("Load error: %q", err)
+	}
+	want := PKCS11Modules{"/usr/lib/libykcs11.so", "/usr/lib/opensc-pkcs11.so"}
+	if !reflect.DeepEqual(config.CertConfigs.PKCS11.PKCS11Module, want) {
+		t.Errorf("Expected pkcs11_module is %v, got: %v", want, config.CertConfigs.PKCS11.PKCS11Module)
+	}
+}
+
+func TestLoadModuleInvalid(t *testing.T) {
+	_, err := Load("./test_data/certificate_config_module_invalid.json")
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestLoad_RetriesPartialWrite(t *testing.T) {
+	data, err := os.ReadFile("./test_data/certificate_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "certificate_config.json")
+	if err := os.WriteFile(path, data[:len(data)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		time.Sleep(loadRetryInterval)
+		done <- os.WriteFile(path, data, 0600)
+	}()
+	config, err := Load(path)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatalf("Load: got %v, want nil err", err)
+	}
+	if got, want := config.CertConfigs.MacOSKeychain.Issuer, "Google Endpoint Verification"; got != want {
+		t.Errorf("Load: got issuer %q, want %q", got, want)
+	}
+}
+
+func TestLoad_Truncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certificate_config.json")
+	if err := os.WriteFile(path, []byte(`{"cert_configs": {`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load: got nil err, want error for truncated config")
+	}
+}
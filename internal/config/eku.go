@@ -0,0 +1,51 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// extKeyUsages maps the names accepted by the eku filter to extended key usages.
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+}
+
+func validateEKU(block, name string) error {
+	if _, ok := extKeyUsages[name]; name != "" && !ok {
+		return fmt.Errorf("invalid %s eku %q, must be one of \"clientAuth\", \"serverAuth\", \"codeSigning\" or \"emailProtection\"", block, name)
+	}
+	return nil
+}
+
+// MatchesEKU reports whether cert may be used for the extended key usage
+// named by the eku filter. An empty filter matches every certificate, as does
+// a certificate without an ExtKeyUsage extension or with the anyExtendedKeyUsage
+// usage.
+func MatchesEKU(cert *x509.Certificate, eku string) bool {
+	want, ok := extKeyUsages[eku]
+	if !ok || (len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0) {
+		return true
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == want || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestMatchesEKU(t *testing.T) {
+	clientAuth := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	email := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}
+	anyUsage := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	unrestricted := &x509.Certificate{}
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		eku  string
+		want bool
+	}{
+		{name: "no filter", cert: email, eku: "", want: true},
+		{name: "matching", cert: clientAuth, eku: "clientAuth", want: true},
+		{name: "not matching", cert: email, eku: "clientAuth", want: false},
+		{name: "any usage", cert: anyUsage, eku: "clientAuth", want: true},
+		{name: "no extension", cert: unrestricted, eku: "clientAuth", want: true},
+	}
+	for _, test := range tests {
+		if got := MatchesEKU(test.cert, test.eku); got != test.want {
+			t.Errorf("%s: MatchesEKU() got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var windowsEnvVar = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%`)
+
+// HomeDir returns the home directory of the current user.
+func HomeDir() string {
+	// Prefer $HOME over user.Current due to glibc bug: golang.org/issue/13470
+	if v := os.Getenv("HOME"); v != "" {
+		return v
+	}
+	// Else, fall back to user.Current:
+	if u, err := user.Current(); err == nil {
+		return u.HomeDir
+	}
+	return ""
+}
+
+// expandPath expands a leading "~", $VAR and ${VAR} references, and on Windows
+// %VAR% references in path. References to unset variables are left as-is.
+func expandPath(path string) string {
+	return expandPathForOS(path, runtime.GOOS)
+}
+
+func expandPathForOS(path string, goos string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || (goos == "windows" && strings.HasPrefix(path, `~\`)) {
+		path = HomeDir() + path[1:]
+	}
+	path = os.Expand(path, func(name string) string {
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		if name == "HOME" {
+			return HomeDir()
+		}
+		return "$" + name
+	})
+	if goos == "windows" {
+		path = windowsEnvVar.ReplaceAllStringFunc(path, func(ref string) string {
+			if v, ok := os.LookupEnv(strings.Trim(ref, "%")); ok {
+				return v
+			}
+			return ref
+		})
+	}
+	return path
+}
+
+// expandPaths expands every path in config in place.
+func (config *EnterpriseCertificateConfig) expandPaths() {
+	config.Libs.ECP = expandPath(config.Libs.ECP)
+	config.Libs.ECPClient = expandPath(config.Libs.ECPClient)
+	config.Libs.TLSOffload = expandPath(config.Libs.TLSOffload)
+	for backend, path := range config.Libs.Signers {
+		config.Libs.Signers[backend] = expandPath(path)
+	}
+	config.Libs.Sandbox.WorkingDir = expandPath(config.Libs.Sandbox.WorkingDir)
+	config.Libs.Sandbox.Profile = expandPath(config.Libs.Sandbox.Profile)
+	config.CertConfigs.CloudKMS.CertificateFile = expandPath(config.CertConfigs.CloudKMS.CertificateFile)
+	for i, module := range config.CertConfigs.PKCS11.PKCS11Module {
+		config.CertConfigs.PKCS11.PKCS11Module[i] = expandPath(module)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("ECP_DIR", "/opt/ecp")
+	t.Setenv("APPDATA", `C:\Users\user\AppData\Roaming`)
+	tests := []struct {
+		path string
+		goos string
+		want string
+	}{
+		{path: "~/ecp/signer", goos: "linux", want: "/home/user/ecp/signer"},
+		{path: "$HOME/ecp/signer", goos: "linux", want: "/home/user/ecp/signer"},
+		{path: "${ECP_DIR}/signer", goos: "darwin", want: "/opt/ecp/signer"},
+		{path: "$ECP_UNSET/signer", goos: "linux", want: "$ECP_UNSET/signer"},
+		{path: "/usr/lib/a~b.so", goos: "linux", want: "/usr/lib/a~b.so"},
+		{path: `C:\PROGRA~1\ecp.exe`, goos: "windows", want: `C:\PROGRA~1\ecp.exe`},
+		{path: `%APPDATA%\gcloud\ecp.exe`, goos: "windows", want: `C:\Users\user\AppData\Roaming\gcloud\ecp.exe`},
+		{path: `%ECP_UNSET%\ecp.exe`, goos: "windows", want: `%ECP_UNSET%\ecp.exe`},
+		{path: `%APPDATA%/ecp`, goos: "linux", want: `%APPDATA%/ecp`},
+	}
+	for _, test := range tests {
+		if got := expandPathForOS(test.path, test.goos); got != test.want {
+			t.Errorf("expandPathForOS(%q, %q): got %q, want %q", test.path, test.goos, got, test.want)
+		}
+	}
+}
+
+func TestLoadExpandsPaths(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	config, err := Load("./test_data/certificate_config_expansion.json")
+	if err != nil {
+		t.Fatalf("Load error: %q", err)
+	}
+	if want := "/home/user/ecp/signer"; config.Libs.ECP != want {
+		t.Errorf("Expected ecp is %q, got: %q", want, config.Libs.ECP)
+	}
+	if want := "/home/user/lib/pkcs11.so"; config.CertConfigs.PKCS11.PKCS11Module[0] != want {
+		t.Errorf("Expected pkcs11_module is %q, got: %q", want, config.CertConfigs.PKCS11.PKCS11Module[0])
+	}
+}
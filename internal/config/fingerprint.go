@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// parseFingerprint decodes a hex-encoded SHA-256 fingerprint, in either case
+// and optionally with colons between the bytes, as printed by
+// "openssl x509 -fingerprint -sha256".
+func parseFingerprint(fingerprint string) ([]byte, error) {
+	digest, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("must be 64 hexadecimal digits, optionally separated by colons")
+	}
+	return digest, nil
+}
+
+func validateFingerprint(block, fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+	if _, err := parseFingerprint(fingerprint); err != nil {
+		return fmt.Errorf("invalid %s sha256_fingerprint %q, %v", block, fingerprint, err)
+	}
+	return nil
+}
+
+// MatchesFingerprint reports whether the SHA-256 digest of the DER encoding of
+// cert is the fingerprint selected by the sha256_fingerprint filter. An empty
+// filter matches every certificate.
+func MatchesFingerprint(cert *x509.Certificate, fingerprint string) bool {
+	if fingerprint == "" {
+		return true
+	}
+	want, err := parseFingerprint(fingerprint)
+	if err != nil {
+		return false
+	}
+	got := sha256.Sum256(cert.Raw)
+	return bytes.Equal(got[:], want)
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMatchesFingerprint(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	digest := sha256.Sum256(cert.Raw)
+	fingerprint := hex.EncodeToString(digest[:])
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	tests := []struct {
+		name        string
+		fingerprint string
+		want        bool
+	}{
+		{name: "no filter", fingerprint: "", want: true},
+		{name: "matching", fingerprint: fingerprint, want: true},
+		{name: "matching with colons", fingerprint: strings.Join(colons, ":"), want: true},
+		{name: "not matching", fingerprint: strings.Repeat("00", sha256.Size), want: false},
+		{name: "invalid", fingerprint: fingerprint[:40], want: false},
+	}
+	for _, test := range tests {
+		if got := MatchesFingerprint(cert, test.fingerprint); got != test.want {
+			t.Errorf("%s: MatchesFingerprint() got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Schemes of the URIs that fields holding secrets, such as the PKCS#11 user
+// PIN, may contain instead of the secret itself.
+const (
+	// SecretServiceScheme references an item of the freedesktop.org Secret
+	// Service (GNOME Keyring, KWallet) by its "service" and "account"
+	// attributes, as in secretservice://<service>/<account>.
+	SecretServiceScheme = "secretservice"
+	// KeychainScheme references a generic password of the MacOS keychain by
+	// its service and account, as in keychain://<service>/<account>.
+	KeychainScheme = "keychain"
+	// DPAPIScheme references a file holding a secret protected with the
+	// Windows DPAPI for the current user, as in dpapi://<path>.
+	DPAPIScheme = "dpapi"
+)
+
+// parseSecretRef splits value into the scheme and reference of a secret URI.
+// ok is false if value is not a secret URI, and is the secret itself.
+func parseSecretRef(value string) (scheme, ref string, ok bool) {
+	for _, scheme := range []string{SecretServiceScheme, KeychainScheme, DPAPIScheme} {
+		if prefix := scheme + "://"; strings.HasPrefix(value, prefix) {
+			return scheme, value[len(prefix):], true
+		}
+	}
+	return "", "", false
+}
+
+// validateSecret checks that value is either a secret or a well-formed secret
+// URI.
+func validateSecret(value string) error {
+	scheme, ref, ok := parseSecretRef(value)
+	if !ok {
+		return nil
+	}
+	if scheme == DPAPIScheme {
+		if ref == "" {
+			return errors.New("dpapi secret URI must name a file, as in dpapi://<path>")
+		}
+		return nil
+	}
+	if service, account, found := strings.Cut(ref, "/"); !found || service == "" || account == "" {
+		return fmt.Errorf("%s secret URI must name a service and an account, as in %s://<service>/<account>", scheme, scheme)
+	}
+	return nil
+}
+
+// ResolveSecret returns the secret referenced by value if it is a secret URI,
+// looking it up in the OS secret store, or a copy of value itself otherwise.
+// The secret is returned in a new buffer that the caller zeroes once it is no
+// longer needed, rather than as a string, which cannot be scrubbed.
+func ResolveSecret(value string) ([]byte, error) {
+	scheme, ref, ok := parseSecretRef(value)
+	if !ok {
+		return []byte(value), nil
+	}
+	if err := validateSecret(value); err != nil {
+		return nil, err
+	}
+	var secret []byte
+	var err error
+	switch scheme {
+	case SecretServiceScheme:
+		service, account, _ := strings.Cut(ref, "/")
+		secret, err = lookupSecret(exec.Command("secret-tool", "lookup", "service", service, "account", account))
+	case KeychainScheme:
+		service, account, _ := strings.Cut(ref, "/")
+		secret, err = lookupSecret(exec.Command("/usr/bin/security", "find-generic-password", "-s", service, "-a", account, "-w"))
+	case DPAPIScheme:
+		var blob []byte
+		if blob, err = os.ReadFile(expandPath(ref)); err == nil {
+			secret, err = unprotect(blob)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up secret %s: %w", value, err)
+	}
+	return secret, nil
+}
+
+// lookupSecret runs cmd, which prints a secret, and returns the secret.
+func lookupSecret(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("secret not found")
+	}
+	return bytes.TrimRight(out, "\r\n"), nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package config
+
+import "errors"
+
+// ProtectSecret encrypts secret with the DPAPI, which is only available on
+// Windows.
+func ProtectSecret(secret []byte) ([]byte, error) {
+	return nil, errors.New("DPAPI is only available on Windows")
+}
+
+// unprotect decrypts a blob protected with the DPAPI, which is only available
+// on Windows.
+func unprotect(blob []byte) ([]byte, error) {
+	return nil, errors.New("DPAPI is only available on Windows")
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestValidateSecret(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "1234"},
+		{value: "secretservice://ecp/pin"},
+		{value: "keychain://ecp/pin"},
+		{value: "dpapi://C:/ProgramData/ecp/pin.bin"},
+		{value: "secretservice://ecp", wantErr: true},
+		{value: "keychain:///pin", wantErr: true},
+		{value: "dpapi://", wantErr: true},
+	}
+	for _, test := range tests {
+		if err := validateSecret(test.value); (err != nil) != test.wantErr {
+			t.Errorf("validateSecret(%q) = %v, want error: %v", test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake secret-tool is a shell script")
+	}
+	// Replace secret-tool with a script printing the attributes it looks up.
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s:%s\\n' \"$3\" \"$5\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	for value, want := range map[string]string{
+		"secretservice://ecp/pin": "ecp:pin",
+		"123456":                  "123456",
+		"":                        "",
+	} {
+		got, err := ResolveSecret(value)
+		if err != nil {
+			t.Errorf("ResolveSecret(%q): %v", value, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("ResolveSecret(%q): got %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestResolveSecret_DPAPI(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("DPAPI is only available on Windows")
+	}
+	blob, err := ProtectSecret([]byte("123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pin.bin")
+	if err := os.WriteFile(path, blob, 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ResolveSecret(DPAPIScheme + "://" + filepath.ToSlash(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "123456" {
+		t.Errorf("ResolveSecret: got %q, want %q", got, "123456")
+	}
+}
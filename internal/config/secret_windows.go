@@ -0,0 +1,60 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package config
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ProtectSecret encrypts secret with the DPAPI for the current user, for
+// storage in a file referenced by a dpapi:// secret URI.
+func ProtectSecret(secret []byte) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, windows.ERROR_INVALID_DATA
+	}
+	in := windows.DataBlob{Size: uint32(len(secret)), Data: &secret[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	blob := make([]byte, out.Size)
+	copy(blob, unsafe.Slice(out.Data, out.Size))
+	return blob, nil
+}
+
+// unprotect decrypts a blob protected with the DPAPI for the current user.
+func unprotect(blob []byte) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, windows.ERROR_INVALID_DATA
+	}
+	in := windows.DataBlob{Size: uint32(len(blob)), Data: &blob[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	data := unsafe.Slice(out.Data, out.Size)
+	secret := make([]byte, len(data))
+	copy(secret, data)
+	for i := range data {
+		data[i] = 0
+	}
+	return secret, nil
+}
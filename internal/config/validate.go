@@ -0,0 +1,250 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+)
+
+// CurrentVersion is the newest certificate config version.
+const CurrentVersion = 1
+
+// Validate checks config for values that cannot be acted upon.
+func (config EnterpriseCertificateConfig) Validate() error {
+	if config.Version < 0 || config.Version > CurrentVersion {
+		return fmt.Errorf("unsupported certificate config version %d, the newest supported version is %d", config.Version, CurrentVersion)
+	}
+	kc := config.CertConfigs.MacOSKeychain
+	switch kc.KeychainType {
+	case "", "all":
+	case "login", "system":
+		if !kc.LegacyKeychain {
+			return fmt.Errorf("macos_keychain keychain_type %q requires legacy_keychain", kc.KeychainType)
+		}
+	default:
+		return fmt.Errorf("invalid macos_keychain keychain_type %q, must be one of \"login\", \"system\" or \"all\"", kc.KeychainType)
+	}
+	if kc.AccessGroup != "" && kc.LegacyKeychain {
+		return fmt.Errorf("macos_keychain access_group cannot be used with legacy_keychain")
+	}
+	if err := validateBackends(config); err != nil {
+		return err
+	}
+	for block, eku := range map[string]string{
+		"macos_keychain": config.CertConfigs.MacOSKeychain.EKU,
+		"windows_store":  config.CertConfigs.WindowsStore.EKU,
+		"pkcs11":         config.CertConfigs.PKCS11.EKU,
+	} {
+		if err := validateEKU(block, eku); err != nil {
+			return err
+		}
+	}
+	for block, fingerprint := range map[string]string{
+		"macos_keychain": config.CertConfigs.MacOSKeychain.Fingerprint,
+		"windows_store":  config.CertConfigs.WindowsStore.Fingerprint,
+		"pkcs11":         config.CertConfigs.PKCS11.Fingerprint,
+	} {
+		if err := validateFingerprint(block, fingerprint); err != nil {
+			return err
+		}
+	}
+	if wait := config.CertConfigs.WindowsStore.SmartCardWait; wait != "" {
+		if d, err := time.ParseDuration(wait); err != nil || d < 0 {
+			return fmt.Errorf("invalid windows_store smart_card_wait %q, must be a duration such as \"30s\"", wait)
+		}
+	}
+	for field, selection := range map[string]string{
+		"macos_keychain": config.CertConfigs.MacOSKeychain.Selection,
+		"windows_store":  config.CertConfigs.WindowsStore.Selection,
+	} {
+		switch selection {
+		case "", SelectionFirst, SelectionPrompt:
+		default:
+			return fmt.Errorf("invalid %s selection %q, must be one of \"first\" or \"prompt\"", field, selection)
+		}
+	}
+	switch config.CertConfigs.PIV.Slot {
+	case "", "9a", "9c", "9d", "9e":
+	default:
+		return fmt.Errorf("invalid piv slot %q, must be one of \"9a\", \"9c\", \"9d\" or \"9e\"", config.CertConfigs.PIV.Slot)
+	}
+	switch config.CertConfigs.PKCS11.PINCache {
+	case "", PINCacheMemory, PINCacheNone:
+	default:
+		return fmt.Errorf("invalid pkcs11 pin_cache %q, must be one of \"memory\" or \"none\"", config.CertConfigs.PKCS11.PINCache)
+	}
+	if pin := config.CertConfigs.PKCS11.UserPin; config.CertConfigs.PKCS11.PINCache == PINCacheNone && pin != "" {
+		if _, _, ok := parseSecretRef(pin); !ok {
+			return fmt.Errorf("pkcs11 pin_cache \"none\" requires user_pin to be a secret URI")
+		}
+	}
+	for field, secret := range map[string]string{
+		"pkcs11 user_pin":   config.CertConfigs.PKCS11.UserPin,
+		"piv pin":           config.CertConfigs.PIV.PIN,
+		"windows_store pin": config.CertConfigs.WindowsStore.PIN,
+	} {
+		if err := validateSecret(secret); err != nil {
+			return fmt.Errorf("invalid %s: %w", field, err)
+		}
+	}
+	if kms := config.CertConfigs.CloudKMS; kms.KeyVersion != "" && !isKeyVersionName(kms.KeyVersion) {
+		return fmt.Errorf("invalid cloud_kms key_version %q, must be of the form \"projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*\"", kms.KeyVersion)
+	}
+	for name, value := range map[string]string{"interval": config.Retry.Interval, "deadline": config.Retry.Deadline} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid retry %s %q, must be a duration such as \"500ms\" or \"30s\"", name, value)
+		}
+	}
+	if sandbox := config.Libs.Sandbox; sandbox.Profile != "" && len(sandbox.Launcher) > 0 {
+		return fmt.Errorf("libs sandbox profile cannot be used with launcher")
+	}
+	if launcher := config.Libs.Sandbox.Launcher; len(launcher) > 0 && launcher[0] == "" {
+		return fmt.Errorf("invalid libs sandbox launcher, the command must not be empty")
+	}
+	if err := wire.Check(config.WireFormat); err != nil {
+		return fmt.Errorf("invalid wire_format: %w", err)
+	}
+	switch config.Revocation.Mode {
+	case "", RevocationOff, RevocationWarn, RevocationEnforce:
+	default:
+		return fmt.Errorf("invalid revocation mode %q, must be one of \"off\", \"warn\" or \"enforce\"", config.Revocation.Mode)
+	}
+	if config.Revocation.Timeout != "" {
+		if _, err := time.ParseDuration(config.Revocation.Timeout); err != nil {
+			return fmt.Errorf("invalid revocation timeout %q, must be a duration such as \"5s\"", config.Revocation.Timeout)
+		}
+	}
+	if lifetime := config.Recycle.MaxLifetime; lifetime != "" {
+		if d, err := time.ParseDuration(lifetime); err != nil || d <= 0 {
+			return fmt.Errorf("invalid recycle max_lifetime %q, must be a positive duration such as \"24h\"", lifetime)
+		}
+	}
+	for name, value := range map[string]string{"window": config.Breaker.Window, "cooldown": config.Breaker.Cooldown} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid circuit_breaker %s %q, must be a positive duration such as \"30s\"", name, value)
+		}
+	}
+	if warning := config.Expiry.Warning; warning != "" {
+		if d, err := time.ParseDuration(warning); err != nil || d < 0 {
+			return fmt.Errorf("invalid expiry warning %q, must be a non-negative duration such as \"720h\"", warning)
+		}
+	}
+	return nil
+}
+
+// isKeyVersionName reports whether name is the resource name of a Cloud KMS
+// key version.
+func isKeyVersionName(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(parts) != 10 {
+		return false
+	}
+	for i, collection := range []string{"projects", "locations", "keyRings", "cryptoKeys", "cryptoKeyVersions"} {
+		if parts[2*i] != collection || parts[2*i+1] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// unknownFieldError rewrites the error returned by a json.Decoder with
+// DisallowUnknownFields into an actionable message, suggesting the closest
+// known field name when there is one.
+func unknownFieldError(err error) error {
+	const prefix = "json: unknown field "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return err
+	}
+	field := strings.Trim(strings.TrimPrefix(msg, prefix), `"`)
+	if suggestion := closestField(field, knownFields()); suggestion != "" {
+		return fmt.Errorf("unknown field %q in certificate config, did you mean %q?", field, suggestion)
+	}
+	return fmt.Errorf("unknown field %q in certificate config", field)
+}
+
+// knownFields returns the JSON names of every field in the config schema.
+func knownFields() []string {
+	var fields []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+				fields = append(fields, name)
+			}
+			walk(f.Type)
+		}
+	}
+	walk(reflect.TypeOf(EnterpriseCertificateConfig{}))
+	return fields
+}
+
+// closestField returns the known field that field is most likely a typo of,
+// or "" if there is no plausible candidate.
+func closestField(field string, known []string) string {
+	normalized := strings.ToLower(strings.TrimSpace(field))
+	best, bestDistance := "", 3
+	for _, k := range known {
+		if d := editDistance(normalized, k); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
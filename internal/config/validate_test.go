@@ -0,0 +1,115 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadUnknownField(t *testing.T) {
+	_, err := Load("./test_data/certificate_config_unknown_field.json")
+	if err == nil {
+		t.Fatal("Expected error but got nil")
+	}
+	want := `unknown field "issuer " in certificate config, did you mean "issuer"?`
+	if err.Error() != want {
+		t.Errorf("Expected error is %q, got: %q", want, err.Error())
+	}
+}
+
+func TestLoadFutureVersion(t *testing.T) {
+	_, err := Load("./test_data/certificate_config_future_version.json")
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EnterpriseCertificateConfig
+		wantErr bool
+	}{
+		{name: "empty", config: EnterpriseCertificateConfig{}},
+		{name: "current version", config: EnterpriseCertificateConfig{Version: CurrentVersion}},
+		{name: "negative version", config: EnterpriseCertificateConfig{Version: -1}, wantErr: true},
+		{name: "valid keychain type", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{KeychainType: "system", LegacyKeychain: true}}}},
+		{name: "keychain type without legacy keychain", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{KeychainType: "login"}}}, wantErr: true},
+		{name: "invalid keychain type", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{KeychainType: "icloud"}}}, wantErr: true},
+		{name: "valid access group", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{AccessGroup: "TEAMID.com.example.ecp"}}}},
+		{name: "access group with legacy keychain", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{AccessGroup: "TEAMID.com.example.ecp", LegacyKeychain: true}}}, wantErr: true},
+		{name: "valid priority", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{Priority: []string{"windows_store", "pkcs11"}}, Libs: Libs{Signers: map[string]string{"pkcs11": "ecp-pkcs11"}}}},
+		{name: "unknown priority backend", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{Priority: []string{"tpm"}}}, wantErr: true},
+		{name: "duplicate priority backend", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{Priority: []string{"pkcs11", "pkcs11"}}}, wantErr: true},
+		{name: "unknown signers backend", config: EnterpriseCertificateConfig{Libs: Libs{Signers: map[string]string{"tpm": "ecp-tpm"}}}, wantErr: true},
+		{name: "valid sandbox", config: EnterpriseCertificateConfig{Libs: Libs{Sandbox: Sandbox{RestrictEnv: true, Env: []string{"PKCS11_PROXY_SOCKET"}, Launcher: []string{"bwrap", "--ro-bind", "/", "/"}}}}},
+		{name: "sandbox profile with launcher", config: EnterpriseCertificateConfig{Libs: Libs{Sandbox: Sandbox{Profile: "signer.sb", Launcher: []string{"firejail"}}}}, wantErr: true},
+		{name: "empty sandbox launcher", config: EnterpriseCertificateConfig{Libs: Libs{Sandbox: Sandbox{Launcher: []string{""}}}}, wantErr: true},
+		{name: "valid piv slot", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{Priority: []string{"piv"}, PIV: PIV{Slot: "9c"}}}},
+		{name: "invalid piv slot", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PIV: PIV{Slot: "0x9a"}}}, wantErr: true},
+		{name: "valid cloud kms key version", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{CloudKMS: CloudKMS{KeyVersion: "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"}}}},
+		{name: "invalid cloud kms key version", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{CloudKMS: CloudKMS{KeyVersion: "projects/p/locations/global/keyRings/r/cryptoKeys/k"}}}, wantErr: true},
+		{name: "json wire format", config: EnterpriseCertificateConfig{WireFormat: "json"}},
+		{name: "invalid wire format", config: EnterpriseCertificateConfig{WireFormat: "protobuf"}, wantErr: true},
+		{name: "valid retry", config: EnterpriseCertificateConfig{Retry: Retry{Attempts: 3, Interval: "1s", Deadline: "1m"}}},
+		{name: "invalid retry interval", config: EnterpriseCertificateConfig{Retry: Retry{Interval: "1 second"}}, wantErr: true},
+		{name: "valid eku", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{EKU: "clientAuth"}}}},
+		{name: "invalid eku", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{WindowsStore: WindowsStore{EKU: "ClientAuthentication"}}}, wantErr: true},
+		{name: "valid fingerprint", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{Fingerprint: strings.Repeat("AB:", 31) + "AB"}}}},
+		{name: "invalid fingerprint", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{Fingerprint: "abcd"}}}, wantErr: true},
+		{name: "valid smart card wait", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{WindowsStore: WindowsStore{SmartCardWait: "1m"}}}},
+		{name: "invalid smart card wait", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{WindowsStore: WindowsStore{SmartCardWait: "-1s"}}}, wantErr: true},
+		{name: "valid selection", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{WindowsStore: WindowsStore{Selection: SelectionPrompt}}}},
+		{name: "invalid selection", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{WindowsStore: WindowsStore{Selection: "last"}}}, wantErr: true},
+		{name: "invalid macos selection", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{MacOSKeychain: MacOSKeychain{Selection: "touchid"}}}, wantErr: true},
+		{name: "valid revocation", config: EnterpriseCertificateConfig{Revocation: Revocation{Mode: RevocationEnforce, Timeout: "5s"}}},
+		{name: "invalid revocation mode", config: EnterpriseCertificateConfig{Revocation: Revocation{Mode: "strict"}}, wantErr: true},
+		{name: "invalid revocation timeout", config: EnterpriseCertificateConfig{Revocation: Revocation{Timeout: "5"}}, wantErr: true},
+		{name: "valid pin cache", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{PINCache: PINCacheNone}}}},
+		{name: "pin cache with secret URI", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{PINCache: PINCacheNone, UserPin: "secretservice://ecp/pin"}}}},
+		{name: "pin cache with plain pin", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{PINCache: PINCacheNone, UserPin: "1234"}}}, wantErr: true},
+		{name: "invalid pin cache", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{PINCache: "disk"}}}, wantErr: true},
+		{name: "invalid secret URI", config: EnterpriseCertificateConfig{CertConfigs: CertConfigs{PKCS11: PKCS11{UserPin: "keychain://ecp"}}}, wantErr: true},
+		{name: "valid circuit breaker", config: EnterpriseCertificateConfig{Breaker: Breaker{Failures: 5, Window: "30s", Cooldown: "10s"}}},
+		{name: "invalid circuit breaker cooldown", config: EnterpriseCertificateConfig{Breaker: Breaker{Failures: 5, Cooldown: "0s"}}, wantErr: true},
+		{name: "valid recycle", config: EnterpriseCertificateConfig{Recycle: Recycle{MaxOperations: 1000, MaxLifetime: "24h"}}},
+		{name: "invalid recycle max lifetime", config: EnterpriseCertificateConfig{Recycle: Recycle{MaxLifetime: "-1h"}}, wantErr: true},
+		{name: "valid expiry warning", config: EnterpriseCertificateConfig{Expiry: Expiry{Warning: "168h"}}},
+		{name: "invalid expiry warning", config: EnterpriseCertificateConfig{Expiry: Expiry{Warning: "30d"}}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := test.config.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() got err %v, want err %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestClosestField(t *testing.T) {
+	known := []string{"issuer", "store", "provider"}
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "issuer ", want: "issuer"},
+		{field: "Issuer", want: "issuer"},
+		{field: "provder", want: "provider"},
+		{field: "fingerprint", want: ""},
+	}
+	for _, test := range tests {
+		if got := closestField(test.field, known); got != test.want {
+			t.Errorf("closestField(%q): got %q, want %q", test.field, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cryptoopts registers the crypto option types that the client sends
+// to the signers over gob-encoded RPC, so that both sides agree on them.
+// Option types that are not registered are sent as an *Opaque.
+package cryptoopts
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	mu         sync.RWMutex
+	registered = make(map[reflect.Type]bool)
+)
+
+func init() {
+	Register(crypto.SHA256)
+	Register(&rsa.PSSOptions{})
+	Register(&rsa.OAEPOptions{})
+	Register(&rsa.PKCS1v15DecryptOptions{})
+	Register(&Opaque{})
+}
+
+// Register records the type of value with gob, so that values of the type can
+// be sent as signer, encrypter or decrypter opts. It must be called in both the
+// client and the signer.
+func Register(value any) {
+	gob.Register(value)
+	mu.Lock()
+	defer mu.Unlock()
+	registered[reflect.TypeOf(value)] = true
+}
+
+// IsRegistered reports whether the type of value was registered with Register.
+func IsRegistered(value any) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return registered[reflect.TypeOf(value)]
+}
+
+// Opaque stands in for opts of a type that is not registered. Signers only
+// learn the name of the original type and its hash function.
+type Opaque struct {
+	Type string      // The Go type of the original opts. Ex: "*mypkg.Options".
+	Hash crypto.Hash // The hash function of the original opts, if it has one.
+}
+
+// HashFunc returns the hash function of the original opts. Implements
+// crypto.SignerOpts.
+func (o *Opaque) HashFunc() crypto.Hash {
+	return o.Hash
+}
+
+// String describes the original opts in error messages.
+func (o *Opaque) String() string {
+	return fmt.Sprintf("%s (hash %v)", o.Type, o.Hash)
+}
+
+// Wrap returns opts if its type is registered or opts is nil, and an *Opaque
+// describing it otherwise.
+func Wrap(opts any) any {
+	if opts == nil || IsRegistered(opts) {
+		return opts
+	}
+	o := &Opaque{Type: fmt.Sprintf("%T", opts)}
+	if h, ok := opts.(crypto.SignerOpts); ok {
+		o.Hash = h.HashFunc()
+	}
+	return o
+}
+
+// WrapSignerOpts is like Wrap for crypto.SignerOpts.
+func WrapSignerOpts(opts crypto.SignerOpts) crypto.SignerOpts {
+	if opts == nil {
+		return nil
+	}
+	return Wrap(opts).(crypto.SignerOpts)
+}
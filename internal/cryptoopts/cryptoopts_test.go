@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptoopts
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+type args struct {
+	Opts crypto.SignerOpts
+}
+
+type customOpts struct{}
+
+func (customOpts) HashFunc() crypto.Hash {
+	return crypto.SHA384
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, opts := range []crypto.SignerOpts{
+		crypto.SHA256,
+		crypto.SHA512,
+		&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256},
+		&Opaque{Type: "*mypkg.Options", Hash: crypto.SHA384},
+	} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(args{Opts: opts}); err != nil {
+			t.Errorf("Encode(%v): got %v, want nil err", opts, err)
+			continue
+		}
+		var got args
+		if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+			t.Errorf("Decode(%v): got %v, want nil err", opts, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Opts, opts) {
+			t.Errorf("round trip: got %#v, want %#v", got.Opts, opts)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	pss := &rsa.PSSOptions{Hash: crypto.SHA256}
+	if got := WrapSignerOpts(pss); got != pss {
+		t.Errorf("WrapSignerOpts(%v): got %v, want the registered opts unchanged", pss, got)
+	}
+	if got := WrapSignerOpts(nil); got != nil {
+		t.Errorf("WrapSignerOpts(nil): got %v, want nil", got)
+	}
+	want := &Opaque{Type: "cryptoopts.customOpts", Hash: crypto.SHA384}
+	if got := WrapSignerOpts(customOpts{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("WrapSignerOpts(customOpts{}): got %#v, want %#v", got, want)
+	}
+	if got := Wrap("label"); !reflect.DeepEqual(got, &Opaque{Type: "string"}) {
+		t.Errorf("Wrap(string): got %#v, want an *Opaque", got)
+	}
+}
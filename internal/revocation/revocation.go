@@ -0,0 +1,163 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package revocation checks whether a certificate has been revoked by its
+// issuer, using the OCSP responders and CRL distribution points listed in the
+// certificate.
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Upper bounds on the size of responses read from OCSP responders and CRL
+// distribution points.
+const (
+	maxOCSPResponseSize = 1 << 20
+	maxCRLSize          = 16 << 20
+)
+
+// Status is the revocation status of a certificate.
+type Status int
+
+const (
+	// Unknown means no OCSP responder or CRL gave a definitive answer.
+	Unknown Status = iota
+	// Good means the certificate has not been revoked.
+	Good
+	// Revoked means the certificate has been revoked by its issuer.
+	Revoked
+)
+
+func (s Status) String() string {
+	switch s {
+	case Good:
+		return "good"
+	case Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNoSources is returned by Check when the certificate lists neither an
+// OCSP responder nor a CRL distribution point.
+var ErrNoSources = errors.New("certificate has no OCSP responder or CRL distribution point")
+
+// Check reports the revocation status of cert, which must have been issued by
+// issuer. The OCSP responders listed in cert are queried first, and its CRL
+// distribution points are consulted when no responder gives a definitive
+// answer. If the status is Unknown, the returned error describes why each
+// source failed.
+func Check(ctx context.Context, client *http.Client, cert, issuer *x509.Certificate) (Status, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var failures []string
+	for _, server := range cert.OCSPServer {
+		status, err := checkOCSP(ctx, client, server, cert, issuer)
+		if err == nil && status != Unknown {
+			return status, nil
+		}
+		if err == nil {
+			err = errors.New("responder does not know the certificate")
+		}
+		failures = append(failures, fmt.Sprintf("OCSP %s: %v", server, err))
+	}
+	for _, url := range cert.CRLDistributionPoints {
+		status, err := checkCRL(ctx, client, url, cert, issuer)
+		if err == nil {
+			return status, nil
+		}
+		failures = append(failures, fmt.Sprintf("CRL %s: %v", url, err))
+	}
+	if len(failures) == 0 {
+		return Unknown, ErrNoSources
+	}
+	return Unknown, fmt.Errorf("revocation status unavailable: %s", strings.Join(failures, "; "))
+}
+
+func checkOCSP(ctx context.Context, client *http.Client, server string, cert, issuer *x509.Certificate) (Status, error) {
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return Unknown, err
+	}
+	body, err := fetch(ctx, client, http.MethodPost, server, "application/ocsp-request", request, maxOCSPResponseSize)
+	if err != nil {
+		return Unknown, err
+	}
+	response, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return Unknown, err
+	}
+	switch response.Status {
+	case ocsp.Good:
+		return Good, nil
+	case ocsp.Revoked:
+		return Revoked, nil
+	default:
+		return Unknown, nil
+	}
+}
+
+func checkCRL(ctx context.Context, client *http.Client, url string, cert, issuer *x509.Certificate) (Status, error) {
+	body, err := fetch(ctx, client, http.MethodGet, url, "", nil, maxCRLSize)
+	if err != nil {
+		return Unknown, err
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return Unknown, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return Unknown, fmt.Errorf("invalid CRL signature: %w", err)
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		return Unknown, fmt.Errorf("CRL expired at %v", crl.NextUpdate)
+	}
+	for _, revoked := range crl.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return Revoked, nil
+		}
+	}
+	return Good, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, method, url, contentType string, body []byte, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, limit))
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testPKI struct {
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testPKI{ca: ca, caKey: key}
+}
+
+func (p *testPKI) leaf(t *testing.T, serial int64, ocspServer, crlURL string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+// ocspServer answers every request with the given OCSP status.
+func (p *testPKI) ocspServer(t *testing.T, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		template := ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if status == ocsp.Revoked {
+			template.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		response, err := ocsp.CreateResponse(p.ca, p.ca, template, p.caKey)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Write(response)
+	}))
+}
+
+// crlServer serves a CRL revoking the given serial numbers.
+func (p *testPKI) crlServer(t *testing.T, revoked ...int64) *httptest.Server {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range revoked {
+		template.RevokedCertificates = append(template.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, p.ca, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(crl)
+	}))
+}
+
+func TestCheckOCSP(t *testing.T) {
+	pki := newTestPKI(t)
+	for _, test := range []struct {
+		ocspStatus int
+		want       Status
+	}{
+		{ocsp.Good, Good},
+		{ocsp.Revoked, Revoked},
+	} {
+		server := pki.ocspServer(t, test.ocspStatus)
+		defer server.Close()
+		got, err := Check(context.Background(), nil, pki.leaf(t, 2, server.URL, ""), pki.ca)
+		if err != nil {
+			t.Errorf("Check: got err %v, want nil", err)
+		}
+		if got != test.want {
+			t.Errorf("Check: got status %v, want %v", got, test.want)
+		}
+	}
+}
+
+func TestCheckCRL(t *testing.T) {
+	pki := newTestPKI(t)
+	server := pki.crlServer(t, 3)
+	defer server.Close()
+	for _, test := range []struct {
+		serial int64
+		want   Status
+	}{
+		{2, Good},
+		{3, Revoked},
+	} {
+		got, err := Check(context.Background(), nil, pki.leaf(t, test.serial, "", server.URL), pki.ca)
+		if err != nil {
+			t.Errorf("Check: got err %v, want nil", err)
+		}
+		if got != test.want {
+			t.Errorf("Check serial %d: got status %v, want %v", test.serial, got, test.want)
+		}
+	}
+}
+
+func TestCheckFallsBackToCRL(t *testing.T) {
+	pki := newTestPKI(t)
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	crl := pki.crlServer(t, 2)
+	defer crl.Close()
+	got, err := Check(context.Background(), nil, pki.leaf(t, 2, unavailable.URL, crl.URL), pki.ca)
+	if err != nil {
+		t.Errorf("Check: got err %v, want nil", err)
+	}
+	if got != Revoked {
+		t.Errorf("Check: got status %v, want %v", got, Revoked)
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	pki := newTestPKI(t)
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	got, err := Check(context.Background(), nil, pki.leaf(t, 2, unavailable.URL, ""), pki.ca)
+	if got != Unknown || err == nil {
+		t.Errorf("Check: got status %v and err %v, want %v and non-nil err", got, err, Unknown)
+	}
+}
+
+func TestCheckNoSources(t *testing.T) {
+	pki := newTestPKI(t)
+	got, err := Check(context.Background(), nil, pki.leaf(t, 2, "", ""), pki.ca)
+	if got != Unknown || !errors.Is(err, ErrNoSources) {
+		t.Errorf("Check: got status %v and err %v, want %v and %v", got, err, Unknown, ErrNoSources)
+	}
+}
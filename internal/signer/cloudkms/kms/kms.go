@@ -0,0 +1,293 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms signs with a key version held in Google Cloud KMS, including
+// Cloud HSM keys, through the Cloud KMS REST API. Cloud KMS does not store
+// certificates, so the certificate chain of the key is read from a file.
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultEndpoint is the Cloud KMS endpoint used when the config does not
+// name one.
+const DefaultEndpoint = "https://cloudkms.googleapis.com"
+
+// Scope is the OAuth 2.0 scope of the Cloud KMS API.
+const Scope = "https://www.googleapis.com/auth/cloudkms"
+
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// castagnoli is the CRC32C table used to check the integrity of the requests
+// and responses of Cloud KMS.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// digestFields maps the hash functions of the signing algorithms of Cloud KMS
+// to the fields of the digest in AsymmetricSign requests.
+var digestFields = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// Key is a certificate chain together with the Cloud KMS key version holding
+// its private key.
+type Key struct {
+	client   *http.Client
+	endpoint string
+	name     string
+	chain    [][]byte
+	pub      crypto.PublicKey
+	hash     crypto.Hash // The hash function of the signing algorithm, or 0 if it signs messages.
+	pss      bool        // Whether the signing algorithm is RSASSA-PSS.
+	closed   atomic.Bool
+}
+
+// Cred returns a Key signing with the key version named keyVersion, of the
+// form "projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*",
+// through the Cloud KMS API at endpoint, which defaults to DefaultEndpoint.
+// client must authenticate its requests, for example with Application Default
+// Credentials. The public key of the leaf of chain must be the public key of
+// the key version.
+func Cred(ctx context.Context, client *http.Client, endpoint string, keyVersion string, chain [][]byte) (*Key, error) {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate for the Cloud KMS key")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	k := &Key{client: client, endpoint: strings.TrimSuffix(endpoint, "/"), name: keyVersion, chain: chain, pub: leaf.PublicKey}
+	var resp struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := k.call(ctx, http.MethodGet, "/publicKey", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get the public key of %s: %w", keyVersion, err)
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key of %s", keyVersion)
+	}
+	if !bytes.Equal(block.Bytes, leaf.RawSubjectPublicKeyInfo) {
+		return nil, fmt.Errorf("the certificate does not match the public key of %s", keyVersion)
+	}
+	if k.hash, k.pss, err = parseAlgorithm(resp.Algorithm); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// parseAlgorithm returns the hash function of a Cloud KMS signing algorithm,
+// and whether it is RSASSA-PSS. The hash function of Ed25519 is 0.
+func parseAlgorithm(algorithm string) (crypto.Hash, bool, error) {
+	if algorithm == "EC_SIGN_ED25519" {
+		return 0, false, nil
+	}
+	if !strings.HasPrefix(algorithm, "RSA_SIGN_PKCS1_") && !strings.HasPrefix(algorithm, "RSA_SIGN_PSS_") && !strings.HasPrefix(algorithm, "EC_SIGN_") {
+		return 0, false, fmt.Errorf("unsupported Cloud KMS algorithm %q, the key must be an asymmetric signing key", algorithm)
+	}
+	pss := strings.HasPrefix(algorithm, "RSA_SIGN_PSS_")
+	switch {
+	case strings.HasSuffix(algorithm, "_SHA256"):
+		return crypto.SHA256, pss, nil
+	case strings.HasSuffix(algorithm, "_SHA384"):
+		return crypto.SHA384, pss, nil
+	case strings.HasSuffix(algorithm, "_SHA512"):
+		return crypto.SHA512, pss, nil
+	}
+	return 0, false, fmt.Errorf("unsupported Cloud KMS algorithm %q", algorithm)
+}
+
+// ReadCertificateChain reads the PEM encoded certificates in file, leaf first.
+func ReadCertificateChain(file string) ([][]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate in %s", file)
+	}
+	return chain, nil
+}
+
+// CertificateChain returns the credential as a raw X509 cert chain. This
+// contains the public key.
+func (k *Key) CertificateChain() [][]byte {
+	return k.chain
+}
+
+// Name returns the resource name of the key version.
+func (k *Key) Name() string {
+	return k.name
+}
+
+// Endpoint returns the Cloud KMS endpoint used by k.
+func (k *Key) Endpoint() string {
+	return k.endpoint
+}
+
+// Close marks k as closed. Requests in flight are not canceled.
+func (k *Key) Close() error {
+	k.closed.Store(true)
+	return nil
+}
+
+// Public returns the corresponding public key for this Key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.pub
+}
+
+// Algorithm returns the hash function of the signing algorithm of the key
+// version, or 0 if it signs messages, and whether it is RSASSA-PSS.
+func (k *Key) Algorithm() (crypto.Hash, bool) {
+	return k.hash, k.pss
+}
+
+// Sign signs a message digest with the Cloud KMS AsymmetricSign method. The
+// hash function of opts, and whether it selects RSASSA-PSS, must match the
+// algorithm of the key version. Ed25519 keys sign the message itself.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if k.closed.Load() {
+		return nil, ErrKeyClosed
+	}
+	var hash crypto.Hash
+	if opts != nil {
+		hash = opts.HashFunc()
+	}
+	if hash != k.hash {
+		return nil, fmt.Errorf("hash function %v does not match the Cloud KMS key algorithm, which uses %v", hash, k.hash)
+	}
+	if _, pss := opts.(*rsa.PSSOptions); pss && !k.pss {
+		return nil, errors.New("the Cloud KMS key algorithm does not use RSASSA-PSS")
+	} else if !pss && k.pss {
+		return nil, errors.New("the Cloud KMS key algorithm requires RSASSA-PSS")
+	}
+	req := map[string]any{}
+	if _, ok := k.pub.(ed25519.PublicKey); ok {
+		req["data"] = digest
+		req["dataCrc32c"] = crc32c(digest)
+	} else {
+		req["digest"] = map[string][]byte{digestFields[hash]: digest}
+		req["digestCrc32c"] = crc32c(digest)
+	}
+	var resp struct {
+		Signature            []byte `json:"signature"`
+		SignatureCrc32c      string `json:"signatureCrc32c"`
+		VerifiedDigestCrc32c bool   `json:"verifiedDigestCrc32c"`
+		VerifiedDataCrc32c   bool   `json:"verifiedDataCrc32c"`
+	}
+	if err := k.call(context.Background(), http.MethodPost, ":asymmetricSign", req, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.VerifiedDigestCrc32c && !resp.VerifiedDataCrc32c {
+		return nil, errors.New("Cloud KMS did not verify the integrity of the signed data")
+	}
+	if resp.SignatureCrc32c != crc32c(resp.Signature) {
+		return nil, errors.New("the signature returned by Cloud KMS is corrupted")
+	}
+	return resp.Signature, nil
+}
+
+// crc32c returns the CRC32C checksum of data in the decimal form used by the
+// JSON encoding of Cloud KMS requests.
+func crc32c(data []byte) string {
+	return strconv.FormatUint(uint64(crc32.Checksum(data, castagnoli)), 10)
+}
+
+// call sends a request to the method of the key version named by suffix, and
+// decodes the JSON response into resp. []byte fields are base64 encoded, as
+// expected by Cloud KMS.
+func (k *Key) call(ctx context.Context, method string, suffix string, req any, resp any) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, k.endpoint+"/v1/"+k.name+suffix, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	res, err := k.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var status struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &status) == nil && status.Error.Message != "" {
+			return fmt.Errorf("Cloud KMS returned %s: %s", res.Status, status.Error.Message)
+		}
+		return fmt.Errorf("Cloud KMS returned %s", res.Status)
+	}
+	return json.Unmarshal(data, resp)
+}
+
+// IsTransient reports whether err is likely to go away when the operation is
+// retried, such as when the network is not up yet or Cloud KMS is throttling
+// requests.
+func IsTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return err != nil && (strings.Contains(err.Error(), "503 Service Unavailable") || strings.Contains(err.Error(), "429 Too Many Requests"))
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
+)
+
+const testKeyVersion = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+
+// newTestCert returns a self-signed certificate of key.
+func newTestCert(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Cloud KMS"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// newFakeKMS returns a server implementing the GetPublicKey and
+// AsymmetricSign methods of the Cloud KMS API for key.
+func newFakeKMS(t *testing.T, key crypto.Signer, algorithm string) *httptest.Server {
+	t.Helper()
+	spki, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/"+testKeyVersion+"/publicKey", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})),
+			"algorithm": algorithm,
+		})
+	})
+	mux.HandleFunc("/v1/"+testKeyVersion+":asymmetricSign", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Digest       map[string][]byte `json:"digest"`
+			DigestCrc32c string            `json:"digestCrc32c"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		digest := req.Digest["sha256"]
+		if req.DigestCrc32c != crc32c(digest) {
+			http.Error(w, `{"error":{"message":"checksum mismatch"}}`, http.StatusBadRequest)
+			return
+		}
+		var opts crypto.SignerOpts = crypto.SHA256
+		if strings.HasPrefix(algorithm, "RSA_SIGN_PSS_") {
+			opts = &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash}
+		}
+		signature, err := key.Sign(rand.Reader, digest, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"signature":            signature,
+			"signatureCrc32c":      crc32c(signature),
+			"verifiedDigestCrc32c": true,
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeKMS(t, key, "EC_SIGN_P256_SHA256")
+	k, err := Cred(context.Background(), server.Client(), server.URL, testKeyVersion, [][]byte{newTestCert(t, key)})
+	if err != nil {
+		t.Fatalf("Cred: %v", err)
+	}
+	digest := sha256.Sum256([]byte("message"))
+	signature, err := k.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Error("Sign: signature does not verify")
+	}
+	if _, err := k.Sign(nil, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Error("Sign with SHA-384: got nil error, want hash mismatch")
+	}
+	if _, err := k.Sign(nil, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256}); err == nil {
+		t.Error("Sign with PSS: got nil error, want PSS mismatch")
+	}
+	k.Close()
+	if _, err := k.Sign(nil, digest[:], crypto.SHA256); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Sign after Close: got %v, want %v", err, ErrKeyClosed)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		algorithm string
+		key       crypto.Signer
+		opts      crypto.SignerOpts
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", key: ecdsaKey, opts: crypto.SHA256},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", key: rsaKey, opts: crypto.SHA256},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", key: rsaKey, opts: &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash}},
+	}
+	for _, test := range tests {
+		t.Run(test.algorithm, func(t *testing.T) {
+			server := newFakeKMS(t, test.key, test.algorithm)
+			k, err := Cred(context.Background(), server.Client(), server.URL, testKeyVersion, [][]byte{newTestCert(t, test.key)})
+			if err != nil {
+				t.Fatalf("Cred: %v", err)
+			}
+			// Cloud KMS key versions sign with a single algorithm.
+			sigtest.TestKey(t, k, &sigtest.Options{SignOpts: []crypto.SignerOpts{test.opts}, ErrClosed: ErrKeyClosed})
+		})
+	}
+}
+
+func TestCredMismatchedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeKMS(t, key, "EC_SIGN_P256_SHA256")
+	if _, err := Cred(context.Background(), server.Client(), server.URL, testKeyVersion, [][]byte{newTestCert(t, other)}); err == nil {
+		t.Error("Cred: got nil error, want certificate mismatch")
+	}
+	if _, err := Cred(context.Background(), server.Client(), server.URL, "projects/p/missing", [][]byte{newTestCert(t, key)}); err == nil {
+		t.Error("Cred: got nil error for a missing key version")
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		hash      crypto.Hash
+		pss       bool
+		wantErr   bool
+	}{
+		{algorithm: "EC_SIGN_P384_SHA384", hash: crypto.SHA384},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", hash: crypto.SHA256},
+		{algorithm: "RSA_SIGN_PSS_4096_SHA512", hash: crypto.SHA512, pss: true},
+		{algorithm: "EC_SIGN_ED25519"},
+		{algorithm: "RSA_DECRYPT_OAEP_2048_SHA256", wantErr: true},
+		{algorithm: "RSA_SIGN_RAW_PKCS1_2048", wantErr: true},
+	}
+	for _, test := range tests {
+		hash, pss, err := parseAlgorithm(test.algorithm)
+		if (err != nil) != test.wantErr || hash != test.hash || pss != test.pss {
+			t.Errorf("parseAlgorithm(%q) = %v, %v, %v, want %v, %v, error %v", test.algorithm, hash, pss, err, test.hash, test.pss, test.wantErr)
+		}
+	}
+}
+
+func TestReadCertificateChain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := newTestCert(t, key)
+	file := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := ReadCertificateChain(file)
+	if err != nil || len(chain) != 1 {
+		t.Fatalf("ReadCertificateChain: got %d certificates, %v, want 1", len(chain), err)
+	}
+	if err := os.WriteFile(file, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCertificateChain(file); err == nil {
+		t.Error("ReadCertificateChain: got nil error without certificates")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Signer.go is a net/rpc server that listens on stdin/stdout, exposing
+// methods that perform device certificate signing with a key held in Google
+// Cloud KMS or Cloud HSM, authenticated with Application Default Credentials.
+// This server is intended to be launched as a subprocess by the signer client,
+// and should not be launched manually as a stand-alone process.
+package main
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/cloudkms/kms"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"golang.org/x/oauth2/google"
+)
+
+// requestTimeout bounds every request to Cloud KMS.
+const requestTimeout = 30 * time.Second
+
+// backend opens the credentials of Cloud KMS key versions.
+type backend struct{}
+
+func (backend) Name() string {
+	return "Cloud KMS"
+}
+
+// IsTransient reports whether err is a transient failure of the keystore.
+func (backend) IsTransient(err error) bool {
+	return kms.IsTransient(err)
+}
+
+// Open returns the credential described by config, retrying transient errors
+// as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	chain, err := kms.ReadCertificateChain(config.CertConfigs.CloudKMS.CertificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the certificate of the Cloud KMS key: %w", err)
+	}
+	ctx := context.Background()
+	client, err := google.DefaultClient(ctx, kms.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Application Default Credentials: %w", err)
+	}
+	client.Timeout = requestTimeout
+	var key *kms.Key
+	err = util.DoWithRetry(config.Retry, kms.IsTransient, func() (err error) {
+		key, err = kms.Cred(ctx, client, config.CertConfigs.CloudKMS.Endpoint, config.CertConfigs.CloudKMS.KeyVersion, chain)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credential{key}, nil
+}
+
+// credential is a Cloud KMS key version served by the signer. Cloud KMS keys
+// are not held by a removable token.
+type credential struct {
+	*kms.Key
+}
+
+// Metadata describes the Cloud KMS key version holding the credential.
+func (c credential) Metadata() server.Metadata {
+	return server.Metadata{
+		KeystoreType: "cloud_kms",
+		TokenLabel:   c.Name(),
+		Endpoint:     c.Endpoint(),
+	}
+}
+
+// Capabilities describes the single signing algorithm of the Cloud KMS key
+// version.
+func (c credential) Capabilities() util.Capabilities {
+	hash, pss := c.Algorithm()
+	capabilities := util.KeyCapabilities(c.Public(), []crypto.Hash{hash}, nil)
+	if capabilities.PKCS1v15 {
+		capabilities.PKCS1v15, capabilities.PSS = !pss, pss
+	}
+	return capabilities
+}
+
+func main() {
+	server.Main(backend{})
+}
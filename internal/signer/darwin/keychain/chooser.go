@@ -0,0 +1,75 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package keychain
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// osascript is the command used to show the identity chooser.
+var osascript = "osascript"
+
+// chooserScript shows a list of its arguments and prints the one chosen by
+// the user, or nothing if the user cancels.
+var chooserScript = []string{
+	"on run argv",
+	`set choice to choose from list argv with title "Enterprise Certificate" with prompt "Several certificates match the enterprise certificate configuration. Select the certificate to use for client authentication." OK button name "Use"`,
+	"if choice is false then return \"\"",
+	"return item 1 of choice",
+	"end run",
+}
+
+// ChooseWithDialog asks the user to choose one of leaves in a dialog and
+// returns its index. It can be used as SearchOptions.Choose.
+func ChooseWithDialog(leaves []*x509.Certificate) (int, error) {
+	labels := make([]string, len(leaves))
+	for i, xc := range leaves {
+		labels[i] = identityLabel(i, xc)
+	}
+	var args []string
+	for _, line := range chooserScript {
+		args = append(args, "-e", line)
+	}
+	out, err := exec.Command(osascript, append(args, labels...)...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to show the identity chooser: %w", err)
+	}
+	choice := strings.TrimSpace(string(out))
+	if choice == "" {
+		return 0, errors.New("no identity was chosen")
+	}
+	for i, label := range labels {
+		if label == choice {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown identity %q chosen", choice)
+}
+
+// identityLabel describes the i-th identity with leaf certificate xc to the
+// user. The index keeps the labels of similar certificates distinct.
+func identityLabel(i int, xc *x509.Certificate) string {
+	subject := xc.Subject.CommonName
+	if subject == "" {
+		subject = xc.Subject.String()
+	}
+	return fmt.Sprintf("%d. %s (issued by %s, expires %s)", i+1, subject, xc.Issuer.CommonName, xc.NotAfter.Format("2006-01-02"))
+}
@@ -0,0 +1,289 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package keychain
+
+/*
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+#include <stdlib.h>
+#include <string.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// ImportOptions controls where and how ImportPKCS12CredWithOptions stores
+// the imported identity.
+type ImportOptions struct {
+	// Keychain is the target keychain: "login", "system", or the path of a
+	// keychain file. If empty, the default keychain is used. It requires
+	// Legacy.
+	Keychain string
+	// NonExtractable imports the private key so that it cannot be exported
+	// from the keychain. It requires Legacy.
+	NonExtractable bool
+	// TrustedApplications are paths of applications that may use the private
+	// key without prompting, in addition to the importing application. If
+	// empty, the default access control of the keychain applies. It requires
+	// Legacy.
+	TrustedApplications []string
+	// TrustIssuer marks the CA certificates contained in the PKCS12 file as
+	// trusted roots, in the admin trust domain for the system keychain and in
+	// the user trust domain otherwise.
+	TrustIssuer bool
+	// Legacy imports with SecItemImport into a file-based keychain, which is
+	// selected with the deprecated SecKeychain APIs. Otherwise the identity
+	// is imported with SecPKCS12Import.
+	Legacy bool
+}
+
+// ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the keychain
+func ImportPKCS12Cred(credPath string, password []byte) error {
+	return ImportPKCS12CredWithOptions(credPath, password, ImportOptions{})
+}
+
+// ImportPKCS12CredWithOptions imports a PKCS12 file containing a client
+// certificate and private key into the keychain selected by opts.
+func ImportPKCS12CredWithOptions(credPath string, password []byte, opts ImportOptions) error {
+	if !opts.Legacy && (opts.Keychain != "" || opts.NonExtractable || len(opts.TrustedApplications) > 0) {
+		return errors.New("the keychain, non-extractable and trusted applications import options require the legacy keychain import")
+	}
+
+	// 1. Load the .p12 file
+	keyData, err := os.ReadFile(credPath)
+	if err != nil {
+		return fmt.Errorf("error reading private key file: %w", err)
+	}
+	defer zeroize.Bytes(keyData)
+	if len(keyData) == 0 {
+		return errors.New("PKCS#12 file is empty")
+	}
+	cfKeyData := secretToCFData(keyData)
+	defer C.CFRelease(C.CFTypeRef(cfKeyData))
+	defer zeroCFMutableData(cfKeyData)
+
+	// The password is passed from its buffer, without a C copy left to scrub.
+	var passwordPtr *C.UInt8
+	if len(password) > 0 {
+		passwordPtr = (*C.UInt8)(unsafe.Pointer(&password[0]))
+	}
+	cfPassword := C.CFStringCreateWithBytes(C.kCFAllocatorDefault, passwordPtr, C.CFIndex(len(password)), C.kCFStringEncodingUTF8, C.Boolean(0))
+	defer C.CFRelease(C.CFTypeRef(cfPassword))
+
+	// 2. Import the .p12 data
+	var certs []C.SecCertificateRef
+	if opts.Legacy {
+		items, err := importLegacy(C.CFDataRef(cfKeyData), cfPassword, credPath, opts)
+		if err != nil {
+			return err
+		}
+		defer C.CFRelease(C.CFTypeRef(items))
+		certs = importedCertificates(items)
+	} else {
+		items, err := importPKCS12(C.CFDataRef(cfKeyData), cfPassword)
+		if err != nil {
+			return err
+		}
+		defer C.CFRelease(C.CFTypeRef(items))
+		certs = importedCertChains(items)
+	}
+
+	// 3. Optionally trust the issuing CA certificates
+	if opts.TrustIssuer {
+		domain := C.SecTrustSettingsDomain(C.kSecTrustSettingsDomainUser)
+		if opts.Keychain == "system" {
+			domain = C.kSecTrustSettingsDomainAdmin
+		}
+		if err := trustCACertificates(certs, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPKCS12 imports the PKCS#12 data with SecPKCS12Import. Caller owns the
+// returned array of identity dictionaries.
+func importPKCS12(data C.CFDataRef, password C.CFStringRef) (C.CFArrayRef, error) {
+	optionsKeys := []C.CFTypeRef{C.CFTypeRef(C.kSecImportExportPassphrase)}
+	optionsValues := []C.CFTypeRef{C.CFTypeRef(password)}
+	optionsDict := C.CFDictionaryCreate(C.kCFAllocatorDefault,
+		(*unsafe.Pointer)(unsafe.Pointer(&optionsKeys[0])),
+		(*unsafe.Pointer)(unsafe.Pointer(&optionsValues[0])),
+		C.CFIndex(len(optionsKeys)),
+		&C.kCFTypeDictionaryKeyCallBacks,
+		&C.kCFTypeDictionaryValueCallBacks,
+	)
+	defer C.CFRelease(C.CFTypeRef(optionsDict))
+
+	var items C.CFArrayRef
+	if status := C.SecPKCS12Import(data, optionsDict, &items); status != C.errSecSuccess {
+		return 0, fmt.Errorf("failed to import PKCS#12 data: %s", osStatusDescription(status))
+	}
+	return items, nil
+}
+
+// importLegacy imports the PKCS#12 data with SecItemImport into the keychain
+// named by opts.Keychain. Caller owns the returned array of imported items.
+func importLegacy(data C.CFDataRef, password C.CFStringRef, credPath string, opts ImportOptions) (C.CFArrayRef, error) {
+	var params C.SecItemImportExportKeyParameters
+	params.version = C.SEC_KEY_IMPORT_EXPORT_PARAMS_VERSION
+	params.passphrase = C.CFTypeRef(password)
+	if opts.NonExtractable {
+		attrs := []C.CFTypeRef{C.CFTypeRef(C.kSecAttrIsPermanent), C.CFTypeRef(C.kSecAttrIsSensitive)}
+		params.keyAttributes = C.CFArrayCreate(C.kCFAllocatorDefault, (*unsafe.Pointer)(unsafe.Pointer(&attrs[0])), C.CFIndex(len(attrs)), &C.kCFTypeArrayCallBacks)
+		defer C.CFRelease(C.CFTypeRef(params.keyAttributes))
+	}
+	if len(opts.TrustedApplications) > 0 {
+		access, err := createAccess(credPath, opts.TrustedApplications)
+		if err != nil {
+			return 0, err
+		}
+		defer C.CFRelease(C.CFTypeRef(access))
+		params.accessRef = access
+	}
+
+	targetKeychain, err := openKeychain(opts.Keychain)
+	if err != nil {
+		return 0, err
+	}
+	defer C.CFRelease(C.CFTypeRef(targetKeychain))
+
+	format := C.SecExternalFormat(C.kSecFormatPKCS12)
+	itemType := C.SecExternalItemType(C.kSecItemTypeAggregate)
+	var items C.CFArrayRef
+	status := C.SecItemImport(data, 0, &format, &itemType, 0, &params, targetKeychain, &items)
+	if status != C.errSecSuccess {
+		return 0, fmt.Errorf("failed to import PKCS#12 data: %s", osStatusDescription(status))
+	}
+	return items, nil
+}
+
+// openKeychain opens the keychain named by an ImportOptions.Keychain value,
+// or the default keychain if name is empty. Caller owns the returned
+// reference.
+func openKeychain(name string) (C.SecKeychainRef, error) {
+	var keychain C.SecKeychainRef
+	var status C.OSStatus
+	switch name {
+	case "":
+		status = C.SecKeychainCopyDefault(&keychain)
+	case "login":
+		status = C.SecKeychainCopyDomainDefault(C.kSecPreferencesDomainUser, &keychain)
+	case "system":
+		status = C.SecKeychainCopyDomainDefault(C.kSecPreferencesDomainSystem, &keychain)
+	default:
+		cPath := C.CString(name)
+		defer C.free(unsafe.Pointer(cPath))
+		status = C.SecKeychainOpen(cPath, &keychain)
+	}
+	if status != C.errSecSuccess {
+		return 0, fmt.Errorf("opening keychain %q: %w", name, keychainError(status))
+	}
+	return keychain, nil
+}
+
+// createAccess creates an access control list that lets the importing
+// application and the applications at paths use the private key. Caller owns
+// the returned reference.
+func createAccess(label string, paths []string) (C.SecAccessRef, error) {
+	var apps []C.CFTypeRef
+	defer func() {
+		for _, app := range apps {
+			C.CFRelease(app)
+		}
+	}()
+	// A nil path refers to the calling application.
+	var self C.SecTrustedApplicationRef
+	if status := C.SecTrustedApplicationCreateFromPath(nil, &self); status != C.errSecSuccess {
+		return 0, fmt.Errorf("creating trusted application: %w", keychainError(status))
+	}
+	apps = append(apps, C.CFTypeRef(self))
+	for _, path := range paths {
+		cPath := C.CString(path)
+		var app C.SecTrustedApplicationRef
+		status := C.SecTrustedApplicationCreateFromPath(cPath, &app)
+		C.free(unsafe.Pointer(cPath))
+		if status != C.errSecSuccess {
+			return 0, fmt.Errorf("creating trusted application %q: %w", path, keychainError(status))
+		}
+		apps = append(apps, C.CFTypeRef(app))
+	}
+	trustedList := C.CFArrayCreate(C.kCFAllocatorDefault, (*unsafe.Pointer)(unsafe.Pointer(&apps[0])), C.CFIndex(len(apps)), &C.kCFTypeArrayCallBacks)
+	defer C.CFRelease(C.CFTypeRef(trustedList))
+
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+	descriptor := C.CFStringCreateWithCString(C.kCFAllocatorDefault, cLabel, C.kCFStringEncodingUTF8)
+	defer C.CFRelease(C.CFTypeRef(descriptor))
+
+	var access C.SecAccessRef
+	if status := C.SecAccessCreate(descriptor, trustedList, &access); status != C.errSecSuccess {
+		return 0, fmt.Errorf("creating access control list: %w", keychainError(status))
+	}
+	return access, nil
+}
+
+// importedCertificates returns the certificates among the items imported by
+// SecItemImport. The references are owned by items.
+func importedCertificates(items C.CFArrayRef) []C.SecCertificateRef {
+	var certs []C.SecCertificateRef
+	for i := 0; i < int(C.CFArrayGetCount(items)); i++ {
+		item := C.CFTypeRef(C.CFArrayGetValueAtIndex(items, C.CFIndex(i)))
+		if C.CFGetTypeID(item) == C.SecCertificateGetTypeID() {
+			certs = append(certs, C.SecCertificateRef(item))
+		}
+	}
+	return certs
+}
+
+// importedCertChains returns the certificate chains of the identity
+// dictionaries returned by SecPKCS12Import. The references are owned by
+// items.
+func importedCertChains(items C.CFArrayRef) []C.SecCertificateRef {
+	var certs []C.SecCertificateRef
+	for i := 0; i < int(C.CFArrayGetCount(items)); i++ {
+		dict := C.CFDictionaryRef(C.CFArrayGetValueAtIndex(items, C.CFIndex(i)))
+		chain := C.CFArrayRef(C.CFDictionaryGetValue(dict, unsafe.Pointer(C.kSecImportItemCertChain)))
+		if chain == 0 {
+			continue
+		}
+		certs = append(certs, importedCertificates(chain)...)
+	}
+	return certs
+}
+
+// trustCACertificates marks the CA certificates among certs as trusted roots
+// in the given trust settings domain.
+func trustCACertificates(certs []C.SecCertificateRef, domain C.SecTrustSettingsDomain) error {
+	for _, certRef := range certs {
+		xc, err := certRefToX509(certRef)
+		if err != nil || !xc.IsCA {
+			continue
+		}
+		if status := C.SecTrustSettingsSetTrustSettings(certRef, domain, 0); status != C.errSecSuccess {
+			return fmt.Errorf("trusting CA certificate %q: %w", xc.Subject, keychainError(status))
+		}
+	}
+	return nil
+}
@@ -23,23 +23,29 @@ package keychain
 
 #include <CoreFoundation/CoreFoundation.h>
 #include <Security/Security.h>
+#include <stdlib.h>
+#include <string.h>
 */
 import "C"
 
 import (
-	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"runtime"
 	"sync"
 	"time"
 	"unsafe"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
 )
 
 // Maps for translating from crypto.Hash to SecKeyAlgorithm.
@@ -50,9 +56,6 @@ var (
 		crypto.SHA384: C.kSecKeyAlgorithmECDSASignatureDigestX962SHA384,
 		crypto.SHA512: C.kSecKeyAlgorithmECDSASignatureDigestX962SHA512,
 	}
-	rsaRaw = map[crypto.Hash]C.CFStringRef{
-		crypto.SHA256: C.kSecKeyAlgorithmRSAEncryptionRaw,
-	}
 	rsaPKCS1v15Algorithms = map[crypto.Hash]C.CFStringRef{
 		crypto.SHA256: C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256,
 		crypto.SHA384: C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384,
@@ -63,7 +66,23 @@ var (
 		crypto.SHA384: C.kSecKeyAlgorithmRSASignatureDigestPSSSHA384,
 		crypto.SHA512: C.kSecKeyAlgorithmRSASignatureDigestPSSSHA512,
 	}
+	ecdsaMessageAlgorithms = map[crypto.Hash]C.CFStringRef{
+		crypto.SHA256: C.kSecKeyAlgorithmECDSASignatureMessageX962SHA256,
+		crypto.SHA384: C.kSecKeyAlgorithmECDSASignatureMessageX962SHA384,
+		crypto.SHA512: C.kSecKeyAlgorithmECDSASignatureMessageX962SHA512,
+	}
+	rsaPKCS1v15MessageAlgorithms = map[crypto.Hash]C.CFStringRef{
+		crypto.SHA256: C.kSecKeyAlgorithmRSASignatureMessagePKCS1v15SHA256,
+		crypto.SHA384: C.kSecKeyAlgorithmRSASignatureMessagePKCS1v15SHA384,
+		crypto.SHA512: C.kSecKeyAlgorithmRSASignatureMessagePKCS1v15SHA512,
+	}
+	rsaPSSMessageAlgorithms = map[crypto.Hash]C.CFStringRef{
+		crypto.SHA256: C.kSecKeyAlgorithmRSASignatureMessagePSSSHA256,
+		crypto.SHA384: C.kSecKeyAlgorithmRSASignatureMessagePSSSHA384,
+		crypto.SHA512: C.kSecKeyAlgorithmRSASignatureMessagePSSSHA512,
+	}
 	rsaOAEPAlgorithms = map[crypto.Hash]C.CFStringRef{
+		crypto.SHA1:   C.kSecKeyAlgorithmRSAEncryptionOAEPSHA1,
 		crypto.SHA256: C.kSecKeyAlgorithmRSAEncryptionOAEPSHA256,
 		crypto.SHA384: C.kSecKeyAlgorithmRSAEncryptionOAEPSHA384,
 		crypto.SHA512: C.kSecKeyAlgorithmRSAEncryptionOAEPSHA512,
@@ -120,6 +139,16 @@ func (e *cfError) Error() string {
 	return cfStringToString(s)
 }
 
+// status returns the OSStatus code of the error, if it is in the OSStatus
+// domain.
+func (e *cfError) status() (C.OSStatus, bool) {
+	domain := C.CFStringRef(C.CFErrorGetDomain(C.CFErrorRef(e.e)))
+	if C.CFStringCompare(domain, C.CFStringRef(C.kCFErrorDomainOSStatus), 0) != C.kCFCompareEqualTo {
+		return 0, false
+	}
+	return C.OSStatus(C.CFErrorGetCode(C.CFErrorRef(e.e))), true
+}
+
 // keychainError is an error type that is based on an OSStatus return code, and
 // obtains the error string with SecCopyErrorMessageString.
 type keychainError C.OSStatus
@@ -130,6 +159,60 @@ func (e keychainError) Error() string {
 	return cfStringToString(s)
 }
 
+// IsTransient reports whether err is likely to go away when the operation is
+// retried, such as when the keychain is not yet available after login.
+func IsTransient(err error) bool {
+	var kcErr keychainError
+	if !errors.As(err, &kcErr) {
+		return false
+	}
+	switch C.OSStatus(kcErr) {
+	case C.errSecNotAvailable, C.errSecInteractionNotAllowed:
+		return true
+	}
+	return false
+}
+
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// AccessError is returned by Sign and Decrypt when the keychain denies the
+// signer the use of the private key without user interaction. This typically
+// happens with identities deployed by MDM, whose partition list does not
+// include the signer, or whose access group the signer is not entitled to.
+type AccessError struct {
+	Err error
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("the keychain denied access to the private key, its partition list or access group may not include the signer (run \"ecptool fix-partition-list\" as the key owner to allow it): %v", e.Err)
+}
+
+func (e *AccessError) Unwrap() error {
+	return e.Err
+}
+
+// accessDeniedStatuses are the OSStatus codes reported when the ACL, partition
+// list or access group of a private key does not allow the signer to use it.
+var accessDeniedStatuses = map[C.OSStatus]bool{
+	C.errSecInteractionNotAllowed: true,
+	C.errSecInternalComponent:     true,
+	C.errSecMissingEntitlement:    true,
+}
+
+// accessError wraps err in an AccessError if it reports that access to the
+// private key was denied.
+func accessError(err error) error {
+	var cfErr *cfError
+	if errors.As(err, &cfErr) {
+		if status, ok := cfErr.status(); ok && accessDeniedStatuses[status] {
+			return &AccessError{Err: err}
+		}
+	}
+	return err
+}
+
 // cfDataToBytes turns a CFDataRef into a byte slice.
 func cfDataToBytes(cfData C.CFDataRef) []byte {
 	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(cfData)), C.int(C.CFDataGetLength(cfData)))
@@ -138,9 +221,33 @@ func cfDataToBytes(cfData C.CFDataRef) []byte {
 // bytesToCFData turns a byte slice into a CFDataRef. Caller then "owns" the
 // CFDataRef and must CFRelease the CFDataRef when done.
 func bytesToCFData(buf []byte) C.CFDataRef {
+	if len(buf) == 0 {
+		return C.CFDataCreate(C.kCFAllocatorDefault, nil, 0)
+	}
 	return C.CFDataCreate(C.kCFAllocatorDefault, (*C.UInt8)(unsafe.Pointer(&buf[0])), C.CFIndex(len(buf)))
 }
 
+// secretToCFData copies a sensitive byte slice into a mutable CFDataRef, so
+// that zeroCFMutableData can scrub it. Caller then "owns" the CFDataRef and
+// must CFRelease the CFDataRef when done.
+func secretToCFData(buf []byte) C.CFMutableDataRef {
+	data := C.CFDataCreateMutable(C.kCFAllocatorDefault, 0)
+	if len(buf) > 0 {
+		C.CFDataAppendBytes(data, (*C.UInt8)(unsafe.Pointer(&buf[0])), C.CFIndex(len(buf)))
+	}
+	return data
+}
+
+// zeroCFMutableData overwrites the contents of a CFMutableDataRef created by
+// secretToCFData with zeros. The CFData returned by the Security framework,
+// such as decrypted plaintexts, is immutable and cannot be scrubbed, so only
+// the Go copies of its contents are.
+func zeroCFMutableData(data C.CFMutableDataRef) {
+	if n := C.CFDataGetLength(C.CFDataRef(data)); n > 0 {
+		C.memset(unsafe.Pointer(C.CFDataGetMutableBytePtr(data)), 0, C.size_t(n))
+	}
+}
+
 // int32ToCFNumber turns an int32 into a CFNumberRef. Caller then "owns"
 // the CFNumberRef and must CFRelease the CFNumberRef when done.
 func int32ToCFNumber(n int32) C.CFNumberRef {
@@ -152,9 +259,12 @@ func int32ToCFNumber(n int32) C.CFNumberRef {
 type Key struct {
 	privateKeyRef C.SecKeyRef
 	certs         []*x509.Certificate
-	once          sync.Once
+	mu            sync.RWMutex // Held for reading by operations and for writing by Close.
+	closed        bool
 	publicKeyRef  C.SecKeyRef
-	hash          crypto.Hash
+	keychainType  KeychainType
+	confirmMu     sync.Mutex
+	confirm       func() error // Called before the first signature, until it succeeds.
 }
 
 // newKey makes a new Key wrapper around the key reference,
@@ -165,7 +275,6 @@ func newKey(privateKeyRef C.SecKeyRef, certs []*x509.Certificate, publicKeyRef C
 		privateKeyRef: privateKeyRef,
 		certs:         certs,
 		publicKeyRef:  publicKeyRef,
-		hash:          crypto.SHA256,
 	}
 
 	// This struct now owns the key reference. Retain now and release on
@@ -188,16 +297,93 @@ func (k *Key) CertificateChain() [][]byte {
 	return rv
 }
 
-// Close releases resources held by the credential.
+// Close releases resources held by the credential. It is safe to call more
+// than once.
 func (k *Key) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	// Don't double-release references.
-	k.once.Do(func() {
-		C.CFRelease(C.CFTypeRef(k.privateKeyRef))
-		C.CFRelease(C.CFTypeRef(k.publicKeyRef))
-	})
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+	C.CFRelease(C.CFTypeRef(k.privateKeyRef))
+	C.CFRelease(C.CFTypeRef(k.publicKeyRef))
 	return nil
 }
 
+// rlock locks k for an operation, or returns ErrKeyClosed if k has been
+// closed, since its references have then been released. The caller must call
+// k.mu.RUnlock if it returns nil.
+func (k *Key) rlock() error {
+	k.mu.RLock()
+	if k.closed {
+		k.mu.RUnlock()
+		return ErrKeyClosed
+	}
+	return nil
+}
+
+// KeychainType returns the keychains that were searched to find this Key.
+func (k *Key) KeychainType() KeychainType {
+	return k.keychainType
+}
+
+// SetConfirmation sets a function that every operation with the private key,
+// Sign, SignMessage, KeyAgreement, Decrypt and UnwrapKey, calls before the
+// first use of the key, such as to ask the user to confirm its use
+// with Touch ID. The operation fails if confirm returns an error, and confirm
+// is called again on the next one.
+func (k *Key) SetConfirmation(confirm func() error) {
+	k.confirmMu.Lock()
+	defer k.confirmMu.Unlock()
+	k.confirm = confirm
+}
+
+// checkConfirmed calls the function set by SetConfirmation, if it has not
+// succeeded yet.
+func (k *Key) checkConfirmed() error {
+	k.confirmMu.Lock()
+	defer k.confirmMu.Unlock()
+	if k.confirm == nil {
+		return nil
+	}
+	if err := k.confirm(); err != nil {
+		return err
+	}
+	k.confirm = nil
+	return nil
+}
+
+// Capabilities returns the algorithms that the keychain supports with the key,
+// as reported by SecKeyIsAlgorithmSupported for its private key, or none if
+// the Key is closed. The keychain hashes the messages passed to SignMessage.
+func (k *Key) Capabilities() util.Capabilities {
+	if err := k.rlock(); err != nil {
+		return util.Capabilities{}
+	}
+	defer k.mu.RUnlock()
+	c := util.ProbeCapabilities(k.Public(), func(alg util.Algorithm) bool {
+		var algorithms map[crypto.Hash]C.CFStringRef
+		operation := C.SecKeyOperationType(C.kSecKeyOperationTypeSign)
+		switch alg.Padding {
+		case util.PaddingNone:
+			algorithms = ecdsaAlgorithms
+		case util.PaddingPKCS1v15:
+			algorithms = rsaPKCS1v15Algorithms
+		case util.PaddingPSS:
+			algorithms = rsaPSSAlgorithms
+		case util.PaddingOAEP:
+			algorithms = rsaOAEPAlgorithms
+			operation = C.kSecKeyOperationTypeDecrypt
+		}
+		algorithm, ok := algorithms[alg.Hash]
+		return ok && C.SecKeyIsAlgorithmSupported(k.privateKeyRef, operation, algorithm) == 1
+	})
+	c.SignMessage = true
+	return c
+}
+
 // Public returns the corresponding public key for this Key. Good
 // thing we extracted it when we created it.
 func (k *Key) Public() crypto.PublicKey {
@@ -206,17 +392,43 @@ func (k *Key) Public() crypto.PublicKey {
 
 // Sign signs a message digest. Here, we pass off the signing to Keychain library.
 func (k *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.sign(digest, opts, false)
+}
+
+// SignMessage signs the full message msg, leaving the hashing with
+// opts.HashFunc() to the Keychain library.
+func (k *Key) SignMessage(msg []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.sign(msg, opts, true)
+}
+
+func (k *Key) sign(data []byte, opts crypto.SignerOpts, isMessage bool) (signature []byte, err error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	if err := k.checkConfirmed(); err != nil {
+		return nil, err
+	}
 	// Map the signing algorithm and hash function to a SecKeyAlgorithm constant.
 	var algorithms map[crypto.Hash]C.CFStringRef
 	switch pub := k.Public().(type) {
 	case *ecdsa.PublicKey:
 		algorithms = ecdsaAlgorithms
+		if isMessage {
+			algorithms = ecdsaMessageAlgorithms
+		}
 	case *rsa.PublicKey:
 		if _, ok := opts.(*rsa.PSSOptions); ok {
 			algorithms = rsaPSSAlgorithms
+			if isMessage {
+				algorithms = rsaPSSMessageAlgorithms
+			}
 			break
 		}
 		algorithms = rsaPKCS1v15Algorithms
+		if isMessage {
+			algorithms = rsaPKCS1v15MessageAlgorithms
+		}
 	default:
 		return nil, fmt.Errorf("unsupported algorithm %T", pub)
 	}
@@ -226,108 +438,360 @@ func (k *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signa
 	}
 
 	// Copy input over into CF-land.
-	cfDigest := bytesToCFData(digest)
-	defer C.CFRelease(C.CFTypeRef(cfDigest))
+	cfData := bytesToCFData(data)
+	defer C.CFRelease(C.CFTypeRef(cfData))
 
 	var cfErr C.CFErrorRef
-	sig := C.SecKeyCreateSignature(C.SecKeyRef(k.privateKeyRef), algorithm, C.CFDataRef(cfDigest), &cfErr)
+	sig := C.SecKeyCreateSignature(C.SecKeyRef(k.privateKeyRef), algorithm, C.CFDataRef(cfData), &cfErr)
 	if cfErr != 0 {
-		return nil, cfErrorFromRef(cfErr)
+		return nil, accessError(cfErrorFromRef(cfErr))
 	}
 	defer C.CFRelease(C.CFTypeRef(sig))
 
 	return cfDataToBytes(C.CFDataRef(sig)), nil
 }
 
-// Cred gets the first Credential (filtering on issuer) corresponding to
-// available certificate and private key pairs (i.e. identities) available in
-// the Keychain. This includes both the current login keychain for the user,
-// and the system keychain.
-func Cred(issuerCN string) (*Key, error) {
-	leafSearch := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 5, &C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)
-	defer C.CFRelease(C.CFTypeRef(unsafe.Pointer(leafSearch)))
-	// Get identities (certificate + private key pairs).
-	C.CFDictionaryAddValue(leafSearch, unsafe.Pointer(C.kSecClass), unsafe.Pointer(C.kSecClassIdentity))
-	// Get identities that are signing capable.
-	C.CFDictionaryAddValue(leafSearch, unsafe.Pointer(C.kSecAttrCanSign), unsafe.Pointer(C.kCFBooleanTrue))
-	// For each identity, give us the reference to it.
-	C.CFDictionaryAddValue(leafSearch, unsafe.Pointer(C.kSecReturnRef), unsafe.Pointer(C.kCFBooleanTrue))
+// KeyAgreement returns the ECDH shared secret of the EC private key and peer,
+// the X coordinate of the shared point.
+func (k *Key) KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	pub, ok := k.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key agreement is only supported with EC keys, got %T", k.Public())
+	}
+	if peer.Curve != pub.Curve {
+		return nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	if err := k.checkConfirmed(); err != nil {
+		return nil, err
+	}
+	attrs := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, &C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)
+	defer C.CFRelease(C.CFTypeRef(attrs))
+	C.CFDictionaryAddValue(attrs, unsafe.Pointer(C.kSecAttrKeyType), unsafe.Pointer(C.kSecAttrKeyTypeECSECPrimeRandom))
+	C.CFDictionaryAddValue(attrs, unsafe.Pointer(C.kSecAttrKeyClass), unsafe.Pointer(C.kSecAttrKeyClassPublic))
+	// SecKeyCreateWithData takes EC public keys in the uncompressed X9.63 form.
+	peerData := bytesToCFData(elliptic.Marshal(peer.Curve, peer.X, peer.Y))
+	defer C.CFRelease(C.CFTypeRef(peerData))
+	var cfErr C.CFErrorRef
+	peerRef := C.SecKeyCreateWithData(peerData, C.CFDictionaryRef(attrs), &cfErr)
+	if cfErr != 0 {
+		return nil, fmt.Errorf("importing the peer public key: %w", cfErrorFromRef(cfErr))
+	}
+	defer C.CFRelease(C.CFTypeRef(peerRef))
+
+	params := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, &C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)
+	defer C.CFRelease(C.CFTypeRef(params))
+	secret := C.SecKeyCopyKeyExchangeResult(k.privateKeyRef, C.kSecKeyAlgorithmECDHKeyExchangeStandard, peerRef, C.CFDictionaryRef(params), &cfErr)
+	if cfErr != 0 {
+		return nil, accessError(cfErrorFromRef(cfErr))
+	}
+	defer C.CFRelease(C.CFTypeRef(secret))
+	return cfDataToBytes(secret), nil
+}
+
+// KeychainType selects which keychains are searched for identities.
+type KeychainType string
+
+const (
+	// KeychainTypeLogin searches the user's login keychain.
+	KeychainTypeLogin KeychainType = "login"
+	// KeychainTypeSystem searches the system keychain.
+	KeychainTypeSystem KeychainType = "system"
+	// KeychainTypeAll searches every keychain in the default search list.
+	KeychainTypeAll KeychainType = "all"
+)
+
+// ParseKeychainType converts a config value into a KeychainType. An empty
+// value is treated as KeychainTypeAll for backwards compatibility.
+func ParseKeychainType(s string) (KeychainType, error) {
+	switch KeychainType(s) {
+	case "", KeychainTypeAll:
+		return KeychainTypeAll, nil
+	case KeychainTypeLogin, KeychainTypeSystem:
+		return KeychainType(s), nil
+	default:
+		return "", fmt.Errorf("keychain type must be login, system or all, got %q", s)
+	}
+}
+
+// keychainSearchList returns the keychains belonging to the preference domain
+// selected by keychainType. A zero CFArrayRef means that the default search
+// list should be used. Caller owns the returned reference.
+func keychainSearchList(keychainType KeychainType) (C.CFArrayRef, error) {
+	var domain C.SecPreferencesDomain
+	switch keychainType {
+	case KeychainTypeLogin:
+		domain = C.kSecPreferencesDomainUser
+	case KeychainTypeSystem:
+		domain = C.kSecPreferencesDomainSystem
+	default:
+		return 0, nil
+	}
+	var searchList C.CFArrayRef
+	if errno := C.SecKeychainCopyDomainSearchList(domain, &searchList); errno != C.errSecSuccess {
+		return 0, keychainError(errno)
+	}
+	return searchList, nil
+}
+
+// SearchOptions selects the keychains searched by CredWithOptions besides the
+// keychain type.
+type SearchOptions struct {
+	// AccessGroup restricts the data protection keychain search to items in
+	// the named keychain access group. It cannot be used with Legacy.
+	AccessGroup string
+	// Legacy searches only the file-based keychains, and is required to
+	// select the login or system keychain, which is done with the deprecated
+	// SecKeychain APIs.
+	Legacy bool
+	// Fingerprint, if set, is the hex-encoded SHA-256 fingerprint of the DER
+	// encoded certificate of the identity to use. An empty issuer then
+	// matches every identity.
+	Fingerprint string
+	// Choose, if set, is called with the leaf certificates of the identities
+	// when several of them match, and returns the index of the one to use.
+	// Otherwise, the first matching identity is used.
+	Choose func(leaves []*x509.Certificate) (int, error)
+	// Preferred, if set, is the hex-encoded SHA-256 fingerprint of the
+	// certificate of an identity chosen earlier, which is used instead of
+	// calling Choose if it still matches.
+	Preferred string
+}
+
+// itemQuery describes a SecItemCopyMatching query for all items of a class.
+type itemQuery struct {
+	class          C.CFTypeRef
+	searchList     C.CFArrayRef
+	dataProtection bool
+	accessGroup    string
+	canSign        bool
+}
+
+// copyMatching runs q and returns the matching item references, or a zero
+// CFArrayRef if there are none. Caller owns the returned reference.
+func (q itemQuery) copyMatching() (C.CFArrayRef, error) {
+	search := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, &C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)
+	defer C.CFRelease(C.CFTypeRef(unsafe.Pointer(search)))
+	C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecClass), unsafe.Pointer(q.class))
+	// Restrict the search to the selected keychains.
+	if q.searchList != 0 {
+		C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecMatchSearchList), unsafe.Pointer(q.searchList))
+	}
+	// Search the data protection keychain instead of the file-based keychains.
+	if q.dataProtection {
+		C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecUseDataProtectionKeychain), unsafe.Pointer(C.kCFBooleanTrue))
+		if q.accessGroup != "" {
+			cGroup := C.CString(q.accessGroup)
+			defer C.free(unsafe.Pointer(cGroup))
+			group := C.CFStringCreateWithCString(C.kCFAllocatorDefault, cGroup, C.kCFStringEncodingUTF8)
+			defer C.CFRelease(C.CFTypeRef(group))
+			C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecAttrAccessGroup), unsafe.Pointer(group))
+		}
+	}
+	if q.canSign {
+		C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecAttrCanSign), unsafe.Pointer(C.kCFBooleanTrue))
+	}
+	// For each item, give us the reference to it.
+	C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecReturnRef), unsafe.Pointer(C.kCFBooleanTrue))
 	// Be sure to list out all the matches.
-	C.CFDictionaryAddValue(leafSearch, unsafe.Pointer(C.kSecMatchLimit), unsafe.Pointer(C.kSecMatchLimitAll))
+	C.CFDictionaryAddValue(search, unsafe.Pointer(C.kSecMatchLimit), unsafe.Pointer(C.kSecMatchLimitAll))
 	// Do the matching-item copy.
-	var leafMatches C.CFTypeRef
-	if errno := C.SecItemCopyMatching((C.CFDictionaryRef)(leafSearch), &leafMatches); errno != C.errSecSuccess {
-		return nil, keychainError(errno)
+	var matches C.CFTypeRef
+	switch errno := C.SecItemCopyMatching((C.CFDictionaryRef)(search), &matches); errno {
+	case C.errSecSuccess:
+		return C.CFArrayRef(matches), nil
+	case C.errSecItemNotFound:
+		return 0, nil
+	default:
+		return 0, keychainError(errno)
 	}
-	defer C.CFRelease(leafMatches)
-	signingIdents := C.CFArrayRef(leafMatches)
-	// Dump the certs into golang x509 Certificates.
-	var (
-		leafIdent C.SecIdentityRef
-		leaf      *x509.Certificate
-	)
-	// Find the first valid leaf whose issuer (CA) matches the name in filter.
-	// Validation in identityToX509 covers Not Before, Not After and key alg.
-	for i := 0; i < int(C.CFArrayGetCount(signingIdents)) && leaf == nil; i++ {
-		identDict := C.CFArrayGetValueAtIndex(signingIdents, C.CFIndex(i))
-		xc, err := identityToX509(C.SecIdentityRef(identDict))
-		if err != nil {
-			continue
+}
+
+// copyMatchingAll runs one query per entry of queries and returns the
+// non-empty results in order. Errors of the data protection keychain queries
+// are ignored, since binaries without a keychain access group entitlement
+// cannot search it. Caller owns the returned references.
+func copyMatchingAll(queries []itemQuery) ([]C.CFArrayRef, error) {
+	var results []C.CFArrayRef
+	for _, q := range queries {
+		matches, err := q.copyMatching()
+		if err != nil && !q.dataProtection {
+			releaseAll(results)
+			return nil, err
 		}
-		if xc.Issuer.CommonName == issuerCN {
-			leaf = xc
-			leafIdent = C.SecIdentityRef(identDict)
+		if matches != 0 {
+			results = append(results, matches)
 		}
 	}
+	return results, nil
+}
 
-	caSearch := C.CFDictionaryCreateMutable(C.kCFAllocatorDefault, 0, &C.kCFTypeDictionaryKeyCallBacks, &C.kCFTypeDictionaryValueCallBacks)
-	defer C.CFRelease(C.CFTypeRef(unsafe.Pointer(caSearch)))
-	// Get identities (certificates).
-	C.CFDictionaryAddValue(caSearch, unsafe.Pointer(C.kSecClass), unsafe.Pointer(C.kSecClassCertificate))
-	// For each identity, give us the reference to it.
-	C.CFDictionaryAddValue(caSearch, unsafe.Pointer(C.kSecReturnRef), unsafe.Pointer(C.kCFBooleanTrue))
-	// Be sure to list out all the matches.
-	C.CFDictionaryAddValue(caSearch, unsafe.Pointer(C.kSecMatchLimit), unsafe.Pointer(C.kSecMatchLimitAll))
-	// Do the matching-item copy.
-	var caMatches C.CFTypeRef
-	if errno := C.SecItemCopyMatching((C.CFDictionaryRef)(caSearch), &caMatches); errno != C.errSecSuccess {
-		return nil, keychainError(errno)
+// preferredIndex returns the index of the certificate in leaves whose
+// fingerprint is preferred, or -1 if there is none.
+func preferredIndex(leaves []*x509.Certificate, preferred string) int {
+	if preferred == "" {
+		return -1
 	}
-	defer C.CFRelease(caMatches)
-	certRefs := C.CFArrayRef(caMatches)
-	// Validate and dump the certs into golang x509 Certificates.
-	var allCerts []*x509.Certificate
-	for i := 0; i < int(C.CFArrayGetCount(certRefs)); i++ {
-		refDict := C.CFArrayGetValueAtIndex(certRefs, C.CFIndex(i))
-		if xc, err := certRefToX509(C.SecCertificateRef(refDict)); err == nil {
-			allCerts = append(allCerts, xc)
+	for i, xc := range leaves {
+		if config.MatchesFingerprint(xc, preferred) {
+			return i
 		}
 	}
+	return -1
+}
 
-	// Build a certificate chain from leaf by matching prev.RawIssuer to
-	// next.RawSubject across all valid certificates in the keychain.
+// matchesIssuer reports whether the issuer common name of xc is issuerCN. An
+// empty issuerCN matches every certificate when the identity is selected by
+// its fingerprint.
+func matchesIssuer(xc *x509.Certificate, issuerCN string, fingerprint string) bool {
+	return xc.Issuer.CommonName == issuerCN || (issuerCN == "" && fingerprint != "")
+}
+
+func releaseAll(refs []C.CFArrayRef) {
+	for _, ref := range refs {
+		C.CFRelease(C.CFTypeRef(ref))
+	}
+}
+
+// Cred gets the first Credential (filtering on issuer) corresponding to
+// available certificate and private key pairs (i.e. identities) available in
+// the file-based keychains, as it always has. The keychainType selects whether
+// the current login keychain for the user, the system keychain, or both are
+// searched. If eku is not empty, identities that do not allow the named
+// extended key usage are skipped.
+func Cred(issuerCN string, keychainType KeychainType, eku string) (*Key, error) {
+	return CredWithOptions(issuerCN, keychainType, eku, SearchOptions{Legacy: true})
+}
+
+// CredWithOptions is like Cred, with the search refined by opts. Unless
+// opts.Legacy is set, the data protection keychain is searched first, and
+// identities found there are preferred over those in the file-based keychains
+// of the default search list; keychainType must then be KeychainTypeAll.
+func CredWithOptions(issuerCN string, keychainType KeychainType, eku string, opts SearchOptions) (*Key, error) {
+	if keychainType != KeychainTypeAll && !opts.Legacy {
+		return nil, fmt.Errorf("keychain type %q requires the legacy keychain search", keychainType)
+	}
+	var queries []itemQuery
+	if !opts.Legacy {
+		queries = append(queries, itemQuery{dataProtection: true, accessGroup: opts.AccessGroup})
+	}
+	if opts.AccessGroup == "" || opts.Legacy {
+		// Only the legacy search selects a search list, with the deprecated
+		// SecKeychain APIs.
+		searchList, err := keychainSearchList(keychainType)
+		if err != nil {
+			return nil, err
+		}
+		if searchList != 0 {
+			defer C.CFRelease(C.CFTypeRef(searchList))
+		}
+		queries = append(queries, itemQuery{searchList: searchList})
+	}
+
+	// Get identities (certificate + private key pairs) that are signing capable.
+	leafQueries := make([]itemQuery, len(queries))
+	for i, q := range queries {
+		q.class = C.CFTypeRef(C.kSecClassIdentity)
+		q.canSign = true
+		leafQueries[i] = q
+	}
+	leafMatches, err := copyMatchingAll(leafQueries)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseAll(leafMatches)
+	// Copy out the DER certificates of all identities and parse them in
+	// parallel, which dominates the search time on large keychains.
 	var (
-		certs      []*x509.Certificate
-		prev, next *x509.Certificate
+		idents   []C.SecIdentityRef
+		identDER [][]byte
 	)
-	for prev = leaf; prev != nil; prev, next = next, nil {
-		certs = append(certs, prev)
-		for _, xc := range allCerts {
-			if certIn(xc, certs) {
-				continue // finite chains only, mmmmkay.
+	for _, signingIdents := range leafMatches {
+		for i := 0; i < int(C.CFArrayGetCount(signingIdents)); i++ {
+			ident := C.SecIdentityRef(C.CFArrayGetValueAtIndex(signingIdents, C.CFIndex(i)))
+			der, err := identityToDER(ident)
+			if err != nil {
+				continue
 			}
-			if bytes.Equal(prev.RawIssuer, xc.RawSubject) && prev.CheckSignatureFrom(xc) == nil {
-				// Prefer certificates with later expirations.
-				if next == nil || xc.NotAfter.After(next.NotAfter) {
-					next = xc
-				}
+			idents = append(idents, ident)
+			identDER = append(identDER, der)
+		}
+	}
+	var cache util.CertCache
+	var (
+		leafIdents []C.SecIdentityRef
+		leaves     []*x509.Certificate
+	)
+	// Find the valid leaves whose issuer (CA) matches the name in filter, or
+	// only the first one if the user is not asked to choose.
+	// Validation in validateCert covers Not Before, Not After and key alg.
+	for i, xc := range cache.ParseAll(identDER) {
+		if xc == nil || validateCert(xc) != nil {
+			continue
+		}
+		if matchesIssuer(xc, issuerCN, opts.Fingerprint) && config.MatchesEKU(xc, eku) && config.MatchesFingerprint(xc, opts.Fingerprint) {
+			leaves = append(leaves, xc)
+			leafIdents = append(leafIdents, idents[i])
+			if opts.Choose == nil {
+				break
 			}
 		}
 	}
-	if len(certs) == 0 {
+	if len(leaves) == 0 {
+		if opts.Fingerprint != "" {
+			return nil, fmt.Errorf("no key found with issuer common name %q and SHA-256 fingerprint %s", issuerCN, opts.Fingerprint)
+		}
 		return nil, fmt.Errorf("no key found with issuer common name %q", issuerCN)
 	}
+	chosen := preferredIndex(leaves, opts.Preferred)
+	if chosen < 0 {
+		chosen = 0
+		if len(leaves) > 1 {
+			if chosen, err = opts.Choose(leaves); err != nil {
+				return nil, err
+			}
+			if chosen < 0 || chosen >= len(leaves) {
+				return nil, fmt.Errorf("invalid identity %d chosen out of %d", chosen, len(leaves))
+			}
+		}
+	}
+	leaf, leafIdent := leaves[chosen], leafIdents[chosen]
+
+	// Get certificates, from every searched keychain and from the default
+	// search list, which holds the system roots and intermediates.
+	var caQueries []itemQuery
+	for _, q := range queries {
+		if q.dataProtection {
+			q.class = C.CFTypeRef(C.kSecClassCertificate)
+			caQueries = append(caQueries, q)
+		}
+	}
+	caQueries = append(caQueries, itemQuery{class: C.CFTypeRef(C.kSecClassCertificate)})
+	caMatches, err := copyMatchingAll(caQueries)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseAll(caMatches)
+	// Certificates of identities are found again here, and only parsed once.
+	var caDER [][]byte
+	for _, certRefs := range caMatches {
+		for i := 0; i < int(C.CFArrayGetCount(certRefs)); i++ {
+			caDER = append(caDER, certRefToDER(C.SecCertificateRef(C.CFArrayGetValueAtIndex(certRefs, C.CFIndex(i)))))
+		}
+	}
+	var allCerts []*x509.Certificate
+	for _, xc := range cache.ParseAll(caDER) {
+		if xc != nil && validateCert(xc) == nil {
+			allCerts = append(allCerts, xc)
+		}
+	}
 
+	// Build a certificate chain from leaf by matching prev.RawIssuer to
+	// next.RawSubject across all valid certificates in the keychain.
+	certs := util.BuildChain(leaf, allCerts)
 	skr, err := identityToPrivateSecKeyRef(leafIdent)
 
 	if err != nil {
@@ -338,63 +802,58 @@ func Cred(issuerCN string) (*Key, error) {
 		return nil, err
 	}
 	defer C.CFRelease(C.CFTypeRef(skr))
-	return newKey(skr, certs, pubKey)
+	k, err := newKey(skr, certs, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	k.keychainType = keychainType
+	return k, nil
 }
 
-// identityToX509 converts a single CFDictionary that contains the item ref and
-// attribute dictionary into an x509.Certificate.
-func identityToX509(ident C.SecIdentityRef) (*x509.Certificate, error) {
+// identityToDER returns the DER encoded certificate of an identity.
+func identityToDER(ident C.SecIdentityRef) ([]byte, error) {
 	var certRef C.SecCertificateRef
 	if errno := C.SecIdentityCopyCertificate(ident, &certRef); errno != 0 {
 		return nil, keychainError(errno)
 	}
 	defer C.CFRelease(C.CFTypeRef(certRef))
 
-	return certRefToX509(certRef)
+	return certRefToDER(certRef), nil
+}
+
+// certRefToDER returns the DER encoding of a single C.SecCertificateRef.
+func certRefToDER(certRef C.SecCertificateRef) []byte {
+	data := C.SecCertificateCopyData(certRef)
+	defer C.CFRelease(C.CFTypeRef(data))
+	return cfDataToBytes(data)
 }
 
 // certRefToX509 converts a single C.SecCertificateRef into an *x509.Certificate.
 func certRefToX509(certRef C.SecCertificateRef) (*x509.Certificate, error) {
-	// Export the PEM-encoded certificate to a CFDataRef.
-	var certPEMData C.CFDataRef
-	if errno := C.SecItemExport(C.CFTypeRef(certRef), C.kSecFormatUnknown, C.kSecItemPemArmour, nil, &certPEMData); errno != 0 {
-		return nil, keychainError(errno)
-	}
-	defer C.CFRelease(C.CFTypeRef(certPEMData))
-	certPEM := cfDataToBytes(certPEMData)
-
-	// This part based on crypto/tls.
-	var certDERBlock *pem.Block
-	for {
-		certDERBlock, certPEM = pem.Decode(certPEM)
-		if certDERBlock == nil {
-			return nil, fmt.Errorf("failed to parse certificate PEM data")
-		}
-		if certDERBlock.Type == "CERTIFICATE" {
-			// found it
-			break
-		}
-	}
-
-	// Check the certificate is OK by the x509 library, and obtain the
-	// public key algorithm (which I assume is the same as the private key
-	// algorithm). This also filters out certs missing critical extensions.
-	xc, err := x509.ParseCertificate(certDERBlock.Bytes)
+	xc, err := x509.ParseCertificate(certRefToDER(certRef))
 	if err != nil {
 		return nil, err
 	}
+	if err := validateCert(xc); err != nil {
+		return nil, err
+	}
+	return xc, nil
+}
+
+// validateCert checks that the certificate is valid now and has a supported
+// public key algorithm, which is assumed to be the private key algorithm.
+func validateCert(xc *x509.Certificate) error {
 	switch xc.PublicKey.(type) {
 	case *rsa.PublicKey, *ecdsa.PublicKey:
 	default:
-		return nil, fmt.Errorf("unsupported key type %T", xc.PublicKey)
+		return fmt.Errorf("unsupported key type %T", xc.PublicKey)
 	}
 
 	// Check the certificate is valid
 	if n := time.Now(); n.Before(xc.NotBefore) || n.After(xc.NotAfter) {
-		return nil, fmt.Errorf("certificate not valid")
+		return fmt.Errorf("certificate not valid")
 	}
-
-	return xc, nil
+	return nil
 }
 
 // identityToSecKeyRef converts a single CFDictionary that contains the item ref and
@@ -436,122 +895,70 @@ func stringIn(s string, ss []string) bool {
 	return false
 }
 
-func certIn(xc *x509.Certificate, xcs []*x509.Certificate) bool {
-	for _, xc2 := range xcs {
-		if xc.Equal(xc2) {
-			return true
-		}
+// oaepAlgorithm returns the RSA-OAEP SecKeyAlgorithm with hash, which always
+// uses an empty label, if key supports it for operation.
+func (k *Key) oaepAlgorithm(key C.SecKeyRef, operation C.SecKeyOperationType, hash crypto.Hash) (C.SecKeyAlgorithm, error) {
+	if _, ok := k.Public().(*rsa.PublicKey); !ok {
+		return unknownSecKeyAlgorithm, fmt.Errorf("algorithm is unsupported. only RSA algorithms are supported. %T", k.Public())
 	}
-	return false
-}
-
-func (k *Key) getPaddingSize() int {
-	algorithms, algoErr := k.getEncryptAlgorithm()
-	if algoErr != nil {
-		fmt.Printf("algorithm is unsupported. only RSA algorithms are supported. %v", algoErr)
-	}
-	// Each padding scheme has varying number of bytes.
-	pssPaddingBytes := 20
-	oaepPaddingBytes := 130
-	pkcsPaddingBytes := 11
-	switch algorithms {
-	case C.kSecKeyAlgorithmRSASignatureDigestPSSSHA256,
-		C.kSecKeyAlgorithmRSASignatureDigestPSSSHA384,
-		C.kSecKeyAlgorithmRSASignatureDigestPSSSHA512:
-		return pssPaddingBytes
-	case C.kSecKeyAlgorithmRSAEncryptionOAEPSHA256,
-		C.kSecKeyAlgorithmRSAEncryptionOAEPSHA384,
-		C.kSecKeyAlgorithmRSAEncryptionOAEPSHA512:
-		return oaepPaddingBytes
-	case C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256,
-		C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384,
-		C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512:
-		return pkcsPaddingBytes
-	default:
-		return int(unknownSecKeyAlgorithm)
+	algorithm, ok := rsaOAEPAlgorithms[hash]
+	if !ok {
+		return unknownSecKeyAlgorithm, fmt.Errorf("unsupported OAEP hash function %v", hash)
+	}
+	if C.SecKeyIsAlgorithmSupported(key, operation, algorithm) != 1 {
+		return unknownSecKeyAlgorithm, fmt.Errorf("the key does not support RSA-OAEP with %v", hash)
 	}
+	return algorithm, nil
 }
 
-func (k *Key) checkDataSize(plaintext []byte) error {
-	// Plaintext data must be smaller than the key's block size minus padding space.
-	sizeLim := uint64(C.SecKeyGetBlockSize(k.publicKeyRef)) - uint64(k.getPaddingSize())
-	if uint64(len(plaintext)) >= sizeLim {
+// checkDataSize returns an error if plaintext is longer than RSA-OAEP with hash
+// allows for the key.
+func (k *Key) checkDataSize(plaintext []byte, hash crypto.Hash) error {
+	if len(plaintext) > int(C.SecKeyGetBlockSize(k.publicKeyRef))-2*hash.Size()-2 {
 		return fmt.Errorf("plaintext is too long")
 	}
 	return nil
 }
 
-func (k *Key) getRSAEncryptAlgorithm() (C.SecKeyAlgorithm, error) {
-	var algorithms map[crypto.Hash]C.CFStringRef
-	switch pub := k.Public().(type) {
-	case *rsa.PublicKey:
-		if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeEncrypt, C.kSecKeyAlgorithmRSASignatureDigestPSSSHA256) == 1 {
-			algorithms = rsaPSSAlgorithms
-		} else if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeEncrypt, C.kSecKeyAlgorithmRSAEncryptionOAEPSHA256) == 1 {
-			algorithms = rsaOAEPAlgorithms
-		} else if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeEncrypt, C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256) == 1 {
-			algorithms = rsaPKCS1v15Algorithms
-		} else {
-			return unknownSecKeyAlgorithm, fmt.Errorf("unknown RSA argument. Only supports PSS, OAEP, and PKCS1v1.5 %T", pub)
-		}
-	default:
-		return unknownSecKeyAlgorithm, fmt.Errorf("algorithm is unsupported. only RSA algorithms are supported. %T", pub)
+// Encrypt encrypts a plaintext message digest using the public key. Here, we pass off the encryption to Keychain library.
+// opts is the crypto.Hash used by RSA-OAEP, or an *rsa.OAEPOptions. The Security framework has no OAEP label
+// parameter, so encryption with a label is done with crypto/rsa.
+func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
 	}
-	return algorithms[k.hash], nil
-}
-
-func (k *Key) getEncryptAlgorithm() (C.SecKeyAlgorithm, error) {
-	if k.hash == 0 {
-		k.hash = crypto.SHA256
+	defer k.mu.RUnlock()
+	hash, label, err := util.EncryptOAEPOptions(opts)
+	if err != nil {
+		return nil, err
 	}
-	return k.getRSAEncryptAlgorithm()
-}
-
-func (k *Key) getRSADecryptAlgorithm() (C.SecKeyAlgorithm, error) {
-	var algorithms map[crypto.Hash]C.CFStringRef
-	switch pub := k.Public().(type) {
-	case *rsa.PublicKey:
-		if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeDecrypt, C.kSecKeyAlgorithmRSASignatureDigestPSSSHA256) == 1 {
-			algorithms = rsaPSSAlgorithms
-		} else if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeDecrypt, C.kSecKeyAlgorithmRSAEncryptionOAEPSHA256) == 1 {
-			algorithms = rsaOAEPAlgorithms
-		} else if C.SecKeyIsAlgorithmSupported(k.publicKeyRef, C.kSecKeyOperationTypeDecrypt, C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256) == 1 {
-			algorithms = rsaPKCS1v15Algorithms
-		} else {
-			return unknownSecKeyAlgorithm, fmt.Errorf("unknown RSA argument. Only supports PSS, OAEP, and PKCS1v1.5 %T", pub)
-		}
-	default:
-		return unknownSecKeyAlgorithm, fmt.Errorf("algorithm is unsupported. only RSA algorithms are supported. %T", pub)
+	if hash == 0 {
+		hash = crypto.SHA256
 	}
-	return algorithms[k.hash], nil
-}
-
-func (k *Key) getDecryptAlgorithm() (C.SecKeyAlgorithm, error) {
-	return k.getRSADecryptAlgorithm()
-}
-
-// Encrypt encrypts a plaintext message digest using the public key. Here, we pass off the encryption to Keychain library.
-func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
-	if hash, ok := opts.(crypto.Hash); ok {
-		k.hash = hash
-	} else {
-		return nil, fmt.Errorf("Unsupported encrypt opts: %v", opts)
+	if len(label) > 0 {
+		pub, ok := k.Public().(*rsa.PublicKey)
+		if !ok || !hash.Available() {
+			return nil, fmt.Errorf("unsupported OAEP key type %T or hash function %v", k.Public(), hash)
+		}
+		return rsa.EncryptOAEP(hash.New(), rand.Reader, pub, plaintext, label)
 	}
 	pub := k.publicKeyRef
-	algorithm, err := k.getEncryptAlgorithm()
+	algorithm, err := k.oaepAlgorithm(pub, C.kSecKeyOperationTypeEncrypt, hash)
 	if err != nil {
 		return nil, err
 	}
-	if err := k.checkDataSize(plaintext); err != nil {
+	if err := k.checkDataSize(plaintext, hash); err != nil {
 		return nil, err
 	}
 	msg := bytesToCFData(plaintext)
+	defer C.CFRelease(C.CFTypeRef(msg))
 	var cfErr C.CFErrorRef
 	bytes := C.SecKeyCreateEncryptedData(pub, algorithm, msg, &cfErr)
 
 	if cfErr != 0 {
 		return nil, cfErrorFromRef(cfErr)
 	}
+	defer C.CFRelease(C.CFTypeRef(bytes))
 
 	ciphertext := cfDataToBytes(bytes)
 	return ciphertext, cfErrorFromRef(cfErr)
@@ -560,28 +967,88 @@ func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
 // Decrypt decrypts a ciphertext message digest using the private key. Here, we pass off the decryption to Keychain library.
 // Currently, only *rsa.OAEPOptions is supported for opts.
 func (k *Key) Decrypt(ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
-	if oaepOpts, ok := opts.(*rsa.OAEPOptions); ok {
-		k.hash = oaepOpts.Hash
-	} else {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	oaepOpts, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
 		return nil, fmt.Errorf("Unsupported DecrypterOpts: %v", opts)
 	}
+	if err := k.checkConfirmed(); err != nil {
+		return nil, err
+	}
+	if len(oaepOpts.Label) > 0 {
+		return k.decryptWithLabel(ciphertext, oaepOpts)
+	}
 	priv := k.privateKeyRef
-	algorithm, err := k.getDecryptAlgorithm()
+	algorithm, err := k.oaepAlgorithm(priv, C.kSecKeyOperationTypeDecrypt, oaepOpts.Hash)
 	if err != nil {
 		return nil, err
 	}
 	msg := bytesToCFData(ciphertext)
+	defer C.CFRelease(C.CFTypeRef(msg))
 	var cfErr C.CFErrorRef
 	bytes := C.SecKeyCreateDecryptedData(priv, algorithm, msg, &cfErr)
 
 	if cfErr != 0 {
-		return nil, cfErrorFromRef(cfErr)
+		return nil, accessError(cfErrorFromRef(cfErr))
 	}
 
+	defer C.CFRelease(C.CFTypeRef(bytes))
+
 	plaintext := cfDataToBytes(bytes)
 	return plaintext, cfErrorFromRef(cfErr)
 }
 
+// decryptWithLabel decrypts ciphertext with RSA-OAEP and the label of opts.
+// The OAEP SecKeyAlgorithm variants always use an empty label, so the
+// ciphertext is decrypted with kSecKeyAlgorithmRSAEncryptionRaw and the padding
+// is removed by util.DecodeOAEP.
+func (k *Key) decryptWithLabel(ciphertext []byte, opts *rsa.OAEPOptions) ([]byte, error) {
+	pub, ok := k.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("algorithm is unsupported. only RSA algorithms are supported. %T", k.Public())
+	}
+	if len(ciphertext) == 0 {
+		return nil, errors.New("empty ciphertext")
+	}
+	if C.SecKeyIsAlgorithmSupported(k.privateKeyRef, C.kSecKeyOperationTypeDecrypt, C.kSecKeyAlgorithmRSAEncryptionRaw) != 1 {
+		return nil, errors.New("the key does not support raw RSA decryption, which OAEP labels require")
+	}
+	msg := bytesToCFData(ciphertext)
+	defer C.CFRelease(C.CFTypeRef(msg))
+	var cfErr C.CFErrorRef
+	bytes := C.SecKeyCreateDecryptedData(k.privateKeyRef, C.kSecKeyAlgorithmRSAEncryptionRaw, msg, &cfErr)
+	if cfErr != 0 {
+		return nil, accessError(cfErrorFromRef(cfErr))
+	}
+	defer C.CFRelease(C.CFTypeRef(bytes))
+
+	raw := cfDataToBytes(bytes)
+	if len(raw) > pub.Size() {
+		return nil, rsa.ErrDecryption
+	}
+	// Restore the leading zeros of the encoded message, if they were dropped.
+	em := make([]byte, pub.Size())
+	copy(em[len(em)-len(raw):], raw)
+	zeroize.Bytes(raw)
+	defer zeroize.Bytes(em)
+	return util.DecodeOAEP(opts.Hash, em, opts.Label)
+}
+
+// WrapKey encrypts a symmetric key with the public key using RSA-OAEP and the
+// given hash function.
+func (k *Key) WrapKey(key []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Encrypt(key, hash)
+}
+
+// UnwrapKey decrypts a symmetric key wrapped by WrapKey using the private key
+// in the keychain.
+func (k *Key) UnwrapKey(wrappedKey []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Decrypt(wrappedKey, &rsa.OAEPOptions{Hash: hash})
+}
+
 var osStatusDescriptions = map[C.OSStatus]string{
 	C.errSecSuccess:               "No error",
 	C.errSecUnimplemented:         "Function or operation not implemented.",
@@ -604,37 +1071,3 @@ func osStatusDescription(status C.OSStatus) string {
 	}
 	return "Unknown OSStatus"
 }
-
-// ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the keychain
-func ImportPKCS12Cred(credPath string, password string) error {
-	// 1. Load the .p12 file
-	keyData, err := os.ReadFile(credPath)
-	if err != nil {
-		return fmt.Errorf("error reading private key file: %w", err)
-	}
-
-	// 2. Create options dictionary with password
-	optionsKeys := []C.CFTypeRef{
-		C.CFTypeRef(C.kSecImportExportPassphrase),
-	}
-	optionsValues := []C.CFTypeRef{
-		C.CFTypeRef(C.CFStringCreateWithCString(C.kCFAllocatorDefault, C.CString(password), C.kCFStringEncodingUTF8)),
-	}
-
-	optionsDict := C.CFDictionaryCreate(C.kCFAllocatorDefault,
-		(*unsafe.Pointer)(unsafe.Pointer(&optionsKeys[0])),
-		(*unsafe.Pointer)(unsafe.Pointer(&optionsValues[0])),
-		C.CFIndex(len(optionsKeys)),
-		&C.kCFTypeDictionaryKeyCallBacks,
-		&C.kCFTypeDictionaryValueCallBacks,
-	)
-	defer C.CFRelease(C.CFTypeRef(optionsDict))
-
-	// 3. Import the .p12 data with password
-	status := C.SecPKCS12Import(bytesToCFData(keyData), optionsDict, nil)
-	if status != C.errSecSuccess {
-		return fmt.Errorf("failed to import PKCS#12 data: %s", osStatusDescription(status))
-	}
-
-	return nil
-}
@@ -19,9 +19,16 @@ package keychain
 import (
 	"bytes"
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
 	"testing"
 	"unsafe"
+
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
 )
 
 const testIssuer = "TestIssuer"
@@ -51,9 +58,47 @@ func TestBytesToCFDataRoundTrip(t *testing.T) {
 	}
 }
 
+func TestCFDataEmpty(t *testing.T) {
+	for _, buf := range [][]byte{nil, {}} {
+		d := bytesToCFData(buf)
+		if got := cfDataToBytes(d); len(got) != 0 {
+			t.Errorf("bytesToCFData(%#v) -> cfDataToBytes: got %x, want empty", buf, got)
+		}
+		cfRelease(unsafe.Pointer(d))
+
+		m := secretToCFData(buf)
+		zeroCFMutableData(m)
+		cfRelease(unsafe.Pointer(m))
+	}
+}
+
+func TestParseKeychainType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    KeychainType
+		wantErr bool
+	}{
+		{in: "", want: KeychainTypeAll},
+		{in: "all", want: KeychainTypeAll},
+		{in: "login", want: KeychainTypeLogin},
+		{in: "system", want: KeychainTypeSystem},
+		{in: "icloud", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseKeychainType(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseKeychainType(%q): got err %v, want err %v", test.in, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("ParseKeychainType(%q): got %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
 func TestImportPKCS12Cred(t *testing.T) {
 	credPath := "../../../../testdata/testcred.p12"
-	password := "1234"
+	password := []byte("1234")
 	err := ImportPKCS12Cred(credPath, password)
 	if err != nil {
 		t.Errorf("ImportPKCS12Cred: got %v, want nil err", err)
@@ -61,8 +106,44 @@ func TestImportPKCS12Cred(t *testing.T) {
 	}
 }
 
+func TestImportPKCS12CredWithOptions(t *testing.T) {
+	credPath := "../../../../testdata/testcred.p12"
+	password := []byte("1234")
+	err := ImportPKCS12CredWithOptions(credPath, password, ImportOptions{Keychain: "login", NonExtractable: true, Legacy: true})
+	if err != nil {
+		t.Errorf("ImportPKCS12CredWithOptions: got %v, want nil err", err)
+	}
+}
+
+func TestImportPKCS12CredMissingKeychain(t *testing.T) {
+	credPath := "../../../../testdata/testcred.p12"
+	password := []byte("1234")
+	err := ImportPKCS12CredWithOptions(credPath, password, ImportOptions{Keychain: "/nonexistent/test.keychain-db", Legacy: true})
+	if err == nil {
+		t.Errorf("ImportPKCS12CredWithOptions: got nil err, want error for missing keychain")
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	if _, err := key.SignMessage([]byte("message to sign"), crypto.SHA256); err != nil {
+		t.Errorf("SignMessage: got %v, want nil err", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	sigtest.TestKey(t, key, &sigtest.Options{ErrClosed: ErrKeyClosed})
+}
+
 func TestEncrypt(t *testing.T) {
-	key, err := Cred(testIssuer)
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
 	if err != nil {
 		t.Errorf("Cred: got %v, want nil err", err)
 		return
@@ -76,7 +157,7 @@ func TestEncrypt(t *testing.T) {
 }
 
 func BenchmarkEncrypt(b *testing.B) {
-	key, err := Cred(testIssuer)
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
 	if err != nil {
 		b.Errorf("Cred: got %v, want nil err", err)
 		return
@@ -91,7 +172,7 @@ func BenchmarkEncrypt(b *testing.B) {
 }
 
 func TestDecrypt(t *testing.T) {
-	key, err := Cred(testIssuer)
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
 	if err != nil {
 		t.Errorf("Cred: got %v, want nil err", err)
 		return
@@ -108,8 +189,35 @@ func TestDecrypt(t *testing.T) {
 	}
 }
 
+func TestDecryptOAEP(t *testing.T) {
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	defer key.Close()
+	pub, ok := key.Public().(*rsa.PublicKey)
+	if !ok {
+		t.Skipf("Decrypt requires an RSA key, got %T", key.Public())
+	}
+	msg := []byte("Plain text to encrypt")
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		ciphertext, err := rsa.EncryptOAEP(hash.New(), rand.Reader, pub, msg, nil)
+		if err != nil {
+			t.Fatalf("EncryptOAEP(%v): %v", hash, err)
+		}
+		plaintext, err := key.Decrypt(ciphertext, &rsa.OAEPOptions{Hash: hash})
+		if err != nil {
+			t.Errorf("Decrypt(%v): got %v, want nil err", hash, err)
+			continue
+		}
+		if !bytes.Equal(plaintext, msg) {
+			t.Errorf("Decrypt(%v): got %q, want %q", hash, plaintext, msg)
+		}
+	}
+}
+
 func BenchmarkDecrypt(b *testing.B) {
-	key, err := Cred(testIssuer)
+	key, err := Cred(testIssuer, KeychainTypeAll, "")
 	if err != nil {
 		b.Errorf("Cred: got %v, want nil err", err)
 		return
@@ -123,3 +231,31 @@ func BenchmarkDecrypt(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkCred(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		key, err := Cred(testIssuer, KeychainTypeAll, "")
+		if err != nil {
+			b.Fatalf("Cred: got %v, want nil err", err)
+		}
+		key.Close()
+	}
+}
+
+func TestChooseWithDialog(t *testing.T) {
+	leaves := []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: "alice"}, Issuer: pkix.Name{CommonName: testIssuer}},
+		{Subject: pkix.Name{CommonName: "alice"}, Issuer: pkix.Name{CommonName: testIssuer}},
+	}
+	// The fake osascript chooses the second identity.
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" + identityLabel(1, leaves[1]) + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "osascript"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { osascript = old }(osascript)
+	osascript = filepath.Join(dir, "osascript")
+	if got, err := ChooseWithDialog(leaves); err != nil || got != 1 {
+		t.Errorf("ChooseWithDialog: got %d, %v, want 1, nil", got, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+// Package presence asks the user to confirm their presence with Touch ID, or
+// with their login password on Macs without Touch ID, through the
+// LocalAuthentication framework.
+package presence
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc -mmacosx-version-min=10.12
+#cgo LDFLAGS: -framework Foundation -framework LocalAuthentication
+
+#import <Foundation/Foundation.h>
+#import <LocalAuthentication/LocalAuthentication.h>
+#include <stdlib.h>
+
+// evaluate asks the user to authenticate, showing reason, and blocks until
+// they do or cancel. It returns 0 on success, or the LAError code.
+static long evaluate(const char *reason) {
+	@autoreleasepool {
+		LAContext *context = [[LAContext alloc] init];
+		__block long result = 0;
+		dispatch_semaphore_t done = dispatch_semaphore_create(0);
+		[context evaluatePolicy:LAPolicyDeviceOwnerAuthentication
+			localizedReason:[NSString stringWithUTF8String:reason]
+			reply:^(BOOL success, NSError *error) {
+				if (!success) {
+					result = error != nil ? (long)error.code : -1;
+				}
+				dispatch_semaphore_signal(done);
+			}];
+		dispatch_semaphore_wait(done, DISPATCH_TIME_FOREVER);
+		return result;
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Error is returned by Confirm when the user could not be authenticated.
+type Error struct {
+	Code int // The LAError code, such as -2 when the user cancels.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("user presence was not confirmed (LAError %d)", e.Code)
+}
+
+// Confirm asks the user to confirm their presence, telling them that it is
+// needed to reason, such as "use your client certificate". It blocks until
+// the user authenticates or cancels.
+func Confirm(reason string) error {
+	cReason := C.CString(reason)
+	defer C.free(unsafe.Pointer(cReason))
+	if code := C.evaluate(cReason); code != 0 {
+		return &Error{Code: int(code)}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package security retrieves certificates from the MacOS keychain with the
+// security command line tool, for builds without cgo, which cannot call the
+// Security framework. Only the file-based keychains are searched, since the
+// tool does not expose the data protection keychain.
+package security
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// securityTool is the path of the security command line tool. It is a
+// variable so that tests can replace it.
+var securityTool = "/usr/bin/security"
+
+// SystemKeychain is the path of the System keychain.
+const SystemKeychain = "/Library/Keychains/System.keychain"
+
+// Keychains returns the keychains to search for the keychain type, one of
+// "login", "system" or "all". Nil means the default search list of the user.
+func Keychains(keychainType string) ([]string, error) {
+	switch keychainType {
+	case "", "all":
+		return nil, nil
+	case "login":
+		return []string{"login.keychain"}, nil
+	case "system":
+		return []string{SystemKeychain}, nil
+	default:
+		return nil, fmt.Errorf("keychain type must be login, system or all, got %q", keychainType)
+	}
+}
+
+// Identities returns the certificates of the identities in keychains, that
+// is the certificates whose private key is also in a searched keychain.
+func Identities(keychains []string) ([]*x509.Certificate, error) {
+	out, err := run("find-identity", keychains...)
+	if err != nil {
+		return nil, err
+	}
+	hashes := identityHashes(out)
+	certs, err := Certificates(keychains)
+	if err != nil {
+		return nil, err
+	}
+	var identities []*x509.Certificate
+	for _, xc := range certs {
+		sum := sha1.Sum(xc.Raw)
+		if hashes[strings.ToUpper(hex.EncodeToString(sum[:]))] {
+			identities = append(identities, xc)
+		}
+	}
+	return identities, nil
+}
+
+// Certificates returns every certificate in keychains. Certificates that
+// cannot be parsed are skipped.
+func Certificates(keychains []string) ([]*x509.Certificate, error) {
+	out, err := run("find-certificate", append([]string{"-a", "-p"}, keychains...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificates(out), nil
+}
+
+func run(command string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(securityTool, append([]string{command}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("security %s: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// identityLine matches the identities listed by "security find-identity", as
+// in `  1) 4E3B...C1 "Common Name"`.
+var identityLine = regexp.MustCompile(`(?m)^\s*\d+\)\s+([0-9A-Fa-f]{40})\s`)
+
+// identityHashes returns the upper case SHA-1 hashes of the identity
+// certificates listed in out.
+func identityHashes(out []byte) map[string]bool {
+	hashes := make(map[string]bool)
+	for _, m := range identityLine.FindAllSubmatch(out, -1) {
+		hashes[strings.ToUpper(string(m[1]))] = true
+	}
+	return hashes
+}
+
+// parseCertificates parses the PEM encoded certificates in out.
+func parseCertificates(out []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, out = pem.Decode(out)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if xc, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, xc)
+		}
+	}
+}
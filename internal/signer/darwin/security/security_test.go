@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func newCert(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xc, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return xc
+}
+
+func TestIdentities(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake security tool is a shell script")
+	}
+	identity, other := newCert(t, "identity"), newCert(t, "other")
+	dir := t.TempDir()
+	certs := filepath.Join(dir, "certs.pem")
+	pemData := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: identity.Raw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Raw})...)
+	if err := os.WriteFile(certs, pemData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+find-identity) printf 'Policy: X509 Basic\n  Matching identities\n  1) %X "identity"\n     1 identities found\n' ;;
+find-certificate) cat %q ;;
+esac
+`, sha1.Sum(identity.Raw), certs)
+	tool := filepath.Join(dir, "security")
+	if err := os.WriteFile(tool, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(tool string) { securityTool = tool }(securityTool)
+	securityTool = tool
+
+	got, err := Identities(nil)
+	if err != nil {
+		t.Fatalf("Identities: got %v, want nil err", err)
+	}
+	if len(got) != 1 || !got[0].Equal(identity) {
+		t.Errorf("Identities: got %d certificates, want only the identity", len(got))
+	}
+	all, err := Certificates(nil)
+	if err != nil {
+		t.Fatalf("Certificates: got %v, want nil err", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Certificates: got %d certificates, want 2", len(all))
+	}
+}
+
+func TestKeychains(t *testing.T) {
+	if got, err := Keychains("system"); err != nil || len(got) != 1 || got[0] != SystemKeychain {
+		t.Errorf("Keychains(system): got %v, %v", got, err)
+	}
+	if got, err := Keychains(""); err != nil || got != nil {
+		t.Errorf("Keychains(\"\"): got %v, %v, want the default search list", got, err)
+	}
+	if _, err := Keychains("other"); err == nil {
+		t.Error("Keychains(other): got nil err, want error")
+	}
+}
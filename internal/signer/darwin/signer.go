@@ -11,6 +11,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build darwin && cgo
+// +build darwin,cgo
+
 // Signer.go is a net/rpc server that listens on stdin/stdout, exposing
 // methods that perform device certificate signing for Mac OS using keychain utils.
 // This server is intended to be launched as a subprocess by the signer client,
@@ -18,141 +21,99 @@
 package main
 
 import (
-	"crypto"
-	"crypto/rsa"
 	"crypto/x509"
-	"encoding/gob"
-	"io"
-	"log"
-	"net/rpc"
-	"os"
-	"time"
+	"fmt"
 
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/keychain"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/darwin/presence"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
 )
 
-// If ECP Logging is enabled return true
-// Otherwise return false
-func enableECPLogging() bool {
-	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
-		return true
-	}
-
-	log.SetOutput(io.Discard)
-	return false
-}
-
-func init() {
-	gob.Register(crypto.SHA256)
-	gob.Register(crypto.SHA384)
-	gob.Register(crypto.SHA512)
-	gob.Register(&rsa.PSSOptions{})
-	gob.Register(&rsa.OAEPOptions{})
-}
-
-// SignArgs contains arguments for a Sign API call.
-type SignArgs struct {
-	Digest []byte            // The content to sign.
-	Opts   crypto.SignerOpts // Options for signing. Must implement HashFunc().
-}
+// backend opens the credentials of keychain identities.
+type backend struct{}
 
-// EncryptArgs contains arguments for an Encrypt API call.
-type EncryptArgs struct {
-	Plaintext []byte // The plaintext to encrypt.
-	Opts      any    // Options for encryption. Ex: an instance of crypto.Hash.
+func (backend) Name() string {
+	return "keychain"
 }
 
-// DecryptArgs contains arguments to for a Decrypt API call.
-type DecryptArgs struct {
-	Ciphertext []byte               // The ciphertext to decrypt.
-	Opts       crypto.DecrypterOpts // Options for decryption. Ex: an instance of *rsa.OAEPOptions.
+// IsTransient reports whether err is a transient failure of the keystore.
+func (backend) IsTransient(err error) bool {
+	return keychain.IsTransient(err)
 }
 
-// A EnterpriseCertSigner exports RPC methods for signing.
-type EnterpriseCertSigner struct {
-	key *keychain.Key
-}
-
-// A Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
-type Connection struct {
-	io.ReadCloser
-	io.WriteCloser
-}
-
-// Close closes c's underlying ReadCloser and WriteCloser.
-func (c *Connection) Close() error {
-	rerr := c.ReadCloser.Close()
-	werr := c.WriteCloser.Close()
-	if rerr != nil {
-		return rerr
+// Open returns the credential described by config, retrying transient errors
+// as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	keychainType, err := keychain.ParseKeychainType(config.CertConfigs.MacOSKeychain.KeychainType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enterprise cert config: %w", err)
+	}
+	opts := keychain.SearchOptions{
+		AccessGroup: config.CertConfigs.MacOSKeychain.AccessGroup,
+		Legacy:      config.CertConfigs.MacOSKeychain.LegacyKeychain,
+		Fingerprint: config.CertConfigs.MacOSKeychain.Fingerprint,
+	}
+	if promptForSelection(config.CertConfigs.MacOSKeychain) {
+		opts.Choose = keychain.ChooseWithDialog
+		opts.Preferred = startup.Selected()
 	}
-	return werr
+	var key *keychain.Key
+	err = util.DoWithRetry(config.Retry, keychain.IsTransient, func() (err error) {
+		key, err = keychain.CredWithOptions(config.CertConfigs.MacOSKeychain.Issuer, keychainType, config.CertConfigs.MacOSKeychain.EKU, opts)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	// A signer replacing another one serving the same identity does not ask
+	// the user to confirm its use again.
+	if config.CertConfigs.MacOSKeychain.UserPresence && !selectedBefore(key) {
+		key.SetConfirmation(func() error {
+			return presence.Confirm("use your enterprise certificate")
+		})
+	}
+	return credential{key}, nil
 }
 
-// CertificateChain returns the credential as a raw X509 cert chain. This
-// contains the public key.
-func (k *EnterpriseCertSigner) CertificateChain(ignored struct{}, certificateChain *[][]byte) error {
-	*certificateChain = k.key.CertificateChain()
-	return nil
+// promptForSelection reports whether mk asks the user to choose between
+// several matching identities.
+func promptForSelection(mk config.MacOSKeychain) bool {
+	return mk.Selection == config.SelectionPrompt
 }
 
-// Public returns the corresponding public key for this Key, in ASN.1 DER form.
-func (k *EnterpriseCertSigner) Public(ignored struct{}, publicKey *[]byte) (err error) {
-	*publicKey, err = x509.MarshalPKIXPublicKey(k.key.Public())
-	return
+// selectedBefore reports whether key is the identity served by the signer that
+// this one replaces.
+func selectedBefore(key *keychain.Key) bool {
+	selected, chain := startup.Selected(), key.CertificateChain()
+	if selected == "" || len(chain) == 0 {
+		return false
+	}
+	xc, err := x509.ParseCertificate(chain[0])
+	return err == nil && config.MatchesFingerprint(xc, selected)
 }
 
-// Sign signs a message digest. Stores result in "resp".
-func (k *EnterpriseCertSigner) Sign(args SignArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Sign(nil, args.Digest, args.Opts)
-	return
+// credential is a keychain identity served by the signer.
+type credential struct {
+	*keychain.Key
 }
 
-// Encrypt encrypts a plaintext message digest. Stores result in "resp".
-func (k *EnterpriseCertSigner) Encrypt(args EncryptArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Encrypt(args.Plaintext, args.Opts)
-	return
+// Metadata describes the keychain holding the credential.
+func (c credential) Metadata() server.Metadata {
+	return server.Metadata{
+		KeystoreType: "keychain",
+		Keychain:     string(c.KeychainType()),
+	}
 }
 
-// Decrypt decrypts a ciphertext message digest. Stores result in "resp".
-func (k *EnterpriseCertSigner) Decrypt(args DecryptArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Decrypt(args.Ciphertext, args.Opts)
-	return
+// Capabilities describes the algorithms that the keychain supports with the
+// credential.
+func (c credential) Capabilities() util.Capabilities {
+	return c.Key.Capabilities()
 }
 
 func main() {
-	enableECPLogging()
-	if len(os.Args) != 2 {
-		log.Fatalln("Signer is not meant to be invoked manually, exiting...")
-	}
-	configFilePath := os.Args[1]
-	config, err := util.LoadConfig(configFilePath)
-	if err != nil {
-		log.Fatalf("Failed to load enterprise cert config: %v", err)
-	}
-
-	enterpriseCertSigner := new(EnterpriseCertSigner)
-	enterpriseCertSigner.key, err = keychain.Cred(config.CertConfigs.MacOSKeychain.Issuer)
-	if err != nil {
-		log.Fatalf("Failed to initialize enterprise cert signer using keychain: %v", err)
-	}
-
-	if err := rpc.Register(enterpriseCertSigner); err != nil {
-		log.Fatalf("Failed to register enterprise cert signer with net/rpc: %v", err)
-	}
-
-	// If the parent process dies, we should exit.
-	// We can detect this by periodically checking if the PID of the parent
-	// process is 1 (https://stackoverflow.com/a/2035683).
-	go func() {
-		for {
-			if os.Getppid() == 1 {
-				log.Fatalln("Enterprise cert signer's parent process died, exiting...")
-			}
-			time.Sleep(time.Second)
-		}
-	}()
-
-	rpc.ServeConn(&Connection{os.Stdin, os.Stdout})
+	server.Main(backend{})
 }
@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"strings"
+)
+
+// Labels of the PIV attestation certificates exposed by Yubico's YKCS11
+// module. The module generates the attestation of the key in a PIV slot, named
+// by the suffix of the label, when the certificate is read. It is signed by
+// the device attestation certificate, which chains to the Yubico PIV CA.
+const (
+	pivAttestationLabelPrefix = "X.509 Certificate for PIV Attestation "
+	pivDeviceAttestationLabel = "X.509 Certificate for PIV Attestation"
+)
+
+// AttestationFormatPIV is the format of attestations made of a PIV key
+// attestation certificate followed by the device attestation certificate.
+const AttestationFormatPIV = "piv"
+
+// ErrAttestationUnsupported is returned by Attestation when the token does not
+// provide attestation data for the key.
+var ErrAttestationUnsupported = errors.New("the token does not provide attestation data for the key")
+
+// An Attestation is evidence from the token that the key was generated in and
+// cannot be exported from the hardware.
+type Attestation struct {
+	Format       string   // The format of the attestation, such as AttestationFormatPIV.
+	Certificates [][]byte // The DER encoded attestation certificate chain, leaf first.
+}
+
+// labeledCert is a certificate object read from the token.
+type labeledCert struct {
+	label string
+	der   []byte
+}
+
+// Attestation returns the attestation of the key, if the token provides one.
+// Only PIV attestation through YKCS11 is supported.
+func (k *Key) Attestation() (*Attestation, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	k.sessionMu.Lock()
+	objs, err := k.module.certificates(k.session, "")
+	k.sessionMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var certs []labeledCert
+	for _, obj := range objs {
+		if strings.HasPrefix(obj.label, pivDeviceAttestationLabel) {
+			certs = append(certs, labeledCert{label: obj.label, der: obj.cert.Raw})
+		}
+	}
+	return pivAttestation(certs, k.Public())
+}
+
+// pivAttestation returns the PIV attestation among certs that certifies pub,
+// followed by the device attestation certificate.
+func pivAttestation(certs []labeledCert, pub crypto.PublicKey) (*Attestation, error) {
+	key, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, ErrAttestationUnsupported
+	}
+	var attestation, device []byte
+	for _, c := range certs {
+		if c.label == pivDeviceAttestationLabel {
+			device = c.der
+			continue
+		}
+		if !strings.HasPrefix(c.label, pivAttestationLabelPrefix) {
+			continue
+		}
+		xc, err := x509.ParseCertificate(c.der)
+		if err == nil && key.Equal(xc.PublicKey) {
+			attestation = c.der
+		}
+	}
+	if attestation == nil {
+		return nil, ErrAttestationUnsupported
+	}
+	chain := [][]byte{attestation}
+	if device != nil {
+		chain = append(chain, device)
+	}
+	return &Attestation{Format: AttestationFormatPIV, Certificates: chain}, nil
+}
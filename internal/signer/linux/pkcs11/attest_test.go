@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func makeCert(t *testing.T, pub, priv any) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "YubiKey PIV Attestation"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestPIVAttestation(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation := makeCert(t, &key.PublicKey, other)
+	device := makeCert(t, &other.PublicKey, other)
+	certs := []labeledCert{
+		{label: pivDeviceAttestationLabel, der: device},
+		{label: pivAttestationLabelPrefix + "9c", der: makeCert(t, &other.PublicKey, other)},
+		{label: pivAttestationLabelPrefix + "9a", der: attestation},
+	}
+
+	got, err := pivAttestation(certs, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("pivAttestation: got %v, want nil err", err)
+	}
+	if got.Format != AttestationFormatPIV || len(got.Certificates) != 2 || !bytes.Equal(got.Certificates[0], attestation) || !bytes.Equal(got.Certificates[1], device) {
+		t.Errorf("pivAttestation: got format %q and %d certificates, want the attestation of the key and the device certificate", got.Format, len(got.Certificates))
+	}
+
+	if _, err := pivAttestation(certs[:2], &key.PublicKey); !errors.Is(err, ErrAttestationUnsupported) {
+		t.Errorf("pivAttestation: got %v, want ErrAttestationUnsupported", err)
+	}
+}
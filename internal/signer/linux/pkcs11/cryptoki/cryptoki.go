@@ -0,0 +1,224 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cryptoki calls the functions of PKCS #11 modules that the PKCS #11
+// signer uses. Its API follows github.com/miekg/pkcs11, which it uses when
+// built with cgo. Without cgo, on the platforms where
+// github.com/ebitengine/purego does not need it, it loads the modules with
+// dlopen and calls them through purego, so that the signer can be built with
+// CGO_ENABLED=0. Such a build still needs the dynamic loader of the C library
+// that the module was built for, such as glibc.
+package cryptoki
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Values of the PKCS #11 constants used by the signer.
+const (
+	CKA_CLASS               = 0x00000000
+	CKA_TOKEN               = 0x00000001
+	CKA_LABEL               = 0x00000003
+	CKA_VALUE               = 0x00000011
+	CKA_CERTIFICATE_TYPE    = 0x00000080
+	CKA_KEY_TYPE            = 0x00000100
+	CKA_ID                  = 0x00000102
+	CKA_SENSITIVE           = 0x00000103
+	CKA_DECRYPT             = 0x00000105
+	CKA_SIGN                = 0x00000108
+	CKA_MODULUS             = 0x00000120
+	CKA_VALUE_LEN           = 0x00000161
+	CKA_EXTRACTABLE         = 0x00000162
+	CKA_EC_POINT            = 0x00000181
+	CKA_ALWAYS_AUTHENTICATE = 0x00000202
+
+	CKC_X_509 = 0x00000000
+
+	CKD_NULL = 0x00000001
+
+	CKF_TOKEN_PRESENT  = 0x00000001
+	CKF_OS_LOCKING_OK  = 0x00000002
+	CKF_SERIAL_SESSION = 0x00000004
+	CKF_DECRYPT        = 0x00000200
+	CKF_SIGN           = 0x00000800
+
+	CKG_MGF1_SHA1   = 0x00000001
+	CKG_MGF1_SHA256 = 0x00000002
+	CKG_MGF1_SHA384 = 0x00000003
+	CKG_MGF1_SHA512 = 0x00000004
+
+	CKK_GENERIC_SECRET = 0x00000010
+
+	CKM_RSA_PKCS      = 0x00000001
+	CKM_RSA_PKCS_OAEP = 0x00000009
+	CKM_RSA_PKCS_PSS  = 0x0000000D
+	CKM_SHA_1         = 0x00000220
+	CKM_SHA256        = 0x00000250
+	CKM_SHA384        = 0x00000260
+	CKM_SHA512        = 0x00000270
+	CKM_ECDSA         = 0x00001041
+	CKM_ECDH1_DERIVE  = 0x00001050
+
+	CKO_CERTIFICATE = 0x00000001
+	CKO_PUBLIC_KEY  = 0x00000002
+	CKO_PRIVATE_KEY = 0x00000003
+	CKO_SECRET_KEY  = 0x00000004
+
+	CKR_OK                           = 0x00000000
+	CKR_ATTRIBUTE_TYPE_INVALID       = 0x00000012
+	CKR_TOKEN_NOT_PRESENT            = 0x000000E0
+	CKR_USER_ALREADY_LOGGED_IN       = 0x00000100
+	CKR_CRYPTOKI_ALREADY_INITIALIZED = 0x00000191
+
+	CKU_USER             = 1
+	CKU_CONTEXT_SPECIFIC = 2
+
+	CKZ_DATA_SPECIFIED = 0x00000001
+)
+
+// Error is a PKCS #11 return value other than CKR_OK.
+type Error uint
+
+func (e Error) Error() string {
+	return fmt.Sprintf("pkcs11: 0x%X: %s", uint(e), errorNames[uint(e)])
+}
+
+// SessionHandle identifies a session with a token.
+type SessionHandle uint
+
+// ObjectHandle identifies an object of a token within a session.
+type ObjectHandle uint
+
+// Info describes a module.
+type Info struct {
+	ManufacturerID     string
+	Flags              uint
+	LibraryDescription string
+}
+
+// SlotInfo describes a slot.
+type SlotInfo struct {
+	SlotDescription string
+	ManufacturerID  string
+	Flags           uint
+}
+
+// TokenInfo describes a token.
+type TokenInfo struct {
+	Label          string
+	ManufacturerID string
+	Model          string
+	SerialNumber   string
+	Flags          uint
+}
+
+// MechanismInfo describes the support of a mechanism by a token.
+type MechanismInfo struct {
+	MinKeySize uint
+	MaxKeySize uint
+	Flags      uint
+}
+
+// Attribute is an attribute of an object, whose value is encoded as in C.
+type Attribute struct {
+	Type  uint
+	Value []byte
+}
+
+// NewAttribute returns the attribute of type typ with the value x, which is
+// nil, a bool, an int, a uint, a string or a []byte.
+func NewAttribute(typ uint, x any) *Attribute {
+	a := &Attribute{Type: typ}
+	switch v := x.(type) {
+	case nil:
+	case bool:
+		a.Value = []byte{0}
+		if v {
+			a.Value[0] = 1
+		}
+	case int:
+		a.Value = ulongBytes(uint(v))
+	case uint:
+		a.Value = ulongBytes(v)
+	case string:
+		a.Value = []byte(v)
+	case []byte:
+		a.Value = v
+	default:
+		panic(fmt.Sprintf("cryptoki: unhandled attribute value of type %T", x))
+	}
+	return a
+}
+
+// ulongBytes encodes x as a CK_ULONG, which is an unsigned long, like uint on
+// the platforms of the signer.
+func ulongBytes(x uint) []byte {
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(&x)), unsafe.Sizeof(x))...)
+}
+
+// Mechanism is a mechanism and its parameter, which is nil, a []byte holding
+// the parameter encoded as in C, a *PSSParams, an *OAEPParams or an
+// *ECDH1DeriveParams.
+type Mechanism struct {
+	Mechanism uint
+	Parameter any
+}
+
+// NewMechanism returns the mechanism mech with the parameter x.
+func NewMechanism(mech uint, x any) *Mechanism {
+	switch x.(type) {
+	case nil, []byte, *PSSParams, *OAEPParams, *ECDH1DeriveParams:
+	default:
+		panic(fmt.Sprintf("cryptoki: unhandled mechanism parameter of type %T", x))
+	}
+	return &Mechanism{Mechanism: mech, Parameter: x}
+}
+
+// PSSParams is the CK_RSA_PKCS_PSS_PARAMS parameter of CKM_RSA_PKCS_PSS.
+type PSSParams struct {
+	HashAlg    uint
+	MGF        uint
+	SaltLength uint
+}
+
+// NewPSSParams returns the parameter of CKM_RSA_PKCS_PSS.
+func NewPSSParams(hashAlg, mgf, saltLength uint) *PSSParams {
+	return &PSSParams{HashAlg: hashAlg, MGF: mgf, SaltLength: saltLength}
+}
+
+// OAEPParams is the CK_RSA_PKCS_OAEP_PARAMS parameter of CKM_RSA_PKCS_OAEP.
+type OAEPParams struct {
+	HashAlg    uint
+	MGF        uint
+	SourceType uint
+	SourceData []byte
+}
+
+// NewOAEPParams returns the parameter of CKM_RSA_PKCS_OAEP.
+func NewOAEPParams(hashAlg, mgf, sourceType uint, sourceData []byte) *OAEPParams {
+	return &OAEPParams{HashAlg: hashAlg, MGF: mgf, SourceType: sourceType, SourceData: sourceData}
+}
+
+// ECDH1DeriveParams is the CK_ECDH1_DERIVE_PARAMS parameter of
+// CKM_ECDH1_DERIVE.
+type ECDH1DeriveParams struct {
+	KDF           uint
+	SharedData    []byte
+	PublicKeyData []byte
+}
+
+// NewECDH1DeriveParams returns the parameter of CKM_ECDH1_DERIVE.
+func NewECDH1DeriveParams(kdf uint, sharedData []byte, publicKeyData []byte) *ECDH1DeriveParams {
+	return &ECDH1DeriveParams{KDF: kdf, SharedData: sharedData, PublicKeyData: publicKeyData}
+}
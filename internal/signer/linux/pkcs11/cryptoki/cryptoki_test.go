@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cryptoki
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+func TestNewAttribute(t *testing.T) {
+	one := make([]byte, unsafe.Sizeof(uint(0)))
+	one[0] = 1 // The signer only runs on little-endian platforms.
+	tests := []struct {
+		value any
+		want  []byte
+	}{
+		{nil, nil},
+		{true, []byte{1}},
+		{false, []byte{0}},
+		{1, one},
+		{uint(1), one},
+		{"label", []byte("label")},
+		{[]byte{1, 2}, []byte{1, 2}},
+	}
+	for _, tc := range tests {
+		a := NewAttribute(CKA_LABEL, tc.value)
+		if a.Type != CKA_LABEL || !bytes.Equal(a.Value, tc.want) {
+			t.Errorf("NewAttribute(CKA_LABEL, %#v) = {%#x, %v}, want {%#x, %v}", tc.value, a.Type, a.Value, CKA_LABEL, tc.want)
+		}
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	if got, want := Error(CKR_TOKEN_NOT_PRESENT).Error(), "pkcs11: 0xE0: CKR_TOKEN_NOT_PRESENT"; got != want {
+		t.Errorf("Error(CKR_TOKEN_NOT_PRESENT).Error() = %q, want %q", got, want)
+	}
+}
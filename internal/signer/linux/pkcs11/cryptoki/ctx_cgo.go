@@ -0,0 +1,222 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo && !windows
+// +build cgo,!windows
+
+package cryptoki
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/miekg/pkcs11"
+)
+
+// Ctx is a loaded PKCS #11 module.
+type Ctx struct {
+	ctx *pkcs11.Ctx
+}
+
+// New loads the PKCS #11 module at path.
+func New(path string) (*Ctx, error) {
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: failed to load %s", path)
+	}
+	return &Ctx{ctx: ctx}, nil
+}
+
+// Destroy unloads the module.
+func (c *Ctx) Destroy() {
+	c.ctx.Destroy()
+}
+
+// Initialize calls C_Initialize, letting the module use the locking
+// primitives of the OS.
+func (c *Ctx) Initialize() error {
+	return toError(c.ctx.Initialize())
+}
+
+// Finalize calls C_Finalize.
+func (c *Ctx) Finalize() error {
+	return toError(c.ctx.Finalize())
+}
+
+// GetInfo calls C_GetInfo.
+func (c *Ctx) GetInfo() (Info, error) {
+	info, err := c.ctx.GetInfo()
+	return Info{ManufacturerID: info.ManufacturerID, Flags: info.Flags, LibraryDescription: info.LibraryDescription}, toError(err)
+}
+
+// GetSlotList calls C_GetSlotList.
+func (c *Ctx) GetSlotList(tokenPresent bool) ([]uint, error) {
+	slots, err := c.ctx.GetSlotList(tokenPresent)
+	return slots, toError(err)
+}
+
+// GetSlotInfo calls C_GetSlotInfo.
+func (c *Ctx) GetSlotInfo(slotID uint) (SlotInfo, error) {
+	info, err := c.ctx.GetSlotInfo(slotID)
+	return SlotInfo{SlotDescription: info.SlotDescription, ManufacturerID: info.ManufacturerID, Flags: info.Flags}, toError(err)
+}
+
+// GetTokenInfo calls C_GetTokenInfo.
+func (c *Ctx) GetTokenInfo(slotID uint) (TokenInfo, error) {
+	info, err := c.ctx.GetTokenInfo(slotID)
+	return TokenInfo{Label: info.Label, ManufacturerID: info.ManufacturerID, Model: info.Model, SerialNumber: info.SerialNumber, Flags: info.Flags}, toError(err)
+}
+
+// GetMechanismList calls C_GetMechanismList.
+func (c *Ctx) GetMechanismList(slotID uint) ([]*Mechanism, error) {
+	list, err := c.ctx.GetMechanismList(slotID)
+	if err != nil {
+		return nil, toError(err)
+	}
+	mechanisms := make([]*Mechanism, len(list))
+	for i, m := range list {
+		mechanisms[i] = &Mechanism{Mechanism: m.Mechanism}
+	}
+	return mechanisms, nil
+}
+
+// GetMechanismInfo calls C_GetMechanismInfo with the mechanism of m, which
+// holds exactly one.
+func (c *Ctx) GetMechanismInfo(slotID uint, m []*Mechanism) (MechanismInfo, error) {
+	info, err := c.ctx.GetMechanismInfo(slotID, mechanisms(m))
+	return MechanismInfo{MinKeySize: info.MinKeySize, MaxKeySize: info.MaxKeySize, Flags: info.Flags}, toError(err)
+}
+
+// OpenSession calls C_OpenSession without notification callback.
+func (c *Ctx) OpenSession(slotID uint, flags uint) (SessionHandle, error) {
+	session, err := c.ctx.OpenSession(slotID, flags)
+	return SessionHandle(session), toError(err)
+}
+
+// CloseSession calls C_CloseSession.
+func (c *Ctx) CloseSession(sh SessionHandle) error {
+	return toError(c.ctx.CloseSession(pkcs11.SessionHandle(sh)))
+}
+
+// Login calls C_Login. The pin is passed to miekg/pkcs11 as a string sharing
+// its memory, rather than as an immutable copy, so that the caller can zero it.
+func (c *Ctx) Login(sh SessionHandle, userType uint, pin []byte) error {
+	return toError(c.ctx.Login(pkcs11.SessionHandle(sh), userType, *(*string)(unsafe.Pointer(&pin))))
+}
+
+// FindObjectsInit calls C_FindObjectsInit.
+func (c *Ctx) FindObjectsInit(sh SessionHandle, template []*Attribute) error {
+	return toError(c.ctx.FindObjectsInit(pkcs11.SessionHandle(sh), attributes(template)))
+}
+
+// FindObjects calls C_FindObjects, returning at most max objects.
+func (c *Ctx) FindObjects(sh SessionHandle, max int) ([]ObjectHandle, bool, error) {
+	found, more, err := c.ctx.FindObjects(pkcs11.SessionHandle(sh), max)
+	objs := make([]ObjectHandle, len(found))
+	for i, o := range found {
+		objs[i] = ObjectHandle(o)
+	}
+	return objs, more, toError(err)
+}
+
+// FindObjectsFinal calls C_FindObjectsFinal.
+func (c *Ctx) FindObjectsFinal(sh SessionHandle) error {
+	return toError(c.ctx.FindObjectsFinal(pkcs11.SessionHandle(sh)))
+}
+
+// GetAttributeValue calls C_GetAttributeValue for the types of a, and returns
+// their values.
+func (c *Ctx) GetAttributeValue(sh SessionHandle, o ObjectHandle, a []*Attribute) ([]*Attribute, error) {
+	values, err := c.ctx.GetAttributeValue(pkcs11.SessionHandle(sh), pkcs11.ObjectHandle(o), attributes(a))
+	if err != nil {
+		return nil, toError(err)
+	}
+	attrs := make([]*Attribute, len(values))
+	for i, v := range values {
+		attrs[i] = &Attribute{Type: v.Type, Value: v.Value}
+	}
+	return attrs, nil
+}
+
+// DestroyObject calls C_DestroyObject.
+func (c *Ctx) DestroyObject(sh SessionHandle, o ObjectHandle) error {
+	return toError(c.ctx.DestroyObject(pkcs11.SessionHandle(sh), pkcs11.ObjectHandle(o)))
+}
+
+// SignInit calls C_SignInit with the mechanism of m, which holds exactly one.
+func (c *Ctx) SignInit(sh SessionHandle, m []*Mechanism, o ObjectHandle) error {
+	return toError(c.ctx.SignInit(pkcs11.SessionHandle(sh), mechanisms(m), pkcs11.ObjectHandle(o)))
+}
+
+// Sign calls C_Sign.
+func (c *Ctx) Sign(sh SessionHandle, message []byte) ([]byte, error) {
+	sig, err := c.ctx.Sign(pkcs11.SessionHandle(sh), message)
+	return sig, toError(err)
+}
+
+// DecryptInit calls C_DecryptInit with the mechanism of m, which holds
+// exactly one.
+func (c *Ctx) DecryptInit(sh SessionHandle, m []*Mechanism, o ObjectHandle) error {
+	return toError(c.ctx.DecryptInit(pkcs11.SessionHandle(sh), mechanisms(m), pkcs11.ObjectHandle(o)))
+}
+
+// Decrypt calls C_Decrypt.
+func (c *Ctx) Decrypt(sh SessionHandle, ciphertext []byte) ([]byte, error) {
+	plaintext, err := c.ctx.Decrypt(pkcs11.SessionHandle(sh), ciphertext)
+	return plaintext, toError(err)
+}
+
+// DeriveKey calls C_DeriveKey with the mechanism of m, which holds exactly
+// one.
+func (c *Ctx) DeriveKey(sh SessionHandle, m []*Mechanism, base ObjectHandle, template []*Attribute) (ObjectHandle, error) {
+	o, err := c.ctx.DeriveKey(pkcs11.SessionHandle(sh), mechanisms(m), pkcs11.ObjectHandle(base), attributes(template))
+	return ObjectHandle(o), toError(err)
+}
+
+// toError converts the PKCS #11 return values reported by
+// github.com/miekg/pkcs11 to an Error.
+func toError(err error) error {
+	var rv pkcs11.Error
+	if errors.As(err, &rv) {
+		return Error(rv)
+	}
+	return err
+}
+
+func attributes(a []*Attribute) []*pkcs11.Attribute {
+	attrs := make([]*pkcs11.Attribute, len(a))
+	for i, attr := range a {
+		attrs[i] = &pkcs11.Attribute{Type: attr.Type, Value: attr.Value}
+	}
+	return attrs
+}
+
+func mechanisms(m []*Mechanism) []*pkcs11.Mechanism {
+	mechs := make([]*pkcs11.Mechanism, len(m))
+	for i, mech := range m {
+		var param any
+		switch p := mech.Parameter.(type) {
+		case []byte:
+			param = p
+		case *PSSParams:
+			param = pkcs11.NewPSSParams(p.HashAlg, p.MGF, p.SaltLength)
+		case *OAEPParams:
+			param = pkcs11.NewOAEPParams(p.HashAlg, p.MGF, p.SourceType, p.SourceData)
+		case *ECDH1DeriveParams:
+			param = pkcs11.NewECDH1DeriveParams(p.KDF, p.SharedData, p.PublicKeyData)
+		}
+		mechs[i] = pkcs11.NewMechanism(mech.Mechanism, param)
+	}
+	return mechs
+}
@@ -0,0 +1,487 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo && (linux || darwin) && (amd64 || arm64)
+// +build !cgo
+// +build linux darwin
+// +build amd64 arm64
+
+package cryptoki
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// Indices of the functions called by Ctx in CK_FUNCTION_LIST.
+const (
+	fnInitialize        = 0
+	fnFinalize          = 1
+	fnGetInfo           = 2
+	fnGetSlotList       = 4
+	fnGetSlotInfo       = 5
+	fnGetTokenInfo      = 6
+	fnGetMechanismList  = 7
+	fnGetMechanismInfo  = 8
+	fnOpenSession       = 12
+	fnCloseSession      = 13
+	fnLogin             = 18
+	fnDestroyObject     = 22
+	fnGetAttributeValue = 24
+	fnFindObjectsInit   = 26
+	fnFindObjects       = 27
+	fnFindObjectsFinal  = 28
+	fnDecryptInit       = 33
+	fnDecrypt           = 34
+	fnSignInit          = 42
+	fnSign              = 43
+	fnDeriveKey         = 62
+)
+
+// ckUnavailableInformation is the length of an attribute whose value cannot
+// be returned.
+const ckUnavailableInformation = ^uint(0)
+
+// The following types have the layout of the PKCS #11 structures on the
+// supported platforms, where CK_ULONG is a 64-bit unsigned long like uint, and
+// the structures are not packed.
+
+type ckInfo struct {
+	cryptokiVersion    [2]byte
+	manufacturerID     [32]byte
+	flags              uint
+	libraryDescription [32]byte
+	libraryVersion     [2]byte
+}
+
+type ckSlotInfo struct {
+	slotDescription [64]byte
+	manufacturerID  [32]byte
+	flags           uint
+	hardwareVersion [2]byte
+	firmwareVersion [2]byte
+}
+
+type ckTokenInfo struct {
+	label              [32]byte
+	manufacturerID     [32]byte
+	model              [16]byte
+	serialNumber       [16]byte
+	flags              uint
+	maxSessionCount    uint
+	sessionCount       uint
+	maxRwSessionCount  uint
+	rwSessionCount     uint
+	maxPinLen          uint
+	minPinLen          uint
+	totalPublicMemory  uint
+	freePublicMemory   uint
+	totalPrivateMemory uint
+	freePrivateMemory  uint
+	hardwareVersion    [2]byte
+	firmwareVersion    [2]byte
+	utcTime            [16]byte
+}
+
+type ckMechanismInfo struct {
+	minKeySize uint
+	maxKeySize uint
+	flags      uint
+}
+
+type ckInitializeArgs struct {
+	createMutex  uintptr
+	destroyMutex uintptr
+	lockMutex    uintptr
+	unlockMutex  uintptr
+	flags        uint
+	reserved     unsafe.Pointer
+}
+
+type ckAttribute struct {
+	typ    uint
+	value  unsafe.Pointer
+	length uint
+}
+
+type ckMechanism struct {
+	mechanism uint
+	parameter unsafe.Pointer
+	length    uint
+}
+
+type ckPSSParams struct {
+	hashAlg uint
+	mgf     uint
+	sLen    uint
+}
+
+type ckOAEPParams struct {
+	hashAlg       uint
+	mgf           uint
+	source        uint
+	sourceData    unsafe.Pointer
+	sourceDataLen uint
+}
+
+type ckECDH1DeriveParams struct {
+	kdf           uint
+	sharedDataLen uint
+	sharedData    unsafe.Pointer
+	publicDataLen uint
+	publicData    unsafe.Pointer
+}
+
+// Ctx is a loaded PKCS #11 module.
+type Ctx struct {
+	lib   uintptr
+	funcs unsafe.Pointer // The CK_FUNCTION_LIST of the module.
+}
+
+// New loads the PKCS #11 module at path.
+func New(path string) (*Ctx, error) {
+	lib, err := purego.Dlopen(path, purego.RTLD_LAZY|purego.RTLD_LOCAL)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: failed to load %s: %w", path, err)
+	}
+	getFunctionList, err := purego.Dlsym(lib, "C_GetFunctionList")
+	if err != nil {
+		purego.Dlclose(lib)
+		return nil, fmt.Errorf("pkcs11: failed to load %s: %w", path, err)
+	}
+	c := &Ctx{lib: lib}
+	if rv, _, _ := purego.SyscallN(getFunctionList, uintptr(unsafe.Pointer(&c.funcs))); uint(rv) != CKR_OK || c.funcs == nil {
+		purego.Dlclose(lib)
+		return nil, fmt.Errorf("pkcs11: failed to load %s: C_GetFunctionList: %w", path, toError(uint(rv)))
+	}
+	return c, nil
+}
+
+// call calls the function of the module at index fn of CK_FUNCTION_LIST. The
+// arguments converted from pointers stay valid during the call.
+//
+//go:uintptrescapes
+func (c *Ctx) call(fn int, args ...uintptr) error {
+	// The function pointers follow the CK_VERSION at the start of the list,
+	// which is padded to their alignment.
+	ptrSize := unsafe.Sizeof(uintptr(0))
+	f := *(*uintptr)(unsafe.Add(c.funcs, uintptr(fn+1)*ptrSize))
+	rv, _, _ := purego.SyscallN(f, args...)
+	return toError(uint(rv))
+}
+
+// toError returns the error of the PKCS #11 return value rv, or nil for
+// CKR_OK.
+func toError(rv uint) error {
+	if rv == CKR_OK {
+		return nil
+	}
+	return Error(rv)
+}
+
+// Destroy unloads the module.
+func (c *Ctx) Destroy() {
+	purego.Dlclose(c.lib)
+}
+
+// Initialize calls C_Initialize, letting the module use the locking
+// primitives of the OS.
+func (c *Ctx) Initialize() error {
+	args := &ckInitializeArgs{flags: CKF_OS_LOCKING_OK}
+	return c.call(fnInitialize, uintptr(unsafe.Pointer(args)))
+}
+
+// Finalize calls C_Finalize.
+func (c *Ctx) Finalize() error {
+	return c.call(fnFinalize, 0)
+}
+
+// GetInfo calls C_GetInfo.
+func (c *Ctx) GetInfo() (Info, error) {
+	info := new(ckInfo)
+	if err := c.call(fnGetInfo, uintptr(unsafe.Pointer(info))); err != nil {
+		return Info{}, err
+	}
+	return Info{
+		ManufacturerID:     padded(info.manufacturerID[:]),
+		Flags:              info.flags,
+		LibraryDescription: padded(info.libraryDescription[:]),
+	}, nil
+}
+
+// GetSlotList calls C_GetSlotList.
+func (c *Ctx) GetSlotList(tokenPresent bool) ([]uint, error) {
+	n := new(uint)
+	if err := c.call(fnGetSlotList, ckBool(tokenPresent), 0, uintptr(unsafe.Pointer(n))); err != nil || *n == 0 {
+		return nil, err
+	}
+	slots := make([]uint, *n)
+	if err := c.call(fnGetSlotList, ckBool(tokenPresent), uintptr(unsafe.Pointer(&slots[0])), uintptr(unsafe.Pointer(n))); err != nil {
+		return nil, err
+	}
+	return slots[:*n], nil
+}
+
+// GetSlotInfo calls C_GetSlotInfo.
+func (c *Ctx) GetSlotInfo(slotID uint) (SlotInfo, error) {
+	info := new(ckSlotInfo)
+	if err := c.call(fnGetSlotInfo, uintptr(slotID), uintptr(unsafe.Pointer(info))); err != nil {
+		return SlotInfo{}, err
+	}
+	return SlotInfo{
+		SlotDescription: padded(info.slotDescription[:]),
+		ManufacturerID:  padded(info.manufacturerID[:]),
+		Flags:           info.flags,
+	}, nil
+}
+
+// GetTokenInfo calls C_GetTokenInfo.
+func (c *Ctx) GetTokenInfo(slotID uint) (TokenInfo, error) {
+	info := new(ckTokenInfo)
+	if err := c.call(fnGetTokenInfo, uintptr(slotID), uintptr(unsafe.Pointer(info))); err != nil {
+		return TokenInfo{}, err
+	}
+	return TokenInfo{
+		Label:          padded(info.label[:]),
+		ManufacturerID: padded(info.manufacturerID[:]),
+		Model:          padded(info.model[:]),
+		SerialNumber:   padded(info.serialNumber[:]),
+		Flags:          info.flags,
+	}, nil
+}
+
+// GetMechanismList calls C_GetMechanismList.
+func (c *Ctx) GetMechanismList(slotID uint) ([]*Mechanism, error) {
+	n := new(uint)
+	if err := c.call(fnGetMechanismList, uintptr(slotID), 0, uintptr(unsafe.Pointer(n))); err != nil || *n == 0 {
+		return nil, err
+	}
+	list := make([]uint, *n)
+	if err := c.call(fnGetMechanismList, uintptr(slotID), uintptr(unsafe.Pointer(&list[0])), uintptr(unsafe.Pointer(n))); err != nil {
+		return nil, err
+	}
+	mechanisms := make([]*Mechanism, *n)
+	for i := range mechanisms {
+		mechanisms[i] = &Mechanism{Mechanism: list[i]}
+	}
+	return mechanisms, nil
+}
+
+// GetMechanismInfo calls C_GetMechanismInfo with the mechanism of m, which
+// holds exactly one.
+func (c *Ctx) GetMechanismInfo(slotID uint, m []*Mechanism) (MechanismInfo, error) {
+	info := new(ckMechanismInfo)
+	if err := c.call(fnGetMechanismInfo, uintptr(slotID), uintptr(mechanismType(m)), uintptr(unsafe.Pointer(info))); err != nil {
+		return MechanismInfo{}, err
+	}
+	return MechanismInfo{MinKeySize: info.minKeySize, MaxKeySize: info.maxKeySize, Flags: info.flags}, nil
+}
+
+// OpenSession calls C_OpenSession without notification callback.
+func (c *Ctx) OpenSession(slotID uint, flags uint) (SessionHandle, error) {
+	session := new(uint)
+	err := c.call(fnOpenSession, uintptr(slotID), uintptr(flags), 0, 0, uintptr(unsafe.Pointer(session)))
+	return SessionHandle(*session), err
+}
+
+// CloseSession calls C_CloseSession.
+func (c *Ctx) CloseSession(sh SessionHandle) error {
+	return c.call(fnCloseSession, uintptr(sh))
+}
+
+// Login calls C_Login.
+func (c *Ctx) Login(sh SessionHandle, userType uint, pin []byte) error {
+	return c.call(fnLogin, uintptr(sh), uintptr(userType), uintptr(bytesPointer(pin)), uintptr(len(pin)))
+}
+
+// FindObjectsInit calls C_FindObjectsInit.
+func (c *Ctx) FindObjectsInit(sh SessionHandle, template []*Attribute) error {
+	attrs := ckAttributes(template)
+	return c.call(fnFindObjectsInit, uintptr(sh), uintptr(attributesPointer(attrs)), uintptr(len(attrs)))
+}
+
+// FindObjects calls C_FindObjects, returning at most max objects.
+func (c *Ctx) FindObjects(sh SessionHandle, max int) ([]ObjectHandle, bool, error) {
+	if max <= 0 {
+		return nil, false, nil
+	}
+	handles := make([]ObjectHandle, max)
+	n := new(uint)
+	if err := c.call(fnFindObjects, uintptr(sh), uintptr(unsafe.Pointer(&handles[0])), uintptr(max), uintptr(unsafe.Pointer(n))); err != nil {
+		return nil, false, err
+	}
+	return handles[:*n], false, nil
+}
+
+// FindObjectsFinal calls C_FindObjectsFinal.
+func (c *Ctx) FindObjectsFinal(sh SessionHandle) error {
+	return c.call(fnFindObjectsFinal, uintptr(sh))
+}
+
+// GetAttributeValue calls C_GetAttributeValue for the types of a, and returns
+// their values.
+func (c *Ctx) GetAttributeValue(sh SessionHandle, o ObjectHandle, a []*Attribute) ([]*Attribute, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	attrs := make([]ckAttribute, len(a))
+	for i, attr := range a {
+		attrs[i].typ = attr.Type
+	}
+	// The first call returns the lengths of the values, and the second one
+	// the values.
+	if err := c.call(fnGetAttributeValue, uintptr(sh), uintptr(o), uintptr(unsafe.Pointer(&attrs[0])), uintptr(len(attrs))); err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(attrs))
+	for i := range attrs {
+		if attrs[i].length != ckUnavailableInformation {
+			values[i] = make([]byte, attrs[i].length)
+			attrs[i].value = bytesPointer(values[i])
+		}
+	}
+	if err := c.call(fnGetAttributeValue, uintptr(sh), uintptr(o), uintptr(unsafe.Pointer(&attrs[0])), uintptr(len(attrs))); err != nil {
+		return nil, err
+	}
+	result := make([]*Attribute, len(attrs))
+	for i := range attrs {
+		result[i] = &Attribute{Type: attrs[i].typ}
+		if attrs[i].length != ckUnavailableInformation {
+			result[i].Value = values[i][:attrs[i].length]
+		}
+	}
+	return result, nil
+}
+
+// DestroyObject calls C_DestroyObject.
+func (c *Ctx) DestroyObject(sh SessionHandle, o ObjectHandle) error {
+	return c.call(fnDestroyObject, uintptr(sh), uintptr(o))
+}
+
+// SignInit calls C_SignInit with the mechanism of m, which holds exactly one.
+func (c *Ctx) SignInit(sh SessionHandle, m []*Mechanism, o ObjectHandle) error {
+	return c.call(fnSignInit, uintptr(sh), uintptr(unsafe.Pointer(ckMechanismOf(m))), uintptr(o))
+}
+
+// Sign calls C_Sign.
+func (c *Ctx) Sign(sh SessionHandle, message []byte) ([]byte, error) {
+	return c.output(fnSign, sh, message)
+}
+
+// DecryptInit calls C_DecryptInit with the mechanism of m, which holds
+// exactly one.
+func (c *Ctx) DecryptInit(sh SessionHandle, m []*Mechanism, o ObjectHandle) error {
+	return c.call(fnDecryptInit, uintptr(sh), uintptr(unsafe.Pointer(ckMechanismOf(m))), uintptr(o))
+}
+
+// Decrypt calls C_Decrypt.
+func (c *Ctx) Decrypt(sh SessionHandle, ciphertext []byte) ([]byte, error) {
+	return c.output(fnDecrypt, sh, ciphertext)
+}
+
+// output calls the single-part operation fn, such as C_Sign, on input, first
+// for the length of its output, and then for the output.
+func (c *Ctx) output(fn int, sh SessionHandle, input []byte) ([]byte, error) {
+	n := new(uint)
+	if err := c.call(fn, uintptr(sh), uintptr(bytesPointer(input)), uintptr(len(input)), 0, uintptr(unsafe.Pointer(n))); err != nil {
+		return nil, err
+	}
+	out := make([]byte, *n)
+	if err := c.call(fn, uintptr(sh), uintptr(bytesPointer(input)), uintptr(len(input)), uintptr(bytesPointer(out)), uintptr(unsafe.Pointer(n))); err != nil {
+		return nil, err
+	}
+	return out[:*n], nil
+}
+
+// DeriveKey calls C_DeriveKey with the mechanism of m, which holds exactly
+// one.
+func (c *Ctx) DeriveKey(sh SessionHandle, m []*Mechanism, base ObjectHandle, template []*Attribute) (ObjectHandle, error) {
+	attrs := ckAttributes(template)
+	key := new(uint)
+	err := c.call(fnDeriveKey, uintptr(sh), uintptr(unsafe.Pointer(ckMechanismOf(m))), uintptr(base), uintptr(attributesPointer(attrs)), uintptr(len(attrs)), uintptr(unsafe.Pointer(key)))
+	return ObjectHandle(*key), err
+}
+
+// padded returns the blank padded string s.
+func padded(s []byte) string {
+	return strings.TrimRight(string(s), " ")
+}
+
+func ckBool(b bool) uintptr {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bytesPointer returns a pointer to the first byte of b, or nil if b is empty.
+func bytesPointer(b []byte) unsafe.Pointer {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&b[0])
+}
+
+func ckAttributes(a []*Attribute) []ckAttribute {
+	attrs := make([]ckAttribute, len(a))
+	for i, attr := range a {
+		attrs[i] = ckAttribute{typ: attr.Type, value: bytesPointer(attr.Value), length: uint(len(attr.Value))}
+	}
+	return attrs
+}
+
+// attributesPointer returns a pointer to the first attribute of a, or nil if a
+// is empty.
+func attributesPointer(a []ckAttribute) unsafe.Pointer {
+	if len(a) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&a[0])
+}
+
+// mechanismType returns the mechanism of m, which holds exactly one.
+func mechanismType(m []*Mechanism) uint {
+	if len(m) != 1 {
+		panic("cryptoki: expected exactly one mechanism")
+	}
+	return m[0].Mechanism
+}
+
+// ckMechanismOf returns the CK_MECHANISM of the mechanism of m, which holds
+// exactly one.
+func ckMechanismOf(m []*Mechanism) *ckMechanism {
+	mech := &ckMechanism{mechanism: mechanismType(m)}
+	switch p := m[0].Parameter.(type) {
+	case []byte:
+		mech.parameter, mech.length = bytesPointer(p), uint(len(p))
+	case *PSSParams:
+		params := &ckPSSParams{hashAlg: p.HashAlg, mgf: p.MGF, sLen: p.SaltLength}
+		mech.parameter, mech.length = unsafe.Pointer(params), uint(unsafe.Sizeof(*params))
+	case *OAEPParams:
+		params := &ckOAEPParams{hashAlg: p.HashAlg, mgf: p.MGF, source: p.SourceType, sourceData: bytesPointer(p.SourceData), sourceDataLen: uint(len(p.SourceData))}
+		mech.parameter, mech.length = unsafe.Pointer(params), uint(unsafe.Sizeof(*params))
+	case *ECDH1DeriveParams:
+		params := &ckECDH1DeriveParams{
+			kdf:           p.KDF,
+			sharedDataLen: uint(len(p.SharedData)),
+			sharedData:    bytesPointer(p.SharedData),
+			publicDataLen: uint(len(p.PublicKeyData)),
+			publicData:    bytesPointer(p.PublicKeyData),
+		}
+		mech.parameter, mech.length = unsafe.Pointer(params), uint(unsafe.Sizeof(*params))
+	}
+	return mech
+}
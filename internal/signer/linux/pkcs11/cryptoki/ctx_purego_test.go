@@ -0,0 +1,53 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cgo && (linux || darwin) && (amd64 || arm64)
+// +build !cgo
+// +build linux darwin
+// +build amd64 arm64
+
+package cryptoki
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// TestLayout checks the layout of the structures against their C
+// declarations on 64-bit platforms.
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"sizeof(CK_INFO)", unsafe.Sizeof(ckInfo{}), 88},
+		{"offsetof(CK_INFO, flags)", unsafe.Offsetof(ckInfo{}.flags), 40},
+		{"sizeof(CK_SLOT_INFO)", unsafe.Sizeof(ckSlotInfo{}), 112},
+		{"offsetof(CK_SLOT_INFO, flags)", unsafe.Offsetof(ckSlotInfo{}.flags), 96},
+		{"sizeof(CK_TOKEN_INFO)", unsafe.Sizeof(ckTokenInfo{}), 208},
+		{"offsetof(CK_TOKEN_INFO, flags)", unsafe.Offsetof(ckTokenInfo{}.flags), 96},
+		{"offsetof(CK_TOKEN_INFO, utcTime)", unsafe.Offsetof(ckTokenInfo{}.utcTime), 188},
+		{"sizeof(CK_MECHANISM_INFO)", unsafe.Sizeof(ckMechanismInfo{}), 24},
+		{"sizeof(CK_C_INITIALIZE_ARGS)", unsafe.Sizeof(ckInitializeArgs{}), 48},
+		{"sizeof(CK_ATTRIBUTE)", unsafe.Sizeof(ckAttribute{}), 24},
+		{"sizeof(CK_MECHANISM)", unsafe.Sizeof(ckMechanism{}), 24},
+		{"sizeof(CK_RSA_PKCS_PSS_PARAMS)", unsafe.Sizeof(ckPSSParams{}), 24},
+		{"sizeof(CK_RSA_PKCS_OAEP_PARAMS)", unsafe.Sizeof(ckOAEPParams{}), 40},
+		{"sizeof(CK_ECDH1_DERIVE_PARAMS)", unsafe.Sizeof(ckECDH1DeriveParams{}), 40},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+}
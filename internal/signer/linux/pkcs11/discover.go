@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// p11KitProxyPaths are the usual locations of the p11-kit proxy module, which
+// exposes the slots of every PKCS#11 module registered with p11-kit, as listed
+// by "p11-kit list-modules". Debian derivatives install it in a multiarch
+// directory, including on 32-bit systems, while Alpine installs it in /usr/lib.
+var p11KitProxyPaths = []string{
+	"/usr/lib/x86_64-linux-gnu/p11-kit-proxy.so",
+	"/usr/lib/aarch64-linux-gnu/p11-kit-proxy.so",
+	"/usr/lib/i386-linux-gnu/p11-kit-proxy.so",
+	"/usr/lib/arm-linux-gnueabihf/p11-kit-proxy.so",
+	"/usr/lib64/p11-kit-proxy.so",
+	"/usr/lib/p11-kit-proxy.so",
+	"/usr/local/lib/p11-kit-proxy.so",
+}
+
+// DiscoverModules returns the modules to search when the config does not name
+// one: the p11-kit proxy module, if it is installed.
+func DiscoverModules() ([]string, error) {
+	for _, path := range p11KitProxyPaths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return []string{path}, nil
+		}
+	}
+	return nil, errors.New("no pkcs11 module was specified and the p11-kit proxy module was not found")
+}
+
+// A SlotCertificate is a certificate object found on a token by Certificates.
+type SlotCertificate struct {
+	Slot       uint32            // The ID of the slot holding the token.
+	TokenLabel string            // The label of the token.
+	Label      string            // The label of the certificate object, which the config selects it by.
+	Cert       *x509.Certificate // The certificate.
+}
+
+// Certificates returns the certificate objects that every token of the module
+// shows without logging in. Tools use it to list the certificates to choose
+// from when writing a config.
+func Certificates(pkcs11Module string) ([]SlotCertificate, error) {
+	m, err := openModule(pkcs11Module)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close()
+	slotIDs, err := m.ctx.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+	var certs []SlotCertificate
+	for _, id := range slotIDs {
+		var tokenLabel string
+		if info, err := m.ctx.GetTokenInfo(id); err == nil {
+			tokenLabel = info.Label
+		}
+		session, err := m.openSession(id, nil)
+		if err != nil {
+			continue
+		}
+		objs, err := m.certificates(session, "")
+		m.ctx.CloseSession(session)
+		if err != nil {
+			continue
+		}
+		for _, obj := range objs {
+			certs = append(certs, SlotCertificate{Slot: uint32(id), TokenLabel: tokenLabel, Label: obj.label, Cert: obj.cert})
+		}
+	}
+	return certs, nil
+}
+
+// maxSlotProbes bounds the number of slots searched concurrently.
+const maxSlotProbes = 8
+
+// credFromSlots returns a Key wrapping the first valid certificate with the
+// given label in any slot of the module. The slots are first searched
+// concurrently for the certificate without logging in, so that slow tokens do
+// not add up and a PIN is not tried on tokens that do not hold the
+// certificate. If no slot shows the certificate before logging in, every slot
+// is tried in turn with the PIN.
+func credFromSlots(pkcs11Module string, label string, userPin []byte, eku string, fingerprint string) (_ *Key, err error) {
+	m, err := openModule(pkcs11Module)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			m.close()
+		}
+	}()
+	slotList, err := m.ctx.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+	if len(slotList) == 0 {
+		return nil, errors.New("the module has no slots")
+	}
+	slotIDs := make([]uint32, len(slotList))
+	for i, id := range slotList {
+		slotIDs[i] = uint32(id)
+	}
+	candidates := probeSlots(slotIDs, maxSlotProbes, func(id uint32) bool {
+		return slotHasLeaf(m, id, label, eku, fingerprint)
+	})
+	if len(candidates) == 0 {
+		candidates = slotIDs
+	}
+	var errs []string
+	for _, id := range candidates {
+		k, err := credFromSlot(m, id, label, userPin, eku, fingerprint)
+		if err == nil {
+			return k, nil
+		}
+		errs = append(errs, fmt.Sprintf("slot 0x%x: %v", id, err))
+	}
+	return nil, fmt.Errorf("no slot holds a valid identity: %s", strings.Join(errs, "; "))
+}
+
+// slotHasLeaf reports whether the slot id of m shows a certificate with the
+// given label allowing eku, and with the given fingerprint if not empty,
+// without logging in.
+func slotHasLeaf(m *module, id uint32, label string, eku string, fingerprint string) bool {
+	session, err := m.openSession(uint(id), nil)
+	if err != nil {
+		return false
+	}
+	defer m.ctx.CloseSession(session)
+	_, err = findLeaf(m, session, label, eku, fingerprint)
+	return err == nil
+}
+
+// probeSlots calls probe for each of ids, with at most workers calls in flight
+// at once, and returns the ids for which it returned true, in their original
+// order.
+func probeSlots(ids []uint32, workers int, probe func(id uint32) bool) []uint32 {
+	found := make([]bool, len(ids))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				found[i] = probe(ids[i])
+			}
+		}()
+	}
+	for i := range ids {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var matches []uint32
+	for i, id := range ids {
+		if found[i] {
+			matches = append(matches, id)
+		}
+	}
+	return matches
+}
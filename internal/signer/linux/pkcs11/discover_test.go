@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiscoverModules(t *testing.T) {
+	defer func(paths []string) { p11KitProxyPaths = paths }(p11KitProxyPaths)
+	dir := t.TempDir()
+	proxy := filepath.Join(dir, "p11-kit-proxy.so")
+	if err := os.WriteFile(proxy, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p11KitProxyPaths = []string{filepath.Join(dir, "missing.so"), dir, proxy}
+	got, err := DiscoverModules()
+	if err != nil {
+		t.Fatalf("DiscoverModules: got %v, want nil err", err)
+	}
+	if want := []string{proxy}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverModules: got %v, want %v", got, want)
+	}
+
+	p11KitProxyPaths = []string{filepath.Join(dir, "missing.so")}
+	if _, err := DiscoverModules(); err == nil {
+		t.Error("DiscoverModules: got nil err, want error without a proxy module")
+	}
+}
+
+func TestProbeSlots(t *testing.T) {
+	ids := []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	var inFlight, maxInFlight int32
+	got := probeSlots(ids, 4, func(id uint32) bool {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return id%5 == 3
+	})
+	if want := []uint32{3, 8, 13}; !reflect.DeepEqual(got, want) {
+		t.Errorf("probeSlots: got %v, want %v", got, want)
+	}
+	if maxInFlight > 4 {
+		t.Errorf("probeSlots: got %d probes in flight, want at most 4", maxInFlight)
+	}
+}
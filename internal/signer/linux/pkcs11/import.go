@@ -0,0 +1,153 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// pkcs11Tool is the OpenSC command used to write objects to a token.
+var pkcs11Tool = "pkcs11-tool"
+
+// pinEnv is the environment variable used to pass the user pin to pkcs11Tool,
+// so that it does not appear on its command line.
+const pinEnv = "ECP_PKCS11_PIN"
+
+// pkcs12Objects holds the DER encoded objects of a PKCS#12 file that are
+// written to the token.
+type pkcs12Objects struct {
+	cert       []byte // The leaf certificate.
+	privateKey []byte // The PKCS#1 or SEC 1 private key of the leaf certificate.
+	publicKey  []byte // The PKIX public key of the leaf certificate.
+}
+
+// decodePKCS12 extracts the leaf certificate and its key pair from PKCS#12 data.
+func decodePKCS12(data []byte, password []byte) (*pkcs12Objects, error) {
+	// x/crypto/pkcs12 takes the password as a string.
+	blocks, err := pkcs12.ToPEM(data, string(password))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PKCS#12 data: %w", err)
+	}
+	var privateKey []byte
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		switch block.Type {
+		case "PRIVATE KEY":
+			if privateKey != nil {
+				return nil, errors.New("PKCS#12 data contains more than one private key")
+			}
+			privateKey = block.Bytes
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if privateKey == nil {
+		return nil, errors.New("PKCS#12 data does not contain a private key")
+	}
+	publicKey, err := parsePublicKey(privateKey)
+	if err != nil {
+		zeroize.Bytes(privateKey)
+		return nil, err
+	}
+	// The leaf is the certificate holding the public key of the private key.
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, publicKey) {
+			return &pkcs12Objects{cert: cert.Raw, privateKey: privateKey, publicKey: publicKey}, nil
+		}
+	}
+	zeroize.Bytes(privateKey)
+	return nil, errors.New("PKCS#12 data does not contain a certificate for its private key")
+}
+
+// parsePublicKey returns the PKIX public key of a PKCS#1 or SEC 1 private key.
+func parsePublicKey(der []byte) ([]byte, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return x509.MarshalPKIXPublicKey(&key.PublicKey)
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return x509.MarshalPKIXPublicKey(&key.PublicKey)
+	}
+	return nil, errors.New("unsupported private key type, must be RSA or ECDSA")
+}
+
+// ImportPKCS12Cred imports the leaf certificate and key pair of a PKCS#12 file
+// into the token in the given slot of a pkcs11 module, under label. The objects
+// are written with pkcs11-tool from OpenSC, which must be installed.
+func ImportPKCS12Cred(credPath string, password []byte, pkcs11Module string, slotUint32Str string, label string, userPin []byte) error {
+	data, err := os.ReadFile(credPath)
+	if err != nil {
+		return fmt.Errorf("error reading PKCS#12 file: %w", err)
+	}
+	defer zeroize.Bytes(data)
+	objects, err := decodePKCS12(data, password)
+	if err != nil {
+		return err
+	}
+	defer zeroize.Bytes(objects.privateKey)
+
+	dir, err := os.MkdirTemp("", "ecp-import")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, object := range []struct {
+		kind string
+		der  []byte
+	}{
+		{"cert", objects.cert},
+		{"privkey", objects.privateKey},
+		{"pubkey", objects.publicKey},
+	} {
+		if err := writeObject(dir, object.kind, object.der, pkcs11Module, slotUint32Str, label, userPin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeObject writes a DER encoded object of the given pkcs11-tool type to the token.
+func writeObject(dir, kind string, der []byte, pkcs11Module, slot, label string, userPin []byte) error {
+	path := filepath.Join(dir, kind+".der")
+	if err := os.WriteFile(path, der, 0600); err != nil {
+		return err
+	}
+	// Overwrite the private key before the file is removed.
+	defer os.WriteFile(path, make([]byte, len(der)), 0600)
+
+	cmd := exec.Command(pkcs11Tool, "--module", pkcs11Module, "--slot", slot, "--login", "--pin", "env:"+pinEnv,
+		"--write-object", path, "--type", kind, "--label", label)
+	cmd.Env = append(os.Environ(), pinEnv+"="+string(userPin))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("writing %s object with %s: %w: %s", kind, pkcs11Tool, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCredPath = "../../../../testdata/testcred.p12"
+
+func TestDecodePKCS12(t *testing.T) {
+	data, err := os.ReadFile(testCredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := decodePKCS12(data, []byte("1234"))
+	if err != nil {
+		t.Fatalf("decodePKCS12: got %v, want nil err", err)
+	}
+	cert, err := x509.ParseCertificate(objects.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(cert.RawSubjectPublicKeyInfo), string(objects.publicKey); got != want {
+		t.Errorf("decodePKCS12: public key does not match certificate")
+	}
+}
+
+func TestDecodePKCS12WrongPassword(t *testing.T) {
+	data, err := os.ReadFile(testCredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodePKCS12(data, []byte("wrong")); err == nil {
+		t.Errorf("decodePKCS12: got nil err, want error for wrong password")
+	}
+}
+
+func TestImportPKCS12Cred(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	tool := filepath.Join(dir, "pkcs11-tool")
+	script := "#!/bin/sh\necho \"$ECP_PKCS11_PIN $*\" >> " + log + "\n"
+	if err := os.WriteFile(tool, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { pkcs11Tool = old }(pkcs11Tool)
+	pkcs11Tool = tool
+
+	if err := ImportPKCS12Cred(testCredPath, []byte("1234"), testModule, "0x1", testLabel, []byte(testUserPin)); err != nil {
+		t.Fatalf("ImportPKCS12Cred: got %v, want nil err", err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 pkcs11-tool invocations, got: %q", lines)
+	}
+	for i, kind := range []string{"cert", "privkey", "pubkey"} {
+		if !strings.HasPrefix(lines[i], testUserPin+" ") || !strings.Contains(lines[i], "--type "+kind) {
+			t.Errorf("Expected invocation %d to write %s with the pin in the environment, got: %q", i, kind, lines[i])
+		}
+		if strings.Contains(lines[i], "--pin "+testUserPin) {
+			t.Errorf("Expected pin to be passed through the environment, got: %q", lines[i])
+		}
+	}
+}
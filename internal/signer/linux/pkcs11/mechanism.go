@@ -0,0 +1,193 @@
+// Copyright 2022 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11/cryptoki"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+)
+
+// hashPrefixes are the DigestInfo prefixes of PKCS #1 v1.5 signatures,
+// borrowed from crypto/rsa.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// hashMechanisms are the PKCS#11 mechanisms and MGF1 functions of the hash
+// functions used in RSA-PSS and RSA-OAEP parameters.
+var hashMechanisms = map[crypto.Hash]struct{ hash, mgf uint }{
+	crypto.SHA1:   {cryptoki.CKM_SHA_1, cryptoki.CKG_MGF1_SHA1},
+	crypto.SHA256: {cryptoki.CKM_SHA256, cryptoki.CKG_MGF1_SHA256},
+	crypto.SHA384: {cryptoki.CKM_SHA384, cryptoki.CKG_MGF1_SHA384},
+	crypto.SHA512: {cryptoki.CKM_SHA512, cryptoki.CKG_MGF1_SHA512},
+}
+
+// signMechanism returns the mechanism signing digest with a key whose public
+// key is pub like crypto.Signer, and the data to pass to C_Sign.
+func signMechanism(pub crypto.PublicKey, digest []byte, opts crypto.SignerOpts) (*cryptoki.Mechanism, []byte, error) {
+	if len(digest) == 0 {
+		return nil, nil, errors.New("nothing to sign")
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := pssParams(pub, pssOpts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return cryptoki.NewMechanism(cryptoki.CKM_RSA_PKCS_PSS, params), digest, nil
+		}
+		if opts.HashFunc().Size() != len(digest) {
+			return nil, nil, errors.New("input must be hashed")
+		}
+		prefix, ok := hashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported hash function: %s", opts.HashFunc())
+		}
+		return cryptoki.NewMechanism(cryptoki.CKM_RSA_PKCS, nil), append(append([]byte(nil), prefix...), digest...), nil
+	case *ecdsa.PublicKey:
+		return cryptoki.NewMechanism(cryptoki.CKM_ECDSA, nil), digest, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// pssParams returns the PKCS#11 parameters of an RSA-PSS signature with opts.
+func pssParams(pub *rsa.PublicKey, opts *rsa.PSSOptions) (*cryptoki.PSSParams, error) {
+	m, ok := hashMechanisms[opts.Hash]
+	if !ok || opts.Hash == crypto.SHA1 {
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", opts.Hash)
+	}
+	var saltLength int
+	switch opts.SaltLength {
+	case rsa.PSSSaltLengthAuto:
+		// Same logic as crypto/rsa.
+		saltLength = (pub.N.BitLen()-1+7)/8 - 2 - opts.Hash.Size()
+	case rsa.PSSSaltLengthEqualsHash:
+		saltLength = opts.Hash.Size()
+	default:
+		saltLength = opts.SaltLength
+	}
+	return cryptoki.NewPSSParams(m.hash, m.mgf, uint(saltLength)), nil
+}
+
+// oaepMechanism returns the mechanism decrypting with RSA-OAEP and opts,
+// including its label.
+func oaepMechanism(opts *rsa.OAEPOptions) (*cryptoki.Mechanism, error) {
+	m, ok := hashMechanisms[opts.Hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", opts.Hash)
+	}
+	return cryptoki.NewMechanism(cryptoki.CKM_RSA_PKCS_OAEP, cryptoki.NewOAEPParams(m.hash, m.mgf, cryptoki.CKZ_DATA_SPECIFIED, opts.Label)), nil
+}
+
+// marshalECDSASignature converts the r || s signature returned by CKM_ECDSA
+// into the ASN.1 form returned by crypto.Signer.
+func marshalECDSASignature(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature of length %d", len(sig))
+	}
+	var r, s big.Int
+	r.SetBytes(sig[:len(sig)/2])
+	s.SetBytes(sig[len(sig)/2:])
+	return asn1.Marshal(struct{ R, S *big.Int }{&r, &s})
+}
+
+// keyMechanisms are the mechanisms used with the keys of each Padding.
+var keyMechanisms = map[util.Padding]uint{
+	util.PaddingNone:     cryptoki.CKM_ECDSA,
+	util.PaddingPKCS1v15: cryptoki.CKM_RSA_PKCS,
+	util.PaddingPSS:      cryptoki.CKM_RSA_PKCS_PSS,
+	util.PaddingOAEP:     cryptoki.CKM_RSA_PKCS_OAEP,
+}
+
+// capabilities returns the capabilities of the private key obj on the token in
+// slot, whose public key is pub, from the mechanisms that the token reports
+// with C_GetMechanismList and C_GetMechanismInfo and from the CKA_SIGN and
+// CKA_DECRYPT attributes of the key. PKCS#11 does not report the hash functions
+// allowed in RSA-PSS and RSA-OAEP parameters, so they are taken to be those
+// whose digest mechanisms the token lists. PKCS #1 v1.5 and ECDSA signatures
+// are computed over digests hashed by the caller, so they support every hash
+// function.
+func (m *module) capabilities(slot uint, session cryptoki.SessionHandle, obj cryptoki.ObjectHandle, pub crypto.PublicKey) (util.Capabilities, error) {
+	list, err := m.ctx.GetMechanismList(slot)
+	if err != nil {
+		return util.Capabilities{}, err
+	}
+	listed := make(map[uint]bool, len(list))
+	for _, mech := range list {
+		listed[mech.Mechanism] = true
+	}
+	var bits uint
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		bits = uint(pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		bits = uint(pub.Curve.Params().BitSize)
+	}
+	// supports reports whether the token supports mech with the key for the
+	// operation flag.
+	supports := func(mech uint, flag uint) bool {
+		if !listed[mech] {
+			return false
+		}
+		info, err := m.ctx.GetMechanismInfo(slot, []*cryptoki.Mechanism{cryptoki.NewMechanism(mech, nil)})
+		if err != nil || info.Flags&flag == 0 {
+			return false
+		}
+		return info.MaxKeySize == 0 || info.MinKeySize <= bits && bits <= info.MaxKeySize
+	}
+	canSign := m.keyAllows(session, obj, cryptoki.CKA_SIGN)
+	canDecrypt := m.keyAllows(session, obj, cryptoki.CKA_DECRYPT)
+	return util.ProbeCapabilities(pub, func(alg util.Algorithm) bool {
+		flag := uint(cryptoki.CKF_SIGN)
+		if alg.Decrypt {
+			if !canDecrypt {
+				return false
+			}
+			flag = cryptoki.CKF_DECRYPT
+		} else if !canSign {
+			return false
+		}
+		if !supports(keyMechanisms[alg.Padding], flag) {
+			return false
+		}
+		if alg.Padding == util.PaddingPSS || alg.Padding == util.PaddingOAEP {
+			return listed[hashMechanisms[alg.Hash].hash]
+		}
+		return true
+	}), nil
+}
+
+// keyAllows reports whether the boolean attribute typ of obj is not false.
+// Tokens that cannot read the attribute are taken to allow the operation.
+func (m *module) keyAllows(session cryptoki.SessionHandle, obj cryptoki.ObjectHandle, typ uint) bool {
+	value, err := m.attribute(session, obj, typ)
+	return err != nil || len(value) == 0 || value[0] != 0
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
+package pkcs11
+
+import (
+	"crypto/x509"
+	"errors"
+	"sync"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11/cryptoki"
+)
+
+// A module is a PKCS#11 module loaded by this process. A module is initialized
+// once per process, and C_Finalize ends every session of the process, so a
+// module is shared by the Keys and sessions using it, and only finalized once
+// the last of them is closed.
+type module struct {
+	path  string
+	ctx   *cryptoki.Ctx
+	owned bool // Whether this process initialized the module, rather than another library of the process.
+	refs  int  // Guarded by modulesMu.
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*module)
+)
+
+// openModule returns the module at path, loading and initializing it unless
+// it is already in use. The caller must close the module.
+func openModule(path string) (*module, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if m, ok := modules[path]; ok {
+		m.refs++
+		return m, nil
+	}
+	ctx, err := cryptoki.New(path)
+	if err != nil {
+		return nil, err
+	}
+	owned := true
+	if err := ctx.Initialize(); err != nil {
+		if !errors.Is(err, cryptoki.Error(cryptoki.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+			ctx.Destroy()
+			return nil, err
+		}
+		owned = false
+	}
+	m := &module{path: path, ctx: ctx, owned: owned, refs: 1}
+	modules[path] = m
+	return m, nil
+}
+
+// retain adds a reference to m, which the caller must close.
+func (m *module) retain() {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	m.refs++
+}
+
+// close releases m, and finalizes and unloads the module once it is no longer
+// in use.
+func (m *module) close() error {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+	if m.refs--; m.refs > 0 {
+		return nil
+	}
+	delete(modules, m.path)
+	var err error
+	if m.owned {
+		err = m.ctx.Finalize()
+	}
+	m.ctx.Destroy()
+	return err
+}
+
+// openSession opens a session on the token in slot, logged in with pin unless
+// it is empty.
+func (m *module) openSession(slot uint, pin []byte) (cryptoki.SessionHandle, error) {
+	session, err := m.ctx.OpenSession(slot, cryptoki.CKF_SERIAL_SESSION)
+	if err != nil {
+		return 0, err
+	}
+	if len(pin) == 0 {
+		return session, nil
+	}
+	// The login state is shared by the sessions on the token.
+	if err := m.ctx.Login(session, cryptoki.CKU_USER, pin); err != nil && !errors.Is(err, cryptoki.Error(cryptoki.CKR_USER_ALREADY_LOGGED_IN)) {
+		m.ctx.CloseSession(session)
+		return 0, err
+	}
+	return session, nil
+}
+
+// findObjects returns the objects of the token that match template.
+func (m *module) findObjects(session cryptoki.SessionHandle, template []*cryptoki.Attribute) ([]cryptoki.ObjectHandle, error) {
+	if err := m.ctx.FindObjectsInit(session, template); err != nil {
+		return nil, err
+	}
+	var objs []cryptoki.ObjectHandle
+	for {
+		found, _, err := m.ctx.FindObjects(session, 64)
+		if err != nil {
+			m.ctx.FindObjectsFinal(session)
+			return nil, err
+		}
+		if len(found) == 0 {
+			break
+		}
+		objs = append(objs, found...)
+	}
+	return objs, m.ctx.FindObjectsFinal(session)
+}
+
+// attribute returns the value of the attribute typ of obj.
+func (m *module) attribute(session cryptoki.SessionHandle, obj cryptoki.ObjectHandle, typ uint) ([]byte, error) {
+	attrs, err := m.ctx.GetAttributeValue(session, obj, []*cryptoki.Attribute{cryptoki.NewAttribute(typ, nil)})
+	if err != nil {
+		return nil, err
+	}
+	return attrs[0].Value, nil
+}
+
+// certObject is a certificate object of a token.
+type certObject struct {
+	handle cryptoki.ObjectHandle
+	label  string
+	cert   *x509.Certificate
+}
+
+// certificates returns the X.509 certificate objects of the token with the
+// given label, or every one of them if label is empty. Objects that cannot be
+// parsed are skipped.
+func (m *module) certificates(session cryptoki.SessionHandle, label string) ([]certObject, error) {
+	template := []*cryptoki.Attribute{
+		cryptoki.NewAttribute(cryptoki.CKA_CLASS, cryptoki.CKO_CERTIFICATE),
+		cryptoki.NewAttribute(cryptoki.CKA_CERTIFICATE_TYPE, cryptoki.CKC_X_509),
+	}
+	if label != "" {
+		template = append(template, cryptoki.NewAttribute(cryptoki.CKA_LABEL, label))
+	}
+	objs, err := m.findObjects(session, template)
+	if err != nil {
+		return nil, err
+	}
+	var certs []certObject
+	for _, obj := range objs {
+		attrs, err := m.ctx.GetAttributeValue(session, obj, []*cryptoki.Attribute{
+			cryptoki.NewAttribute(cryptoki.CKA_LABEL, nil),
+			cryptoki.NewAttribute(cryptoki.CKA_VALUE, nil),
+		})
+		if err != nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(attrs[1].Value)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, certObject{handle: obj, label: string(attrs[0].Value), cert: cert})
+	}
+	return certs, nil
+}
@@ -11,25 +11,37 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
 // pkcs11 provides helpers for working with certificates via PKCS#11 APIs
-// provided by go-pkcs11
+// provided by the cryptoki package
 package pkcs11
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/asn1"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/google/go-pkcs11/pkcs11"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11/cryptoki"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
 )
 
 // ParseHexString parses hexadecimal string into uint32
@@ -42,98 +54,308 @@ func ParseHexString(str string) (i uint32, err error) {
 	return uint32(resultUint64), nil
 }
 
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// ErrTokenNotPresent is returned by CheckPresent when the token holding a Key
+// has been removed from its slot.
+var ErrTokenNotPresent = errors.New("token is not present")
+
+// transientErrors are PKCS#11 return values that smartcard middleware reports
+// while the token or its service is still starting up.
+var transientErrors = []string{"CKR_DEVICE_ERROR", "CKR_DEVICE_REMOVED", "CKR_TOKEN_NOT_PRESENT"}
+
+// IsTransient reports whether err is likely to go away when the operation is retried.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, code := range transientErrors {
+		if strings.Contains(err.Error(), code) {
+			return true
+		}
+	}
+	return false
+}
+
+// CredFromModules tries each of the given pkcs11 modules in order and returns
+// a Key wrapping the first valid certificate matching the given slot, label,
+// and optional extended key usage and SHA-256 fingerprint. If no module is given, the modules found by
+// DiscoverModules are used. If the slot is empty, every slot of a module is
+// searched.
+func CredFromModules(pkcs11Modules []string, slotUint32Str string, label string, userPin []byte, eku string, fingerprint string) (*Key, error) {
+	if len(pkcs11Modules) == 0 {
+		modules, err := DiscoverModules()
+		if err != nil {
+			return nil, err
+		}
+		pkcs11Modules = modules
+	}
+	var errs []string
+	for _, pkcs11Module := range pkcs11Modules {
+		var k *Key
+		var err error
+		if slotUint32Str == "" {
+			k, err = credFromSlots(pkcs11Module, label, userPin, eku, fingerprint)
+		} else {
+			k, err = Cred(pkcs11Module, slotUint32Str, label, userPin, eku, fingerprint)
+		}
+		if err == nil {
+			return k, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", pkcs11Module, err))
+	}
+	return nil, fmt.Errorf("no valid identity found in pkcs11 modules: %s", strings.Join(errs, "; "))
+}
+
 // Cred returns a Key wrapping the first valid certificate in the pkcs11 module
-// matching a given slot and label.
-func Cred(pkcs11Module string, slotUint32Str string, label string, userPin string) (*Key, error) {
-	module, err := pkcs11.Open(pkcs11Module)
+// matching a given slot and label. If eku is not empty, certificates that do
+// not allow the named extended key usage are skipped. If fingerprint is not
+// empty, only the certificate with that hex-encoded SHA-256 fingerprint is
+// used.
+func Cred(pkcs11Module string, slotUint32Str string, label string, userPin []byte, eku string, fingerprint string) (*Key, error) {
+	slotUint32, err := ParseHexString(slotUint32Str)
 	if err != nil {
 		return nil, err
 	}
-	slotUint32, err := ParseHexString(slotUint32Str)
+	m, err := openModule(pkcs11Module)
 	if err != nil {
 		return nil, err
 	}
-	kslot, err := module.Slot(slotUint32, pkcs11.Options{PIN: userPin})
+	k, err := credFromSlot(m, slotUint32, label, userPin, eku, fingerprint)
 	if err != nil {
+		m.close()
 		return nil, err
 	}
+	return k, nil
+}
 
-	certs, err := kslot.Objects(pkcs11.Filter{Class: pkcs11.ClassCertificate, Label: label})
+// findLeaf returns the first certificate object with the given label in the
+// token of session that allows the extended key usage eku and has the SHA-256
+// fingerprint fingerprint, if not empty.
+func findLeaf(m *module, session cryptoki.SessionHandle, label string, eku string, fingerprint string) (certObject, error) {
+	certs, err := m.certificates(session, label)
 	if err != nil {
-		return nil, err
+		return certObject{}, err
 	}
 
 	if len(certs) < 1 {
-		return nil, fmt.Errorf("No certificate object was found with label %s.", label)
+		return certObject{}, fmt.Errorf("No certificate object was found with label %s.", label)
 	}
 
-	cert, err := certs[0].Certificate()
-	if err != nil {
-		return nil, err
+	for _, c := range certs {
+		if config.MatchesEKU(c.cert, eku) && config.MatchesFingerprint(c.cert, fingerprint) {
+			return c, nil
+		}
 	}
-	x509, err := cert.X509()
+	if fingerprint != "" {
+		return certObject{}, fmt.Errorf("No certificate object with label %s and SHA-256 fingerprint %s allows extended key usage %s.", label, fingerprint, eku)
+	}
+	return certObject{}, fmt.Errorf("No certificate object with label %s allows extended key usage %s.", label, eku)
+}
+
+// findPrivateKey returns the private key of the certificate object leaf. The
+// private key is the one sharing the CKA_ID of the certificate, as PKCS#11
+// applications link the objects of a key pair, or else one with the given
+// label. Either way, a private key whose public key does not match the one of
+// the certificate is skipped, so that certificates sharing a label are not
+// paired with the wrong key. A key whose public key cannot be read is only
+// used if it is linked to the certificate by CKA_ID, or is the only one with
+// the label.
+func findPrivateKey(m *module, session cryptoki.SessionHandle, leaf certObject, label string) (cryptoki.ObjectHandle, error) {
+	id, _ := m.attribute(session, leaf.handle, cryptoki.CKA_ID)
+	var byID []cryptoki.ObjectHandle
+	if len(id) > 0 {
+		var err error
+		byID, err = m.findObjects(session, []*cryptoki.Attribute{
+			cryptoki.NewAttribute(cryptoki.CKA_CLASS, cryptoki.CKO_PRIVATE_KEY),
+			cryptoki.NewAttribute(cryptoki.CKA_ID, id),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	byLabel, err := m.findObjects(session, []*cryptoki.Attribute{
+		cryptoki.NewAttribute(cryptoki.CKA_CLASS, cryptoki.CKO_PRIVATE_KEY),
+		cryptoki.NewAttribute(cryptoki.CKA_LABEL, label),
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+	var unknown []cryptoki.ObjectHandle
+	for i, obj := range append(byID, byLabel...) {
+		match, known := privateKeyMatches(m, session, obj, leaf.cert.PublicKey)
+		if match {
+			return obj, nil
+		}
+		if !known && (i < len(byID) || len(byLabel) == 1) {
+			unknown = append(unknown, obj)
+		}
 	}
-	var kchain [][]byte
-	kchain = append(kchain, x509.Raw)
+	if len(unknown) > 0 {
+		return unknown[0], nil
+	}
+	if len(byID) == 0 && len(byLabel) == 0 {
+		return 0, fmt.Errorf("No private key object was found with label %s.", label)
+	}
+	return 0, fmt.Errorf("No private key object with label %s or the CKA_ID of the certificate matches its public key.", label)
+}
 
-	pubKeys, err := kslot.Objects(pkcs11.Filter{Class: pkcs11.ClassPublicKey, Label: label})
+// privateKeyMatches reports whether the private key obj is the one of pub.
+// known is false if the public key of obj cannot be read. For RSA keys, the modulus of the private key is compared. For
+// EC keys, the point of the private key is compared if the token exposes it,
+// or else the one of the public key object sharing its CKA_ID.
+func privateKeyMatches(m *module, session cryptoki.SessionHandle, obj cryptoki.ObjectHandle, pub crypto.PublicKey) (match, known bool) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		modulus, err := m.attribute(session, obj, cryptoki.CKA_MODULUS)
+		if err != nil || len(modulus) == 0 {
+			return false, false
+		}
+		return new(big.Int).SetBytes(modulus).Cmp(pub.N) == 0, true
+	case *ecdsa.PublicKey:
+		point, err := m.attribute(session, obj, cryptoki.CKA_EC_POINT)
+		if err != nil || len(point) == 0 {
+			point, err = publicKeyPoint(m, session, obj)
+			if err != nil || len(point) == 0 {
+				return false, false
+			}
+		}
+		return ecPointMatches(point, pub), true
+	default:
+		return false, false
+	}
+}
+
+// publicKeyPoint returns the CKA_EC_POINT of the public key object sharing the
+// CKA_ID of the private key obj.
+func publicKeyPoint(m *module, session cryptoki.SessionHandle, obj cryptoki.ObjectHandle) ([]byte, error) {
+	id, err := m.attribute(session, obj, cryptoki.CKA_ID)
+	if err != nil || len(id) == 0 {
+		return nil, errors.New("the private key has no CKA_ID")
+	}
+	pubKeys, err := m.findObjects(session, []*cryptoki.Attribute{
+		cryptoki.NewAttribute(cryptoki.CKA_CLASS, cryptoki.CKO_PUBLIC_KEY),
+		cryptoki.NewAttribute(cryptoki.CKA_ID, id),
+	})
 	if err != nil {
 		return nil, err
 	}
+	if len(pubKeys) != 1 {
+		return nil, fmt.Errorf("found %d public keys with the CKA_ID of the private key", len(pubKeys))
+	}
+	return m.attribute(session, pubKeys[0], cryptoki.CKA_EC_POINT)
+}
 
-	if len(pubKeys) < 1 {
-		return nil, fmt.Errorf("No public key object was found with label %s.", label)
+// ecPointMatches reports whether point, the CKA_EC_POINT of a key, is the
+// point of pub. PKCS#11 specifies a DER encoded OCTET STRING holding the
+// uncompressed point, but some tokens omit the OCTET STRING.
+func ecPointMatches(point []byte, pub *ecdsa.PublicKey) bool {
+	want := elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	if bytes.Equal(point, want) {
+		return true
 	}
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) != 0 {
+		return false
+	}
+	return bytes.Equal(raw, want)
+}
 
-	pubKey, err := pubKeys[0].PublicKey()
+// credFromSlot returns a Key wrapping the first valid certificate in the slot
+// slotUint32 of the open module m. The returned Key owns m, which the caller
+// must close if an error is returned.
+func credFromSlot(m *module, slotUint32 uint32, label string, userPin []byte, eku string, fingerprint string) (_ *Key, err error) {
+	session, err := m.openSession(uint(slotUint32), userPin)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			m.ctx.CloseSession(session)
+		}
+	}()
 
-	privkeys, err := kslot.Objects(pkcs11.Filter{Class: pkcs11.ClassPrivateKey, Label: label})
+	leafObj, err := findLeaf(m, session, label, eku, fingerprint)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(privkeys) < 1 {
-		return nil, fmt.Errorf("No private key object was found with label %s.", label)
+	leaf := leafObj.cert
+	switch leaf.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", leaf.PublicKey)
 	}
 
-	privKey, err := privkeys[0].PrivateKey(pubKey)
+	privKey, err := findPrivateKey(m, session, leafObj, label)
 	if err != nil {
 		return nil, err
 	}
-	ksigner, ok := privKey.(crypto.Signer)
-	if !ok {
-		return nil, errors.New("PrivateKey does not implement crypto.Signer")
+	alwaysAuthenticate, err := m.attribute(session, privKey, cryptoki.CKA_ALWAYS_AUTHENTICATE)
+	if errors.Is(err, cryptoki.Error(cryptoki.CKR_ATTRIBUTE_TYPE_INVALID)) {
+		// Tokens that do not know the attribute do not require the login.
+		alwaysAuthenticate, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CKA_ALWAYS_AUTHENTICATE: %w", err)
+	}
+	capabilities, err := m.capabilities(uint(slotUint32), session, privKey, leaf.PublicKey)
+	if err != nil {
+		// Tokens that do not list their mechanisms are taken to support
+		// the ones that every token supports.
+		capabilities = util.KeyCapabilities(leaf.PublicKey, util.SignHashes, defaultDecryptHashes(leaf.PublicKey))
+	}
+	tokenInfo := TokenInfo{Module: m.path, Slot: slotUint32}
+	if info, err := m.ctx.GetInfo(); err == nil {
+		tokenInfo.Manufacturer = info.ManufacturerID
+	}
+	if info, err := m.ctx.GetTokenInfo(uint(slotUint32)); err == nil {
+		tokenInfo.Label = info.Label
+		tokenInfo.Serial = info.SerialNumber
 	}
-	kdecrypter, _ := privKey.(crypto.Decrypter)
-	defaultHash := crypto.SHA256
 	return &Key{
-		slot:      kslot,
-		signer:    ksigner,
-		chain:     kchain,
-		privKey:   privKey,
-		label:     label,
-		module:    *module,
-		hash:      defaultHash,
-		decrypter: kdecrypter,
+		module:             m,
+		slotID:             slotUint32,
+		session:            session,
+		privKey:            privKey,
+		pub:                leaf.PublicKey,
+		chain:              [][]byte{leaf.Raw},
+		label:              label,
+		alwaysAuthenticate: len(alwaysAuthenticate) > 0 && alwaysAuthenticate[0] != 0,
+		tokenInfo:          tokenInfo,
+		capabilities:       capabilities,
 	}, nil
 }
 
+// TokenInfo describes the token and module holding a Key.
+type TokenInfo struct {
+	Label        string // The token label.
+	Serial       string // The token serial number.
+	Slot         uint32 // The ID of the slot holding the token.
+	Module       string // The path to the pkcs11 module.
+	Manufacturer string // The manufacturer of the pkcs11 module.
+}
+
 // Key is a wrapper around the pkcs11 module and uses it to
 // implement signing-related methods.
 type Key struct {
-	slot      *pkcs11.Slot
-	signer    crypto.Signer
-	chain     [][]byte
-	privKey   crypto.PrivateKey
-	label     string
-	module    pkcs11.Module
-	hash      crypto.Hash
-	decrypter crypto.Decrypter
+	module             *module
+	slotID             uint32
+	session            cryptoki.SessionHandle
+	privKey            cryptoki.ObjectHandle
+	pub                crypto.PublicKey
+	chain              [][]byte
+	label              string
+	alwaysAuthenticate bool // Whether the token requires the user pin before each operation with the key.
+	tokenInfo          TokenInfo
+	capabilities       util.Capabilities
+	pinSource          func() ([]byte, error)
+
+	sessionMu sync.Mutex   // Serializes the operations of the session, which runs one at a time.
+	mu        sync.RWMutex // Held for reading by operations and for writing by Close.
+	closed    bool
+	closeErr  error
 }
 
 // CertificateChain returns the credential as a raw X509 cert chain. This
@@ -142,33 +364,184 @@ func (k *Key) CertificateChain() [][]byte {
 	return k.chain
 }
 
-// Close releases resources held by the credential.
-func (k *Key) Close() {
-	k.slot.Close()
-	k.module.Close()
+// TokenInfo returns information about the token and module holding this Key.
+func (k *Key) TokenInfo() TokenInfo {
+	return k.tokenInfo
+}
+
+// Reload returns a Key wrapping the first valid certificate matching the given
+// label, extended key usage and fingerprint in the slot of k, such as a renewed
+// certificate. It uses the module already loaded for k, which stays in use
+// until both Keys are closed, rather than loading and initializing it again.
+func (k *Key) Reload(label string, userPin []byte, eku string, fingerprint string) (*Key, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	k.module.retain()
+	nk, err := credFromSlot(k.module, k.slotID, label, userPin, eku, fingerprint)
+	if err != nil {
+		k.module.close()
+		return nil, err
+	}
+	return nk, nil
+}
+
+// CheckPresent returns ErrTokenNotPresent if the token holding the key is no
+// longer in its slot, or has been replaced by a token with another serial
+// number.
+func (k *Key) CheckPresent() error {
+	if err := k.rlock(); err != nil {
+		return err
+	}
+	defer k.mu.RUnlock()
+	slotInfo, err := k.module.ctx.GetSlotInfo(uint(k.slotID))
+	if err != nil {
+		return err
+	}
+	if slotInfo.Flags&cryptoki.CKF_TOKEN_PRESENT == 0 {
+		return ErrTokenNotPresent
+	}
+	info, err := k.module.ctx.GetTokenInfo(uint(k.slotID))
+	if errors.Is(err, cryptoki.Error(cryptoki.CKR_TOKEN_NOT_PRESENT)) {
+		return ErrTokenNotPresent
+	}
+	if err != nil {
+		return err
+	}
+	if k.tokenInfo.Serial != "" && info.SerialNumber != k.tokenInfo.Serial {
+		return ErrTokenNotPresent
+	}
+	return nil
+}
+
+// AlwaysAuthenticate reports whether the token requires the user pin before
+// each signature with the key, because its CKA_ALWAYS_AUTHENTICATE attribute
+// is set.
+func (k *Key) AlwaysAuthenticate() bool {
+	return k.alwaysAuthenticate
+}
+
+// SetPINSource sets the function returning the user pin that Sign, Decrypt and
+// KeyAgreement log in with before each operation if AlwaysAuthenticate is
+// true. The pin is returned in a new buffer, which is zeroed once logged in
+// with.
+func (k *Key) SetPINSource(pinSource func() ([]byte, error)) {
+	k.pinSource = pinSource
+}
+
+// Close releases resources held by the credential. It waits for the
+// operations in progress, and is safe to call more than once; later calls
+// return the result of the first one.
+func (k *Key) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return k.closeErr
+	}
+	k.closed = true
+	err := k.module.ctx.CloseSession(k.session)
+	if merr := k.module.close(); err == nil {
+		err = merr
+	}
+	k.closeErr = err
+	return err
+}
+
+// rlock locks k for an operation, or returns ErrKeyClosed if k has been
+// closed. The caller must call k.mu.RUnlock if it returns nil.
+func (k *Key) rlock() error {
+	k.mu.RLock()
+	if k.closed {
+		k.mu.RUnlock()
+		return ErrKeyClosed
+	}
+	return nil
 }
 
 // Public returns the corresponding public key for this Key.
 func (k *Key) Public() crypto.PublicKey {
-	return k.signer.Public()
+	return k.pub
+}
+
+// contextPIN returns the user pin to log in with before an operation with the
+// key, if the token requires it.
+func (k *Key) contextPIN() ([]byte, error) {
+	if !k.alwaysAuthenticate {
+		return nil, nil
+	}
+	if k.pinSource == nil {
+		return nil, errors.New("the key requires the user pin before each operation, but none is configured")
+	}
+	pin, err := k.pinSource()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the user pin: %w", err)
+	}
+	return pin, nil
+}
+
+// contextLogin logs in with pin after the initialization of an operation if
+// the token requires it. If the login fails, finish is called to end the
+// operation, which fails without it.
+func (k *Key) contextLogin(pin []byte, finish func()) error {
+	if !k.alwaysAuthenticate {
+		return nil
+	}
+	if err := k.module.ctx.Login(k.session, cryptoki.CKU_CONTEXT_SPECIFIC, pin); err != nil {
+		finish()
+		return err
+	}
+	return nil
 }
 
 // Sign signs a message.
 func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	return k.signer.Sign(nil, digest, opts)
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	mechanism, data, err := signMechanism(k.pub, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := k.contextPIN()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize.Bytes(pin)
+
+	k.sessionMu.Lock()
+	defer k.sessionMu.Unlock()
+	if err := k.module.ctx.SignInit(k.session, []*cryptoki.Mechanism{mechanism}, k.privKey); err != nil {
+		return nil, err
+	}
+	if err := k.contextLogin(pin, func() { k.module.ctx.Sign(k.session, data) }); err != nil {
+		return nil, err
+	}
+	sig, err := k.module.ctx.Sign(k.session, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
+		return marshalECDSASignature(sig)
+	}
+	return sig, nil
 }
 
 // Encrypt encrypts a plaintext message digest using the public key. Here, we use standard golang API.
 func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
-	if hash, ok := opts.(crypto.Hash); ok {
-		k.hash = hash
-	} else {
-		return nil, fmt.Errorf("Unsupported encrypt opts: %v", opts)
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	hash, label, err := util.EncryptOAEPOptions(opts)
+	if err != nil {
+		return nil, err
 	}
 	publicKey := k.Public()
 	_, ok := publicKey.(*rsa.PublicKey)
 	if ok {
-		return k.encryptRSA(plaintext)
+		return k.encryptRSA(plaintext, hash, label)
 	}
 	_, ok = publicKey.(*ecdsa.PublicKey)
 	if ok {
@@ -180,18 +553,18 @@ func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
 
 // Decrypt decrypts a ciphertext message digest using the private key. Here, we pass off the decryption to pkcs11 library.
 func (k *Key) Decrypt(msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
-	if oaepOpts, ok := opts.(*rsa.OAEPOptions); ok {
-		k.hash = oaepOpts.Hash
-	} else {
-		return nil, fmt.Errorf("Unsupported DecrypterOpts: %v", opts)
+	if err := k.rlock(); err != nil {
+		return nil, err
 	}
-	if k.decrypter == nil {
-		return nil, fmt.Errorf("decrypt error: Decrypter is nil")
+	defer k.mu.RUnlock()
+	oaepOpts, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported DecrypterOpts: %v", opts)
 	}
 	publicKey := k.Public()
-	_, ok := publicKey.(*rsa.PublicKey)
+	_, ok = publicKey.(*rsa.PublicKey)
 	if ok {
-		return k.decryptRSAWithPKCS11(msg)
+		return k.decryptRSA(msg, oaepOpts)
 	}
 	_, ok = publicKey.(*ecdsa.PublicKey)
 	if ok {
@@ -201,19 +574,125 @@ func (k *Key) Decrypt(msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
 	return nil, errors.New("decrypt error: Unsupported key type")
 }
 
-func (k *Key) encryptRSA(data []byte) ([]byte, error) {
+// Capabilities returns the algorithms that the token supports with the key, as
+// reported by the token when the Key was created.
+func (k *Key) Capabilities() util.Capabilities {
+	return k.capabilities
+}
+
+// defaultDecryptHashes returns the RSA-OAEP hash functions assumed for keys
+// whose public key is pub on tokens that do not list their mechanisms, or nil
+// if the key cannot decrypt.
+func defaultDecryptHashes(pub crypto.PublicKey) []crypto.Hash {
+	if _, ok := pub.(*rsa.PublicKey); !ok {
+		return nil
+	}
+	return util.DecryptHashes
+}
+
+// WrapKey encrypts a symmetric key with the RSA public key using RSA-OAEP and
+// the given hash function. The token is not involved, since wrapping with
+// CKM_AES_KEY_WRAP would require an AES key object on the token.
+func (k *Key) WrapKey(key []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Encrypt(key, hash)
+}
+
+// UnwrapKey decrypts a symmetric key wrapped by WrapKey using the private key
+// on the token.
+func (k *Key) UnwrapKey(wrappedKey []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Decrypt(wrappedKey, &rsa.OAEPOptions{Hash: hash})
+}
+
+// KeyAgreement returns the ECDH shared secret of the private key on the token
+// and peer, the X coordinate of the shared point, derived with
+// CKM_ECDH1_DERIVE as a temporary session object. It logs in first if the
+// token requires it.
+func (k *Key) KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	pub, ok := k.pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key agreement is only supported with EC keys, got %T", k.pub)
+	}
+	point := elliptic.Marshal(peer.Curve, peer.X, peer.Y)
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	mechanism := cryptoki.NewMechanism(cryptoki.CKM_ECDH1_DERIVE, cryptoki.NewECDH1DeriveParams(cryptoki.CKD_NULL, nil, point))
+	template := []*cryptoki.Attribute{
+		cryptoki.NewAttribute(cryptoki.CKA_CLASS, cryptoki.CKO_SECRET_KEY),
+		cryptoki.NewAttribute(cryptoki.CKA_KEY_TYPE, cryptoki.CKK_GENERIC_SECRET),
+		cryptoki.NewAttribute(cryptoki.CKA_TOKEN, false),
+		cryptoki.NewAttribute(cryptoki.CKA_SENSITIVE, false),
+		cryptoki.NewAttribute(cryptoki.CKA_EXTRACTABLE, true),
+		cryptoki.NewAttribute(cryptoki.CKA_VALUE_LEN, size),
+	}
+	pin, err := k.contextPIN()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize.Bytes(pin)
+
+	k.sessionMu.Lock()
+	defer k.sessionMu.Unlock()
+	// C_DeriveKey is a single call without an initialization, so the login
+	// directly precedes it and there is no operation to finish on failure.
+	if err := k.contextLogin(pin, func() {}); err != nil {
+		return nil, err
+	}
+	derived, err := k.module.ctx.DeriveKey(k.session, []*cryptoki.Mechanism{mechanism}, k.privKey, template)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := k.module.attribute(k.session, derived, cryptoki.CKA_VALUE)
+	if derr := k.module.ctx.DestroyObject(k.session, derived); err == nil {
+		err = derr
+	}
+	if err == nil && len(secret) != size {
+		err = fmt.Errorf("expected a shared secret of length %d, got %d", size, len(secret))
+	}
+	if err != nil {
+		zeroize.Bytes(secret)
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (k *Key) encryptRSA(data []byte, hash crypto.Hash, label []byte) ([]byte, error) {
 	publicKey := k.Public()
 	rsaPubKey := publicKey.(*rsa.PublicKey)
-	hash, err := cryptoHashToHash(k.hash)
+	h, err := cryptoHashToHash(hash)
 	if err != nil {
 		return nil, err
 	}
-	return rsa.EncryptOAEP(hash, rand.Reader, rsaPubKey, data, nil)
+	return rsa.EncryptOAEP(h, rand.Reader, rsaPubKey, data, label)
 }
 
-func (k *Key) decryptRSAWithPKCS11(encryptedData []byte) ([]byte, error) {
-	opts := &rsa.OAEPOptions{Hash: k.hash}
-	return k.decrypter.Decrypt(nil, encryptedData, opts)
+// decryptRSA decrypts with RSA-OAEP and opts on the token, logging in first if
+// the token requires it.
+func (k *Key) decryptRSA(encryptedData []byte, opts *rsa.OAEPOptions) ([]byte, error) {
+	if len(encryptedData) == 0 {
+		return nil, errors.New("empty ciphertext")
+	}
+	mechanism, err := oaepMechanism(opts)
+	if err != nil {
+		return nil, err
+	}
+	pin, err := k.contextPIN()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize.Bytes(pin)
+
+	k.sessionMu.Lock()
+	defer k.sessionMu.Unlock()
+	if err := k.module.ctx.DecryptInit(k.session, []*cryptoki.Mechanism{mechanism}, k.privKey); err != nil {
+		return nil, err
+	}
+	if err := k.contextLogin(pin, func() { k.module.ctx.Decrypt(k.session, encryptedData) }); err != nil {
+		return nil, err
+	}
+	return k.module.ctx.Decrypt(k.session, encryptedData)
 }
 
 func cryptoHashToHash(hash crypto.Hash) (hash.Hash, error) {
@@ -11,26 +11,38 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
 package pkcs11
 
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
 	"flag"
 	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
 )
 
 const (
 	testModule  = "/usr/lib/softhsm/libsofthsm2.so"
 	testLabel   = "Demo Object"
 	testUserPin = "0000"
+	testECLabel = "Demo EC Object"
 )
 
 var testSlot = flag.String("testSlot", "", "libsofthsm2 slot location")
 
 func makeTestKey() (*Key, error) {
-	key, err := Cred(testModule, *testSlot, testLabel, testUserPin)
+	key, err := Cred(testModule, *testSlot, testLabel, []byte(testUserPin), "", "")
 	return key, err
 }
 
@@ -52,6 +64,23 @@ func TestParseHexStringFailure(t *testing.T) {
 	}
 }
 
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: errors.New("pkcs11: C_OpenSession() CKR_DEVICE_ERROR"), want: true},
+		{err: errors.New("pkcs11: C_GetSlotInfo() CKR_TOKEN_NOT_PRESENT"), want: true},
+		{err: errors.New("pkcs11: C_Login() CKR_PIN_INCORRECT"), want: false},
+	}
+	for _, test := range tests {
+		if got := IsTransient(test.err); got != test.want {
+			t.Errorf("IsTransient(%v): got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
 func TestCredLinux(t *testing.T) {
 	key, err := makeTestKey()
 	if err != nil {
@@ -60,6 +89,47 @@ func TestCredLinux(t *testing.T) {
 	defer key.Close()
 }
 
+func TestClose(t *testing.T) {
+	key, err := makeTestKey()
+	if err != nil {
+		t.Fatalf("Cred error: %q", err)
+	}
+	if err := key.Close(); err != nil {
+		t.Errorf("Close error: %v", err)
+	}
+	if err := key.Close(); err != nil {
+		t.Errorf("Close error on second call: %v", err)
+	}
+	if _, err := key.Sign(nil, make([]byte, 32), crypto.SHA256); !errors.Is(err, ErrKeyClosed) {
+		t.Errorf("Sign after Close: got %v, want ErrKeyClosed", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	key, err := makeTestKey()
+	if err != nil {
+		t.Fatalf("Cred error: %q", err)
+	}
+	sigtest.TestKey(t, key, &sigtest.Options{ErrClosed: ErrKeyClosed})
+}
+
+func TestCredFromModulesFallback(t *testing.T) {
+	key, err := CredFromModules([]string{"/nonexistent/libpkcs11.so", testModule}, *testSlot, testLabel, []byte(testUserPin), "", "")
+	if err != nil {
+		t.Fatalf("CredFromModules error: %q", err)
+	}
+	defer key.Close()
+}
+
+func TestCredFromModulesEmpty(t *testing.T) {
+	defer func(paths []string) { p11KitProxyPaths = paths }(p11KitProxyPaths)
+	p11KitProxyPaths = nil
+	_, err := CredFromModules(nil, *testSlot, testLabel, []byte(testUserPin), "", "")
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
 func BenchmarkEncryptRSA(b *testing.B) {
 	msg := "Plain text to encrypt"
 	bMsg := []byte(msg)
@@ -71,7 +141,7 @@ func BenchmarkEncryptRSA(b *testing.B) {
 	defer key.Close()
 	b.Run("encryptRSA Crypto", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			_, errEncrypt := key.encryptRSA(bMsg)
+			_, errEncrypt := key.encryptRSA(bMsg, crypto.SHA256, nil)
 			if errEncrypt != nil {
 				b.Errorf("EncryptRSA error: %q", errEncrypt)
 				return
@@ -118,3 +188,126 @@ func TestDecrypt(t *testing.T) {
 		t.Errorf("Decrypt error: expected %q, got %q", msg, string(decrypted))
 	}
 }
+
+func TestDecryptWithLabel(t *testing.T) {
+	key, errCred := makeTestKey()
+	if errCred != nil {
+		t.Errorf("Cred error: %q", errCred)
+		return
+	}
+	defer key.Close()
+	msg := "Plain text to encrypt"
+	// Softhsm only supports SHA1
+	opts := &rsa.OAEPOptions{Hash: crypto.SHA1, Label: []byte("label")}
+	ciphertext, err := key.Encrypt([]byte(msg), opts)
+	if err != nil {
+		t.Fatalf("Encrypt error: %v", err)
+	}
+	decrypted, err := key.Decrypt(ciphertext, opts)
+	if err != nil {
+		t.Fatalf("Decrypt error: %v", err)
+	}
+	if string(decrypted) != msg {
+		t.Errorf("Decrypt error: expected %q, got %q", msg, string(decrypted))
+	}
+	if _, err := key.Decrypt(ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA1, Label: []byte("other")}); err == nil {
+		t.Error("Decrypt with another label: got nil err, want error")
+	}
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	key, errCred := makeTestKey()
+	if errCred != nil {
+		t.Errorf("Cred error: %q", errCred)
+		return
+	}
+	defer key.Close()
+	dataKey := []byte("0123456789abcdef0123456789abcdef")
+	// Softhsm only supports SHA1
+	wrappedKey, err := key.WrapKey(dataKey, crypto.SHA1)
+	if err != nil {
+		t.Fatalf("WrapKey error: %v", err)
+	}
+	unwrappedKey, err := key.UnwrapKey(wrappedKey, crypto.SHA1)
+	if err != nil {
+		t.Fatalf("UnwrapKey error: %v", err)
+	}
+	if !bytes.Equal(bytes.Trim(unwrappedKey, "\x00"), dataKey) {
+		t.Errorf("UnwrapKey error: expected %x, got %x", dataKey, unwrappedKey)
+	}
+}
+
+func TestKeyAgreement(t *testing.T) {
+	key, err := Cred(testModule, *testSlot, testECLabel, []byte(testUserPin), "", "")
+	if err != nil {
+		t.Fatalf("Cred error: %q", err)
+	}
+	defer key.Close()
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := key.KeyAgreement(&peer.PublicKey)
+	if err != nil {
+		t.Fatalf("KeyAgreement error: %v", err)
+	}
+	pub := key.Public().(*ecdsa.PublicKey)
+	x, _ := elliptic.P256().ScalarMult(pub.X, pub.Y, peer.D.Bytes())
+	if want := x.FillBytes(make([]byte, 32)); !bytes.Equal(secret, want) {
+		t.Errorf("KeyAgreement error: expected %x, got %x", want, secret)
+	}
+}
+
+func TestKeyAgreementContextLogin(t *testing.T) {
+	key, err := Cred(testModule, *testSlot, testECLabel, []byte(testUserPin), "", "")
+	if err != nil {
+		t.Fatalf("Cred error: %q", err)
+	}
+	defer key.Close()
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SoftHSM does not mark keys as always authenticate, so the key is made to
+	// require the user pin before each operation.
+	key.alwaysAuthenticate = true
+	if _, err := key.KeyAgreement(&peer.PublicKey); err == nil {
+		t.Error("KeyAgreement without a pin source: got nil err, want error")
+	}
+	errPIN := errors.New("no pin")
+	key.SetPINSource(func() ([]byte, error) { return nil, errPIN })
+	if _, err := key.KeyAgreement(&peer.PublicKey); !errors.Is(err, errPIN) {
+		t.Errorf("KeyAgreement with a failing pin source: got %v, want %v", err, errPIN)
+	}
+}
+
+func TestECPointMatches(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := elliptic.Marshal(key.Curve, key.X, key.Y)
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		point []byte
+		want  bool
+	}{
+		{name: "DER", point: der, want: true},
+		{name: "raw", point: raw, want: true},
+		{name: "trailing data", point: append(der, 0), want: false},
+		{name: "other key", point: elliptic.Marshal(other.Curve, other.X, other.Y), want: false},
+	}
+	for _, test := range tests {
+		if got := ecPointMatches(test.point, &key.PublicKey); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
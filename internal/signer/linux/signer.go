@@ -11,149 +11,169 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
 // Signer.go is a net/rpc server that listens on stdin/stdout, exposing
-// methods that perform device certificate signing for Linux using PKCS11
-// shared library.
+// methods that perform device certificate signing for Linux, FreeBSD and
+// OpenBSD using PKCS11 shared library.
 // This server is intended to be launched as a subprocess by the signer client,
 // and should not be launched manually as a stand-alone process.
 package main
 
 import (
-	"crypto"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/gob"
-	"io"
-	"log"
-	"net/rpc"
-	"os"
-	"time"
+	"errors"
+	"fmt"
 
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
 )
 
-// If ECP Logging is enabled return true
-// Otherwise return false
-func enableECPLogging() bool {
-	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
-		return true
-	}
-
-	log.SetOutput(io.Discard)
-	return false
-}
-
-func init() {
-	gob.Register(crypto.SHA256)
-	gob.Register(crypto.SHA384)
-	gob.Register(crypto.SHA512)
-	gob.Register(&rsa.PSSOptions{})
-	gob.Register(&rsa.OAEPOptions{})
-}
-
-// SignArgs contains arguments for a Sign API call.
-type SignArgs struct {
-	Digest []byte            // The content to sign.
-	Opts   crypto.SignerOpts // Options for signing. Must implement HashFunc().
-}
-
-// EncryptArgs contains arguments for an Encrypt API call.
-type EncryptArgs struct {
-	Plaintext []byte // The plaintext to encrypt.
-	Opts      any    // Options for encryption. Ex: an instance of crypto.Hash.
-}
+// backend opens the credentials of PKCS#11 tokens.
+type backend struct{}
 
-// DecryptArgs contains arguments to for a Decrypt API call.
-type DecryptArgs struct {
-	Ciphertext []byte               // The ciphertext to decrypt.
-	Opts       crypto.DecrypterOpts // Options for decryption. Ex: an instance of *rsa.OAEPOptions.
+func (backend) Name() string {
+	return "pkcs11"
 }
 
-// A EnterpriseCertSigner exports RPC methods for signing.
-type EnterpriseCertSigner struct {
-	key *pkcs11.Key
+// IsTransient reports whether err is a transient failure of the keystore.
+func (backend) IsTransient(err error) bool {
+	return pkcs11.IsTransient(err)
 }
 
-// A Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
-type Connection struct {
-	io.ReadCloser
-	io.WriteCloser
+// Open returns the credential described by config, loaded from
+// configFilePath, retrying transient errors as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	return open(config, func(pin []byte) (*pkcs11.Key, error) {
+		p11 := config.CertConfigs.PKCS11
+		return pkcs11.CredFromModules(p11.PKCS11Module, p11.Slot, p11.Label, pin, p11.EKU, p11.Fingerprint)
+	})
 }
 
-// Close closes c's underlying ReadCloser and WriteCloser.
-func (c *Connection) Close() error {
-	rerr := c.ReadCloser.Close()
-	werr := c.WriteCloser.Close()
-	if rerr != nil {
-		return rerr
+// open returns the credential described by config that cred finds with the
+// user PIN, once resolved, retrying transient errors as configured.
+func open(config *config.EnterpriseCertificateConfig, cred func(pin []byte) (*pkcs11.Key, error)) (server.Key, error) {
+	pinRef := config.CertConfigs.PKCS11.UserPin
+	pin, err := resolvePIN(pinRef)
+	if err != nil {
+		return nil, err
 	}
-	return werr
-}
-
-// CertificateChain returns the credential as a raw X509 cert chain. This
-// contains the public key.
-func (k *EnterpriseCertSigner) CertificateChain(ignored struct{}, certificateChain *[][]byte) (err error) {
-	*certificateChain = k.key.CertificateChain()
-	return nil
+	var key *pkcs11.Key
+	err = util.DoWithRetry(config.Retry, pkcs11.IsTransient, func() (err error) {
+		key, err = cred(pin)
+		return
+	})
+	if err == nil && key.AlwaysAuthenticate() {
+		key.SetPINSource(pinSource(config.CertConfigs.PKCS11.PINCache, pin, pinRef))
+	} else {
+		// The PIN is only needed to log in to the token.
+		zeroize.Bytes(pin)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return credential{key}, nil
 }
 
-// Public returns the corresponding public key for this Key, in ASN.1 DER form.
-func (k *EnterpriseCertSigner) Public(ignored struct{}, publicKey *[]byte) (err error) {
-	*publicKey, err = x509.MarshalPKIXPublicKey(k.key.Public())
-	return
+// resolvePIN returns the user PIN that the user_pin field pinRef holds or
+// references.
+func resolvePIN(pinRef string) ([]byte, error) {
+	pin, err := config.ResolveSecret(pinRef)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11 user_pin: %w", err)
+	}
+	return pin, nil
 }
 
-// Sign signs a message digest. Stores result in "resp".
-func (k *EnterpriseCertSigner) Sign(args SignArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Sign(nil, args.Digest, args.Opts)
-	return
+// pinSource returns the function that a key requiring the user PIN before each
+// signature gets it from. Unless the pin cache policy is "none", the PIN is
+// kept in memory, and a copy of it is returned each time. Otherwise, pin is
+// zeroed, and the secret URI pinRef is resolved again each time.
+func pinSource(policy string, pin []byte, pinRef string) func() ([]byte, error) {
+	if policy != config.PINCacheNone {
+		return func() ([]byte, error) {
+			return append([]byte(nil), pin...), nil
+		}
+	}
+	zeroize.Bytes(pin)
+	return func() ([]byte, error) {
+		return resolvePIN(pinRef)
+	}
 }
 
-// Encrypt encrypts a plaintext msg. Stores result in "resp".
-func (k *EnterpriseCertSigner) Encrypt(args EncryptArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Encrypt(args.Plaintext, args.Opts)
-	return
+// credential is a PKCS#11 key served by the signer.
+type credential struct {
+	*pkcs11.Key
 }
 
-// Decrypt decrypts a ciphertext msg. Stores result in "resp".
-func (k *EnterpriseCertSigner) Decrypt(args DecryptArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Decrypt(args.Ciphertext, args.Opts)
-	return
+// Metadata describes the PKCS#11 token holding the credential.
+func (c credential) Metadata() server.Metadata {
+	tokenInfo := c.TokenInfo()
+	return server.Metadata{
+		KeystoreType: "pkcs11",
+		TokenLabel:   tokenInfo.Label,
+		TokenSerial:  tokenInfo.Serial,
+		Module:       tokenInfo.Module,
+	}
 }
 
-func main() {
-	enableECPLogging()
-	if len(os.Args) != 2 {
-		log.Fatalln("Signer is not meant to be invoked manually, exiting...")
+// Attest returns the attestation of the key, or an empty Attestation if the
+// token does not provide one.
+func (c credential) Attest() (server.Attestation, error) {
+	a, err := c.Attestation()
+	if errors.Is(err, pkcs11.ErrAttestationUnsupported) {
+		return server.Attestation{}, nil
 	}
-	configFilePath := os.Args[1]
-	config, err := util.LoadConfig(configFilePath)
 	if err != nil {
-		log.Fatalf("Failed to load enterprise cert config: %v", err)
+		return server.Attestation{}, err
 	}
+	return server.Attestation{Format: a.Format, Certificates: a.Certificates}, nil
+}
 
-	enterpriseCertSigner := new(EnterpriseCertSigner)
-	enterpriseCertSigner.key, err = pkcs11.Cred(config.CertConfigs.PKCS11.PKCS11Module, config.CertConfigs.PKCS11.Slot, config.CertConfigs.PKCS11.Label, config.CertConfigs.PKCS11.UserPin)
-	if err != nil {
-		log.Fatalf("Failed to initialize enterprise cert signer using pkcs11: %v", err)
+// Reload returns the credential described by config, found through the module
+// and slot of c if config still selects them, so that the module is not loaded
+// again and the slots are not searched.
+func (c credential) Reload(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	if !c.selectedBy(&config.CertConfigs.PKCS11) {
+		return backend{}.Open(config, configFilePath)
 	}
+	return open(config, func(pin []byte) (*pkcs11.Key, error) {
+		p11 := config.CertConfigs.PKCS11
+		return c.Key.Reload(p11.Label, pin, p11.EKU, p11.Fingerprint)
+	})
+}
 
-	if err := rpc.Register(enterpriseCertSigner); err != nil {
-		log.Fatalf("Failed to register enterprise cert signer with net/rpc: %v", err)
+// selectedBy reports whether the module and slot of c are among those that
+// p11 selects.
+func (c credential) selectedBy(p11 *config.PKCS11) bool {
+	tokenInfo := c.TokenInfo()
+	if p11.Slot != "" {
+		if slot, err := pkcs11.ParseHexString(p11.Slot); err != nil || slot != tokenInfo.Slot {
+			return false
+		}
 	}
-
-	// If the parent process dies, we should exit.
-	// We can detect this by periodically checking if the PID of the parent
-	// process is 1 (https://stackoverflow.com/a/2035683).
-	go func() {
-		for {
-			if os.Getppid() == 1 {
-				log.Fatalln("Enterprise cert signer's parent process died, exiting...")
-			}
-			time.Sleep(time.Second)
+	modules := []string(p11.PKCS11Module)
+	if len(modules) == 0 {
+		modules, _ = pkcs11.DiscoverModules()
+	}
+	for _, module := range modules {
+		if module == tokenInfo.Module {
+			return true
 		}
-	}()
+	}
+	return false
+}
+
+// Capabilities describes the algorithms that the PKCS#11 token supports with
+// the credential.
+func (c credential) Capabilities() util.Capabilities {
+	return c.Key.Capabilities()
+}
 
-	rpc.ServeConn(&Connection{os.Stdin, os.Stdout})
+func main() {
+	server.Main(backend{})
 }
@@ -0,0 +1,30 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows || (!cgo && !linux && !darwin) || (!cgo && !amd64 && !arm64)
+// +build windows !cgo,!linux,!darwin !cgo,!amd64,!arm64
+
+// Signer_other.go is built on the platforms that the PKCS#11 signer does not
+// support, so that the package builds on every platform. The signer then
+// reports the unsupported platform and exits.
+package main
+
+import (
+	"runtime"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+)
+
+func main() {
+	startup.Fail(startup.CodeInternal, "The PKCS#11 signer is not supported on %s/%s, it must be built for a platform other than Windows, with cgo unless the platform is linux or darwin on amd64 or arm64", runtime.GOOS, runtime.GOARCH)
+}
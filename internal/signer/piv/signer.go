@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build piv
+// +build piv
+
+// Signer.go is a net/rpc server that listens on stdin/stdout, exposing
+// methods that perform device certificate signing with a YubiKey through its
+// PIV application, without a PKCS#11 module.
+// This server is intended to be launched as a subprocess by the signer client,
+// and should not be launched manually as a stand-alone process.
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/piv/yubikey"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// backend opens the credentials of YubiKeys. The card is held exclusively by
+// the signer, so the previous credential is closed before the certificate
+// chain is refreshed.
+type backend struct{}
+
+func (backend) Name() string {
+	return "PIV"
+}
+
+// IsTransient reports whether err is a transient failure of the keystore.
+func (backend) IsTransient(err error) bool {
+	return yubikey.IsTransient(err)
+}
+
+func (backend) Exclusive() {}
+
+// Open returns the credential described by config, retrying transient errors
+// as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	pin, err := resolvePIN(config.CertConfigs.PIV.PIN)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize.Bytes(pin)
+	var key *yubikey.Key
+	err = util.DoWithRetry(config.Retry, yubikey.IsTransient, func() (err error) {
+		key, err = yubikey.Cred(config.CertConfigs.PIV.Card, config.CertConfigs.PIV.Slot, pin)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credential{key}, nil
+}
+
+// resolvePIN returns the PIV PIN that the pin field pinRef holds or
+// references.
+func resolvePIN(pinRef string) ([]byte, error) {
+	pin, err := config.ResolveSecret(pinRef)
+	if err != nil {
+		return nil, fmt.Errorf("piv pin: %w", err)
+	}
+	return pin, nil
+}
+
+// credential is a YubiKey PIV key served by the signer. Decryption is not
+// served, since PIV cards only implement RSA PKCS #1 v1.5 decryption.
+type credential struct {
+	*yubikey.Key
+}
+
+// Metadata describes the YubiKey holding the credential.
+func (c credential) Metadata() server.Metadata {
+	return server.Metadata{
+		KeystoreType: "piv",
+		TokenLabel:   c.Card(),
+		TokenSerial:  c.Serial(),
+		TouchPolicy:  c.TouchPolicy(),
+	}
+}
+
+// Attest returns the attestation of the key, or an empty Attestation if the
+// card does not provide one.
+func (c credential) Attest() (server.Attestation, error) {
+	a, err := c.Attestation()
+	if errors.Is(err, yubikey.ErrAttestationUnsupported) {
+		return server.Attestation{}, nil
+	}
+	if err != nil {
+		return server.Attestation{}, err
+	}
+	return server.Attestation{Format: a.Format, Certificates: a.Certificates}, nil
+}
+
+// Capabilities describes the algorithms that the PIV key supports. PIV keys do
+// not decrypt through the signer.
+func (c credential) Capabilities() util.Capabilities {
+	return util.KeyCapabilities(c.Public(), util.SignHashes, nil)
+}
+
+func main() {
+	server.Main(backend{})
+}
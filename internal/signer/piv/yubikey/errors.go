@@ -0,0 +1,66 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Touch policies of a PIV key, as reported by its attestation.
+const (
+	TouchPolicyNever  = "never"
+	TouchPolicyAlways = "always"
+	TouchPolicyCached = "cached"
+)
+
+// ErrTouchRequired is returned by Sign when the key requires a touch of the
+// security key and the security key was not touched in time. The client
+// recognizes this error by its message, which must not change.
+var ErrTouchRequired = errors.New("security key touch required")
+
+// ErrCardNotPresent is returned by Cred when no smart card matches the config.
+var ErrCardNotPresent = errors.New("no matching smart card present")
+
+// ErrAttestationUnsupported is returned by Attestation when the card does not
+// attest the key, which is the case for keys imported into the card.
+var ErrAttestationUnsupported = errors.New("the card does not provide attestation data for the key")
+
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// statusSecurityNotSatisfied is the status word returned by the card when an
+// operation lacks the touch or PIN verification the key requires.
+const statusSecurityNotSatisfied = 0x6982
+
+// IsTransient reports whether err is likely to go away when the operation is
+// retried, such as when the security key has not been plugged in yet.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrCardNotPresent)
+}
+
+// touchError returns an error wrapping ErrTouchRequired if err is the card
+// rejecting an operation on a key whose touch policy requires a touch.
+// Otherwise it returns err.
+func touchError(err error, touchPolicy string) error {
+	if err == nil || (touchPolicy != TouchPolicyAlways && touchPolicy != TouchPolicyCached) {
+		return err
+	}
+	var status interface{ Status() uint16 }
+	if errors.As(err, &status) && status.Status() == statusSecurityNotSatisfied {
+		return fmt.Errorf("%w: %v", ErrTouchRequired, err)
+	}
+	return err
+}
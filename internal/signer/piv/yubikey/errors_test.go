@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yubikey
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// statusError mimics the errors go-piv returns for card status words.
+type statusError uint16
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("smart card error %04x", uint16(e))
+}
+
+func (e statusError) Status() uint16 {
+	return uint16(e)
+}
+
+func TestTouchError(t *testing.T) {
+	denied := fmt.Errorf("command failed: %w", statusError(statusSecurityNotSatisfied))
+	tests := []struct {
+		name        string
+		err         error
+		touchPolicy string
+		wantTouch   bool
+	}{
+		{name: "success", touchPolicy: TouchPolicyAlways},
+		{name: "touch always", err: denied, touchPolicy: TouchPolicyAlways, wantTouch: true},
+		{name: "touch cached", err: denied, touchPolicy: TouchPolicyCached, wantTouch: true},
+		{name: "touch never", err: denied, touchPolicy: TouchPolicyNever},
+		{name: "unknown touch policy", err: denied},
+		{name: "other status", err: statusError(0x6a80), touchPolicy: TouchPolicyAlways},
+		{name: "other error", err: errors.New("connection reset"), touchPolicy: TouchPolicyAlways},
+	}
+	for _, test := range tests {
+		err := touchError(test.err, test.touchPolicy)
+		if got := errors.Is(err, ErrTouchRequired); got != test.wantTouch {
+			t.Errorf("%s: touchError(%v) = %v, want touch required %v", test.name, test.err, err, test.wantTouch)
+		}
+		if test.err != nil && err == nil {
+			t.Errorf("%s: touchError(%v) = nil, want an error", test.name, test.err)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !IsTransient(fmt.Errorf("searching slot 9a: %w", ErrCardNotPresent)) {
+		t.Error("IsTransient: got false for ErrCardNotPresent, want true")
+	}
+	if IsTransient(ErrTouchRequired) {
+		t.Error("IsTransient: got true for ErrTouchRequired, want false")
+	}
+}
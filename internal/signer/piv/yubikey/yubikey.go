@@ -0,0 +1,287 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build piv
+// +build piv
+
+// Package yubikey provides access to a certificate and private key on a
+// YubiKey through its PIV application over PC/SC, without a PKCS#11 module.
+package yubikey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+// AttestationFormatPIV is the format of attestations made of a PIV key
+// attestation certificate followed by the device attestation certificate.
+const AttestationFormatPIV = "piv"
+
+// slots maps the names of the PIV slots accepted in the config to the slots.
+var slots = map[string]piv.Slot{
+	"9a": piv.SlotAuthentication,
+	"9c": piv.SlotSignature,
+	"9d": piv.SlotKeyManagement,
+	"9e": piv.SlotCardAuthentication,
+}
+
+// An Attestation is evidence from the card that the key was generated in and
+// cannot be exported from the hardware.
+type Attestation struct {
+	Format       string   // The format of the attestation, AttestationFormatPIV.
+	Certificates [][]byte // The DER encoded attestation certificate chain, leaf first.
+}
+
+// Key is a wrapper around a certificate and private key in a PIV slot of a
+// YubiKey. The card is held open, and thus unavailable to other applications,
+// until the Key is closed.
+type Key struct {
+	mu          sync.Mutex // Serializes commands sent to the card.
+	yk          *piv.YubiKey
+	card        string
+	serial      uint32
+	chain       [][]byte
+	signer      crypto.Signer
+	touchPolicy string
+	attestation *Attestation
+	closeOnce   sync.Once
+	closeErr    error
+	closed      atomic.Bool
+}
+
+// Cred returns a Key wrapping the certificate and private key in the given
+// slot ("9a" if empty) of the first smart card whose name contains card,
+// ignoring case. If card is empty, every card is searched. pin unlocks the key
+// if its PIN policy requires it.
+func Cred(card string, slot string, pin []byte) (*Key, error) {
+	if slot == "" {
+		slot = "9a"
+	}
+	s, ok := slots[slot]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PIV slot %q", slot)
+	}
+	cards, err := piv.Cards()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list smart cards: %w", err)
+	}
+	var errs []string
+	for _, name := range cards {
+		if card != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(card)) {
+			continue
+		}
+		key, err := open(name, s, pin)
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+	}
+	if len(errs) == 0 {
+		return nil, ErrCardNotPresent
+	}
+	return nil, fmt.Errorf("no usable certificate in PIV slot %s: %s", slot, strings.Join(errs, "; "))
+}
+
+// open returns a Key wrapping the certificate and private key in slot of the
+// named card.
+func open(card string, slot piv.Slot, pin []byte) (_ *Key, err error) {
+	yk, err := piv.Open(card)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			yk.Close()
+		}
+	}()
+	cert, err := yk.Certificate(slot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	// piv-go takes the PIN as a string, which it keeps for the operations of
+	// keys whose PIN policy is "always".
+	priv, err := yk.PrivateKey(slot, cert.PublicKey, piv.KeyAuth{PIN: string(pin)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to access private key: %w", err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	serial, err := yk.Serial()
+	if err != nil {
+		// Older YubiKeys do not report their serial number over PIV.
+		serial = 0
+	}
+	k := &Key{
+		yk:     yk,
+		card:   card,
+		serial: serial,
+		chain:  [][]byte{cert.Raw},
+		signer: signer,
+	}
+	k.attestation, k.touchPolicy = attest(yk, slot, cert.PublicKey)
+	return k, nil
+}
+
+// attest returns the attestation of the key in slot, and the touch policy it
+// reports. Keys imported into the card are not attested, so their touch
+// policy is unknown.
+func attest(yk *piv.YubiKey, slot piv.Slot, pub crypto.PublicKey) (*Attestation, string) {
+	device, err := yk.AttestationCertificate()
+	if err != nil {
+		return nil, ""
+	}
+	leaf, err := yk.Attest(slot)
+	if err != nil {
+		return nil, ""
+	}
+	if key, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(leaf.PublicKey) {
+		return nil, ""
+	}
+	a, err := piv.Verify(device, leaf)
+	if err != nil {
+		return nil, ""
+	}
+	var touchPolicy string
+	switch a.TouchPolicy {
+	case piv.TouchPolicyNever:
+		touchPolicy = TouchPolicyNever
+	case piv.TouchPolicyAlways:
+		touchPolicy = TouchPolicyAlways
+	case piv.TouchPolicyCached:
+		touchPolicy = TouchPolicyCached
+	}
+	return &Attestation{Format: AttestationFormatPIV, Certificates: [][]byte{leaf.Raw, device.Raw}}, touchPolicy
+}
+
+// CertificateChain returns the credential as a raw X509 cert chain. This
+// contains the public key.
+func (k *Key) CertificateChain() [][]byte {
+	return k.chain
+}
+
+// Card returns the name of the smart card holding this Key.
+func (k *Key) Card() string {
+	return k.card
+}
+
+// Serial returns the serial number of the YubiKey holding this Key, or "" if
+// the YubiKey does not report it.
+func (k *Key) Serial() string {
+	if k.serial == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(k.serial), 10)
+}
+
+// TouchPolicy returns the touch policy of this Key, or "" if it is unknown.
+func (k *Key) TouchPolicy() string {
+	return k.touchPolicy
+}
+
+// Attestation returns the attestation of the key, if the card provides one.
+func (k *Key) Attestation() (*Attestation, error) {
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	if k.attestation == nil {
+		return nil, ErrAttestationUnsupported
+	}
+	return k.attestation, nil
+}
+
+// Close releases the card. It is safe to call more than once; later calls
+// return the result of the first one.
+func (k *Key) Close() error {
+	k.closeOnce.Do(func() {
+		k.closed.Store(true)
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.closeErr = k.yk.Close()
+	})
+	return k.closeErr
+}
+
+// checkOpen returns ErrKeyClosed if k has been closed.
+func (k *Key) checkOpen() error {
+	if k.closed.Load() {
+		return ErrKeyClosed
+	}
+	return nil
+}
+
+// CheckPresent returns an error wrapping ErrCardNotPresent if the YubiKey
+// holding the key no longer answers, such as after it was unplugged.
+func (k *Key) CheckPresent() error {
+	if err := k.checkOpen(); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, err := k.yk.Serial(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCardNotPresent, err)
+	}
+	return nil
+}
+
+// Public returns the corresponding public key for this Key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// Sign signs a message digest. If the key requires a touch and the security
+// key is not touched in time, the returned error wraps ErrTouchRequired.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := k.Public().(ed25519.PublicKey); !ok && (opts == nil || opts.HashFunc() == 0) {
+		return nil, errors.New("PIV keys only sign digests, the hash function must be set")
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	signature, err := k.signer.Sign(rand.Reader, digest, opts)
+	return signature, touchError(err, k.touchPolicy)
+}
+
+// KeyAgreement returns the ECDH shared secret of the EC private key on the
+// card and peer, the X coordinate of the shared point. If the key requires a
+// touch and the security key is not touched in time, the returned error wraps
+// ErrTouchRequired.
+func (k *Key) KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error) {
+	agreer, ok := k.signer.(interface {
+		SharedKey(peer *ecdsa.PublicKey) ([]byte, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("key agreement is only supported with EC keys, got %T", k.Public())
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.checkOpen(); err != nil {
+		return nil, err
+	}
+	secret, err := agreer.SharedKey(peer)
+	return secret, touchError(err, k.touchPolicy)
+}
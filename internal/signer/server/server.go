@@ -0,0 +1,598 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server is the net/rpc server of the signer binaries. It listens on
+// stdin/stdout and exposes methods that perform device certificate signing
+// with the credential of a keystore Backend. Each signer binary is a main
+// package that calls Main with its Backend.
+//
+// The signer is intended to be launched as a subprocess by the signer client,
+// and should not be launched manually as a stand-alone process.
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	_ "github.com/googleapis/enterprise-certificate-proxy/internal/cryptoopts" // Registers the opts types sent by the client.
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/systemlog"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/version"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/wire"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// A Backend opens the credentials of a keystore.
+type Backend interface {
+	// Name names the keystore in log messages, such as "pkcs11".
+	Name() string
+	// Open opens the credential described by config, which was loaded from
+	// configFilePath, retrying transient errors as configured.
+	Open(config *config.EnterpriseCertificateConfig, configFilePath string) (Key, error)
+}
+
+// A TransientClassifier is a Backend that reports which errors of its keys are
+// transient failures of the keystore, such as a removed token or a lost
+// connection, rather than failures of the request, such as a wrong PIN or
+// unsupported options. The signer marks them with wire.TransientErrorPrefix.
+type TransientClassifier interface {
+	Backend
+	IsTransient(err error) bool
+}
+
+// An ExclusiveBackend holds its keystore exclusively while a credential is
+// open, such as a PIV card, so that the credential is closed before the next
+// one is opened.
+type ExclusiveBackend interface {
+	Backend
+	// Exclusive is a marker method.
+	Exclusive()
+}
+
+// Key is a credential opened by a Backend.
+//
+// Keys implement the optional interfaces of this package for the operations
+// that their keystore supports. The signer answers the others as if it did
+// not have the RPC method, which the client reports as unsupported, as it does
+// for older signers.
+type Key interface {
+	crypto.Signer
+	// CertificateChain returns the DER encoded certificate chain, leaf first.
+	CertificateChain() [][]byte
+	// Metadata describes the keystore holding the key.
+	Metadata() Metadata
+	// Capabilities describes the algorithms that the keystore supports with
+	// the key.
+	Capabilities() util.Capabilities
+	// Close releases the credential. Later operations fail.
+	Close() error
+}
+
+// A Decrypter encrypts to and decrypts with the key.
+type Decrypter interface {
+	Encrypt(plaintext []byte, opts any) ([]byte, error)
+	Decrypt(ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error)
+}
+
+// A KeyWrapper wraps symmetric keys with the key using RSA-OAEP.
+type KeyWrapper interface {
+	WrapKey(key []byte, hash crypto.Hash) ([]byte, error)
+	UnwrapKey(wrappedKey []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// A KeyAgreer computes ECDH shared secrets with the key.
+type KeyAgreer interface {
+	KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error)
+}
+
+// An Attester attests that the key is bound to the hardware.
+type Attester interface {
+	Attest() (Attestation, error)
+}
+
+// A PresenceChecker is held by a removable token. CheckPresent returns an
+// error if the token has been removed.
+type PresenceChecker interface {
+	CheckPresent() error
+}
+
+// A PresenceWaiter waits for its token to be removed or inserted itself,
+// instead of being polled with CheckPresent.
+type PresenceWaiter interface {
+	WaitPresenceChange(present bool, timeout time.Duration) bool
+}
+
+// A Reloader opens the credential that a config file describes through the
+// resources that it holds, such as a loaded PKCS#11 module, when the config
+// still selects them, instead of the backend opening the keystore again.
+type Reloader interface {
+	Reload(config *config.EnterpriseCertificateConfig, configFilePath string) (Key, error)
+}
+
+// SignArgs contains arguments for a Sign API call.
+type SignArgs struct {
+	Digest  []byte            // The content to sign.
+	Opts    crypto.SignerOpts // Options for signing. Must implement HashFunc().
+	Message []byte            // The full message to sign instead of Digest, if set. Hashed with Opts.HashFunc() unless it is zero.
+}
+
+// EncryptArgs contains arguments for an Encrypt API call.
+type EncryptArgs struct {
+	Plaintext []byte // The plaintext to encrypt.
+	Opts      any    // Options for encryption. Ex: an instance of crypto.Hash.
+}
+
+// DecryptArgs contains arguments to for a Decrypt API call.
+type DecryptArgs struct {
+	Ciphertext []byte               // The ciphertext to decrypt.
+	Opts       crypto.DecrypterOpts // Options for decryption. Ex: an instance of *rsa.OAEPOptions.
+}
+
+// WrapKeyArgs contains arguments for a WrapKey API call.
+type WrapKeyArgs struct {
+	Key  []byte      // The symmetric key to wrap.
+	Hash crypto.Hash // The hash function used by RSA-OAEP.
+}
+
+// UnwrapKeyArgs contains arguments for an UnwrapKey API call.
+type UnwrapKeyArgs struct {
+	WrappedKey []byte      // The wrapped symmetric key.
+	Hash       crypto.Hash // The hash function used by RSA-OAEP.
+}
+
+// KeyAgreementArgs contains arguments for a KeyAgreement API call.
+type KeyAgreementArgs struct {
+	PeerPublicKey []byte // The peer's EC public key, in PKIX, ASN.1 DER form.
+}
+
+// WaitTokenChangeArgs contains arguments for a WaitTokenChange API call.
+type WaitTokenChangeArgs struct {
+	Present bool          // Whether the client last saw the token present.
+	Timeout time.Duration // Upper bound on the wait.
+}
+
+// StagedCredential is the credential loaded by a StageCertificateChain API
+// call.
+type StagedCredential struct {
+	CertificateChain [][]byte // The DER encoded certificate chain, leaf first.
+	PublicKey        []byte   // The public key, in PKIX, ASN.1 DER form.
+}
+
+// Metadata describes the keystore backing the signer's credential.
+type Metadata struct {
+	KeystoreType       string // The type of keystore holding the key.
+	TokenLabel         string // The label of the token holding the key, if applicable.
+	TokenSerial        string // The serial number of the token holding the key, if applicable.
+	Module             string // The path of the PKCS#11 module of the token, for the pkcs11 keystore.
+	KeyStorageProvider string // The CNG key storage provider of the key, for the ncrypt keystore.
+	StoreLocation      string // The certificate store location, "current_user" or "local_machine", for the ncrypt keystore.
+	Keychain           string // The keychains searched for the key, for the keychain keystore.
+	Endpoint           string // The API endpoint of the key, for the cloud_kms keystore.
+	Backend            string // The name of the remote signer backend, for the remote keystore.
+	TouchPolicy        string // The touch policy of the key, if known.
+}
+
+// Attestation is evidence from the keystore that the signer's key is bound to
+// the hardware.
+type Attestation struct {
+	Format       string   // The attestation format, or "" if the keystore does not attest the key.
+	Certificates [][]byte // The DER encoded attestation certificate chain, leaf first.
+}
+
+// A EnterpriseCertSigner exports RPC methods for signing.
+type EnterpriseCertSigner struct {
+	mu             sync.RWMutex // Held for writing while the credential is replaced.
+	key            Key
+	staged         Key // The credential loaded by StageCertificateChain, until it is committed.
+	backend        Backend
+	configFilePath string
+}
+
+// A Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
+type Connection struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+// Close closes c's underlying ReadCloser and WriteCloser.
+func (c *Connection) Close() error {
+	rerr := c.ReadCloser.Close()
+	werr := c.WriteCloser.Close()
+	if rerr != nil {
+		return rerr
+	}
+	return werr
+}
+
+// methodNotFound returns the error of net/rpc for a method that the signer
+// does not have, which the client recognizes.
+func methodNotFound(method string) error {
+	return fmt.Errorf("rpc: can't find method EnterpriseCertSigner.%s", method)
+}
+
+// markTransient prefixes *err with wire.TransientErrorPrefix if the backend
+// classifies it as a transient failure of the keystore. Private key operations
+// defer it.
+func (k *EnterpriseCertSigner) markTransient(err *error) {
+	if *err == nil {
+		return
+	}
+	if c, ok := k.backend.(TransientClassifier); ok && c.IsTransient(*err) {
+		*err = fmt.Errorf("%s%w", wire.TransientErrorPrefix, *err)
+	}
+}
+
+// reportFailure reports *err, the failure of the private key operation
+// operation, to the system log. Private key operations defer it.
+func reportFailure(operation string, err *error) {
+	if *err != nil {
+		startup.OperationFailed(operation, *err)
+	}
+}
+
+// CertificateChain returns the credential as a raw X509 cert chain. This
+// contains the public key.
+func (k *EnterpriseCertSigner) CertificateChain(ignored struct{}, certificateChain *[][]byte) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	*certificateChain = k.key.CertificateChain()
+	return nil
+}
+
+// Public returns the corresponding public key for this Key, in ASN.1 DER form.
+func (k *EnterpriseCertSigner) Public(ignored struct{}, publicKey *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	*publicKey, err = x509.MarshalPKIXPublicKey(k.key.Public())
+	return
+}
+
+// Sign signs a message digest. Stores result in "resp".
+func (k *EnterpriseCertSigner) Sign(args SignArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	defer reportFailure("sign", &err)
+	defer zeroize.Bytes(args.Digest)
+	if args.Message != nil {
+		*resp, err = util.SignMessage(k.key, args.Message, args.Opts)
+		return
+	}
+	if err := util.CheckDigestLength(args.Digest, args.Opts); err != nil {
+		return err
+	}
+	*resp, err = k.key.Sign(nil, args.Digest, args.Opts)
+	return
+}
+
+// Encrypt encrypts a plaintext msg. Stores result in "resp".
+func (k *EnterpriseCertSigner) Encrypt(args EncryptArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	defer zeroize.Bytes(args.Plaintext)
+	d, ok := k.key.(Decrypter)
+	if !ok {
+		return methodNotFound("Encrypt")
+	}
+	*resp, err = d.Encrypt(args.Plaintext, args.Opts)
+	return
+}
+
+// Decrypt decrypts a ciphertext msg. Stores result in "resp".
+func (k *EnterpriseCertSigner) Decrypt(args DecryptArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	d, ok := k.key.(Decrypter)
+	if !ok {
+		return methodNotFound("Decrypt")
+	}
+	defer reportFailure("decrypt", &err)
+	*resp, err = d.Decrypt(args.Ciphertext, args.Opts)
+	return
+}
+
+// WrapKey wraps a symmetric key with the credential's key using RSA-OAEP.
+// Stores result in "resp".
+func (k *EnterpriseCertSigner) WrapKey(args WrapKeyArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	defer zeroize.Bytes(args.Key)
+	w, ok := k.key.(KeyWrapper)
+	if !ok {
+		return methodNotFound("WrapKey")
+	}
+	*resp, err = w.WrapKey(args.Key, args.Hash)
+	return
+}
+
+// UnwrapKey unwraps a symmetric key wrapped by WrapKey. Stores result in
+// "resp".
+func (k *EnterpriseCertSigner) UnwrapKey(args UnwrapKeyArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	w, ok := k.key.(KeyWrapper)
+	if !ok {
+		return methodNotFound("UnwrapKey")
+	}
+	defer reportFailure("unwrap_key", &err)
+	*resp, err = w.UnwrapKey(args.WrappedKey, args.Hash)
+	return
+}
+
+// KeyAgreement computes the ECDH shared secret of the credential's EC private
+// key and args.PeerPublicKey. Stores result in "resp".
+func (k *EnterpriseCertSigner) KeyAgreement(args KeyAgreementArgs, resp *[]byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	a, ok := k.key.(KeyAgreer)
+	if !ok {
+		return methodNotFound("KeyAgreement")
+	}
+	defer reportFailure("key_agreement", &err)
+	peer, err := util.ParseECDHPublicKey(args.PeerPublicKey, k.key.Public())
+	if err != nil {
+		return err
+	}
+	*resp, err = a.KeyAgreement(peer)
+	return
+}
+
+// Metadata describes the keystore holding the credential.
+func (k *EnterpriseCertSigner) Metadata(ignored struct{}, metadata *Metadata) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	*metadata = k.key.Metadata()
+	return nil
+}
+
+// Attest returns the attestation of the key, or an empty Attestation if the
+// keystore does not provide one.
+func (k *EnterpriseCertSigner) Attest(ignored struct{}, attestation *Attestation) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	defer k.markTransient(&err)
+	a, ok := k.key.(Attester)
+	if !ok {
+		return methodNotFound("Attest")
+	}
+	*attestation, err = a.Attest()
+	return
+}
+
+// Capabilities describes the algorithms that the keystore supports with the
+// credential.
+func (k *EnterpriseCertSigner) Capabilities(ignored struct{}, capabilities *util.Capabilities) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	*capabilities = k.key.Capabilities()
+	return nil
+}
+
+// Ping returns an error if the token holding the credential has been removed.
+// Credentials that are not held by a removable token are always present.
+func (k *EnterpriseCertSigner) Ping(ignored struct{}, ignored2 *struct{}) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if p, ok := k.key.(PresenceChecker); ok {
+		return p.CheckPresent()
+	}
+	return nil
+}
+
+// Shutdown releases the credential before the client closes the connection
+// and the signer exits, so that the keystore does not wait for the process to
+// exit to release the token, session or handles that it holds. Later
+// operations fail.
+func (k *EnterpriseCertSigner) Shutdown(ignored struct{}, ignored2 *struct{}) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.key.Close()
+}
+
+// WaitTokenChange waits up to args.Timeout for the token holding the
+// credential to be removed or inserted, unless its presence already differs
+// from args.Present, and reports whether it is present. Credentials that are
+// not held by a removable token are always present.
+func (k *EnterpriseCertSigner) WaitTokenChange(args WaitTokenChangeArgs, present *bool) error {
+	k.mu.RLock()
+	key := k.key
+	k.mu.RUnlock()
+	if w, ok := key.(PresenceWaiter); ok {
+		*present = w.WaitPresenceChange(args.Present, args.Timeout)
+		return nil
+	}
+	*present = util.WaitForPresenceChange(args.Present, args.Timeout, util.PresencePollInterval, func() error {
+		k.mu.RLock()
+		defer k.mu.RUnlock()
+		if p, ok := k.key.(PresenceChecker); ok {
+			return p.CheckPresent()
+		}
+		return nil
+	})
+	return nil
+}
+
+// Version returns the version and build information of the signer binary.
+func (k *EnterpriseCertSigner) Version(ignored struct{}, v *string) error {
+	*v = version.String()
+	return nil
+}
+
+// RefreshCertificateChain reloads the config file and the credential it
+// describes, so that a renewed certificate is used without restarting the
+// signer, and returns the new certificate chain. The previous credential is
+// closed once in-flight operations on it have completed. If reloading fails,
+// the previous credential is kept, unless the backend is exclusive: then the
+// previous credential is closed first, and later operations fail until the
+// certificate chain is refreshed again.
+func (k *EnterpriseCertSigner) RefreshCertificateChain(ignored struct{}, certificateChain *[][]byte) error {
+	var staged StagedCredential
+	if err := k.StageCertificateChain(struct{}{}, &staged); err != nil {
+		return err
+	}
+	*certificateChain = staged.CertificateChain
+	return k.CommitCertificateChain(true, &struct{}{})
+}
+
+// StageCertificateChain reloads the config file and the credential it
+// describes like RefreshCertificateChain, but keeps serving the previous
+// credential until CommitCertificateChain accepts the new one, so that the
+// client can check the renewed certificate first. A credential staged earlier
+// and not committed is closed. An exclusive backend cannot hold both
+// credentials: the previous one is closed first, and the new one is served
+// right away.
+func (k *EnterpriseCertSigner) StageCertificateChain(ignored struct{}, staged *StagedCredential) error {
+	config, err := config.Load(k.configFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load enterprise cert config: %w", err)
+	}
+	var key Key
+	if _, ok := k.backend.(ExclusiveBackend); ok {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.discardStagedLocked()
+		k.key.Close()
+		if key, err = k.backend.Open(&config, k.configFilePath); err != nil {
+			return err
+		}
+		k.key = key
+	} else {
+		k.mu.RLock()
+		current := k.key
+		k.mu.RUnlock()
+		if r, ok := current.(Reloader); ok {
+			key, err = r.Reload(&config, k.configFilePath)
+		} else {
+			key, err = k.backend.Open(&config, k.configFilePath)
+		}
+		if err != nil {
+			return err
+		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		k.discardStagedLocked()
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		if key != k.key {
+			key.Close()
+		}
+		return err
+	}
+	k.staged = key
+	*staged = StagedCredential{CertificateChain: key.CertificateChain(), PublicKey: publicKey}
+	return nil
+}
+
+// CommitCertificateChain serves the credential staged by StageCertificateChain
+// if accept is true, and closes the previous one once in-flight operations on
+// it have completed. Otherwise, it closes the staged credential, and keeps
+// serving the previous one unless the backend is exclusive.
+func (k *EnterpriseCertSigner) CommitCertificateChain(accept bool, ignored *struct{}) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.staged == nil {
+		return errors.New("no certificate chain is staged")
+	}
+	if !accept {
+		k.discardStagedLocked()
+		return nil
+	}
+	old := k.key
+	k.key, k.staged = k.staged, nil
+	if old != k.key {
+		old.Close()
+	}
+	return nil
+}
+
+// discardStagedLocked closes the staged credential, if any. k.mu must be held
+// for writing.
+func (k *EnterpriseCertSigner) discardStagedLocked() {
+	if k.staged != nil {
+		k.staged.Close()
+		k.staged = nil
+	}
+}
+
+// enableLogging returns whether ECP logging is enabled, and otherwise discards
+// the logs.
+func enableLogging() bool {
+	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
+		return true
+	}
+	log.SetOutput(io.Discard)
+	return false
+}
+
+// Main serves the signer RPC API on stdin/stdout for the credential that
+// backend opens from the config file whose path is the only argument of the
+// binary, and returns when the client closes the connection.
+func Main(backend Backend) {
+	loggingEnabled := enableLogging()
+	if len(os.Args) == 2 && os.Args[1] == "--version" {
+		fmt.Println(version.String())
+		return
+	}
+	if len(os.Args) != 2 {
+		log.Fatalln("Signer is not meant to be invoked manually, exiting...")
+	}
+	configFilePath := os.Args[1]
+	config, err := config.Load(configFilePath)
+	if err != nil {
+		startup.Fail(startup.CodeConfig, "Failed to load enterprise cert config: %v", err)
+	}
+	startup.EnableSystemLog(config.SystemLog)
+	if loggingEnabled && (config.SystemLog || systemLogByDefault) {
+		// Also write the logs to the system log.
+		if w, err := systemlog.NewWriter("signer"); err == nil {
+			log.SetOutput(io.MultiWriter(os.Stderr, w))
+		} else if config.SystemLog {
+			log.Printf("Failed to open the system log: %v", err)
+		}
+	}
+
+	enterpriseCertSigner := &EnterpriseCertSigner{backend: backend, configFilePath: configFilePath}
+	enterpriseCertSigner.key, err = backend.Open(&config, configFilePath)
+	if err != nil {
+		startup.Fail(startup.CodeCredential, "Failed to initialize enterprise cert signer using %s: %v", backend.Name(), err)
+	}
+
+	if err := rpc.Register(enterpriseCertSigner); err != nil {
+		startup.Fail(startup.CodeInternal, "Failed to register enterprise cert signer with net/rpc: %v", err)
+	}
+
+	// If the parent process dies, we should exit.
+	go watchParent()
+
+	startup.Ready()
+	// The plaintexts, unwrapped keys and shared secrets are zeroed once sent.
+	wire.ServeConn(&Connection{os.Stdin, os.Stdout}, config.WireFormat,
+		"EnterpriseCertSigner.Decrypt", "EnterpriseCertSigner.UnwrapKey", "EnterpriseCertSigner.KeyAgreement")
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin
+// +build darwin
+
+package server
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// systemLogByDefault reports whether the logs, when enabled, are also written
+// to the system log without the system_log field of the config. They are
+// written to the "signer" category of the unified logging system, where admins
+// can collect them with "log collect".
+const systemLogByDefault = true
+
+// watchParent exits the signer when its parent process exits. It waits for a
+// kqueue EVFILT_PROC event on the parent, which also works when the signer is
+// reparented to a process other than launchd. If kqueue is unavailable, it
+// falls back to periodically checking if the parent PID has changed
+// (https://stackoverflow.com/a/2035683).
+func watchParent() {
+	ppid := os.Getppid()
+	// A parent that exited before the signer started watching it cannot be
+	// watched, and the signer was reparented to launchd.
+	if ppid == 1 {
+		log.Fatalln("Enterprise cert signer's parent process died, exiting...")
+	}
+	if err := waitForExit(ppid); err != nil {
+		log.Printf("Failed to watch parent process with kqueue, falling back to polling: %v", err)
+		for os.Getppid() == ppid {
+			time.Sleep(time.Second)
+		}
+	}
+	log.Fatalln("Enterprise cert signer's parent process died, exiting...")
+}
+
+// waitForExit blocks until the process with the given pid exits.
+func waitForExit(pid int) error {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return err
+	}
+	defer unix.Close(kq)
+
+	var event unix.Kevent_t
+	unix.SetKevent(&event, pid, unix.EVFILT_PROC, unix.EV_ADD|unix.EV_ONESHOT)
+	event.Fflags = unix.NOTE_EXIT
+	changes := []unix.Kevent_t{event}
+	events := make([]unix.Kevent_t, 1)
+	for {
+		n, err := unix.Kevent(kq, changes, events, nil)
+		switch {
+		case err == unix.EINTR:
+			// The event was registered before the wait was interrupted.
+			changes = nil
+		case err == unix.ESRCH:
+			// The process exited before the event could be registered.
+			return nil
+		case err != nil:
+			return err
+		case n > 0:
+			return nil
+		}
+	}
+}
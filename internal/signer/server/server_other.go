@@ -0,0 +1,39 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package server
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// systemLogByDefault reports whether the logs, when enabled, are also written
+// to the system log without the system_log field of the config.
+const systemLogByDefault = false
+
+// watchParent exits the signer when its parent process exits. On Linux, the
+// client sets PR_SET_PDEATHSIG on the signer, but as a fallback we
+// periodically check if the signer has been reparented, either to PID 1
+// (https://stackoverflow.com/a/2035683) or to a container init shim.
+func watchParent() {
+	ppid := os.Getppid()
+	for os.Getppid() == ppid {
+		time.Sleep(time.Second)
+	}
+	log.Fatalln("Enterprise cert signer's parent process died, exiting...")
+}
@@ -0,0 +1,26 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package server
+
+// systemLogByDefault reports whether the logs, when enabled, are also written
+// to the system log without the system_log field of the config.
+const systemLogByDefault = false
+
+// watchParent returns at once. Windows does not reparent the processes of an
+// exited parent, so the signer cannot detect it from its parent PID; the
+// client assigns the signer to a job object that is closed with it instead.
+func watchParent() {}
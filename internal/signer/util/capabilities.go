@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// SignHashes are the hash functions of the digests that keystores sign unless
+// they report otherwise.
+var SignHashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// DecryptHashes are the RSA-OAEP hash functions that ProbeCapabilities asks
+// keystores about.
+var DecryptHashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// Capabilities describes the operations that a signer supports with its key.
+// It is the reply of the Capabilities API, and client.Capabilities is defined
+// as this type.
+type Capabilities struct {
+	Hashes            []crypto.Hash // The hash functions of the digests that the key signs.
+	PKCS1v15          bool          // Whether the RSA key signs with PKCS #1 v1.5.
+	PSS               bool          // Whether the RSA key signs with RSASSA-PSS.
+	RawSign           bool          // Whether the key signs data as-is, with crypto.Hash(0), as Ed25519 keys do.
+	SignMessage       bool          // Whether the keystore hashes the messages passed to SignMessage itself, rather than the signer hashing them before signing the digest.
+	Decrypt           bool          // Whether the RSA key decrypts with RSA-OAEP.
+	DecryptHashes     []crypto.Hash // The RSA-OAEP hash functions that Decrypt supports.
+	MaxCiphertextSize int           // The size of the ciphertexts that Decrypt accepts, in bytes.
+}
+
+// Padding is the padding scheme of an RSA Algorithm.
+type Padding int
+
+// Paddings of RSA algorithms.
+const (
+	PaddingNone     Padding = iota // The algorithm is not an RSA one.
+	PaddingPKCS1v15                // RSASSA-PKCS1-v1_5 signatures.
+	PaddingPSS                     // RSASSA-PSS signatures.
+	PaddingOAEP                    // RSAES-OAEP decryption.
+)
+
+// An Algorithm is a private key operation that ProbeCapabilities asks a
+// keystore about.
+type Algorithm struct {
+	Decrypt bool        // Whether the operation is a decryption rather than a signature.
+	Padding Padding     // The padding of an RSA operation.
+	Hash    crypto.Hash // The hash function of the signed digest or of RSA-OAEP, or 0 for raw signatures.
+}
+
+// ProbeCapabilities returns the capabilities of a keystore key whose public key
+// is pub, for which supported reports whether the keystore supports an
+// algorithm with the key. The hash functions of SignHashes and DecryptHashes
+// are probed. An RSA key signs the digests of a hash function if it supports
+// it with either padding.
+func ProbeCapabilities(pub crypto.PublicKey, supported func(Algorithm) bool) Capabilities {
+	var c Capabilities
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		for _, hash := range SignHashes {
+			pkcs1v15 := supported(Algorithm{Padding: PaddingPKCS1v15, Hash: hash})
+			pss := supported(Algorithm{Padding: PaddingPSS, Hash: hash})
+			if pkcs1v15 || pss {
+				c.Hashes = append(c.Hashes, hash)
+			}
+			c.PKCS1v15 = c.PKCS1v15 || pkcs1v15
+			c.PSS = c.PSS || pss
+		}
+		for _, hash := range DecryptHashes {
+			if supported(Algorithm{Decrypt: true, Padding: PaddingOAEP, Hash: hash}) {
+				c.DecryptHashes = append(c.DecryptHashes, hash)
+			}
+		}
+		if len(c.DecryptHashes) > 0 {
+			c.Decrypt = true
+			c.MaxCiphertextSize = pub.Size()
+		}
+	case *ecdsa.PublicKey:
+		for _, hash := range SignHashes {
+			if supported(Algorithm{Hash: hash}) {
+				c.Hashes = append(c.Hashes, hash)
+			}
+		}
+	case ed25519.PublicKey:
+		c.RawSign = supported(Algorithm{})
+	}
+	return c
+}
+
+// KeyCapabilities returns the capabilities of a keystore key whose public key
+// is pub, which signs digests of signHashes, with both paddings for RSA keys,
+// and decrypts with RSA-OAEP with decryptHashes, if any, for RSA keys.
+func KeyCapabilities(pub crypto.PublicKey, signHashes []crypto.Hash, decryptHashes []crypto.Hash) Capabilities {
+	var c Capabilities
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		c.Hashes = signHashes
+		c.PKCS1v15 = true
+		c.PSS = true
+		if len(decryptHashes) > 0 {
+			c.Decrypt = true
+			c.DecryptHashes = decryptHashes
+			c.MaxCiphertextSize = pub.Size()
+		}
+	case *ecdsa.PublicKey:
+		c.Hashes = signHashes
+	case ed25519.PublicKey:
+		c.RawSign = true
+	}
+	return c
+}
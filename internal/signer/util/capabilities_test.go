@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestKeyCapabilities(t *testing.T) {
+	rsaKey := &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047), E: 65537}
+	sha256 := []crypto.Hash{crypto.SHA256}
+	tests := []struct {
+		name          string
+		pub           crypto.PublicKey
+		decryptHashes []crypto.Hash
+		want          Capabilities
+	}{
+		{
+			name: "RSA",
+			pub:  rsaKey,
+			want: Capabilities{Hashes: SignHashes, PKCS1v15: true, PSS: true},
+		},
+		{
+			name:          "RSA-Decrypt",
+			pub:           rsaKey,
+			decryptHashes: sha256,
+			want:          Capabilities{Hashes: SignHashes, PKCS1v15: true, PSS: true, Decrypt: true, DecryptHashes: sha256, MaxCiphertextSize: 256},
+		},
+		{
+			name:          "ECDSA",
+			pub:           &ecdsa.PublicKey{},
+			decryptHashes: sha256,
+			want:          Capabilities{Hashes: SignHashes},
+		},
+		{
+			name: "Ed25519",
+			pub:  ed25519.PublicKey{},
+			want: Capabilities{RawSign: true},
+		},
+	}
+	for _, test := range tests {
+		if got := KeyCapabilities(test.pub, SignHashes, test.decryptHashes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("KeyCapabilities(%s): got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	rsaKey := &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047), E: 65537}
+	tests := []struct {
+		name      string
+		pub       crypto.PublicKey
+		supported func(Algorithm) bool
+		want      Capabilities
+	}{
+		{
+			name:      "RSA",
+			pub:       rsaKey,
+			supported: func(Algorithm) bool { return true },
+			want:      Capabilities{Hashes: SignHashes, PKCS1v15: true, PSS: true, Decrypt: true, DecryptHashes: DecryptHashes, MaxCiphertextSize: 256},
+		},
+		{
+			name: "RSA without PSS",
+			pub:  rsaKey,
+			supported: func(a Algorithm) bool {
+				return a.Padding == PaddingPKCS1v15 || a.Padding == PaddingOAEP && a.Hash == crypto.SHA1
+			},
+			want: Capabilities{Hashes: SignHashes, PKCS1v15: true, Decrypt: true, DecryptHashes: []crypto.Hash{crypto.SHA1}, MaxCiphertextSize: 256},
+		},
+		{
+			name:      "RSA signing SHA-256 digests",
+			pub:       rsaKey,
+			supported: func(a Algorithm) bool { return !a.Decrypt && a.Hash == crypto.SHA256 },
+			want:      Capabilities{Hashes: []crypto.Hash{crypto.SHA256}, PKCS1v15: true, PSS: true},
+		},
+		{
+			name:      "ECDSA",
+			pub:       &ecdsa.PublicKey{},
+			supported: func(a Algorithm) bool { return a.Padding == PaddingNone && a.Hash != crypto.SHA512 },
+			want:      Capabilities{Hashes: []crypto.Hash{crypto.SHA256, crypto.SHA384}},
+		},
+		{
+			name:      "Ed25519",
+			pub:       ed25519.PublicKey{},
+			supported: func(a Algorithm) bool { return a == Algorithm{} },
+			want:      Capabilities{RawSign: true},
+		},
+	}
+	for _, test := range tests {
+		if got := ProbeCapabilities(test.pub, test.supported); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ProbeCapabilities(%s): got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
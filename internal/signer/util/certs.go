@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/x509"
+	"runtime"
+	"sync"
+)
+
+type parsedCert struct {
+	cert *x509.Certificate
+	err  error
+}
+
+// CertCache parses DER certificates, parsing each distinct certificate only
+// once. It is safe for concurrent use.
+type CertCache struct {
+	mu    sync.Mutex
+	certs map[string]parsedCert
+}
+
+// Parse returns the parsed certificate der, or the error of parsing it.
+func (c *CertCache) Parse(der []byte) (*x509.Certificate, error) {
+	c.mu.Lock()
+	p, ok := c.certs[string(der)]
+	c.mu.Unlock()
+	if ok {
+		return p.cert, p.err
+	}
+	p.cert, p.err = x509.ParseCertificate(der)
+	c.mu.Lock()
+	if c.certs == nil {
+		c.certs = make(map[string]parsedCert)
+	}
+	c.certs[string(der)] = p
+	c.mu.Unlock()
+	return p.cert, p.err
+}
+
+// ParseAll parses ders in parallel. The result has the same order as ders,
+// with a nil entry for each certificate that could not be parsed.
+func (c *CertCache) ParseAll(ders [][]byte) []*x509.Certificate {
+	certs := make([]*x509.Certificate, len(ders))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(ders) {
+		workers = len(ders)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				certs[i], _ = c.Parse(ders[i])
+			}
+		}()
+	}
+	for i := range ders {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return certs
+}
+
+// BuildChain returns the certificate chain starting at leaf, built by matching
+// the issuer of each certificate to the subject of a certificate in pool that
+// signed it. When several certificates match, the one expiring last is used.
+// Duplicates in pool are ignored.
+func BuildChain(leaf *x509.Certificate, pool []*x509.Certificate) []*x509.Certificate {
+	bySubject := make(map[string][]*x509.Certificate)
+	for _, xc := range pool {
+		if xc != nil {
+			bySubject[string(xc.RawSubject)] = append(bySubject[string(xc.RawSubject)], xc)
+		}
+	}
+	var (
+		chain      []*x509.Certificate
+		prev, next *x509.Certificate
+	)
+	inChain := make(map[string]bool)
+	for prev = leaf; prev != nil; prev, next = next, nil {
+		chain = append(chain, prev)
+		inChain[string(prev.Raw)] = true
+		for _, xc := range bySubject[string(prev.RawIssuer)] {
+			if inChain[string(xc.Raw)] {
+				continue // finite chains only.
+			}
+			// Prefer certificates with later expirations, and only check
+			// signatures of candidates that would be preferred.
+			if next != nil && !xc.NotAfter.After(next.NotAfter) {
+				continue
+			}
+			if prev.CheckSignatureFrom(xc) == nil {
+				next = xc
+			}
+		}
+	}
+	return chain
+}
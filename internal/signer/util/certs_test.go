@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t testing.TB, name string, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func TestCertCache(t *testing.T) {
+	root := newTestCert(t, "root", time.Now().Add(time.Hour), nil)
+	var c CertCache
+	certs := c.ParseAll([][]byte{root.cert.Raw, []byte("not a certificate"), root.cert.Raw})
+	if len(certs) != 3 {
+		t.Fatalf("ParseAll: got %d certificates, want 3", len(certs))
+	}
+	if certs[0] == nil || certs[1] != nil || certs[2] != certs[0] {
+		t.Errorf("ParseAll: got %v, want the same parsed certificate at 0 and 2 and nil at 1", certs)
+	}
+	if _, err := c.Parse([]byte("not a certificate")); err == nil {
+		t.Errorf("Parse: got nil err, want error for invalid certificate")
+	}
+}
+
+func TestBuildChain(t *testing.T) {
+	root := newTestCert(t, "root", time.Now().Add(2*time.Hour), nil)
+	oldIntermediate := newTestCert(t, "intermediate", time.Now().Add(time.Hour), root)
+	newIntermediate := &testCert{key: oldIntermediate.key}
+	template := *oldIntermediate.cert
+	template.NotAfter = time.Now().Add(90 * time.Minute)
+	der, err := x509.CreateCertificate(rand.Reader, &template, root.cert, &oldIntermediate.key.PublicKey, root.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newIntermediate.cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	leaf := newTestCert(t, "leaf", time.Now().Add(time.Hour), oldIntermediate)
+	unrelated := newTestCert(t, "unrelated", time.Now().Add(time.Hour), nil)
+
+	pool := []*x509.Certificate{nil, unrelated.cert, leaf.cert, oldIntermediate.cert, root.cert, newIntermediate.cert, root.cert}
+	chain := BuildChain(leaf.cert, pool)
+	want := []*x509.Certificate{leaf.cert, newIntermediate.cert, root.cert}
+	if len(chain) != len(want) {
+		t.Fatalf("BuildChain: got chain of %d certificates, want %d", len(chain), len(want))
+	}
+	for i := range want {
+		if !chain[i].Equal(want[i]) {
+			t.Errorf("BuildChain: certificate %d is %q expiring %v, want %q expiring %v", i, chain[i].Subject.CommonName, chain[i].NotAfter, want[i].Subject.CommonName, want[i].NotAfter)
+		}
+	}
+}
+
+// BenchmarkParseAndBuildChain measures finding the chain of a leaf among 500
+// certificates, as on a machine with a large keychain.
+func BenchmarkParseAndBuildChain(b *testing.B) {
+	root := newTestCert(b, "root", time.Now().Add(time.Hour), nil)
+	ders := [][]byte{root.cert.Raw}
+	for i := 0; i < 499; i++ {
+		ders = append(ders, newTestCert(b, fmt.Sprintf("cert %d", i), time.Now().Add(time.Hour), root).cert.Raw)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var c CertCache
+		certs := c.ParseAll(ders)
+		if chain := BuildChain(certs[len(certs)-1], certs); len(chain) != 2 {
+			b.Fatalf("BuildChain: got chain of %d certificates, want 2", len(chain))
+		}
+	}
+}
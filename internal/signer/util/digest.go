@@ -0,0 +1,32 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// CheckDigestLength returns an error if opts names a hash function whose size
+// does not match the length of digest, so that signers report the mismatch
+// uniformly instead of passing it on to the keystore.
+func CheckDigestLength(digest []byte, opts crypto.SignerOpts) error {
+	if opts == nil || opts.HashFunc() == 0 {
+		return nil
+	}
+	if size := opts.HashFunc().Size(); len(digest) != size {
+		return fmt.Errorf("digest length of %d bytes does not match hash function size of %d bytes", len(digest), size)
+	}
+	return nil
+}
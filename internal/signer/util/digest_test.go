@@ -0,0 +1,40 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestCheckDigestLength(t *testing.T) {
+	tests := []struct {
+		digest  []byte
+		opts    crypto.SignerOpts
+		wantErr bool
+	}{
+		{digest: make([]byte, 32), opts: crypto.SHA256},
+		{digest: make([]byte, 48), opts: &rsa.PSSOptions{Hash: crypto.SHA384}},
+		{digest: []byte("message"), opts: crypto.Hash(0)},
+		{digest: []byte("message"), opts: nil},
+		{digest: make([]byte, 20), opts: crypto.SHA256, wantErr: true},
+		{digest: make([]byte, 32), opts: &rsa.PSSOptions{Hash: crypto.SHA512}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := CheckDigestLength(test.digest, test.opts); (err != nil) != test.wantErr {
+			t.Errorf("CheckDigestLength(%d bytes, %v): got err %v, want err %v", len(test.digest), test.opts, err, test.wantErr)
+		}
+	}
+}
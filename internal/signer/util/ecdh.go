@@ -0,0 +1,45 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// ParseECDHPublicKey parses the PKIX, ASN.1 DER form of the public key of the
+// peer of an ECDH key agreement with the key pub, and checks that both keys are
+// on the same curve. Points that are not on the curve are rejected by the
+// parser.
+func ParseECDHPublicKey(der []byte, pub crypto.PublicKey) (*ecdsa.PublicKey, error) {
+	own, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key agreement is only supported with EC keys, got %T", pub)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the peer public key: %w", err)
+	}
+	peer, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the peer public key is a %T, not an EC key", parsed)
+	}
+	if peer.Curve.Params().Name != own.Curve.Params().Name {
+		return nil, errors.New("the peer public key is not on the curve of the key")
+	}
+	return peer, nil
+}
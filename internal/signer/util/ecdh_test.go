@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"testing"
+)
+
+func TestParseECDHPublicKey(t *testing.T) {
+	own, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshal := func(pub any) []byte {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	got, err := ParseECDHPublicKey(marshal(&peer.PublicKey), &own.PublicKey)
+	if err != nil {
+		t.Fatalf("ParseECDHPublicKey: got %v, want nil err", err)
+	}
+	if !got.Equal(&peer.PublicKey) {
+		t.Error("ParseECDHPublicKey: got another key")
+	}
+	if _, err := ParseECDHPublicKey(marshal(&other.PublicKey), &own.PublicKey); err == nil {
+		t.Error("ParseECDHPublicKey with another curve: got nil err, want error")
+	}
+	if _, err := ParseECDHPublicKey(marshal(&peer.PublicKey), &rsa.PublicKey{N: big.NewInt(1), E: 3}); err == nil {
+		t.Error("ParseECDHPublicKey with an RSA key: got nil err, want error")
+	}
+	if _, err := ParseECDHPublicKey([]byte("garbage"), &own.PublicKey); err == nil {
+		t.Error("ParseECDHPublicKey of garbage: got nil err, want error")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// MessageSigner is implemented by keys whose keystore can hash the message
+// itself, for example on the card.
+type MessageSigner interface {
+	SignMessage(msg []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// SignMessage signs the full message msg with key. If key implements
+// MessageSigner, hashing is left to the keystore. Otherwise msg is hashed with
+// opts.HashFunc() before signing, or signed as-is if it is crypto.Hash(0).
+func SignMessage(key crypto.Signer, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if ms, ok := key.(MessageSigner); ok {
+		return ms.SignMessage(msg, opts)
+	}
+	hash := opts.HashFunc()
+	if hash == 0 {
+		return key.Sign(nil, msg, opts)
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	h := hash.New()
+	h.Write(msg)
+	return key.Sign(nil, h.Sum(nil), opts)
+}
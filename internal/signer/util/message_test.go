@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"io"
+	"testing"
+)
+
+// echoSigner returns the input to Sign as the signature.
+type echoSigner struct{}
+
+func (echoSigner) Public() crypto.PublicKey { return nil }
+
+func (echoSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return digest, nil
+}
+
+// echoMessageSigner additionally returns the message to SignMessage as the signature.
+type echoMessageSigner struct{ echoSigner }
+
+func (echoMessageSigner) SignMessage(msg []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return msg, nil
+}
+
+func TestSignMessage(t *testing.T) {
+	msg := []byte("message")
+	digest := sha256.Sum256(msg)
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		opts crypto.SignerOpts
+		want []byte
+	}{
+		{name: "hashed by signer", key: echoSigner{}, opts: crypto.SHA256, want: digest[:]},
+		{name: "raw message", key: echoSigner{}, opts: crypto.Hash(0), want: msg},
+		{name: "hashed by keystore", key: echoMessageSigner{}, opts: crypto.SHA256, want: msg},
+	}
+	for _, test := range tests {
+		got, err := SignMessage(test.key, msg, test.opts)
+		if err != nil {
+			t.Errorf("SignMessage(%s): got %v, want nil err", test.name, err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("SignMessage(%s): got %x, want %x", test.name, got, test.want)
+		}
+	}
+}
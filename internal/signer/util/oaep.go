@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// EncryptOAEPOptions returns the hash function and label of the RSA-OAEP
+// encryption selected by opts, either the crypto.Hash to use or an
+// *rsa.OAEPOptions whose MGFHash, if set, is the same as its Hash.
+func EncryptOAEPOptions(opts any) (crypto.Hash, []byte, error) {
+	switch opts := opts.(type) {
+	case crypto.Hash:
+		return opts, nil, nil
+	case *rsa.OAEPOptions:
+		if opts == nil {
+			break
+		}
+		if opts.MGFHash != 0 && opts.MGFHash != opts.Hash {
+			return 0, nil, fmt.Errorf("unsupported OAEP MGF1 hash function %v", opts.MGFHash)
+		}
+		return opts.Hash, opts.Label, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported encrypt opts: %v", opts)
+}
+
+// DecodeOAEP removes the RSA-OAEP padding (RFC 8017, section 7.1.2) from em,
+// the raw RSA decryption of a ciphertext, and checks it against label. It is
+// used by keystores whose native OAEP decryption always uses an empty label.
+// The padding is checked in constant time, as in crypto/rsa, and any failure is
+// reported as rsa.ErrDecryption.
+func DecodeOAEP(hashFunc crypto.Hash, em []byte, label []byte) ([]byte, error) {
+	if !hashFunc.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v", hashFunc)
+	}
+	h := hashFunc.New()
+	hLen := h.Size()
+	if len(em) < 2*hLen+2 {
+		return nil, rsa.ErrDecryption
+	}
+	h.Write(label)
+	lHash := h.Sum(nil)
+
+	em = append([]byte(nil), em...)
+	firstByteIsZero := subtle.ConstantTimeByteEq(em[0], 0)
+	seed, db := em[1:hLen+1], em[hLen+1:]
+	mgf1XOR(seed, h, db)
+	mgf1XOR(db, h, seed)
+	lHashGood := subtle.ConstantTimeCompare(lHash, db[:hLen])
+
+	// The rest of db is zero or more zeros, a one, and the message.
+	rest := db[hLen:]
+	lookingForIndex, index, invalid := 1, 0, 0
+	for i := range rest {
+		equals0 := subtle.ConstantTimeByteEq(rest[i], 0)
+		equals1 := subtle.ConstantTimeByteEq(rest[i], 1)
+		index = subtle.ConstantTimeSelect(lookingForIndex&equals1, i, index)
+		lookingForIndex = subtle.ConstantTimeSelect(equals1, 0, lookingForIndex)
+		invalid = subtle.ConstantTimeSelect(lookingForIndex&^equals0, 1, invalid)
+	}
+	if firstByteIsZero&lHashGood&^invalid&^lookingForIndex != 1 {
+		return nil, rsa.ErrDecryption
+	}
+	return rest[index+1:], nil
+}
+
+// mgf1XOR XORs out with the MGF1 mask generated from seed with h.
+func mgf1XOR(out []byte, h hash.Hash, seed []byte) {
+	var counter [4]byte
+	for done := 0; done < len(out); {
+		h.Reset()
+		h.Write(seed)
+		h.Write(counter[:])
+		for _, b := range h.Sum(nil) {
+			if done == len(out) {
+				break
+			}
+			out[done] ^= b
+			done++
+		}
+		binary.BigEndian.PutUint32(counter[:], binary.BigEndian.Uint32(counter[:])+1)
+	}
+}
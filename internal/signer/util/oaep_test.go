@@ -0,0 +1,72 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestDecodeOAEP(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, label := []byte("data key"), []byte("label")
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &priv.PublicKey, msg, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Raw RSA decryption, as done by keystores without OAEP label support.
+	em := new(big.Int).Exp(new(big.Int).SetBytes(ciphertext), priv.D, priv.N).FillBytes(make([]byte, priv.Size()))
+
+	got, err := DecodeOAEP(crypto.SHA256, em, label)
+	if err != nil {
+		t.Fatalf("DecodeOAEP: got %v, want nil err", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("DecodeOAEP: got %q, want %q", got, msg)
+	}
+	if _, err := DecodeOAEP(crypto.SHA256, em, nil); !errors.Is(err, rsa.ErrDecryption) {
+		t.Errorf("DecodeOAEP with the wrong label: got %v, want rsa.ErrDecryption", err)
+	}
+	if _, err := DecodeOAEP(crypto.SHA384, em, label); !errors.Is(err, rsa.ErrDecryption) {
+		t.Errorf("DecodeOAEP with the wrong hash: got %v, want rsa.ErrDecryption", err)
+	}
+	if _, err := DecodeOAEP(crypto.SHA256, em[:10], label); !errors.Is(err, rsa.ErrDecryption) {
+		t.Errorf("DecodeOAEP of a short block: got %v, want rsa.ErrDecryption", err)
+	}
+}
+
+func TestEncryptOAEPOptions(t *testing.T) {
+	if hash, label, err := EncryptOAEPOptions(crypto.SHA256); hash != crypto.SHA256 || label != nil || err != nil {
+		t.Errorf("EncryptOAEPOptions(SHA256): got %v, %q, %v", hash, label, err)
+	}
+	opts := &rsa.OAEPOptions{Hash: crypto.SHA384, Label: []byte("label")}
+	if hash, label, err := EncryptOAEPOptions(opts); hash != crypto.SHA384 || string(label) != "label" || err != nil {
+		t.Errorf("EncryptOAEPOptions(OAEPOptions): got %v, %q, %v", hash, label, err)
+	}
+	if _, _, err := EncryptOAEPOptions(&rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1}); err == nil {
+		t.Error("EncryptOAEPOptions with a different MGF1 hash: got nil err, want error")
+	}
+	if _, _, err := EncryptOAEPOptions(&rsa.PSSOptions{}); err == nil {
+		t.Error("EncryptOAEPOptions(PSSOptions): got nil err, want error")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "time"
+
+// PresencePollInterval is the interval at which signers check the presence of
+// their token in WaitForPresenceChange.
+const PresencePollInterval = time.Second
+
+// WaitForPresenceChange calls check every interval until the presence of the
+// token it reports, where a nil error means present, differs from present or
+// timeout elapses. It returns the presence of the token when it returns.
+func WaitForPresenceChange(present bool, timeout time.Duration, interval time.Duration, check func() error) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		now := check() == nil
+		if now != present || !time.Now().Add(interval).Before(deadline) {
+			return now
+		}
+		time.Sleep(interval)
+	}
+}
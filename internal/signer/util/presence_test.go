@@ -0,0 +1,45 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForPresenceChange(t *testing.T) {
+	checks := 0
+	removedAfterTwoChecks := func() error {
+		checks++
+		if checks > 2 {
+			return errors.New("token removed")
+		}
+		return nil
+	}
+	if got := WaitForPresenceChange(true, time.Minute, time.Millisecond, removedAfterTwoChecks); got {
+		t.Error("WaitForPresenceChange: got present, want the removal to be reported")
+	}
+	if checks != 3 {
+		t.Errorf("WaitForPresenceChange: got %d checks, want 3", checks)
+	}
+	present := func() error { return nil }
+	start := time.Now()
+	if got := WaitForPresenceChange(true, 20*time.Millisecond, time.Millisecond, present); !got {
+		t.Error("WaitForPresenceChange: got not present after the timeout, want present")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitForPresenceChange: returned after %v, want about the timeout", elapsed)
+	}
+}
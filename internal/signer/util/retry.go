@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package util provides helper functions for the signer.
+package util
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+const (
+	defaultRetryInterval = time.Second
+	maxRetryInterval     = 30 * time.Second
+)
+
+// sleep is replaced in tests.
+var sleep = time.Sleep
+
+// DoWithRetry calls fn until it succeeds, returns an error for which isTransient
+// is false, or the attempts or deadline of policy are exhausted. The last error
+// is returned.
+func DoWithRetry(policy config.Retry, isTransient func(error) bool, fn func() error) error {
+	interval := defaultRetryInterval
+	if policy.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(policy.Interval); err != nil {
+			return fmt.Errorf("invalid retry interval: %w", err)
+		}
+	}
+	var deadline time.Time
+	if policy.Deadline != "" {
+		d, err := time.ParseDuration(policy.Deadline)
+		if err != nil {
+			return fmt.Errorf("invalid retry deadline: %w", err)
+		}
+		deadline = time.Now().Add(d)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.Attempts || !isTransient(err) {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			return err
+		}
+		log.Printf("Transient keystore error on attempt %d, retrying in %v: %v", attempt, interval, err)
+		sleep(interval)
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
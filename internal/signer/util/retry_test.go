@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+var errTransient = errors.New("transient")
+
+func isTestTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func recordSleeps(t *testing.T) *[]time.Duration {
+	var sleeps []time.Duration
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+	return &sleeps
+}
+
+func TestDoWithRetrySucceedsAfterTransientErrors(t *testing.T) {
+	sleeps := recordSleeps(t)
+	calls := 0
+	err := DoWithRetry(config.Retry{Attempts: 5, Interval: "100ms"}, isTestTransient, func() error {
+		if calls++; calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("DoWithRetry: got %v, want nil err", err)
+	}
+	if want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}; !reflect.DeepEqual(*sleeps, want) {
+		t.Errorf("DoWithRetry: got sleeps %v, want %v", *sleeps, want)
+	}
+}
+
+func TestDoWithRetryStopsOnPermanentError(t *testing.T) {
+	recordSleeps(t)
+	errPermanent := errors.New("permanent")
+	calls := 0
+	err := DoWithRetry(config.Retry{Attempts: 5}, isTestTransient, func() error {
+		calls++
+		return errPermanent
+	})
+	if !errors.Is(err, errPermanent) || calls != 1 {
+		t.Errorf("DoWithRetry: got err %v after %d calls, want %v after 1 call", err, calls, errPermanent)
+	}
+}
+
+func TestDoWithRetryExhaustsAttempts(t *testing.T) {
+	recordSleeps(t)
+	calls := 0
+	err := DoWithRetry(config.Retry{Attempts: 3}, isTestTransient, func() error {
+		calls++
+		return errTransient
+	})
+	if !errors.Is(err, errTransient) || calls != 3 {
+		t.Errorf("DoWithRetry: got err %v after %d calls, want %v after 3 calls", err, calls, errTransient)
+	}
+}
+
+func TestDoWithRetryDisabledByDefault(t *testing.T) {
+	recordSleeps(t)
+	calls := 0
+	_ = DoWithRetry(config.Retry{}, isTestTransient, func() error {
+		calls++
+		return errTransient
+	})
+	if calls != 1 {
+		t.Errorf("DoWithRetry: got %d calls, want 1", calls)
+	}
+}
+
+func TestDoWithRetryDeadline(t *testing.T) {
+	recordSleeps(t)
+	calls := 0
+	_ = DoWithRetry(config.Retry{Attempts: 10, Interval: "1s", Deadline: "500ms"}, isTestTransient, func() error {
+		calls++
+		return errTransient
+	})
+	if calls != 1 {
+		t.Errorf("DoWithRetry: got %d calls, want 1", calls)
+	}
+}
+
+func TestDoWithRetryInvalidInterval(t *testing.T) {
+	err := DoWithRetry(config.Retry{Attempts: 2, Interval: "soon"}, isTestTransient, func() error { return nil })
+	if err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
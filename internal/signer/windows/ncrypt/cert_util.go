@@ -19,14 +19,27 @@
 package ncrypt
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 	"unsafe"
 
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
 	"golang.org/x/sys/windows"
 )
 
@@ -40,6 +53,7 @@ const (
 	certStoreProvSystem               = 10                                             // CERT_STORE_PROV_SYSTEM
 	compareShift                      = 16                                             // CERT_COMPARE_SHIFT
 	locationShift                     = 16                                             // CERT_SYSTEM_STORE_LOCATION_SHIFT
+	findAny                           = 0                                              // CERT_FIND_ANY
 	findIssuerStr                     = compareNameStrW<<compareShift | infoIssuerFlag // CERT_FIND_ISSUER_STR_W
 	certStoreLocalMachine             = certStoreLocalMachineID << locationShift       // CERT_SYSTEM_STORE_LOCAL_MACHINE
 	certStoreCurrentUser              = certStoreCurrentUserID << locationShift        // CERT_SYSTEM_STORE_CURRENT_USER
@@ -55,7 +69,11 @@ const (
 	hcceLocalMachine = windows.Handle(0x01) // HCCE_LOCAL_MACHINE
 
 	// winerror.h constants
-	cryptENotFound = 0x80092004 // CRYPT_E_NOT_FOUND
+	cryptENotFound       = 0x80092004 // CRYPT_E_NOT_FOUND
+	nteDeviceNotReady    = 0x80090030 // NTE_DEVICE_NOT_READY
+	scardENoSmartcard    = 0x8010000C // SCARD_E_NO_SMARTCARD
+	scardENoService      = 0x8010001D // SCARD_E_NO_SERVICE
+	scardEServiceStopped = 0x8010001E // SCARD_E_SERVICE_STOPPED
 )
 
 var (
@@ -68,6 +86,20 @@ var (
 	cryptAcquireCertificatePrivateKey = crypt32.MustFindProc("CryptAcquireCertificatePrivateKey")
 )
 
+// IsTransient reports whether err is likely to go away when the operation is
+// retried, such as when the smart card service is still starting.
+func IsTransient(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case nteDeviceNotReady, scardENoSmartcard, scardENoService, scardEServiceStopped:
+		return true
+	}
+	return false
+}
+
 // findCert wraps the CertFindCertificateInStore call. Note that any cert context passed
 // into prev will be freed. If no certificate was found, nil will be returned.
 func findCert(store windows.Handle, enc uint32, findFlags uint32, findType uint32, para *uint16, prev *windows.CertContext) (*windows.CertContext, error) {
@@ -90,7 +122,15 @@ func findCert(store windows.Handle, enc uint32, findFlags uint32, findType uint3
 		}
 		return nil, err
 	}
-	return (*windows.CertContext)(unsafe.Pointer(h)), nil
+	return certContextFromHandle(h), nil
+}
+
+// certContextFromHandle converts the PCCERT_CONTEXT returned by a crypt32
+// call to a *windows.CertContext. The memory is owned by crypt32, so the
+// conversion goes through a pointer to h rather than converting h itself,
+// which go vet reports as a possible misuse of unsafe.Pointer.
+func certContextFromHandle(h uintptr) *windows.CertContext {
+	return *(**windows.CertContext)(unsafe.Pointer(&h))
 }
 
 // extractSimpleChain extracts the final certificate chain from a CertSimpleChain.
@@ -166,7 +206,7 @@ func acquirePrivateKey(cert *windows.CertContext) (windows.Handle, error) {
 	var (
 		key      windows.Handle
 		keySpec  uint32
-		mustFree int
+		mustFree int32 // BOOL
 	)
 	r, _, err := cryptAcquireCertificatePrivateKey.Call(
 		uintptr(unsafe.Pointer(cert)),
@@ -176,7 +216,7 @@ func acquirePrivateKey(cert *windows.CertContext) (windows.Handle, error) {
 		uintptr(unsafe.Pointer(&keySpec)),
 		uintptr(unsafe.Pointer(&mustFree)),
 	)
-	if r == 0 {
+	if uint32(r) == 0 { // BOOL
 		return 0, fmt.Errorf("acquiring private key: %x %w", r, err)
 	}
 	if mustFree != 0 {
@@ -202,37 +242,114 @@ func certContextToX509(ctx *windows.CertContext) (*x509.Certificate, error) {
 	return xc, nil
 }
 
-// Cred returns a Key wrapping the first valid certificate in the system store
-// matching a given issuer string.
-func Cred(issuer string, storeName string, provider string) (*Key, error) {
+// openStore opens the named system certificate store of provider, which must
+// be local_machine or current_user.
+func openStore(storeName string, provider string) (windows.Handle, error) {
 	var certStore uint32
 	if provider == "local_machine" {
 		certStore = uint32(certStoreLocalMachine)
 	} else if provider == "current_user" {
 		certStore = uint32(certStoreCurrentUser)
 	} else {
-		return nil, errors.New("provider must be local_machine or current_user")
+		return 0, errors.New("provider must be local_machine or current_user")
 	}
 	storeNamePtr, err := windows.UTF16PtrFromString(storeName)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	store, err := windows.CertOpenStore(certStoreProvSystem, 0, null, certStore, uintptr(unsafe.Pointer(storeNamePtr)))
 	if err != nil {
-		return nil, fmt.Errorf("opening certificate store: %w", err)
+		return 0, fmt.Errorf("opening certificate store: %w", err)
+	}
+	return store, nil
+}
+
+// AutoKeyStorageProvider accepts certificates whose private key is held by any
+// key storage provider.
+const AutoKeyStorageProvider = "auto"
+
+// checkStorageProvider returns an error listing the registered key storage
+// providers if ksp is not one of them.
+func checkStorageProvider(ksp string) error {
+	providers, err := StorageProviders()
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if strings.EqualFold(p, ksp) {
+			return nil
+		}
+	}
+	return fmt.Errorf("key storage provider %q not found, registered providers are: %s", ksp, strings.Join(providers, ", "))
+}
+
+// SelectOptions narrows down the certificates of the system store that
+// CredWithOptions considers, and how it picks one of them.
+type SelectOptions struct {
+	// EKU, if set, is the extended key usage that the certificate must
+	// allow, such as "clientAuth".
+	EKU string
+	// Fingerprint, if set, is the hex-encoded SHA-256 fingerprint of the DER
+	// encoded certificate to use. An empty issuer then matches any
+	// certificate.
+	Fingerprint string
+	// KeyStorageProvider, if set, names the CNG key storage provider, such as
+	// "Microsoft Smart Card Key Storage Provider", that must hold the private
+	// key of the certificate. AutoKeyStorageProvider is equivalent to an
+	// empty name.
+	KeyStorageProvider string
+	// Prompt, if set, lets the user select the certificate in a dialog when
+	// several of them match, once per process. Otherwise, the first matching
+	// certificate is used.
+	Prompt bool
+	// Preferred, if set, is the hex-encoded SHA-256 fingerprint of a
+	// certificate selected earlier, which is used instead of prompting the
+	// user if it still matches.
+	Preferred string
+}
+
+// Cred returns a Key wrapping the first valid certificate in the system store
+// matching a given issuer string.
+func Cred(issuer string, storeName string, provider string) (*Key, error) {
+	return CredWithOptions(issuer, storeName, provider, SelectOptions{})
+}
+
+// CredWithOptions is like Cred, but only considers the certificates selected
+// by opts.
+func CredWithOptions(issuer string, storeName string, provider string, opts SelectOptions) (*Key, error) {
+	eku, fingerprint, ksp, prompt := opts.EKU, opts.Fingerprint, opts.KeyStorageProvider, opts.Prompt
+	if ksp == AutoKeyStorageProvider {
+		ksp = ""
 	}
-	i, err := windows.UTF16PtrFromString(issuer)
+	if ksp != "" {
+		if err := checkStorageProvider(ksp); err != nil {
+			return nil, err
+		}
+	}
+	store, err := openStore(storeName, provider)
 	if err != nil {
 		return nil, err
 	}
+	findType, i := uint32(findIssuerStr), (*uint16)(nil)
+	if issuer == "" && fingerprint != "" {
+		findType = findAny
+	} else if i, err = windows.UTF16PtrFromString(issuer); err != nil {
+		return nil, err
+	}
 	var prev *windows.CertContext
+	var candidates []*Key
+	defer func() {
+		for _, c := range candidates {
+			windows.CertFreeCertificateContext(c.ctx)
+		}
+	}()
 	for {
-		nc, err := findCert(store, encodingX509ASN, 0, findIssuerStr, i, prev)
+		nc, err := findCert(store, encodingX509ASN, 0, findType, i, prev)
 		if err != nil {
 			return nil, fmt.Errorf("finding certificates: %w", err)
 		}
 		if nc == nil {
-			return nil, errors.New("no certificate found")
+			break
 		}
 		prev = nc
 		if (intendedKeyUsage(encodingX509ASN, nc) & signatureKeyUsage) == 0 {
@@ -240,7 +357,23 @@ func Cred(issuer string, storeName string, provider string) (*Key, error) {
 		}
 
 		xc, err := certContextToX509(nc)
-		if err != nil {
+		if err != nil || !config.MatchesEKU(xc, eku) || !config.MatchesFingerprint(xc, fingerprint) {
+			continue
+		}
+
+		// The provider name is only needed to filter by ksp, otherwise it is
+		// informational and failing to read it is not fatal.
+		var (
+			storageProvider string
+			card            smartCard
+		)
+		if priv, err := acquirePrivateKey(nc); err == nil {
+			storageProvider, _ = keyStorageProvider(priv)
+			if strings.EqualFold(storageProvider, SmartCardKeyStorageProvider) {
+				card = keySmartCard(priv)
+			}
+		}
+		if ksp != "" && !strings.EqualFold(storageProvider, ksp) {
 			continue
 		}
 
@@ -248,22 +381,117 @@ func Cred(issuer string, storeName string, provider string) (*Key, error) {
 		if err != nil {
 			continue
 		}
-		return &Key{
-			cert:  xc,
-			ctx:   nc,
-			store: store,
-			chain: machineChain,
-		}, nil
+		key := &Key{
+			cert:            xc,
+			ctx:             nc,
+			store:           store,
+			chain:           machineChain,
+			provider:        provider,
+			storageProvider: storageProvider,
+			card:            card,
+		}
+		if !prompt {
+			return key, nil
+		}
+		// findCert frees nc when it looks for the next certificate.
+		key.ctx = windows.CertDuplicateCertificateContext(nc)
+		candidates = append(candidates, key)
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	selected := preferredIndex(candidates, opts.Preferred)
+	if selected < 0 {
+		selected = preferredIndex(candidates, lastSelection())
+	}
+	if selected < 0 {
+		selected = 0
+		if len(candidates) > 1 {
+			if selected, err = selectCert(candidates); err != nil {
+				return nil, err
+			}
+		}
+	}
+	key := candidates[selected]
+	candidates = append(candidates[:selected], candidates[selected+1:]...)
+	return key, nil
+}
+
+// preferredIndex returns the index of the key in candidates whose certificate
+// fingerprint is preferred, or -1 if there is none.
+func preferredIndex(candidates []*Key, preferred string) int {
+	if preferred == "" {
+		return -1
+	}
+	for i, c := range candidates {
+		if config.MatchesFingerprint(c.cert, preferred) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Identities returns the certificates in the system store storeName of
+// provider that Cred can use: those allowing signatures whose private key can
+// be acquired without prompting the user. Tools use it to list the
+// certificates to choose from when writing a config.
+func Identities(storeName string, provider string) ([]*x509.Certificate, error) {
+	store, err := openStore(storeName, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertCloseStore(store, 0)
+	var identities []*x509.Certificate
+	var prev *windows.CertContext
+	for {
+		nc, err := findCert(store, encodingX509ASN, 0, findAny, nil, prev)
+		if err != nil {
+			return nil, fmt.Errorf("finding certificates: %w", err)
+		}
+		if nc == nil {
+			return identities, nil
+		}
+		prev = nc
+		if (intendedKeyUsage(encodingX509ASN, nc) & signatureKeyUsage) == 0 {
+			continue
+		}
+		if _, err := acquirePrivateKey(nc); err != nil {
+			continue
+		}
+		if xc, err := certContextToX509(nc); err == nil {
+			identities = append(identities, xc)
+		}
 	}
 }
 
 // Key is a wrapper around the certificate store and context that uses it to
 // implement signing-related methods with CryptoNG functionality.
 type Key struct {
-	cert  *x509.Certificate
-	ctx   *windows.CertContext
-	store windows.Handle
-	chain []*x509.Certificate
+	cert            *x509.Certificate
+	ctx             *windows.CertContext
+	store           windows.Handle
+	chain           []*x509.Certificate
+	provider        string
+	storageProvider string
+	card            smartCard    // The card holding the key, for the smart card key storage provider.
+	mu              sync.RWMutex // Held for reading by operations and for writing by Close.
+	closed          bool
+	closeErr        error
+}
+
+// ErrKeyClosed is returned by the operations of a Key after it has been
+// closed.
+var ErrKeyClosed = errors.New("key is closed")
+
+// Provider returns the certificate store location holding this Key.
+func (k *Key) Provider() string {
+	return k.provider
+}
+
+// StorageProvider returns the name of the key storage provider holding the
+// private key, or an empty string if it could not be determined.
+func (k *Key) StorageProvider() string {
+	return k.storageProvider
 }
 
 // CertificateChain returns the credential as a raw X509 cert chain. This
@@ -277,12 +505,150 @@ func (k *Key) CertificateChain() [][]byte {
 	return chain
 }
 
-// Close releases resources held by the credential.
+// Close releases resources held by the credential. It is safe to call more
+// than once; later calls return the result of the first one.
 func (k *Key) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return k.closeErr
+	}
+	k.closed = true
 	if err := windows.CertFreeCertificateContext(k.ctx); err != nil {
+		k.closeErr = err
+		return err
+	}
+	k.closeErr = windows.CertCloseStore(k.store, 0)
+	return k.closeErr
+}
+
+// rlock locks k for an operation, or returns ErrKeyClosed if k has been
+// closed, since its certificate context has then been freed. The caller must
+// call k.mu.RUnlock if it returns nil.
+func (k *Key) rlock() error {
+	k.mu.RLock()
+	if k.closed {
+		k.mu.RUnlock()
+		return ErrKeyClosed
+	}
+	return nil
+}
+
+// CheckPresent returns an error wrapping ErrCardNotPresent if the key is held
+// by the smart card key storage provider and the card holding it, as found in
+// its reader when the key was opened, is no longer present. Keys of other
+// providers are always present.
+func (k *Key) CheckPresent() error {
+	if err := k.rlock(); err != nil {
+		return err
+	}
+	defer k.mu.RUnlock()
+	if !strings.EqualFold(k.storageProvider, SmartCardKeyStorageProvider) {
+		return nil
+	}
+	present, err := cardPresent(k.card)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCardNotPresent, err)
+	}
+	if !present {
+		return ErrCardNotPresent
+	}
+	return nil
+}
+
+// WaitPresenceChange waits up to timeout for the card holding the key to be
+// inserted or removed, unless whether the key is present already differs from
+// present, and reports whether the key is present then. Keys of other providers than
+// the smart card key storage provider are always present.
+func (k *Key) WaitPresenceChange(present bool, timeout time.Duration) bool {
+	if !strings.EqualFold(k.storageProvider, SmartCardKeyStorageProvider) {
+		if present {
+			time.Sleep(timeout)
+		}
+		return true
+	}
+	now, err := waitForCardChange(k.card, present, timeout)
+	if err != nil {
+		// Avoid spinning while the smart card service is unavailable.
+		time.Sleep(smartCardPollInterval)
+		return false
+	}
+	return now
+}
+
+// SetPIN sets the PIN of the smart card holding the private key, so that later
+// operations do not prompt for it. The private key handle is cached in the
+// certificate context, which keeps the PIN for the lifetime of the Key.
+func (k *Key) SetPIN(pin []byte) error {
+	if err := k.rlock(); err != nil {
+		return err
+	}
+	defer k.mu.RUnlock()
+	key, err := acquirePrivateKey(k.ctx)
+	if err != nil {
+		return fmt.Errorf("cannot acquire private key handle: %w", err)
+	}
+	pinUTF16, err := utf16FromBytes(pin)
+	if err != nil {
 		return err
 	}
-	return windows.CertCloseStore(k.store, 0)
+	value := unsafe.Slice((*byte)(unsafe.Pointer(&pinUTF16[0])), len(pinUTF16)*2)
+	defer zeroize.Bytes(value)
+	if err := setProperty(key, nCryptPINProperty, value); err != nil {
+		return fmt.Errorf("setting smart card PIN: %w", err)
+	}
+	return nil
+}
+
+// utf16FromBytes returns the NUL-terminated UTF-16 encoding of the UTF-8 secret
+// b, like windows.UTF16FromString, without copying b into a string, which
+// cannot be scrubbed. The caller zeroes the result once it is used.
+func utf16FromBytes(b []byte) ([]uint16, error) {
+	if bytes.IndexByte(b, 0) != -1 {
+		return nil, syscall.EINVAL
+	}
+	// Each byte of UTF-8 encodes at most one UTF-16 code unit, so the
+	// result is never reallocated, which would leave a copy behind.
+	u := make([]uint16, 0, len(b)+1)
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+			u = append(u, uint16(r1), uint16(r2))
+		} else {
+			u = append(u, uint16(r))
+		}
+	}
+	return append(u, 0), nil
+}
+
+// Capabilities returns the algorithms that CryptoNG supports with the key, or
+// none if the Key is closed. RSA keys only sign and decrypt with SHA-256, and
+// the operations that the NCRYPT_KEY_USAGE_PROPERTY of the key does not allow
+// are left out. Keys whose usage cannot be read are taken to allow signing and
+// decryption.
+func (k *Key) Capabilities() util.Capabilities {
+	if err := k.rlock(); err != nil {
+		return util.Capabilities{}
+	}
+	defer k.mu.RUnlock()
+	usage := uint32(nCryptAllowSigningFlag | nCryptAllowDecryptFlag)
+	if key, err := acquirePrivateKey(k.ctx); err == nil {
+		if u, err := keyUsage(key); err == nil {
+			usage = u
+		}
+	}
+	_, isRSA := k.Public().(*rsa.PublicKey)
+	return util.ProbeCapabilities(k.Public(), func(alg util.Algorithm) bool {
+		if alg.Decrypt {
+			return usage&nCryptAllowDecryptFlag != 0 && alg.Hash == crypto.SHA256
+		}
+		if usage&nCryptAllowSigningFlag == 0 {
+			return false
+		}
+		_, ok := algID(alg.Hash)
+		return !isRSA || ok
+	})
 }
 
 // Public returns the corresponding public key for this Key.
@@ -292,9 +658,83 @@ func (k *Key) Public() crypto.PublicKey {
 
 // Sign signs a message digest. Here, we pass off the signing to the Windows CryptoNG library.
 func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
 	key, err := acquirePrivateKey(k.ctx)
 	if err != nil {
 		return nil, fmt.Errorf("cannot acquire private key handle: %w", err)
 	}
 	return SignHash(key, k.Public(), digest, opts)
 }
+
+// Encrypt encrypts a plaintext message with the RSA public key using RSA-OAEP.
+// opts must be the crypto.Hash used by OAEP, or an *rsa.OAEPOptions.
+func (k *Key) Encrypt(plaintext []byte, opts any) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	hash, label, err := util.EncryptOAEPOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := k.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", k.Public())
+	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	return rsa.EncryptOAEP(hash.New(), rand.Reader, pub, plaintext, label)
+}
+
+// Decrypt decrypts a ciphertext message. Here, we pass off the decryption to
+// the Windows CryptoNG library. Only *rsa.OAEPOptions is supported for opts.
+func (k *Key) Decrypt(ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	oaepOpts, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, fmt.Errorf("unsupported DecrypterOpts: %v", opts)
+	}
+	if _, ok := k.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", k.Public())
+	}
+	key, err := acquirePrivateKey(k.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot acquire private key handle: %w", err)
+	}
+	return DecryptOAEP(key, ciphertext, oaepOpts.Hash, oaepOpts.Label)
+}
+
+// KeyAgreement returns the ECDH shared secret of the EC private key and peer.
+// Here, we pass off the key agreement to the Windows CryptoNG library.
+func (k *Key) KeyAgreement(peer *ecdsa.PublicKey) ([]byte, error) {
+	if err := k.rlock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.RUnlock()
+	if _, ok := k.Public().(*ecdsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", k.Public())
+	}
+	key, err := acquirePrivateKey(k.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot acquire private key handle: %w", err)
+	}
+	return SecretAgreement(key, peer)
+}
+
+// WrapKey encrypts a symmetric key with the RSA public key using RSA-OAEP and
+// the given hash function.
+func (k *Key) WrapKey(key []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Encrypt(key, hash)
+}
+
+// UnwrapKey decrypts a symmetric key wrapped by WrapKey.
+func (k *Key) UnwrapKey(wrappedKey []byte, hash crypto.Hash) ([]byte, error) {
+	return k.Decrypt(wrappedKey, &rsa.OAEPOptions{Hash: hash})
+}
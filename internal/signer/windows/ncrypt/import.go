@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package ncrypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+	"golang.org/x/sys/windows"
+)
+
+// ImportPKCS12Cred imports the certificates and private key of a PKCS#12 file
+// into the named system store of provider, which must be local_machine or
+// current_user. The private key is persisted with a CNG key storage provider.
+func ImportPKCS12Cred(credPath string, password []byte, storeName string, provider string) error {
+	var keySet uint32
+	switch provider {
+	case "local_machine":
+		keySet = windows.CRYPT_MACHINE_KEYSET
+	case "current_user":
+		keySet = windows.CRYPT_USER_KEYSET
+	default:
+		return errors.New("provider must be local_machine or current_user")
+	}
+	data, err := os.ReadFile(credPath)
+	if err != nil {
+		return fmt.Errorf("error reading PKCS#12 file: %w", err)
+	}
+	defer zeroize.Bytes(data)
+	if len(data) == 0 {
+		return errors.New("PKCS#12 file is empty")
+	}
+	passwordUTF16, err := utf16FromBytes(password)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for i := range passwordUTF16 {
+			passwordUTF16[i] = 0
+		}
+	}()
+
+	blob := windows.CryptDataBlob{Size: uint32(len(data)), Data: &data[0]}
+	pfxStore, err := windows.PFXImportCertStore(&blob, &passwordUTF16[0], keySet|windows.PKCS12_PREFER_CNG_KSP)
+	if err != nil {
+		return fmt.Errorf("failed to import PKCS#12 data: %w", err)
+	}
+	defer windows.CertCloseStore(pfxStore, 0)
+
+	store, err := openStore(storeName, provider)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	var ctx *windows.CertContext
+	imported := 0
+	for {
+		ctx, err = windows.CertEnumCertificatesInStore(pfxStore, ctx)
+		if errors.Is(err, syscall.Errno(cryptENotFound)) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading PKCS#12 certificates: %w", err)
+		}
+		if err := windows.CertAddCertificateContextToStore(store, ctx, windows.CERT_STORE_ADD_REPLACE_EXISTING, nil); err != nil {
+			windows.CertFreeCertificateContext(ctx)
+			return fmt.Errorf("adding certificate to store %s: %w", storeName, err)
+		}
+		imported++
+	}
+	if imported == 0 {
+		return errors.New("PKCS#12 file does not contain a certificate")
+	}
+	return nil
+}
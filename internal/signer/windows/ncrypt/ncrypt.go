@@ -21,7 +21,9 @@ package ncrypt
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"unsafe"
@@ -34,15 +36,44 @@ import (
 const (
 	// bcrypt.h constants
 	bcryptPadPKCS1 = 0x00000002 // BCRYPT_PAD_PKCS1
+	bcryptPadOAEP  = 0x00000004 // BCRYPT_PAD_OAEP
 	bcryptPadPSS   = 0x00000008 // BCRYPT_PAD_PSS
 
+	bcryptECDHPublicP256Magic = 0x314B4345      // BCRYPT_ECDH_PUBLIC_P256_MAGIC
+	bcryptECDHPublicP384Magic = 0x334B4345      // BCRYPT_ECDH_PUBLIC_P384_MAGIC
+	bcryptECDHPublicP521Magic = 0x354B4345      // BCRYPT_ECDH_PUBLIC_P521_MAGIC
+	bcryptECCPublicBlob       = "ECCPUBLICBLOB" // BCRYPT_ECCPUBLIC_BLOB
+	bcryptKDFRawSecret        = "TRUNCATE"      // BCRYPT_KDF_RAW_SECRET
+
 	// ncrypt.h constants
 	nCryptSilentFlag = 0x00000040 // NCRYPT_SILENT_FLAG
+
+	// ncrypt.h property names
+	nCryptProviderHandleProperty = "Provider Handle" // NCRYPT_PROVIDER_HANDLE_PROPERTY
+	nCryptNameProperty           = "Name"            // NCRYPT_NAME_PROPERTY
+	nCryptPINProperty            = "SmartCardPin"    // NCRYPT_PIN_PROPERTY
+	nCryptReaderProperty         = "SmartCardReader" // NCRYPT_READER_PROPERTY
+	nCryptKeyUsageProperty       = "Key Usage"       // NCRYPT_KEY_USAGE_PROPERTY
+
+	// ncrypt.h key usage flags
+	nCryptAllowDecryptFlag = 0x00000001 // NCRYPT_ALLOW_DECRYPT_FLAG
+	nCryptAllowSigningFlag = 0x00000002 // NCRYPT_ALLOW_SIGNING_FLAG
 )
 
 var (
 	nCrypt         = windows.MustLoadDLL("ncrypt.dll")
 	nCryptSignHash = nCrypt.MustFindProc("NCryptSignHash")
+	nCryptDecrypt  = nCrypt.MustFindProc("NCryptDecrypt")
+
+	nCryptImportKey       = nCrypt.MustFindProc("NCryptImportKey")
+	nCryptSecretAgreement = nCrypt.MustFindProc("NCryptSecretAgreement")
+	nCryptDeriveKey       = nCrypt.MustFindProc("NCryptDeriveKey")
+
+	nCryptGetProperty          = nCrypt.MustFindProc("NCryptGetProperty")
+	nCryptSetProperty          = nCrypt.MustFindProc("NCryptSetProperty")
+	nCryptFreeObject           = nCrypt.MustFindProc("NCryptFreeObject")
+	nCryptFreeBuffer           = nCrypt.MustFindProc("NCryptFreeBuffer")
+	nCryptEnumStorageProviders = nCrypt.MustFindProc("NCryptEnumStorageProviders")
 )
 
 // bcypt.h structs.
@@ -53,12 +84,32 @@ type pssPaddingInfo struct {
 	algID      *uint16
 	saltLength uint32
 }
+type providerName struct {
+	name    *uint16
+	comment *uint16
+}
+type oaepPaddingInfo struct {
+	algID     *uint16
+	label     *byte
+	labelSize uint32
+}
+
+// status returns the 32-bit result of a Windows API call, such as a
+// SECURITY_STATUS, a LONG or a BOOL. Only the lower half of the return register
+// is defined for these types, and on arm64 the upper half is not guaranteed to
+// be zero, so the result must not be compared as a uintptr.
+func status(r uintptr, _ uintptr, _ error) uint32 {
+	return uint32(r)
+}
 
 func algID(hashFunc crypto.Hash) (*uint16, bool) {
 	algID, ok := map[crypto.Hash][]uint16{
 		crypto.SHA256: {'S', 'H', 'A', '2', '5', '6', 0}, // BCRYPT_SHA256_ALGORITHM
 	}[hashFunc]
-	return &algID[0], ok
+	if !ok {
+		return nil, false
+	}
+	return &algID[0], true
 }
 
 func rsaPadding(opts crypto.SignerOpts, flags *int) (paddingInfo unsafe.Pointer, err error) {
@@ -98,7 +149,7 @@ func rsaPadding(opts crypto.SignerOpts, flags *int) (paddingInfo unsafe.Pointer,
 
 func signHashInternal(priv windows.Handle, pub crypto.PublicKey, digest []byte, flags int, paddingInfo unsafe.Pointer) ([]byte, error) {
 	var size uint32
-	r, _, _ := nCryptSignHash.Call(
+	r := status(nCryptSignHash.Call(
 		/* hKey */ uintptr(priv),
 		/* *pPaddingInfo */ uintptr(paddingInfo),
 		/* pbHashValue */ uintptr(unsafe.Pointer(&digest[0])),
@@ -106,13 +157,13 @@ func signHashInternal(priv windows.Handle, pub crypto.PublicKey, digest []byte,
 		/* pbSignature */ 0,
 		/* cbSignature */ 0,
 		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
-		/* dwFlagss */ uintptr(flags))
+		/* dwFlagss */ uintptr(flags)))
 	if r != 0 {
 		return nil, fmt.Errorf("NCryptSignHash: failed to get signature length: %#x", r)
 	}
 
 	sig := make([]byte, size)
-	r, _, _ = nCryptSignHash.Call(
+	r = status(nCryptSignHash.Call(
 		/* hKey */ uintptr(priv),
 		/* *pPaddingInfo */ uintptr(paddingInfo),
 		/* pbHashValue */ uintptr(unsafe.Pointer(&digest[0])),
@@ -120,7 +171,7 @@ func signHashInternal(priv windows.Handle, pub crypto.PublicKey, digest []byte,
 		/* pbSignature */ uintptr(unsafe.Pointer(&sig[0])),
 		/* cbSignature */ uintptr(size),
 		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
-		/* dwFlagss */ uintptr(flags))
+		/* dwFlagss */ uintptr(flags)))
 	if r != 0 {
 		return nil, fmt.Errorf("NCryptSignHash: failed to get signature: %#x", r)
 	}
@@ -168,3 +219,287 @@ func SignHash(priv windows.Handle, pub crypto.PublicKey, digest []byte, opts cry
 
 	return signHashInternal(priv, pub, digest, flags, paddingInfo)
 }
+
+// DecryptOAEP is a wrapper for the NCryptDecrypt function that decrypts
+// ciphertext with RSAES-OAEP and the given label, which may be empty, using the
+// given hash function for both the label and the mask generation function.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptdecrypt
+func DecryptOAEP(priv windows.Handle, ciphertext []byte, hash crypto.Hash, label []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("empty ciphertext")
+	}
+	algID, ok := algID(hash)
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	info := &oaepPaddingInfo{algID: algID}
+	if len(label) > 0 {
+		info.label, info.labelSize = &label[0], uint32(len(label))
+	}
+	paddingInfo := unsafe.Pointer(info)
+	flags := nCryptSilentFlag | bcryptPadOAEP
+
+	var size uint32
+	r := status(nCryptDecrypt.Call(
+		/* hKey */ uintptr(priv),
+		/* pbInput */ uintptr(unsafe.Pointer(&ciphertext[0])),
+		/* cbInput */ uintptr(len(ciphertext)),
+		/* *pPaddingInfo */ uintptr(paddingInfo),
+		/* pbOutput */ 0,
+		/* cbOutput */ 0,
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ uintptr(flags)))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptDecrypt: failed to get plaintext length: %#x", r)
+	}
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	plaintext := make([]byte, size)
+	r = status(nCryptDecrypt.Call(
+		/* hKey */ uintptr(priv),
+		/* pbInput */ uintptr(unsafe.Pointer(&ciphertext[0])),
+		/* cbInput */ uintptr(len(ciphertext)),
+		/* *pPaddingInfo */ uintptr(paddingInfo),
+		/* pbOutput */ uintptr(unsafe.Pointer(&plaintext[0])),
+		/* cbOutput */ uintptr(size),
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ uintptr(flags)))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptDecrypt: failed to decrypt: %#x", r)
+	}
+	return plaintext[:size], nil
+}
+
+// SecretAgreement returns the ECDH shared secret of the EC private key priv
+// and peer, the big-endian X coordinate of the shared point. The peer public
+// key is imported into the key storage provider of priv, and the secret is
+// read with NCryptSecretAgreement and NCryptDeriveKey(BCRYPT_KDF_RAW_SECRET).
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptsecretagreement
+func SecretAgreement(priv windows.Handle, peer *ecdsa.PublicKey) ([]byte, error) {
+	blob, err := eccPublicBlob(peer)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := getProperty(priv, nCryptProviderHandleProperty)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < int(unsafe.Sizeof(uintptr(0))) {
+		return nil, fmt.Errorf("invalid provider handle of %d bytes", len(buf))
+	}
+	provider := *(*windows.Handle)(unsafe.Pointer(&buf[0]))
+	defer nCryptFreeObject.Call(uintptr(provider))
+
+	blobType, err := windows.UTF16PtrFromString(bcryptECCPublicBlob)
+	if err != nil {
+		return nil, err
+	}
+	var peerKey windows.Handle
+	r := status(nCryptImportKey.Call(
+		/* hProvider */ uintptr(provider),
+		/* hImportKey */ 0,
+		/* pszBlobType */ uintptr(unsafe.Pointer(blobType)),
+		/* pParameterList */ 0,
+		/* *phKey */ uintptr(unsafe.Pointer(&peerKey)),
+		/* pbData */ uintptr(unsafe.Pointer(&blob[0])),
+		/* cbData */ uintptr(len(blob)),
+		/* dwFlags */ uintptr(nCryptSilentFlag)))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptImportKey: failed to import the peer public key: %#x", r)
+	}
+	defer nCryptFreeObject.Call(uintptr(peerKey))
+
+	var agreement windows.Handle
+	r = status(nCryptSecretAgreement.Call(
+		/* hPrivKey */ uintptr(priv),
+		/* hPubKey */ uintptr(peerKey),
+		/* *phAgreedSecret */ uintptr(unsafe.Pointer(&agreement)),
+		/* dwFlags */ uintptr(nCryptSilentFlag)))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptSecretAgreement: %#x", r)
+	}
+	defer nCryptFreeObject.Call(uintptr(agreement))
+
+	kdf, err := windows.UTF16PtrFromString(bcryptKDFRawSecret)
+	if err != nil {
+		return nil, err
+	}
+	var size uint32
+	r = status(nCryptDeriveKey.Call(
+		/* hSharedSecret */ uintptr(agreement),
+		/* pwszKDF */ uintptr(unsafe.Pointer(kdf)),
+		/* pParameterList */ 0,
+		/* pbDerivedKey */ 0,
+		/* cbDerivedKey */ 0,
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptDeriveKey: failed to get secret length: %#x", r)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("NCryptDeriveKey: empty secret")
+	}
+	secret := make([]byte, size)
+	r = status(nCryptDeriveKey.Call(
+		/* hSharedSecret */ uintptr(agreement),
+		/* pwszKDF */ uintptr(unsafe.Pointer(kdf)),
+		/* pParameterList */ 0,
+		/* pbDerivedKey */ uintptr(unsafe.Pointer(&secret[0])),
+		/* cbDerivedKey */ uintptr(size),
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptDeriveKey: failed to derive secret: %#x", r)
+	}
+	secret = secret[:size]
+	// BCRYPT_KDF_RAW_SECRET returns the secret in little-endian byte order.
+	for i, j := 0, len(secret)-1; i < j; i, j = i+1, j-1 {
+		secret[i], secret[j] = secret[j], secret[i]
+	}
+	return secret, nil
+}
+
+// eccPublicBlob encodes pub as a BCRYPT_ECCKEY_BLOB for ECDH, followed by the
+// big-endian X and Y coordinates.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/bcrypt/ns-bcrypt-bcrypt_ecckey_blob
+func eccPublicBlob(pub *ecdsa.PublicKey) ([]byte, error) {
+	var magic uint32
+	switch pub.Curve {
+	case elliptic.P256():
+		magic = bcryptECDHPublicP256Magic
+	case elliptic.P384():
+		magic = bcryptECDHPublicP384Magic
+	case elliptic.P521():
+		magic = bcryptECDHPublicP521Magic
+	default:
+		return nil, fmt.Errorf("unsupported curve %v", pub.Curve.Params().Name)
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	blob := make([]byte, 8+2*size)
+	binary.LittleEndian.PutUint32(blob[0:], magic)
+	binary.LittleEndian.PutUint32(blob[4:], uint32(size))
+	pub.X.FillBytes(blob[8 : 8+size])
+	pub.Y.FillBytes(blob[8+size:])
+	return blob, nil
+}
+
+// getProperty is a wrapper for the NCryptGetProperty function.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptgetproperty
+func getProperty(object windows.Handle, property string) ([]byte, error) {
+	propertyPtr, err := windows.UTF16PtrFromString(property)
+	if err != nil {
+		return nil, err
+	}
+	var size uint32
+	r := status(nCryptGetProperty.Call(
+		/* hObject */ uintptr(object),
+		/* pszProperty */ uintptr(unsafe.Pointer(propertyPtr)),
+		/* pbOutput */ 0,
+		/* cbOutput */ 0,
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptGetProperty(%s): failed to get property length: %#x", property, r)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("NCryptGetProperty(%s): empty property", property)
+	}
+	buf := make([]byte, size)
+	r = status(nCryptGetProperty.Call(
+		/* hObject */ uintptr(object),
+		/* pszProperty */ uintptr(unsafe.Pointer(propertyPtr)),
+		/* pbOutput */ uintptr(unsafe.Pointer(&buf[0])),
+		/* cbOutput */ uintptr(size),
+		/* *pcbResult */ uintptr(unsafe.Pointer(&size)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptGetProperty(%s): failed to get property: %#x", property, r)
+	}
+	return buf[:size], nil
+}
+
+// setProperty is a wrapper for the NCryptSetProperty function.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptsetproperty
+func setProperty(object windows.Handle, property string, value []byte) error {
+	propertyPtr, err := windows.UTF16PtrFromString(property)
+	if err != nil {
+		return err
+	}
+	var valuePtr *byte
+	if len(value) > 0 {
+		valuePtr = &value[0]
+	}
+	r := status(nCryptSetProperty.Call(
+		/* hObject */ uintptr(object),
+		/* pszProperty */ uintptr(unsafe.Pointer(propertyPtr)),
+		/* pbInput */ uintptr(unsafe.Pointer(valuePtr)),
+		/* cbInput */ uintptr(len(value)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return fmt.Errorf("NCryptSetProperty(%s): %#x", property, r)
+	}
+	return nil
+}
+
+// keyUsage returns the NCRYPT_KEY_USAGE_PROPERTY of priv, the operations that
+// the key allows.
+func keyUsage(priv windows.Handle) (uint32, error) {
+	buf, err := getProperty(priv, nCryptKeyUsageProperty)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < 4 {
+		return 0, fmt.Errorf("invalid key usage of %d bytes", len(buf))
+	}
+	return *(*uint32)(unsafe.Pointer(&buf[0])), nil
+}
+
+// keyStorageProvider returns the name of the key storage provider holding
+// priv, read from its NCRYPT_PROVIDER_HANDLE_PROPERTY.
+func keyStorageProvider(priv windows.Handle) (string, error) {
+	buf, err := getProperty(priv, nCryptProviderHandleProperty)
+	if err != nil {
+		return "", err
+	}
+	if len(buf) < int(unsafe.Sizeof(uintptr(0))) {
+		return "", fmt.Errorf("invalid provider handle of %d bytes", len(buf))
+	}
+	provider := *(*windows.Handle)(unsafe.Pointer(&buf[0]))
+	defer nCryptFreeObject.Call(uintptr(provider))
+	name, err := getProperty(provider, nCryptNameProperty)
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&name[0])), len(name)/2)), nil
+}
+
+// StorageProviders returns the names of the CNG key storage providers
+// registered on the machine, wrapping NCryptEnumStorageProviders.
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/ncrypt/nf-ncrypt-ncryptenumstorageproviders
+func StorageProviders() ([]string, error) {
+	var (
+		count uint32
+		list  *providerName
+	)
+	r := status(nCryptEnumStorageProviders.Call(
+		/* *pdwProviderCount */ uintptr(unsafe.Pointer(&count)),
+		/* **ppProviderList */ uintptr(unsafe.Pointer(&list)),
+		/* dwFlags */ 0))
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptEnumStorageProviders: %#x", r)
+	}
+	defer nCryptFreeBuffer.Call(uintptr(unsafe.Pointer(list)))
+	names := make([]string, 0, count)
+	for _, p := range unsafe.Slice(list, count) {
+		names = append(names, windows.UTF16PtrToString(p.name))
+	}
+	return names, nil
+}
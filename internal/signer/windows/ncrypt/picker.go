@@ -0,0 +1,155 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package ncrypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	cryptui = windows.NewLazySystemDLL("cryptui.dll")
+
+	cryptUIDlgSelectCertificateFromStore = cryptui.NewProc("CryptUIDlgSelectCertificateFromStore")
+
+	user32 = windows.NewLazySystemDLL("user32.dll")
+
+	getProcessWindowStation  = user32.NewProc("GetProcessWindowStation")
+	getUserObjectInformation = user32.NewProc("GetUserObjectInformationW")
+)
+
+const (
+	uoiFlags   = 1 // UOI_FLAGS
+	wsfVisible = 1 // WSF_VISIBLE
+)
+
+// userObjectFlags is the USEROBJECTFLAGS structure.
+type userObjectFlags struct {
+	inherit  int32
+	reserved int32
+	flags    uint32
+}
+
+var (
+	selectionMu sync.Mutex
+	// selection is the fingerprint of the certificate that the user selected
+	// in the dialog, so that reopening the credential, such as on refresh,
+	// does not prompt again.
+	selection string
+)
+
+// lastSelection returns the fingerprint of the certificate last selected by
+// the user in this process, or "" if the dialog was not shown.
+func lastSelection() string {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	return selection
+}
+
+func rememberSelection(cert *x509.Certificate) {
+	digest := sha256.Sum256(cert.Raw)
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+	selection = hex.EncodeToString(digest[:])
+}
+
+// interactive reports whether the process runs on a window station that the
+// user can see. Services and remote shells run on a hidden one, where the
+// dialog would wait for input forever.
+func interactive() bool {
+	if err := getUserObjectInformation.Find(); err != nil {
+		return false
+	}
+	ws, _, _ := getProcessWindowStation.Call()
+	if ws == 0 {
+		return false
+	}
+	var f userObjectFlags
+	var needed uint32
+	ok, _, _ := getUserObjectInformation.Call(ws, uoiFlags, uintptr(unsafe.Pointer(&f)), unsafe.Sizeof(f), uintptr(unsafe.Pointer(&needed)))
+	return ok != 0 && f.flags&wsfVisible != 0
+}
+
+const (
+	pickerTitle   = "Select a certificate"
+	pickerMessage = "Several certificates match the enterprise certificate configuration. Select the certificate to use for client authentication."
+)
+
+// selectCert shows the certificate selection dialog of Windows with the
+// certificates of candidates and returns the index of the one selected by the
+// user, which later calls prefer over prompting again.
+func selectCert(candidates []*Key) (int, error) {
+	if !interactive() {
+		return 0, errors.New("several certificates match and the selection dialog cannot be shown without an interactive desktop, set sha256_fingerprint to select one")
+	}
+	// The dialog lists the certificates of a store, so the candidates are
+	// copied to a store of their own.
+	mem, err := windows.CertOpenStore(windows.CERT_STORE_PROV_MEMORY, 0, 0, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("opening memory store: %w", err)
+	}
+	defer windows.CertCloseStore(mem, 0)
+	for _, c := range candidates {
+		if err := windows.CertAddCertificateContextToStore(mem, c.ctx, windows.CERT_STORE_ADD_ALWAYS, nil); err != nil {
+			return 0, fmt.Errorf("adding certificate to memory store: %w", err)
+		}
+	}
+	title, err := windows.UTF16PtrFromString(pickerTitle)
+	if err != nil {
+		return 0, err
+	}
+	message, err := windows.UTF16PtrFromString(pickerMessage)
+	if err != nil {
+		return 0, err
+	}
+	if err := cryptUIDlgSelectCertificateFromStore.Find(); err != nil {
+		return 0, fmt.Errorf("certificate selection dialog is unavailable: %w", err)
+	}
+	h, _, _ := cryptUIDlgSelectCertificateFromStore.Call(
+		uintptr(mem),
+		0, // No parent window.
+		uintptr(unsafe.Pointer(title)),
+		uintptr(unsafe.Pointer(message)),
+		0, // Show every column.
+		0,
+		0,
+	)
+	if h == 0 {
+		return 0, errors.New("no certificate was selected")
+	}
+	selected := certContextFromHandle(h)
+	defer windows.CertFreeCertificateContext(selected)
+	xc, err := certContextToX509(selected)
+	if err != nil {
+		return 0, err
+	}
+	for i, c := range candidates {
+		if bytes.Equal(c.cert.Raw, xc.Raw) {
+			rememberSelection(c.cert)
+			return i, nil
+		}
+	}
+	return 0, errors.New("the selected certificate is not a candidate")
+}
@@ -0,0 +1,303 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package ncrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// SmartCardKeyStorageProvider is the name of the key storage provider of
+// smart cards using the Windows inbox minidriver.
+const SmartCardKeyStorageProvider = "Microsoft Smart Card Key Storage Provider"
+
+// DefaultSmartCardWait bounds the time WaitForSmartCard is given by the
+// signer when the config does not set smart_card_wait.
+const DefaultSmartCardWait = 30 * time.Second
+
+// ErrCardNotPresent is returned by WaitForSmartCard when no smart card was
+// inserted before the deadline, and by CheckPresent when the card holding the
+// key is not present.
+var ErrCardNotPresent = errors.New("no smart card present")
+
+const (
+	// winscard.h constants
+	scardScopeUser    = 0          // SCARD_SCOPE_USER
+	scardStateChanged = 0x00000002 // SCARD_STATE_CHANGED
+	scardStatePresent = 0x00000020 // SCARD_STATE_PRESENT
+
+	// winerror.h constants
+	scardETimeout            = 0x8010000A // SCARD_E_TIMEOUT
+	scardENoReadersAvailable = 0x8010002E // SCARD_E_NO_READERS_AVAILABLE
+
+	smartCardPollInterval = 500 * time.Millisecond
+	smartCardLogInterval  = 5 * time.Second
+)
+
+var (
+	winscard = windows.NewLazySystemDLL("winscard.dll")
+
+	scardEstablishContext = winscard.NewProc("SCardEstablishContext")
+	scardReleaseContext   = winscard.NewProc("SCardReleaseContext")
+	scardListReaders      = winscard.NewProc("SCardListReadersW")
+	scardGetStatusChange  = winscard.NewProc("SCardGetStatusChangeW")
+)
+
+// scardReaderState is the SCARD_READERSTATEW structure.
+type scardReaderState struct {
+	reader       *uint16
+	userData     uintptr
+	currentState uint32
+	eventState   uint32
+	atrLen       uint32
+	atr          [36]byte
+}
+
+// WaitForSmartCard waits up to timeout for the Smart Card service (SCardSvr)
+// to accept connections and for a card to be present in a reader, logging
+// progress while waiting. It returns an error wrapping ErrCardNotPresent if no
+// card is present by then. A zero timeout disables waiting, and checking for a
+// card, so that opening the key reports why it is unavailable instead.
+func WaitForSmartCard(timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	return waitFor(timeout, smartCardPollInterval, func() (bool, error) {
+		return cardPresent(smartCard{})
+	})
+}
+
+// smartCard identifies the card holding a key by the reader it was found in
+// and the ATR of the card then. The zero smartCard matches a card in any
+// reader.
+type smartCard struct {
+	reader string // The name of the reader, or "" for any reader.
+	atr    []byte // The ATR of the card, or nil if unknown.
+}
+
+// keySmartCard returns the card holding priv, a key of the smart card key
+// storage provider, or the zero smartCard if its reader cannot be read.
+func keySmartCard(priv windows.Handle) smartCard {
+	buf, err := getProperty(priv, nCryptReaderProperty)
+	if err != nil || len(buf) < 2 {
+		return smartCard{}
+	}
+	card := smartCard{reader: windows.UTF16ToString(unsafe.Slice((*uint16)(unsafe.Pointer(&buf[0])), len(buf)/2))}
+	// Without the ATR, any card in the reader is taken for the one holding
+	// the key.
+	card.atr, _ = readerATR(card.reader)
+	return card
+}
+
+// matches reports whether s, as updated by SCardGetStatusChange, shows c.
+func (c smartCard) matches(s scardReaderState) bool {
+	if s.eventState&scardStatePresent == 0 {
+		return false
+	}
+	if c.reader == "" {
+		return true
+	}
+	if windows.UTF16PtrToString(s.reader) != c.reader {
+		return false
+	}
+	return c.atr == nil || bytes.Equal(stateATR(s), c.atr)
+}
+
+// present reports whether states, as updated by SCardGetStatusChange, show c
+// in any reader.
+func (c smartCard) present(states []scardReaderState) bool {
+	for _, s := range states {
+		if c.matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// stateATR returns the ATR of the card in the reader of s.
+func stateATR(s scardReaderState) []byte {
+	n := int(s.atrLen)
+	if n > len(s.atr) {
+		n = len(s.atr)
+	}
+	return s.atr[:n]
+}
+
+// readerATR returns the ATR of the card in the named reader.
+func readerATR(reader string) ([]byte, error) {
+	var ctx uintptr
+	if r := status(scardEstablishContext.Call(scardScopeUser, 0, 0, uintptr(unsafe.Pointer(&ctx)))); r != 0 {
+		return nil, fmt.Errorf("smart card service not available: %w", windows.Errno(r))
+	}
+	defer scardReleaseContext.Call(ctx)
+
+	name, err := windows.UTF16PtrFromString(reader)
+	if err != nil {
+		return nil, err
+	}
+	states := []scardReaderState{{reader: name}}
+	if r := status(scardGetStatusChange.Call(ctx, 0, uintptr(unsafe.Pointer(&states[0])), 1)); r != 0 {
+		return nil, fmt.Errorf("SCardGetStatusChange: %w", windows.Errno(r))
+	}
+	if states[0].eventState&scardStatePresent == 0 {
+		return nil, fmt.Errorf("no card in reader %q", reader)
+	}
+	return append([]byte(nil), stateATR(states[0])...), nil
+}
+
+// waitFor calls poll every interval until it reports true or timeout elapses.
+func waitFor(timeout, interval time.Duration, poll func() (bool, error)) error {
+	start := time.Now()
+	var lastLog time.Time
+	for {
+		present, err := poll()
+		if present {
+			if !lastLog.IsZero() {
+				log.Printf("Smart card present after %v", time.Since(start).Round(time.Millisecond))
+			}
+			return nil
+		}
+		waited := time.Since(start)
+		if waited >= timeout {
+			if err != nil {
+				return fmt.Errorf("%w after waiting %v: %v", ErrCardNotPresent, timeout, err)
+			}
+			return fmt.Errorf("%w after waiting %v", ErrCardNotPresent, timeout)
+		}
+		if time.Since(lastLog) >= smartCardLogInterval {
+			lastLog = time.Now()
+			log.Printf("Waiting for smart card (%v of %v): %v", waited.Round(time.Second), timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// cardPresent reports whether card is present in a smart card reader. The
+// error describes why it was not found.
+func cardPresent(card smartCard) (bool, error) {
+	var ctx uintptr
+	if r := status(scardEstablishContext.Call(scardScopeUser, 0, 0, uintptr(unsafe.Pointer(&ctx)))); r != 0 {
+		return false, fmt.Errorf("smart card service not available: %w", windows.Errno(r))
+	}
+	defer scardReleaseContext.Call(ctx)
+
+	readers, err := listReaders(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(readers) == 0 {
+		return false, errors.New("no smart card reader")
+	}
+	states := make([]scardReaderState, len(readers))
+	for i := range readers {
+		states[i].reader = &readers[i][0]
+	}
+	if r := status(scardGetStatusChange.Call(ctx, 0, uintptr(unsafe.Pointer(&states[0])), uintptr(len(states)))); r != 0 {
+		return false, fmt.Errorf("SCardGetStatusChange: %w", windows.Errno(r))
+	}
+	if card.present(states) {
+		return true, nil
+	}
+	if card.reader != "" {
+		return false, fmt.Errorf("the card holding the key is not in reader %q", card.reader)
+	}
+	return false, errors.New("no card in any reader")
+}
+
+// waitForCardChange waits up to timeout for a card to be inserted in or
+// removed from a reader, unless whether card is present already differs from
+// present, and reports whether card is present then.
+func waitForCardChange(card smartCard, present bool, timeout time.Duration) (bool, error) {
+	var ctx uintptr
+	if r := status(scardEstablishContext.Call(scardScopeUser, 0, 0, uintptr(unsafe.Pointer(&ctx)))); r != 0 {
+		return false, fmt.Errorf("smart card service not available: %w", windows.Errno(r))
+	}
+	defer scardReleaseContext.Call(ctx)
+
+	readers, err := listReaders(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(readers) == 0 {
+		// There is no reader to wait on. Readers plugged in meanwhile are
+		// found by the next call.
+		time.Sleep(timeout)
+		return false, nil
+	}
+	states := make([]scardReaderState, len(readers))
+	for i := range readers {
+		states[i].reader = &readers[i][0]
+	}
+	if r := status(scardGetStatusChange.Call(ctx, 0, uintptr(unsafe.Pointer(&states[0])), uintptr(len(states)))); r != 0 {
+		return false, fmt.Errorf("SCardGetStatusChange: %w", windows.Errno(r))
+	}
+	if now := card.present(states); now != present {
+		return now, nil
+	}
+	for i := range states {
+		states[i].currentState = states[i].eventState &^ scardStateChanged
+	}
+	r := status(scardGetStatusChange.Call(ctx, uintptr(timeout.Milliseconds()), uintptr(unsafe.Pointer(&states[0])), uintptr(len(states))))
+	switch r {
+	case 0:
+		return card.present(states), nil
+	case scardETimeout:
+		return present, nil
+	default:
+		return false, fmt.Errorf("SCardGetStatusChange: %w", windows.Errno(r))
+	}
+}
+
+// listReaders returns the names of the smart card readers, wrapping
+// SCardListReadersW.
+func listReaders(ctx uintptr) ([][]uint16, error) {
+	var size uint32
+	r := status(scardListReaders.Call(ctx, 0, 0, uintptr(unsafe.Pointer(&size))))
+	if r == scardENoReadersAvailable {
+		return nil, nil
+	}
+	if r != 0 {
+		return nil, fmt.Errorf("SCardListReaders: %w", windows.Errno(r))
+	}
+	buf := make([]uint16, size)
+	r = status(scardListReaders.Call(ctx, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))))
+	if r == scardENoReadersAvailable {
+		return nil, nil
+	}
+	if r != 0 {
+		return nil, fmt.Errorf("SCardListReaders: %w", windows.Errno(r))
+	}
+	// The names form a multi-string, terminated by an empty string.
+	var readers [][]uint16
+	for start, i := 0, 0; i < int(size); i++ {
+		if buf[i] != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		readers = append(readers, buf[start:i+1])
+		start = i + 1
+	}
+	return readers, nil
+}
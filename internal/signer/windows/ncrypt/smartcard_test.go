@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package ncrypt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestWaitFor(t *testing.T) {
+	polls := 0
+	err := waitFor(time.Second, time.Millisecond, func() (bool, error) {
+		polls++
+		return polls == 3, errors.New("no card in any reader")
+	})
+	if err != nil {
+		t.Errorf("waitFor: got %v, want nil err", err)
+	}
+	if polls != 3 {
+		t.Errorf("waitFor: got %d polls, want 3", polls)
+	}
+
+	err = waitFor(10*time.Millisecond, time.Millisecond, func() (bool, error) {
+		return false, errors.New("no smart card reader")
+	})
+	if !errors.Is(err, ErrCardNotPresent) {
+		t.Errorf("waitFor: got %v, want ErrCardNotPresent", err)
+	}
+}
+
+func TestWaitForSmartCardDisabled(t *testing.T) {
+	if err := WaitForSmartCard(0); err != nil {
+		t.Errorf("WaitForSmartCard(0): got %v, want nil err", err)
+	}
+}
+
+func TestSmartCardMatches(t *testing.T) {
+	name := func(reader string) *uint16 {
+		p, err := windows.UTF16PtrFromString(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	state := func(reader string, atr []byte) scardReaderState {
+		s := scardReaderState{reader: name(reader), eventState: scardStatePresent, atrLen: uint32(len(atr))}
+		copy(s.atr[:], atr)
+		return s
+	}
+	atr := []byte{0x3b, 0x8f, 0x80, 0x01}
+	card := smartCard{reader: "Reader 0", atr: atr}
+	tests := []struct {
+		name  string
+		card  smartCard
+		state scardReaderState
+		want  bool
+	}{
+		{name: "same card", card: card, state: state("Reader 0", atr), want: true},
+		{name: "other card", card: card, state: state("Reader 0", []byte{0x3b, 0x00})},
+		{name: "other reader", card: card, state: state("Reader 1", atr)},
+		{name: "empty reader", card: card, state: scardReaderState{reader: name("Reader 0")}},
+		{name: "unknown ATR", card: smartCard{reader: "Reader 0"}, state: state("Reader 0", []byte{0x3b, 0x00}), want: true},
+		{name: "any card", card: smartCard{}, state: state("Reader 1", atr), want: true},
+	}
+	for _, test := range tests {
+		if got := test.card.matches(test.state); got != test.want {
+			t.Errorf("matches(%s): got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
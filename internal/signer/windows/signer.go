@@ -11,6 +11,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build windows
+// +build windows
+
 // Signer.go is a net/rpc server that listens on stdin/stdout, exposing
 // methods that perform device certificate signing for Windows OS using ncrypt utils.
 // This server is intended to be launched as a subprocess by the signer client,
@@ -18,103 +21,108 @@
 package main
 
 import (
-	"crypto"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/gob"
-	"io"
-	"log"
-	"net/rpc"
-	"os"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/windows/ncrypt"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/startup"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
 )
 
-// If ECP Logging is enabled return true
-// Otherwise return false
-func enableECPLogging() bool {
-	if os.Getenv("ENABLE_ENTERPRISE_CERTIFICATE_LOGS") != "" {
-		return true
-	}
+// backend opens the credentials of the Windows certificate stores.
+type backend struct{}
 
-	log.SetOutput(io.Discard)
-	return false
+func (backend) Name() string {
+	return "ncrypt"
 }
 
-func init() {
-	gob.Register(crypto.SHA256)
-	gob.Register(crypto.SHA384)
-	gob.Register(crypto.SHA512)
-	gob.Register(&rsa.PSSOptions{})
+// IsTransient reports whether err is a transient failure of the keystore.
+func (backend) IsTransient(err error) bool {
+	return ncrypt.IsTransient(err)
 }
 
-// SignArgs contains arguments to a crypto Signer.Sign method.
-type SignArgs struct {
-	Digest []byte            // The content to sign.
-	Opts   crypto.SignerOpts // Options for signing, such as Hash identifier.
+// Open returns the credential described by config, retrying transient errors
+// as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	if ws := config.CertConfigs.WindowsStore; strings.EqualFold(ws.KeyStorageProvider, ncrypt.SmartCardKeyStorageProvider) {
+		wait := ncrypt.DefaultSmartCardWait
+		if ws.SmartCardWait != "" {
+			// The duration was checked by config.Validate.
+			wait, _ = time.ParseDuration(ws.SmartCardWait)
+		}
+		if err := ncrypt.WaitForSmartCard(wait); err != nil {
+			return nil, err
+		}
+	}
+	pin, err := resolvePIN(config.CertConfigs.WindowsStore.PIN)
+	if err != nil {
+		return nil, err
+	}
+	// The PIN is only needed to unlock the key.
+	defer zeroize.Bytes(pin)
+	var key *ncrypt.Key
+	err = util.DoWithRetry(config.Retry, ncrypt.IsTransient, func() (err error) {
+		key, err = ncrypt.CredWithOptions(config.CertConfigs.WindowsStore.Issuer, config.CertConfigs.WindowsStore.Store, config.CertConfigs.WindowsStore.Provider, ncrypt.SelectOptions{
+			EKU:                config.CertConfigs.WindowsStore.EKU,
+			Fingerprint:        config.CertConfigs.WindowsStore.Fingerprint,
+			KeyStorageProvider: config.CertConfigs.WindowsStore.KeyStorageProvider,
+			Prompt:             promptForSelection(config.CertConfigs.WindowsStore),
+			Preferred:          startup.Selected(),
+		})
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pin) > 0 {
+		if err := key.SetPIN(pin); err != nil {
+			key.Close()
+			return nil, err
+		}
+	}
+	return credential{key}, nil
 }
 
-// A EnterpriseCertSigner exports RPC methods for signing.
-type EnterpriseCertSigner struct {
-	key *ncrypt.Key
+// resolvePIN returns the smart card PIN that the pin field pinRef holds or
+// references.
+func resolvePIN(pinRef string) ([]byte, error) {
+	pin, err := config.ResolveSecret(pinRef)
+	if err != nil {
+		return nil, fmt.Errorf("windows_store pin: %w", err)
+	}
+	return pin, nil
 }
 
-// A Connection wraps a pair of unidirectional streams as an io.ReadWriteCloser.
-type Connection struct {
-	io.ReadCloser
-	io.WriteCloser
+// promptForSelection reports whether ws asks the user to choose between
+// several matching certificates.
+func promptForSelection(ws config.WindowsStore) bool {
+	return ws.Selection == config.SelectionPrompt
 }
 
-// Close closes c's underlying ReadCloser and WriteCloser.
-func (c *Connection) Close() error {
-	rerr := c.ReadCloser.Close()
-	werr := c.WriteCloser.Close()
-	if rerr != nil {
-		return rerr
-	}
-	return werr
+// credential is a certificate store key served by the signer.
+type credential struct {
+	*ncrypt.Key
 }
 
-// CertificateChain returns the credential as a raw X509 cert chain. This
-// contains the public key.
-func (k *EnterpriseCertSigner) CertificateChain(ignored struct{}, certificateChain *[][]byte) error {
-	*certificateChain = k.key.CertificateChain()
-	return nil
-}
-
-// Public returns the corresponding public key for this Key, in ASN.1 DER form.
-func (k *EnterpriseCertSigner) Public(ignored struct{}, publicKey *[]byte) (err error) {
-	*publicKey, err = x509.MarshalPKIXPublicKey(k.key.Public())
-	return
+// Metadata describes the certificate store holding the credential.
+func (c credential) Metadata() server.Metadata {
+	return server.Metadata{
+		KeystoreType:       "ncrypt",
+		KeyStorageProvider: c.StorageProvider(),
+		StoreLocation:      c.Provider(),
+	}
 }
 
-// Sign signs a message digest specified by args and writes the output to resp.
-func (k *EnterpriseCertSigner) Sign(args SignArgs, resp *[]byte) (err error) {
-	*resp, err = k.key.Sign(nil, args.Digest, args.Opts)
-	return
+// Capabilities describes the algorithms that CryptoNG supports with the
+// credential.
+func (c credential) Capabilities() util.Capabilities {
+	return c.Key.Capabilities()
 }
 
 func main() {
-	enableECPLogging()
-	if len(os.Args) != 2 {
-		log.Fatalln("Signer is not meant to be invoked manually, exiting...")
-	}
-	configFilePath := os.Args[1]
-	config, err := util.LoadConfig(configFilePath)
-	if err != nil {
-		log.Fatalf("Failed to load enterprise cert config: %v", err)
-	}
-
-	enterpriseCertSigner := new(EnterpriseCertSigner)
-	enterpriseCertSigner.key, err = ncrypt.Cred(config.CertConfigs.WindowsStore.Issuer, config.CertConfigs.WindowsStore.Store, config.CertConfigs.WindowsStore.Provider)
-	if err != nil {
-		log.Fatalf("Failed to initialize enterprise cert signer using ncrypt: %v", err)
-	}
-
-	if err := rpc.Register(enterpriseCertSigner); err != nil {
-		log.Fatalf("Failed to register enterprise cert signer with net/rpc: %v", err)
-	}
-
-	rpc.ServeConn(&Connection{os.Stdin, os.Stdout})
+	server.Main(backend{})
 }
@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package startup defines the machine-readable startup status of the signer
+// binaries. When the client sets the StatusEnv environment variable, the signer
+// writes a single status record to standard error, as a line holding Prefix
+// followed by a JSON encoded Record:
+//
+//	ECP_STATUS {"status":"ready"}
+//	ECP_STATUS {"status":"error","code":"credential_unavailable","message":"..."}
+//
+// The signer also exits with a code specific to the failure, so that a failed
+// startup can be diagnosed without the record, and can report the failure to
+// the system log with a stable event ID.
+package startup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/systemlog"
+)
+
+// StatusEnv is the environment variable set by the client to request the
+// status record. Its value is "stderr".
+const StatusEnv = "ECP_STARTUP_STATUS"
+
+// SelectedEnv is the environment variable set by the client when it replaces a
+// signer subprocess, to the hex-encoded SHA-256 fingerprint of the certificate
+// served by the replaced one. The user already chose that certificate, and
+// confirmed its use, so the replacement serves it again without asking them.
+const SelectedEnv = "ECP_SELECTED_CERTIFICATE"
+
+// Selected returns the fingerprint set by the client in SelectedEnv, or "" if
+// the signer does not replace another one.
+func Selected() string {
+	return os.Getenv(SelectedEnv)
+}
+
+// Prefix starts the line holding the status record.
+const Prefix = "ECP_STATUS "
+
+// Values of Record.Status.
+const (
+	StatusReady = "ready"
+	StatusError = "error"
+)
+
+// Error codes of a failed startup.
+const (
+	CodeConfig     = "config_invalid"         // The config file could not be loaded.
+	CodeCredential = "credential_unavailable" // The keystore did not yield a credential.
+	CodeInternal   = "internal"               // The signer could not serve requests.
+)
+
+// CodeOperation is the error code of a failed private key operation, which the
+// signer reports to the system log while it keeps serving requests.
+const CodeOperation = "operation_failed"
+
+// Exit codes of a failed startup, by error code. Other failures exit with 1.
+var exitCodes = map[string]int{
+	CodeConfig:     3,
+	CodeCredential: 4,
+	CodeInternal:   5,
+}
+
+// Event IDs of a failed startup in the system log, by error code. They are
+// stable, so that endpoint management tooling can alert on them.
+var eventIDs = map[string]uint32{
+	CodeConfig:     1001,
+	CodeCredential: 1002,
+	CodeInternal:   1003,
+	CodeOperation:  1004,
+}
+
+// eventIDOther is the event ID of other failures.
+const eventIDOther = 1000
+
+// SystemLogEnv is the environment variable that enables reporting failures to
+// the system log, like the system_log field of the config. It also covers
+// failures to load the config.
+const SystemLogEnv = "ENABLE_ENTERPRISE_CERTIFICATE_SYSTEM_LOG"
+
+// systemLog is the system log failures are reported to, if enabled.
+var systemLog systemlog.Logger
+
+// EnableSystemLog reports later failures to the system log as well, if
+// enabled is true or SystemLogEnv is set.
+func EnableSystemLog(enabled bool) {
+	if systemLog != nil || (!enabled && os.Getenv(SystemLogEnv) == "") {
+		return
+	}
+	l, err := systemlog.Open()
+	if err != nil {
+		log.Printf("Failed to open the system log: %v", err)
+		return
+	}
+	systemLog = l
+}
+
+// EventID returns the system log event ID for the error code.
+func EventID(code string) uint32 {
+	if id, ok := eventIDs[code]; ok {
+		return id
+	}
+	return eventIDOther
+}
+
+// ExitCode returns the exit code of the signer for the error code.
+func ExitCode(code string) int {
+	if exitCode, ok := exitCodes[code]; ok {
+		return exitCode
+	}
+	return 1
+}
+
+// A Record is the startup status of a signer.
+type Record struct {
+	Status  string `json:"status"`            // StatusReady or StatusError.
+	Code    string `json:"code,omitempty"`    // The error code, if Status is StatusError.
+	Message string `json:"message,omitempty"` // A description of the error, if Status is StatusError.
+}
+
+// requested reports whether the client requested the status record.
+func requested() bool {
+	return os.Getenv(StatusEnv) == "stderr"
+}
+
+// Write writes the status record to w.
+func Write(w io.Writer, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", Prefix, data)
+	return err
+}
+
+// Ready reports that the signer is ready to serve requests, if the client
+// requested the status record.
+func Ready() {
+	if requested() {
+		_ = Write(os.Stderr, Record{Status: StatusReady})
+	}
+}
+
+// Fail logs the startup failure, reports it in the status record if the client
+// requested it and to the system log if enabled, and exits with the exit code
+// of the error code.
+func Fail(code string, format string, v ...any) {
+	message := fmt.Sprintf(format, v...)
+	log.Print(message)
+	EnableSystemLog(false)
+	if systemLog != nil {
+		_ = systemLog.Error(systemlog.Event{ID: EventID(code), Code: code, Operation: "startup", Message: message})
+		_ = systemLog.Close()
+	}
+	if requested() {
+		_ = Write(os.Stderr, Record{Status: StatusError, Code: code, Message: message})
+	}
+	os.Exit(ExitCode(code))
+}
+
+// OperationFailed reports the failure of a private key operation, such as
+// "sign", to the system log if enabled.
+func OperationFailed(operation string, err error) {
+	if systemLog == nil {
+		return
+	}
+	_ = systemLog.Error(systemlog.Event{ID: EventID(CodeOperation), Code: CodeOperation, Operation: operation, Message: err.Error()})
+}
+
+// Parse returns the status record held by line, which must not include the
+// line terminator.
+func Parse(line string) (Record, bool) {
+	if !strings.HasPrefix(line, Prefix) {
+		return Record{}, false
+	}
+	var record Record
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, Prefix)), &record); err != nil || record.Status == "" {
+		return Record{}, false
+	}
+	return record, true
+}
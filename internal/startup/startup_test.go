@@ -0,0 +1,105 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package startup
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/systemlog"
+)
+
+func TestWriteParse(t *testing.T) {
+	for _, record := range []Record{
+		{Status: StatusReady},
+		{Status: StatusError, Code: CodeCredential, Message: "no identity found"},
+	} {
+		var buf bytes.Buffer
+		if err := Write(&buf, record); err != nil {
+			t.Fatalf("Write: got %v, want nil err", err)
+		}
+		line := buf.String()
+		if !strings.HasSuffix(line, "\n") {
+			t.Errorf("Write: got %q, want a complete line", line)
+		}
+		got, ok := Parse(strings.TrimSuffix(line, "\n"))
+		if !ok || got != record {
+			t.Errorf("Parse(%q): got %+v, %v, want %+v, true", line, got, ok, record)
+		}
+	}
+}
+
+func TestParseOther(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"2024/01/01 00:00:00 Failed to load enterprise cert config",
+		Prefix + "not json",
+		Prefix + "{}",
+	} {
+		if got, ok := Parse(line); ok {
+			t.Errorf("Parse(%q): got %+v, want no record", line, got)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	codes := map[int]bool{}
+	for _, code := range []string{CodeConfig, CodeCredential, CodeInternal} {
+		exitCode := ExitCode(code)
+		if exitCode <= 1 || codes[exitCode] {
+			t.Errorf("ExitCode(%q): got %d, want a distinct code above 1", code, exitCode)
+		}
+		codes[exitCode] = true
+	}
+	if got := ExitCode("unknown"); got != 1 {
+		t.Errorf("ExitCode: got %d, want 1 for an unknown code", got)
+	}
+}
+
+func TestEventID(t *testing.T) {
+	ids := map[uint32]bool{EventID("unknown"): true}
+	for _, code := range []string{CodeConfig, CodeCredential, CodeInternal, CodeOperation} {
+		id := EventID(code)
+		if ids[id] {
+			t.Errorf("EventID(%q): got %d, want a distinct event ID", code, id)
+		}
+		ids[id] = true
+	}
+}
+
+type fakeLogger struct {
+	events []systemlog.Event
+}
+
+func (l *fakeLogger) Error(event systemlog.Event) error {
+	l.events = append(l.events, event)
+	return nil
+}
+
+func (l *fakeLogger) Close() error {
+	return nil
+}
+
+func TestOperationFailed(t *testing.T) {
+	l := &fakeLogger{}
+	systemLog = l
+	defer func() { systemLog = nil }()
+	OperationFailed("sign", errors.New("token removed"))
+	want := systemlog.Event{ID: EventID(CodeOperation), Code: CodeOperation, Operation: "sign", Message: "token removed"}
+	if len(l.events) != 1 || l.events[0] != want {
+		t.Errorf("OperationFailed: got events %+v, want [%+v]", l.events, want)
+	}
+}
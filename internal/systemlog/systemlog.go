@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package systemlog reports signer failures to the log of the operating
+// system, so that endpoint management tooling can alert on them. On Windows the
+// failures are written to the Application channel of the Event Log, on MacOS to
+// the unified logging system (os_log), and on Linux to the systemd journal.
+package systemlog
+
+// Source is the name under which the signer reports to the system log.
+const Source = "EnterpriseCertificateProxy"
+
+// An Event is a failure reported to the system log.
+type Event struct {
+	ID        uint32 // A stable ID of the kind of failure.
+	Code      string // The error code, such as "credential_unavailable".
+	Operation string // The operation that failed, such as "startup".
+	Message   string // A description of the failure.
+}
+
+// A Logger writes to the system log.
+type Logger interface {
+	// Error reports a failure.
+	Error(event Event) error
+	// Close releases the resources held by the Logger.
+	Close() error
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package systemlog
+
+/*
+#cgo CFLAGS: -mmacosx-version-min=10.12
+
+#include <os/log.h>
+#include <stdlib.h>
+
+// os_log_with_type is a macro, which cgo cannot call.
+static void ecp_os_log(os_log_t log, os_log_type_t type, const char *msg) {
+	os_log_with_type(log, type, "%{public}s", msg);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Subsystem is the os_log subsystem of the signer. Its logs can be collected
+// with, for example:
+//
+//	log show --predicate 'subsystem == "com.google.enterprise-certificate-proxy"'
+const Subsystem = "com.google.enterprise-certificate-proxy"
+
+var (
+	logsMu sync.Mutex
+	logs   = map[string]C.os_log_t{}
+)
+
+// osLog returns the os_log handle of category. Handles are never released, as
+// is customary for os_log.
+func osLog(category string) C.os_log_t {
+	logsMu.Lock()
+	defer logsMu.Unlock()
+	if l, ok := logs[category]; ok {
+		return l
+	}
+	subsystem := C.CString(Subsystem)
+	defer C.free(unsafe.Pointer(subsystem))
+	cCategory := C.CString(category)
+	defer C.free(unsafe.Pointer(cCategory))
+	l := C.os_log_create(subsystem, cCategory)
+	logs[category] = l
+	return l
+}
+
+func write(l C.os_log_t, logType C.os_log_type_t, message string) {
+	msg := C.CString(message)
+	defer C.free(unsafe.Pointer(msg))
+	C.ecp_os_log(l, logType, msg)
+}
+
+// osLogger reports failures to the "failures" category of the unified log.
+type osLogger struct {
+	l C.os_log_t
+}
+
+// Open returns a Logger writing errors to the unified logging system.
+func Open() (Logger, error) {
+	return &osLogger{l: osLog("failures")}, nil
+}
+
+func (l *osLogger) Error(event Event) error {
+	write(l.l, C.OS_LOG_TYPE_ERROR, fmt.Sprintf("[event %d] %s failed (%s): %s", event.ID, event.Operation, event.Code, event.Message))
+	return nil
+}
+
+func (l *osLogger) Close() error {
+	return nil
+}
+
+// osLogWriter writes each call to Write as an entry of the unified log.
+type osLogWriter struct {
+	l C.os_log_t
+}
+
+// NewWriter returns an io.Writer that writes to category of the unified
+// logging system, for use with log.SetOutput. Each Write is one entry.
+func NewWriter(category string) (io.Writer, error) {
+	return &osLogWriter{l: osLog(category)}, nil
+}
+
+func (w *osLogWriter) Write(p []byte) (int, error) {
+	write(w.l, C.OS_LOG_TYPE_DEFAULT, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package systemlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// SyslogIdentifier identifies the entries of the signer in the journal, for
+// example in "journalctl -t ecp-signer".
+const SyslogIdentifier = "ecp-signer"
+
+// journalSocket is the socket of the native protocol of systemd-journald.
+var journalSocket = "/run/systemd/journal/socket"
+
+// Journal priorities, as in syslog(3).
+const (
+	priorityError = 3
+	priorityInfo  = 6
+)
+
+// journal writes entries to systemd-journald with its native protocol.
+type journal struct {
+	conn *net.UnixConn
+}
+
+func openJournal() (*journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the systemd journal: %w", err)
+	}
+	return &journal{conn: conn}, nil
+}
+
+// send writes an entry with the message, priority and extra fields.
+func (j *journal) send(priority int, message string, fields map[string]string) error {
+	var buf bytes.Buffer
+	appendField(&buf, "MESSAGE", message)
+	appendField(&buf, "PRIORITY", fmt.Sprint(priority))
+	appendField(&buf, "SYSLOG_IDENTIFIER", SyslogIdentifier)
+	for key, value := range fields {
+		appendField(&buf, key, value)
+	}
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+// appendField appends a field in the native journal format. Values holding a
+// newline are written with their little-endian 64-bit length instead of "=".
+func appendField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// Open returns a Logger writing errors to the systemd journal, with the fields
+// ECP_EVENT_ID, ECP_ERROR_CODE and ECP_OPERATION.
+func Open() (Logger, error) {
+	return openJournal()
+}
+
+func (j *journal) Error(event Event) error {
+	return j.send(priorityError, event.Message, map[string]string{
+		"ECP_EVENT_ID":   fmt.Sprint(event.ID),
+		"ECP_ERROR_CODE": event.Code,
+		"ECP_OPERATION":  event.Operation,
+	})
+}
+
+func (j *journal) Close() error {
+	return j.conn.Close()
+}
+
+// journalWriter writes each call to Write as an entry of the journal.
+type journalWriter struct {
+	j        *journal
+	category string
+}
+
+// NewWriter returns an io.Writer that writes to the systemd journal, with the
+// category in the ECP_CATEGORY field, for use with log.SetOutput. Each Write
+// is one entry.
+func NewWriter(category string) (io.Writer, error) {
+	j, err := openJournal()
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{j: j, category: category}, nil
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	if err := w.j.send(priorityInfo, strings.TrimRight(string(p), "\n"), map[string]string{"ECP_CATEGORY": w.category}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
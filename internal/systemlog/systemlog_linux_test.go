@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package systemlog
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendField(t *testing.T) {
+	var buf bytes.Buffer
+	appendField(&buf, "MESSAGE", "one line")
+	appendField(&buf, "MESSAGE", "two\nlines")
+	want := "MESSAGE=one line\n" + "MESSAGE\n\x09\x00\x00\x00\x00\x00\x00\x00two\nlines\n"
+	if got := buf.String(); got != want {
+		t.Errorf("appendField: got %q, want %q", got, want)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	defer func(path string) { journalSocket = path }(journalSocket)
+	journalSocket = filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	l, err := Open()
+	if err != nil {
+		t.Fatalf("Open: got %v, want nil err", err)
+	}
+	defer l.Close()
+	if err := l.Error(Event{ID: 1002, Code: "credential_unavailable", Operation: "startup", Message: "no identity"}); err != nil {
+		t.Fatalf("Error: got %v, want nil err", err)
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := string(buf[:n])
+	for _, field := range []string{"MESSAGE=no identity\n", "PRIORITY=3\n", "SYSLOG_IDENTIFIER=ecp-signer\n", "ECP_EVENT_ID=1002\n", "ECP_ERROR_CODE=credential_unavailable\n", "ECP_OPERATION=startup\n"} {
+		if !strings.Contains(entry, field) {
+			t.Errorf("Error: entry %q lacks field %q", entry, field)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !linux && !(darwin && cgo)
+// +build !windows
+// +build !linux
+// +build !darwin !cgo
+
+package systemlog
+
+import (
+	"errors"
+	"io"
+)
+
+// Open returns an error, as the system log is not supported on this platform.
+func Open() (Logger, error) {
+	return nil, errors.New("the system log is not supported on this platform")
+}
+
+// NewWriter returns an error, as the system log is not supported on this
+// platform.
+func NewWriter(category string) (io.Writer, error) {
+	return nil, errors.New("the system log is not supported on this platform")
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package systemlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Open returns a Logger writing to the Application channel of the Windows
+// Event Log. The event source does not need to be registered, in which case
+// Event Viewer shows the message without a message file.
+func Open() (Logger, error) {
+	l, err := eventlog.Open(Source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{l}, nil
+}
+
+// eventLog reports failures as Error events with the event ID of the failure.
+type eventLog struct {
+	l *eventlog.Log
+}
+
+func (l *eventLog) Error(event Event) error {
+	return l.l.Error(event.ID, fmt.Sprintf("%s failed (%s): %s", event.Operation, event.Code, event.Message))
+}
+
+func (l *eventLog) Close() error {
+	return l.l.Close()
+}
+
+// NewWriter returns an error, as only failures are reported to the Event Log.
+func NewWriter(category string) (io.Writer, error) {
+	return nil, errors.New("the logs are not written to the Event Log")
+}
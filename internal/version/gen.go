@@ -0,0 +1,56 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build ignore
+// +build ignore
+
+// Gen writes release.go, which defines Release as the version in version.txt
+// at the root of the repository. It is run by go generate.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const header = `// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by gen.go from version.txt. DO NOT EDIT.
+
+package version
+`
+
+func main() {
+	data, err := os.ReadFile("../../version.txt")
+	if err != nil {
+		log.Fatalf("Failed to read version: %v", err)
+	}
+	release := strings.TrimSpace(string(data))
+	src := fmt.Sprintf("%s\n// Release is the version of this source tree, from version.txt.\nconst Release = %q\n", header, release)
+	if err := os.WriteFile("release.go", []byte(src), 0644); err != nil {
+		log.Fatalf("Failed to write release.go: %v", err)
+	}
+}
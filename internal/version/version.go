@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package version reports the version of the enterprise certificate proxy
+// binaries. The values are set at link time by the release tooling in
+// cmd/release, for example:
+//
+//	go build -ldflags "-X github.com/googleapis/enterprise-certificate-proxy/internal/version.Version=v0.3.4"
+//
+// Release is generated from version.txt; run go generate after changing it.
+package version
+
+//go:generate go run gen.go
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// FeatureSignMessage indicates that the signer accepts a full message in the
+// Message field of SignArgs, which it hashes itself or, with crypto.Hash(0),
+// signs as-is.
+const FeatureSignMessage = "sign-message"
+
+// FeatureWireJSON indicates that the signer can use the json wire format, when
+// selected by the wire_format field of the config.
+const FeatureWireJSON = "wire-json"
+
+// FeatureOAEPLabel indicates that the signer honors the Label of
+// *rsa.OAEPOptions when encrypting and decrypting, rather than ignoring it.
+const FeatureOAEPLabel = "oaep-label"
+
+// Features lists the optional signer features of this build. They are
+// included in String, so that clients can detect them with the Version RPC.
+var Features = []string{FeatureSignMessage, FeatureWireJSON, FeatureOAEPLabel}
+
+// Version is the release version the binary was built from.
+var Version = Release
+
+// Commit is the git commit the binary was built from. When it is not set at
+// link time, the revision recorded by the go command is used if available.
+var Commit = ""
+
+// commit returns Commit, falling back to the VCS revision in the build info.
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				return setting.Value[:7]
+			}
+		}
+	}
+	return "unknown"
+}
+
+// String returns the version and build information in the form printed by
+// --version, e.g.
+// "v0.3.4 (commit 1a2b3c4, go1.21.0 darwin/arm64, features: sign-message)".
+func String() string {
+	return fmt.Sprintf("%s (commit %s, %s %s/%s, features: %s)", Version, commit(), runtime.Version(), runtime.GOOS, runtime.GOARCH, strings.Join(Features, " "))
+}
+
+// HasFeature reports whether the version string s, as returned by String,
+// lists feature. Version strings of builds that predate features never do.
+func HasFeature(s string, feature string) bool {
+	_, features, ok := strings.Cut(s, "features: ")
+	if !ok {
+		return false
+	}
+	for _, f := range strings.Fields(strings.TrimSuffix(features, ")")) {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
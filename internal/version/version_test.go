@@ -0,0 +1,56 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReleaseMatchesVersionFile(t *testing.T) {
+	data, err := os.ReadFile("../../version.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Release, strings.TrimSpace(string(data)); got != want {
+		t.Errorf("Expected Release is %q, got: %q; run go generate ./internal/version", want, got)
+	}
+}
+
+func TestString(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "v1.2.3", "abc1234"
+	if got, want := String(), "v1.2.3 (commit abc1234, "; !strings.HasPrefix(got, want) {
+		t.Errorf("Expected String to start with %q, got: %q", want, got)
+	}
+}
+
+func TestHasFeature(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: String(), want: true},
+		{s: "v0.3.4 (commit abc1234, go1.21.0 linux/amd64, features: foo sign-message)", want: true},
+		{s: "v0.3.4 (commit abc1234, go1.21.0 linux/amd64, features: )", want: false},
+		{s: "v0.3.4 (commit abc1234, go1.21.0 linux/amd64)", want: false},
+		{s: "", want: false},
+	}
+	for _, test := range tests {
+		if got := HasFeature(test.s, FeatureSignMessage); got != test.want {
+			t.Errorf("HasFeature(%q): got %v, want %v", test.s, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"reflect"
+	"sync"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+type request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     uint64            `json:"id"`
+}
+
+type response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *string         `json:"error"`
+}
+
+type clientCodec struct {
+	dec  *json.Decoder
+	enc  *json.Encoder
+	c    io.Closer
+	resp response
+}
+
+func newClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	return &clientCodec{dec: json.NewDecoder(conn), enc: json.NewEncoder(conn), c: conn}
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, param any) error {
+	params, err := marshal(param)
+	if err != nil {
+		return err
+	}
+	return c.enc.Encode(request{Method: r.ServiceMethod, Params: []json.RawMessage{params}, ID: r.Seq})
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	c.resp = response{}
+	if err := c.dec.Decode(&c.resp); err != nil {
+		return err
+	}
+	r.Seq = c.resp.ID
+	r.Error = ""
+	if c.resp.Error != nil {
+		r.Error = *c.resp.Error
+		if r.Error == "" {
+			r.Error = "unspecified error"
+		}
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body any) error {
+	if body == nil || len(c.resp.Result) == 0 {
+		return nil
+	}
+	return unmarshal(c.resp.Result, body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.c.Close()
+}
+
+type serverCodec struct {
+	dec *json.Decoder
+	c   io.Closer
+	req request
+
+	mu  sync.Mutex // Guards enc, since responses are written concurrently.
+	enc *json.Encoder
+}
+
+func newServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &serverCodec{dec: json.NewDecoder(conn), enc: json.NewEncoder(conn), c: conn}
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	c.req = request{}
+	if err := c.dec.Decode(&c.req); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.req.Method
+	r.Seq = c.req.ID
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(body any) error {
+	if body == nil {
+		return nil
+	}
+	if len(c.req.Params) != 1 {
+		return errors.New("wire: request must have exactly one parameter")
+	}
+	return unmarshal(c.req.Params[0], body)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body any) error {
+	resp := response{ID: r.Seq}
+	if r.Error != "" {
+		resp.Error = &r.Error
+	} else {
+		result, err := marshal(body)
+		if err != nil {
+			return err
+		}
+		resp.Result = result
+		// The encoded result is a copy of the reply, which may hold a
+		// secret, and is not used once written.
+		defer zeroize.Bytes(result)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(resp)
+}
+
+func (c *serverCodec) Close() error {
+	return c.c.Close()
+}
+
+// marshal encodes v as JSON, encoding the interface fields of structs, which
+// hold crypto options, as Opts.
+func marshal(v any) (json.RawMessage, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || !hasInterfaceField(rv.Type()) {
+		return json.Marshal(v)
+	}
+	fields := make(map[string]any)
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Type.Kind() != reflect.Interface {
+			fields[f.Name] = rv.Field(i).Interface()
+			continue
+		}
+		if rv.Field(i).IsNil() {
+			fields[f.Name] = nil
+			continue
+		}
+		opts, err := FromOpts(rv.Field(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("wire: field %s: %w", f.Name, err)
+		}
+		fields[f.Name] = opts
+	}
+	return json.Marshal(fields)
+}
+
+// unmarshal decodes data into the value pointed to by v, decoding the
+// interface fields of structs from Opts.
+func unmarshal(data json.RawMessage, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("wire: cannot decode into %T", v)
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct || !hasInterfaceField(rv.Type()) {
+		return json.Unmarshal(data, v)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		raw, ok := fields[f.Name]
+		if !f.IsExported() || !ok {
+			continue
+		}
+		if f.Type.Kind() != reflect.Interface {
+			if err := json.Unmarshal(raw, rv.Field(i).Addr().Interface()); err != nil {
+				return fmt.Errorf("wire: field %s: %w", f.Name, err)
+			}
+			continue
+		}
+		var opts *Opts
+		if err := json.Unmarshal(raw, &opts); err != nil {
+			return fmt.Errorf("wire: field %s: %w", f.Name, err)
+		}
+		if opts == nil {
+			continue
+		}
+		value, err := opts.Value()
+		if err != nil {
+			return fmt.Errorf("wire: field %s: %w", f.Name, err)
+		}
+		if !reflect.TypeOf(value).AssignableTo(f.Type) {
+			return fmt.Errorf("wire: field %s: %s options cannot be used as %v", f.Name, opts.Type, f.Type)
+		}
+		rv.Field(i).Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func hasInterfaceField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() == reflect.Interface {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/cryptoopts"
+)
+
+// Types of Opts.
+const (
+	OptsHash     = "hash"     // A hash function, as crypto.Hash.
+	OptsPSS      = "pss"      // RSA-PSS signing, as *rsa.PSSOptions.
+	OptsOAEP     = "oaep"     // RSA-OAEP encryption, as *rsa.OAEPOptions.
+	OptsPKCS1v15 = "pkcs1v15" // RSA PKCS #1 v1.5 decryption, as *rsa.PKCS1v15DecryptOptions.
+	OptsOpaque   = "opaque"   // Options of another type, as *cryptoopts.Opaque.
+)
+
+// Opts is the json wire format of signer, encrypter and decrypter options.
+// Hash functions are named as by crypto.Hash.String, such as "SHA-256".
+type Opts struct {
+	Type       string `json:"type"`
+	Hash       string `json:"hash,omitempty"`
+	SaltLength int    `json:"salt_length,omitempty"` // Only for OptsPSS.
+	Label      []byte `json:"label,omitempty"`       // Only for OptsOAEP.
+	Name       string `json:"name,omitempty"`        // Only for OptsOpaque, the Go type of the options.
+}
+
+// FromOpts converts options of a type registered in package cryptoopts to
+// Opts. Options of other types are converted as by cryptoopts.Wrap.
+func FromOpts(opts any) (*Opts, error) {
+	switch opts := cryptoopts.Wrap(opts).(type) {
+	case crypto.Hash:
+		return &Opts{Type: OptsHash, Hash: hashName(opts)}, nil
+	case *rsa.PSSOptions:
+		return &Opts{Type: OptsPSS, Hash: hashName(opts.Hash), SaltLength: opts.SaltLength}, nil
+	case *rsa.OAEPOptions:
+		if opts.MGFHash != 0 && opts.MGFHash != opts.Hash {
+			return nil, fmt.Errorf("unsupported OAEP MGF1 hash function %v", opts.MGFHash)
+		}
+		return &Opts{Type: OptsOAEP, Hash: hashName(opts.Hash), Label: opts.Label}, nil
+	case *rsa.PKCS1v15DecryptOptions:
+		return &Opts{Type: OptsPKCS1v15}, nil
+	case *cryptoopts.Opaque:
+		return &Opts{Type: OptsOpaque, Hash: hashName(opts.Hash), Name: opts.Type}, nil
+	}
+	return &Opts{Type: OptsOpaque, Name: fmt.Sprintf("%T", opts)}, nil
+}
+
+// Value converts o to the Go options it stands for.
+func (o *Opts) Value() (any, error) {
+	hash, err := parseHash(o.Hash)
+	if err != nil {
+		return nil, err
+	}
+	switch o.Type {
+	case OptsHash:
+		return hash, nil
+	case OptsPSS:
+		return &rsa.PSSOptions{Hash: hash, SaltLength: o.SaltLength}, nil
+	case OptsOAEP:
+		return &rsa.OAEPOptions{Hash: hash, Label: o.Label}, nil
+	case OptsPKCS1v15:
+		return &rsa.PKCS1v15DecryptOptions{}, nil
+	case OptsOpaque:
+		return &cryptoopts.Opaque{Type: o.Name, Hash: hash}, nil
+	}
+	return nil, fmt.Errorf("unsupported options type %q", o.Type)
+}
+
+func hashName(h crypto.Hash) string {
+	if h == 0 {
+		return ""
+	}
+	return h.String()
+}
+
+func parseHash(name string) (crypto.Hash, error) {
+	if name == "" {
+		return 0, nil
+	}
+	for h := crypto.MD4; h <= crypto.BLAKE2b_512; h++ {
+		if h.String() == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash function %q", name)
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wire selects the encoding of the RPC messages exchanged between the
+// client and the signer over the signer's stdin and stdout.
+//
+// Two wire formats are supported, named by the wire_format field of the
+// certificate config, which both sides read:
+//
+//   - "gob" (the default) encodes the messages of net/rpc with encoding/gob.
+//     It is only practical for signers written in Go.
+//   - "json" encodes them as JSON-RPC 1.0 requests and responses, one JSON
+//     object per line, so that signers can be written in any language.
+//
+// In the json format, a request is {"method": M, "params": [P], "id": N} and a
+// response is {"id": N, "result": R, "error": E}, where E is null or an error
+// string. M is "EnterpriseCertSigner." followed by the method name, such as
+// "EnterpriseCertSigner.Sign". P is an object with the fields of the argument
+// struct of the method, or {} for methods without arguments. Byte strings are
+// base64 encoded, and fields holding signer, encrypter or decrypter options
+// are encoded as an Opts object. The format of the messages of a given format
+// name never changes incompatibly; an incompatible change gets a new name.
+// Before using the json format, the client checks that the signer lists the
+// "wire-json" feature in the output of its --version flag, which signers
+// written in other languages must implement as well.
+//
+// In both formats, the errors of transient failures of the keystore, such as a
+// removed token, start with TransientErrorPrefix, so that the client can tell
+// them from failures of the request, such as a wrong PIN.
+package wire
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/rpc"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/zeroize"
+)
+
+// Supported wire formats.
+const (
+	FormatGob  = "gob"
+	FormatJSON = "json"
+)
+
+// TransientErrorPrefix starts the errors that the signer returns for transient
+// failures of the keystore.
+const TransientErrorPrefix = "transient keystore failure: "
+
+// Check returns an error if format is not a supported wire format. The empty
+// string selects FormatGob.
+func Check(format string) error {
+	switch format {
+	case "", FormatGob, FormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported wire format %q, must be %q or %q", format, FormatGob, FormatJSON)
+}
+
+// NewClient returns a client that talks to a signer over conn in format.
+func NewClient(conn io.ReadWriteCloser, format string) *rpc.Client {
+	if format == FormatJSON {
+		return rpc.NewClientWithCodec(newClientCodec(conn))
+	}
+	return rpc.NewClient(conn)
+}
+
+// ServeConn serves the registered RPC methods on conn in format, until the
+// client hangs up. The []byte replies of the methods named by secret, such as
+// "EnterpriseCertSigner.Decrypt", hold secrets, and are zeroed once written.
+func ServeConn(conn io.ReadWriteCloser, format string, secret ...string) {
+	rpc.ServeCodec(newFormatServerCodec(conn, format, secret))
+}
+
+// newFormatServerCodec returns the server codec of format on conn, which
+// zeroes the replies of the methods named by secret.
+func newFormatServerCodec(conn io.ReadWriteCloser, format string, secret []string) rpc.ServerCodec {
+	var codec rpc.ServerCodec
+	if format == FormatJSON {
+		codec = newServerCodec(conn)
+	} else {
+		codec = newGobServerCodec(conn)
+	}
+	if len(secret) > 0 {
+		codec = &scrubbingCodec{ServerCodec: codec, secret: secret}
+	}
+	return codec
+}
+
+// scrubbingCodec zeroes the []byte replies of the methods named by secret once
+// they are written.
+type scrubbingCodec struct {
+	rpc.ServerCodec
+	secret []string
+}
+
+func (c *scrubbingCodec) WriteResponse(r *rpc.Response, body any) error {
+	err := c.ServerCodec.WriteResponse(r, body)
+	if b, ok := body.(*[]byte); ok {
+		for _, method := range c.secret {
+			if r.ServiceMethod == method {
+				zeroize.Bytes(*b)
+			}
+		}
+	}
+	return err
+}
+
+// gobServerCodec is the server codec of rpc.ServeConn, which net/rpc does not
+// export, so that its replies can be scrubbed.
+type gobServerCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func newGobServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{rwc: conn, dec: gob.NewDecoder(conn), enc: gob.NewEncoder(buf), encBuf: buf}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobServerCodec) ReadRequestBody(body any) error {
+	return c.dec.Decode(body)
+}
+
+// WriteResponse is called by one goroutine at a time, as net/rpc serializes
+// the responses.
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body any) error {
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Gob could not encode the header, which should not happen, so
+			// shut down the connection to signal that it is broken.
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// The body could not be encoded, such as for a type that is
+			// not registered, so shut down the connection.
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined.
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
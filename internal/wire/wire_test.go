@@ -0,0 +1,183 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/cryptoopts"
+)
+
+type SignArgs struct {
+	Digest []byte
+	Opts   crypto.SignerOpts
+}
+
+type Metadata struct {
+	KeystoreType string
+	Provider     string
+}
+
+type Signer struct{}
+
+func (s *Signer) Sign(args SignArgs, resp *string) error {
+	*resp = fmt.Sprintf("%x %#v", args.Digest, args.Opts)
+	return nil
+}
+
+func (s *Signer) Metadata(ignored struct{}, metadata *Metadata) error {
+	*metadata = Metadata{KeystoreType: "test", Provider: "wire"}
+	return nil
+}
+
+func (s *Signer) Fail(ignored struct{}, resp *string) error {
+	return fmt.Errorf("failed")
+}
+
+// plaintext is the reply of Decrypt, kept to check that it is zeroed.
+var plaintext []byte
+
+func (s *Signer) Decrypt(ignored struct{}, resp *[]byte) error {
+	plaintext = []byte("secret")
+	*resp = plaintext
+	return nil
+}
+
+func newTestClient(t *testing.T, format string) *rpc.Client {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("EnterpriseCertSigner", new(Signer)); err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn := net.Pipe()
+	go server.ServeCodec(newFormatServerCodec(serverConn, format, []string{"EnterpriseCertSigner.Decrypt"}))
+	client := NewClient(clientConn, format)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestFormats(t *testing.T) {
+	for _, format := range []string{FormatGob, FormatJSON} {
+		client := newTestClient(t, format)
+		for _, opts := range []crypto.SignerOpts{
+			crypto.SHA256,
+			&rsa.PSSOptions{Hash: crypto.SHA384, SaltLength: rsa.PSSSaltLengthEqualsHash},
+			&cryptoopts.Opaque{Type: "*mypkg.Options", Hash: crypto.SHA512},
+			nil,
+		} {
+			var got string
+			if err := client.Call("EnterpriseCertSigner.Sign", SignArgs{Digest: []byte{1, 2}, Opts: opts}, &got); err != nil {
+				t.Errorf("%s: Sign(%v): got %v, want nil err", format, opts, err)
+				continue
+			}
+			if want := fmt.Sprintf("0102 %#v", opts); got != want {
+				t.Errorf("%s: Sign(%v): got %q, want %q", format, opts, got, want)
+			}
+		}
+		var metadata Metadata
+		if err := client.Call("EnterpriseCertSigner.Metadata", struct{}{}, &metadata); err != nil {
+			t.Errorf("%s: Metadata: got %v, want nil err", format, err)
+		}
+		if want := (Metadata{KeystoreType: "test", Provider: "wire"}); metadata != want {
+			t.Errorf("%s: Metadata: got %+v, want %+v", format, metadata, want)
+		}
+		var decrypted []byte
+		if err := client.Call("EnterpriseCertSigner.Decrypt", struct{}{}, &decrypted); err != nil {
+			t.Errorf("%s: Decrypt: got %v, want nil err", format, err)
+		}
+		if string(decrypted) != "secret" {
+			t.Errorf("%s: Decrypt: got %q, want %q", format, decrypted, "secret")
+		}
+		// The server writes the next reply once it has zeroed the previous
+		// one.
+		var resp string
+		if err := client.Call("EnterpriseCertSigner.Fail", struct{}{}, &resp); err == nil || err.Error() != "failed" {
+			t.Errorf("%s: Fail: got err %v, want %q", format, err, "failed")
+		}
+		if !bytes.Equal(plaintext, make([]byte, len(plaintext))) {
+			t.Errorf("%s: Decrypt: reply %q was not zeroed once written", format, plaintext)
+		}
+	}
+}
+
+// TestJSONMessages checks the messages documented in the package comment, as
+// a signer written in another language would see them.
+func TestJSONMessages(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("EnterpriseCertSigner", new(Signer)); err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	go server.ServeCodec(newServerCodec(serverConn))
+
+	go fmt.Fprintln(clientConn, `{"method": "EnterpriseCertSigner.Sign", "params": [{"Digest": "AQI=", "Opts": {"type": "pss", "hash": "SHA-256", "salt_length": -1}}], "id": 7}`)
+	line, err := bufio.NewReader(clientConn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":7,"result":"0102 \u0026rsa.PSSOptions{SaltLength:-1, Hash:0x5}","error":null}`; strings.TrimSpace(line) != want {
+		t.Errorf("response: got %s, want %s", line, want)
+	}
+}
+
+func TestOpts(t *testing.T) {
+	for _, opts := range []any{
+		crypto.SHA256,
+		&rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: 32},
+		&rsa.OAEPOptions{Hash: crypto.SHA512, Label: []byte("label")},
+		&rsa.PKCS1v15DecryptOptions{},
+		&cryptoopts.Opaque{Type: "*mypkg.Options", Hash: crypto.SHA384},
+	} {
+		o, err := FromOpts(opts)
+		if err != nil {
+			t.Errorf("FromOpts(%v): got %v, want nil err", opts, err)
+			continue
+		}
+		got, err := o.Value()
+		if err != nil {
+			t.Errorf("Value(%+v): got %v, want nil err", o, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, opts) {
+			t.Errorf("round trip: got %#v, want %#v", got, opts)
+		}
+	}
+	if _, err := (&Opts{Type: OptsHash, Hash: "SHA-257"}).Value(); err == nil {
+		t.Error("Value: got nil err, want error for unknown hash function")
+	}
+	if _, err := (&Opts{Type: "ed448"}).Value(); err == nil {
+		t.Error("Value: got nil err, want error for unknown options type")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, format := range []string{"", FormatGob, FormatJSON} {
+		if err := Check(format); err != nil {
+			t.Errorf("Check(%q): got %v, want nil err", format, err)
+		}
+	}
+	if err := Check("protobuf"); err == nil {
+		t.Error("Check(\"protobuf\"): got nil err, want error")
+	}
+}
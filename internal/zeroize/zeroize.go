@@ -0,0 +1,35 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package zeroize provides helpers for scrubbing sensitive buffers, such as
+// PINs, digests and decrypted plaintexts, from memory once they are no longer needed.
+package zeroize
+
+import "runtime"
+
+// Bytes overwrites every byte of b with zero.
+func Bytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	// Keep b reachable until the loop above has run so that the stores
+	// cannot be optimized away.
+	runtime.KeepAlive(b)
+}
+
+// Slices overwrites every byte of each slice in bs with zero.
+func Slices(bs ...[]byte) {
+	for _, b := range bs {
+		Bytes(b)
+	}
+}
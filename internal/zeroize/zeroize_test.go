@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zeroize
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	b := []byte("sensitive")
+	Bytes(b)
+	if want := make([]byte, len(b)); !bytes.Equal(b, want) {
+		t.Errorf("Bytes: got %v, want %v", b, want)
+	}
+}
+
+func TestSlices(t *testing.T) {
+	a, b := []byte("pin"), []byte("digest")
+	Slices(a, b, nil)
+	for _, s := range [][]byte{a, b} {
+		if want := make([]byte, len(s)); !bytes.Equal(s, want) {
+			t.Errorf("Slices: got %v, want %v", s, want)
+		}
+	}
+}
@@ -11,12 +11,17 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !windows && (cgo || (linux && amd64) || (linux && arm64) || (darwin && amd64) || (darwin && arm64))
+// +build !windows
+// +build cgo linux,amd64 linux,arm64 darwin,amd64 darwin,arm64
+
 // Package linux contains a linux-specific client for accessing the PKCS#11 APIs directly,
 // bypassing the RPC-mechanism of the universal client.
 package linux
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"io"
 
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/linux/pkcs11"
@@ -52,17 +57,49 @@ func (sk *SecureKey) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts)
 	return sk.key.Decrypt(msg, opts)
 }
 
-// Close frees up resources associated with the underlying key.
-func (sk *SecureKey) Close() {
-	sk.key.Close()
+// WrapKey wraps a symmetric key with the public key using RSA-OAEP and the specified hash.
+func (sk *SecureKey) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	return sk.key.WrapKey(key, hash)
+}
+
+// UnwrapKey unwraps a symmetric key wrapped by WrapKey, using the private key.
+func (sk *SecureKey) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	return sk.key.UnwrapKey(wrappedKey, hash)
+}
+
+// KeyAgreement returns the ECDH shared secret of the EC private key and peer.
+func (sk *SecureKey) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	return sk.key.KeyAgreement(peer)
+}
+
+// Close frees up resources associated with the underlying key. It is safe to
+// call more than once. Operations on a closed SecureKey return an error.
+func (sk *SecureKey) Close() error {
+	return sk.key.Close()
 }
 
 // NewSecureKey returns a handle to the first available certificate and private key pair in
 // the specified PKCS#11 Module matching the filters.
 func NewSecureKey(pkcs11Module string, slotUint32Str string, label string, userPin string) (*SecureKey, error) {
-	k, err := pkcs11.Cred(pkcs11Module, slotUint32Str, label, userPin)
+	k, err := pkcs11.Cred(pkcs11Module, slotUint32Str, label, []byte(userPin), "", "")
 	if err != nil {
 		return nil, err
 	}
 	return &SecureKey{key: k}, nil
 }
+
+// NewSecureKeyFromModules returns a handle to the first available certificate and private key pair
+// matching the filters, trying each of the specified PKCS#11 Modules in order.
+func NewSecureKeyFromModules(pkcs11Modules []string, slotUint32Str string, label string, userPin string) (*SecureKey, error) {
+	k, err := pkcs11.CredFromModules(pkcs11Modules, slotUint32Str, label, []byte(userPin), "", "")
+	if err != nil {
+		return nil, err
+	}
+	return &SecureKey{key: k}, nil
+}
+
+// ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the
+// token in the specified slot of a PKCS#11 Module, under label. It requires pkcs11-tool from OpenSC.
+func ImportPKCS12Cred(credPath, password, pkcs11Module, slotUint32Str, label, userPin string) error {
+	return pkcs11.ImportPKCS12Cred(credPath, []byte(password), pkcs11Module, slotUint32Str, label, []byte(userPin))
+}
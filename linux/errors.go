@@ -0,0 +1,20 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import "errors"
+
+// ErrUnsupportedPlatform is returned by the functions of the package on the
+// platforms it does not support: PKCS#11 modules cannot be loaded without cgo or on Windows.
+var ErrUnsupportedPlatform = errors.New("linux: the platform is not supported")
@@ -0,0 +1,191 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote lets third parties build signer binaries for key management
+// systems that ECP does not support, such as Azure Key Vault or AWS KMS,
+// without forking the signer binaries.
+//
+// A backend implements RemoteSigner and registers a Factory under a name,
+// usually from an init function. A main package importing the backends then
+// calls Main, which serves the signer RPC API for the backend named in the
+// certificate config:
+//
+//	package main
+//
+//	import (
+//		"github.com/googleapis/enterprise-certificate-proxy/remote"
+//		_ "example.com/ecp-azure" // Registers the "azure_key_vault" backend.
+//	)
+//
+//	func main() {
+//		remote.Main()
+//	}
+//
+// The binary is used as the signer of the "remote" backend, and the "remote"
+// block of the certificate config selects the backend and holds its config:
+//
+//	"cert_configs": {
+//	  "priority": ["remote"],
+//	  "remote": {"backend": "azure_key_vault", "config": {"vault": "..."}}
+//	},
+//	"libs": {"signers": {"remote": "/usr/local/bin/ecp-azure"}}
+//
+// Implementations can check that they satisfy the contract of RemoteSigner
+// with the remotetest package.
+package remote
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/server"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/util"
+)
+
+// RemoteSigner is a private key held by a remote key management system,
+// together with its certificate chain.
+//
+// Sign receives a digest and the hash function used to compute it, or the
+// full message when the hash function is zero, as for Ed25519 keys. RSA keys
+// must support both PKCS #1 v1.5 and, with *rsa.PSSOptions, RSASSA-PSS with
+// a salt as long as the hash, which TLS 1.3 requires. Sign must be safe for
+// concurrent use.
+//
+// CertificateChain returns the DER encoded certificate chain, leaf first. The
+// public key of the leaf must be the public key returned by Public.
+//
+// Close releases the resources held by the RemoteSigner. It must be safe to
+// call more than once.
+type RemoteSigner interface {
+	crypto.Signer
+	CertificateChain() [][]byte
+	Close() error
+}
+
+// A Factory opens the RemoteSigner described by config, the JSON value of the
+// "config" field of the "remote" block of the certificate config. Errors
+// implementing Temporary() bool that return true are retried as configured by
+// the "retry" block of the certificate config.
+type Factory func(ctx context.Context, config json.RawMessage) (RemoteSigner, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a backend available under name. It panics if name is
+// already registered or if factory is nil.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("remote: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("remote: Register called twice for backend " + name)
+	}
+	factories[name] = factory
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the RemoteSigner of the backend registered under name.
+func Open(ctx context.Context, name string, config json.RawMessage) (RemoteSigner, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown remote backend %q, registered backends are %q", name, Backends())
+	}
+	return factory(ctx, config)
+}
+
+// Main serves the signer RPC API on stdin/stdout for the backend named in the
+// certificate config whose path is the only argument of the binary, and
+// returns when the client closes the connection. It is meant to be the whole
+// main function of a signer binary.
+func Main() {
+	server.Main(backend{})
+}
+
+// backend opens the RemoteSigner of the registered backend named in the
+// certificate config.
+type backend struct{}
+
+func (backend) Name() string {
+	return "remote"
+}
+
+// IsTransient reports whether err is a transient failure of the remote signer.
+func (backend) IsTransient(err error) bool {
+	return isTransient(err)
+}
+
+// Open returns the credential described by config, retrying transient errors
+// as configured.
+func (backend) Open(config *config.EnterpriseCertificateConfig, configFilePath string) (server.Key, error) {
+	remote := config.CertConfigs.Remote
+	var signer RemoteSigner
+	err := util.DoWithRetry(config.Retry, isTransient, func() (err error) {
+		signer, err = Open(context.Background(), remote.Backend, remote.Config)
+		return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("remote backend %q: %w", remote.Backend, err)
+	}
+	return credential{signer, remote.Backend}, nil
+}
+
+// isTransient reports whether err asks to be retried by implementing
+// Temporary() bool.
+func isTransient(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// credential is a RemoteSigner served by the signer. Remote signers are not
+// held by a removable token and do not decrypt.
+type credential struct {
+	RemoteSigner
+	backend string
+}
+
+// Metadata describes the remote backend holding the credential.
+func (c credential) Metadata() server.Metadata {
+	return server.Metadata{
+		KeystoreType: "remote",
+		Backend:      c.backend,
+	}
+}
+
+// Capabilities describes the algorithms that remote signers are expected to
+// support with the type of the key.
+func (c credential) Capabilities() util.Capabilities {
+	return util.KeyCapabilities(c.Public(), util.SignHashes, nil)
+}
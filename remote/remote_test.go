@@ -0,0 +1,117 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/remote"
+	"github.com/googleapis/enterprise-certificate-proxy/remote/remotetest"
+)
+
+// localSigner is a RemoteSigner backed by a key in memory.
+type localSigner struct {
+	crypto.Signer
+	chain [][]byte
+}
+
+func (s *localSigner) CertificateChain() [][]byte { return s.chain }
+
+func (s *localSigner) Close() error { return nil }
+
+func newLocalSigner(t *testing.T, key crypto.Signer) *localSigner {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Remote Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &localSigner{Signer: key, chain: [][]byte{der}}
+}
+
+func TestConformance(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecdsaKey, "Ed25519": ed25519Key} {
+		t.Run(name, func(t *testing.T) {
+			remotetest.TestRemoteSigner(t, newLocalSigner(t, key))
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotConfig json.RawMessage
+	remote.Register("test_register", func(ctx context.Context, config json.RawMessage) (remote.RemoteSigner, error) {
+		gotConfig = config
+		return newLocalSigner(t, key), nil
+	})
+	found := false
+	for _, name := range remote.Backends() {
+		found = found || name == "test_register"
+	}
+	if !found {
+		t.Errorf("Backends: got %q, want it to include %q", remote.Backends(), "test_register")
+	}
+
+	config := json.RawMessage(`{"vault":"example"}`)
+	s, err := remote.Open(context.Background(), "test_register", config)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	if string(gotConfig) != string(config) {
+		t.Errorf("Open: factory got config %s, want %s", gotConfig, config)
+	}
+	if _, err := remote.Open(context.Background(), "missing", nil); err == nil {
+		t.Error("Open: got nil error for an unregistered backend")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register: got no panic for a duplicate backend")
+		}
+	}()
+	remote.Register("test_register", func(context.Context, json.RawMessage) (remote.RemoteSigner, error) { return nil, nil })
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remotetest provides conformance tests for implementations of
+// remote.RemoteSigner.
+package remotetest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/remote"
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
+)
+
+// TestRemoteSigner checks that s satisfies the contract of
+// remote.RemoteSigner, and closes it. It runs the sigtest suite with the ways
+// of signing that TLS uses with the key of s. It signs a few messages with the
+// key, so it should not be run against keys whose use is restricted or
+// audited.
+func TestRemoteSigner(t *testing.T, s remote.RemoteSigner) {
+	t.Helper()
+	// RemoteSigner does not require Close to revoke access to the key.
+	sigtest.TestKey(t, s, &sigtest.Options{SignOpts: tlsSignOpts(s.Public()), SkipSignAfterClose: true})
+}
+
+// tlsSignOpts returns the ways of signing that TLS uses with pub, or nil if
+// the type of pub is not supported.
+func tlsSignOpts(pub crypto.PublicKey) []crypto.SignerOpts {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return []crypto.SignerOpts{crypto.SHA256, &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash}}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return []crypto.SignerOpts{crypto.SHA384}
+		case elliptic.P521():
+			return []crypto.SignerOpts{crypto.SHA512}
+		}
+		return []crypto.SignerOpts{crypto.SHA256}
+	case ed25519.PublicKey:
+		return []crypto.SignerOpts{crypto.Hash(0)}
+	}
+	return nil
+}
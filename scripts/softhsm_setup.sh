@@ -18,6 +18,7 @@ set -eux
 SOFTHSM2_MODULE="/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so"
 TOKEN_NAME="Demo Token"
 OBJECT_LABEL="Demo Object"
+EC_OBJECT_LABEL="Demo EC Object"
 PIN="0000"
 
 install_dependencies() {
@@ -65,6 +66,16 @@ EOF
   pkcs11-tool --module $SOFTHSM2_MODULE --slot $SLOT --write-object private_key.der --type privkey --label "$OBJECT_LABEL" --login --pin $PIN
   pkcs11-tool --module $SOFTHSM2_MODULE --slot $SLOT --write-object public_key.der --type pubkey --label "$OBJECT_LABEL" --login --pin $PIN
 
+  # A P-256 credential for the key agreement tests.
+  openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -keyout ec_key.pem -out ec_cert.pem -sha256 -days 365 -nodes -subj "/CN=ecdh.example.com"
+  openssl x509 -in ec_cert.pem -out ec_cert.der -outform der
+  openssl pkey -in ec_key.pem -outform DER -out ec_private_key.der
+  openssl pkey -in ec_key.pem -pubout -outform DER -out ec_public_key.der
+
+  pkcs11-tool --module $SOFTHSM2_MODULE --slot $SLOT --write-object ec_cert.der --type cert --label "$EC_OBJECT_LABEL" --login --pin $PIN
+  pkcs11-tool --module $SOFTHSM2_MODULE --slot $SLOT --write-object ec_private_key.der --type privkey --label "$EC_OBJECT_LABEL" --login --pin $PIN
+  pkcs11-tool --module $SOFTHSM2_MODULE --slot $SLOT --write-object ec_public_key.der --type pubkey --label "$EC_OBJECT_LABEL" --login --pin $PIN
+
   rm -rf $BUILD_DIR
 
   popd
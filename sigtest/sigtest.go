@@ -0,0 +1,265 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sigtest provides a conformance test suite for keys backed by a
+// keystore, such as the keys of the signer backends of this module and the
+// remote signers registered with the remote package. Backend authors can run
+// it from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		key := openTestKey(t)
+//		sigtest.TestKey(t, key, nil)
+//	}
+package sigtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Key is a private key held by a keystore, together with its certificate
+// chain.
+//
+// CertificateChain returns the DER encoded certificate chain, leaf first. The
+// public key of the leaf must be the public key returned by Public.
+//
+// Sign receives a digest and the hash function used to compute it, or the
+// full message when the hash function is zero, as for Ed25519 keys. It must be
+// safe for concurrent use.
+//
+// Close releases the resources held by the key. It must be safe to call more
+// than once, and return the same result each time.
+type Key interface {
+	crypto.Signer
+	CertificateChain() [][]byte
+	Close() error
+}
+
+// Options configure TestKey. The zero value tests everything.
+type Options struct {
+	// SignOpts lists the signer opts that the key must sign with. If empty,
+	// RSA keys must support PKCS #1 v1.5 and RSASSA-PSS, with a salt as long
+	// as the hash, ECDSA keys must sign digests of any length, and Ed25519
+	// keys must sign messages, each with SHA-256, SHA-384 and SHA-512 except
+	// for Ed25519. Backends whose keys only support one algorithm, such as
+	// Cloud KMS key versions, list it here.
+	SignOpts []crypto.SignerOpts
+
+	// Concurrency is the number of goroutines signing at the same time in
+	// the concurrency test. It defaults to 8.
+	Concurrency int
+
+	// ErrClosed, if not nil, is the error that Sign must wrap once the key is
+	// closed.
+	ErrClosed error
+
+	// SkipSignAfterClose disables checking that Sign fails once the key is
+	// closed, for keys whose Close does not release the key itself.
+	SkipSignAfterClose bool
+}
+
+// hashes are the hash functions that TestKey signs digests of by default.
+var hashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// TestKey checks that k satisfies the contract of Key and signs correctly,
+// then closes it. It signs a few messages with the key, so it should not be
+// run against keys whose use is restricted or audited. opts may be nil.
+func TestKey(t *testing.T, k Key, opts *Options) {
+	t.Helper()
+	if opts == nil {
+		opts = &Options{}
+	}
+	signOpts := opts.SignOpts
+	if len(signOpts) == 0 {
+		signOpts = DefaultSignOpts(k.Public())
+		if signOpts == nil {
+			t.Fatalf("unsupported public key type %T", k.Public())
+		}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	t.Run("CertificateChain", func(t *testing.T) { testCertificateChain(t, k) })
+	t.Run("Sign", func(t *testing.T) { testSign(t, k, signOpts) })
+	t.Run("ConcurrentSign", func(t *testing.T) { testConcurrentSign(t, k, signOpts[0], concurrency) })
+	t.Run("Close", func(t *testing.T) { testClose(t, k, signOpts[0], opts) })
+}
+
+// DefaultSignOpts returns the signer opts that TestKey uses with the public key
+// pub when Options.SignOpts is empty, or nil if the type of pub is not
+// supported.
+func DefaultSignOpts(pub crypto.PublicKey) []crypto.SignerOpts {
+	var signOpts []crypto.SignerOpts
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		for _, hash := range hashes {
+			signOpts = append(signOpts, hash, &rsa.PSSOptions{Hash: hash, SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		for _, hash := range hashes {
+			signOpts = append(signOpts, hash)
+		}
+	case ed25519.PublicKey:
+		signOpts = append(signOpts, crypto.Hash(0))
+	}
+	return signOpts
+}
+
+// Name describes opts used with the public key pub, as in the names of the
+// subtests of TestKey. Ex: "PSS-SHA256".
+func Name(pub crypto.PublicKey, opts crypto.SignerOpts) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return "PSS-" + hashName(opts.HashFunc())
+		}
+		return "PKCS1v15-" + hashName(opts.HashFunc())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + hashName(opts.HashFunc())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T-%v", pub, opts.HashFunc())
+}
+
+// hashName returns the name of hash without dashes, as used in TLS signature
+// scheme names. Ex: "SHA256".
+func hashName(hash crypto.Hash) string {
+	switch hash {
+	case crypto.SHA256:
+		return "SHA256"
+	case crypto.SHA384:
+		return "SHA384"
+	case crypto.SHA512:
+		return "SHA512"
+	}
+	return hash.String()
+}
+
+func testCertificateChain(t *testing.T, k Key) {
+	chain := k.CertificateChain()
+	if len(chain) == 0 {
+		t.Fatal("CertificateChain: got no certificates, want the leaf first")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		t.Fatalf("CertificateChain: failed to parse the leaf certificate: %v", err)
+	}
+	pub, ok := k.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		t.Fatalf("Public: unsupported public key type %T", k.Public())
+	}
+	if !pub.Equal(leaf.PublicKey) {
+		t.Error("Public: the public key does not match the leaf certificate")
+	}
+	for i, der := range chain[1:] {
+		if _, err := x509.ParseCertificate(der); err != nil {
+			t.Errorf("CertificateChain: failed to parse certificate %d: %v", i+1, err)
+		}
+	}
+}
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// sign signs msg with k, hashing it first unless opts has no hash function,
+// and verifies the signature.
+func sign(k Key, msg []byte, opts crypto.SignerOpts) error {
+	digest := msg
+	if hash := opts.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(msg)
+		digest = h.Sum(nil)
+	}
+	signature, err := k.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return err
+	}
+	return verify(k.Public(), digest, signature, opts)
+}
+
+func verify(pub crypto.PublicKey, digest, signature []byte, opts crypto.SignerOpts) error {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			return rsa.VerifyPSS(pub, pss.Hash, digest, signature, pss)
+		}
+		return rsa.VerifyPKCS1v15(pub, opts.HashFunc(), digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return errInvalidSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, signature) {
+			return errInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+func testSign(t *testing.T, k Key, signOpts []crypto.SignerOpts) {
+	for _, opts := range signOpts {
+		if err := sign(k, []byte("sigtest message"), opts); err != nil {
+			t.Errorf("Sign %s: %v", Name(k.Public(), opts), err)
+		}
+	}
+}
+
+func testConcurrentSign(t *testing.T, k Key, opts crypto.SignerOpts, concurrency int) {
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- sign(k, []byte{byte(i)}, opts)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent Sign %s: %v", Name(k.Public(), opts), err)
+		}
+	}
+}
+
+func testClose(t *testing.T, k Key, signOpts crypto.SignerOpts, opts *Options) {
+	err := k.Close()
+	if err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err2 := k.Close(); err2 != err {
+		t.Errorf("second Close: got %v, want the result of the first call, %v", err2, err)
+	}
+	if opts.SkipSignAfterClose {
+		return
+	}
+	err = sign(k, []byte("sigtest message"), signOpts)
+	switch {
+	case err == nil:
+		t.Error("Sign after Close: got nil err, want error")
+	case opts.ErrClosed != nil && !errors.Is(err, opts.ErrClosed):
+		t.Errorf("Sign after Close: got %v, want %v", err, opts.ErrClosed)
+	}
+}
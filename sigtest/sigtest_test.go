@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigtest_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
+)
+
+var errClosed = errors.New("key is closed")
+
+// memoryKey is a Key backed by a private key in memory.
+type memoryKey struct {
+	crypto.Signer
+	chain  [][]byte
+	closed atomic.Bool
+}
+
+func (k *memoryKey) CertificateChain() [][]byte { return k.chain }
+
+func (k *memoryKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if k.closed.Load() {
+		return nil, errClosed
+	}
+	return k.Signer.Sign(rand, digest, opts)
+}
+
+func (k *memoryKey) Close() error {
+	k.closed.Store(true)
+	return nil
+}
+
+func newMemoryKey(t *testing.T, key crypto.Signer) *memoryKey {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Key"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memoryKey{Signer: key, chain: [][]byte{der}}
+}
+
+func TestTestKey(t *testing.T) {
+	keys := map[string]func() (crypto.Signer, error){
+		"RSA":        func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+		"ECDSA-P256": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+		"ECDSA-P384": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+		"ECDSA-P521": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P521(), rand.Reader) },
+		"Ed25519": func() (crypto.Signer, error) {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			return key, err
+		},
+	}
+	for name, generate := range keys {
+		t.Run(name, func(t *testing.T) {
+			key, err := generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigtest.TestKey(t, newMemoryKey(t, key), &sigtest.Options{ErrClosed: errClosed})
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	rsaKey := &rsa.PublicKey{}
+	tests := []struct {
+		pub  crypto.PublicKey
+		opts crypto.SignerOpts
+		want string
+	}{
+		{pub: rsaKey, opts: crypto.SHA384, want: "PKCS1v15-SHA384"},
+		{pub: rsaKey, opts: &rsa.PSSOptions{Hash: crypto.SHA256}, want: "PSS-SHA256"},
+		{pub: &ecdsa.PublicKey{}, opts: crypto.SHA512, want: "ECDSA-SHA512"},
+		{pub: ed25519.PublicKey{}, opts: crypto.Hash(0), want: "Ed25519"},
+	}
+	for _, test := range tests {
+		if got := sigtest.Name(test.pub, test.opts); got != test.want {
+			t.Errorf("Name(%T, %v): got %q, want %q", test.pub, test.opts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package integration contains end-to-end tests that provision a credential in
+// the real keystore of the current platform, start the signer binary built from
+// this tree and use it through the client library:
+//
+//   - Linux: a SoftHSM2 token, which requires softhsm2-util and pkcs11-tool.
+//   - MacOS: an ephemeral keychain, which requires openssl and codesign.
+//   - Windows: a self-signed certificate in the CurrentUser\MY store.
+//
+// The tests modify keystore state and are only built with the integration tag:
+//
+//	go test -tags integration ./test/integration
+package integration
@@ -0,0 +1,184 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/client"
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+	"github.com/googleapis/enterprise-certificate-proxy/sigtest"
+)
+
+// run runs a command that provisions the keystore and returns its output.
+func run(t *testing.T, name string, args ...string) []byte {
+	t.Helper()
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", name, err, out)
+	}
+	return out
+}
+
+// cleanup runs a command that reverts a change to the keystore when the test
+// finishes. Failures are logged, since the keystore may need manual cleanup.
+func cleanup(t *testing.T, name string, args ...string) {
+	t.Cleanup(func() {
+		if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			t.Logf("cleanup: %s: %v\n%s", name, err, out)
+		}
+	})
+}
+
+// buildSigner builds the signer binary for the current platform and returns
+// its path.
+func buildSigner(t *testing.T) string {
+	t.Helper()
+	signer := filepath.Join(t.TempDir(), "ecp")
+	if runtime.GOOS == "windows" {
+		signer += ".exe"
+	}
+	cmd := exec.Command("go", "build", "-o", signer, signerPackage)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building signer: %v\n%s", err, out)
+	}
+	return signer
+}
+
+// newCredential starts a signer for the credential provisioned by provision.
+func newCredential(t *testing.T) *client.Key {
+	t.Helper()
+	signer := buildSigner(t)
+	ecpConfig := config.EnterpriseCertificateConfig{
+		CertConfigs: provision(t, signer),
+		Libs:        config.Libs{ECP: signer},
+		Version:     config.CurrentVersion,
+	}
+	data, err := json.Marshal(ecpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFilePath := filepath.Join(t.TempDir(), "certificate_config.json")
+	if err := os.WriteFile(configFilePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := client.Cred(configFilePath)
+	if err != nil {
+		t.Fatalf("Cred: got %v, want nil err", err)
+	}
+	t.Cleanup(func() { key.Close() })
+	return key
+}
+
+// newSelfSignedCert returns a self-signed client authentication certificate
+// with the given common name, and its RSA private key.
+func newSelfSignedCert(t *testing.T, commonName string) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, priv
+}
+
+func TestCertificateChain(t *testing.T) {
+	key := newCredential(t)
+	chain := key.CertificateChain()
+	if len(chain) == 0 {
+		t.Fatal("CertificateChain: got empty chain")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: got %v, want nil err", err)
+	}
+	want, err := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Public: got a key that does not match the leaf certificate")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	key := newCredential(t)
+	sigtest.TestKey(t, key, &sigtest.Options{ErrClosed: client.ErrKeyClosed})
+}
+
+func TestSign(t *testing.T) {
+	key := newCredential(t)
+	digest := sha256.Sum256([]byte("enterprise certificate proxy integration test"))
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		sig, err := key.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatalf("Sign(PKCS1v15): got %v, want nil err", err)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			t.Errorf("VerifyPKCS1v15: got %v, want nil err", err)
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		sig, err = key.Sign(nil, digest[:], opts)
+		if err != nil {
+			t.Fatalf("Sign(PSS): got %v, want nil err", err)
+		}
+		if err := rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, opts); err != nil {
+			t.Errorf("VerifyPSS: got %v, want nil err", err)
+		}
+	case *ecdsa.PublicKey:
+		sig, err := key.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatalf("Sign: got %v, want nil err", err)
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			t.Error("VerifyASN1: got invalid signature")
+		}
+	default:
+		t.Fatalf("Public: unsupported key type %T", pub)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration && darwin
+// +build integration,darwin
+
+package integration
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+const signerPackage = "../../internal/signer/darwin"
+
+const keychainPassword = "1234"
+
+var cdHash = regexp.MustCompile(`CDHash=([0-9a-f]+)`)
+
+// provision creates an ephemeral keychain on the user's search list, imports a
+// self-signed identity into it and allows the signer binary to use its key.
+func provision(t *testing.T, signer string) config.CertConfigs {
+	for _, tool := range []string{"openssl", "security", "codesign"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	issuer := fmt.Sprintf("ECP Integration %d", time.Now().UnixNano())
+	certDER, priv := newSelfSignedCert(t, issuer)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	credPath := filepath.Join(dir, "cred.p12")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run(t, "openssl", "pkcs12", "-export", "-inkey", keyPath, "-in", certPath, "-out", credPath, "-passout", "pass:"+keychainPassword)
+
+	keychain := filepath.Join(dir, "integration.keychain-db")
+	run(t, "security", "create-keychain", "-p", keychainPassword, keychain)
+	cleanup(t, "security", "delete-keychain", keychain)
+	// Disable the lock timeout of the keychain.
+	run(t, "security", "set-keychain-settings", keychain)
+
+	// Add the keychain to the search list, so that the signer finds the identity.
+	searchList := strings.Fields(strings.ReplaceAll(string(run(t, "security", "list-keychains", "-d", "user")), "\"", ""))
+	run(t, "security", append([]string{"list-keychains", "-d", "user", "-s", keychain}, searchList...)...)
+	cleanup(t, "security", append([]string{"list-keychains", "-d", "user", "-s"}, searchList...)...)
+
+	run(t, "security", "unlock-keychain", "-p", keychainPassword, keychain)
+	run(t, "security", "import", credPath, "-P", keychainPassword, "-k", keychain, "-A")
+
+	// Importing with -A is not enough for the signer to use the private key
+	// without a prompt, its code directory hash must be on the partition list.
+	run(t, "codesign", "-f", "-s", "-", signer)
+	m := cdHash.FindSubmatch(run(t, "codesign", "--display", "--verbose=4", signer))
+	if m == nil {
+		t.Fatal("codesign: CDHash not found")
+	}
+	run(t, "security", "set-key-partition-list", "-S", "cdhash:"+string(m[1]), "-k", keychainPassword, keychain)
+
+	return config.CertConfigs{
+		MacOSKeychain: config.MacOSKeychain{Issuer: issuer},
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration && linux
+// +build integration,linux
+
+package integration
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+const signerPackage = "../../internal/signer/linux"
+
+const (
+	tokenLabel  = "ECP Integration Token"
+	objectLabel = "ECP Integration Object"
+	tokenPin    = "0000"
+)
+
+// softHSMModules are the usual install locations of the SoftHSM2 module.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+}
+
+var reassignedSlot = regexp.MustCompile(`reassigned to slot (\d+)`)
+
+// provision initializes a SoftHSM2 token in a temporary token directory and
+// writes a self-signed certificate and its key pair to it.
+func provision(t *testing.T, signer string) config.CertConfigs {
+	for _, tool := range []string{"softhsm2-util", "pkcs11-tool"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		for _, m := range softHSMModules {
+			if _, err := os.Stat(m); err == nil {
+				module = m
+				break
+			}
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM2 module not found, set SOFTHSM2_MODULE")
+	}
+
+	// The signer subprocess inherits SOFTHSM2_CONF.
+	dir := t.TempDir()
+	tokenDir := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokenDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokenDir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	out := run(t, "softhsm2-util", "--init-token", "--free", "--label", tokenLabel, "--pin", tokenPin, "--so-pin", tokenPin)
+	m := reassignedSlot.FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("softhsm2-util: slot not found in output:\n%s", out)
+	}
+	slotID, err := strconv.ParseUint(string(m[1]), 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := fmt.Sprintf("0x%x", slotID)
+
+	certDER, priv := newSelfSignedCert(t, "ECP Integration")
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []struct {
+		typ  string
+		data []byte
+	}{
+		{typ: "cert", data: certDER},
+		{typ: "privkey", data: x509.MarshalPKCS1PrivateKey(priv)},
+		{typ: "pubkey", data: pubDER},
+	}
+	for _, object := range objects {
+		path := filepath.Join(dir, object.typ+".der")
+		if err := os.WriteFile(path, object.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		run(t, "pkcs11-tool", "--module", module, "--slot", slot, "--write-object", path, "--type", object.typ, "--label", objectLabel, "--login", "--pin", tokenPin)
+	}
+
+	return config.CertConfigs{
+		PKCS11: config.PKCS11{
+			Slot:         slot,
+			Label:        objectLabel,
+			PKCS11Module: config.PKCS11Modules{module},
+			UserPin:      tokenPin,
+		},
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration && windows
+// +build integration,windows
+
+package integration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleapis/enterprise-certificate-proxy/internal/config"
+)
+
+const signerPackage = "../../internal/signer/windows"
+
+// provision creates a self-signed client authentication certificate with a
+// key in the Microsoft Software Key Storage Provider in the CurrentUser\MY
+// store, and removes it with its key when the test finishes.
+func provision(t *testing.T, signer string) config.CertConfigs {
+	issuer := fmt.Sprintf("ECP Integration %d", time.Now().UnixNano())
+	newCert := fmt.Sprintf(`(New-SelfSignedCertificate -Subject "CN=%s" -CertStoreLocation Cert:\CurrentUser\My -KeyAlgorithm RSA -KeyLength 2048 -KeyUsage DigitalSignature,KeyEncipherment -TextExtension @("2.5.29.37={text}1.3.6.1.5.5.7.3.2") -Provider "Microsoft Software Key Storage Provider").Thumbprint`, issuer)
+	thumbprint := strings.TrimSpace(string(run(t, "powershell", "-NoProfile", "-Command", newCert)))
+	cleanup(t, "powershell", "-NoProfile", "-Command", fmt.Sprintf(`Remove-Item -DeleteKey Cert:\CurrentUser\My\%s`, thumbprint))
+
+	return config.CertConfigs{
+		WindowsStore: config.WindowsStore{
+			Issuer:   issuer,
+			Store:    "MY",
+			Provider: "current_user",
+		},
+	}
+}
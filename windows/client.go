@@ -11,12 +11,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build windows
+// +build windows
+
 // Package windows contains a windows-specific client for accessing the ncrypt APIs directly,
 // bypassing the RPC-mechanism of the universal client.
 package windows
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"io"
 
 	"github.com/googleapis/enterprise-certificate-proxy/internal/signer/windows/ncrypt"
@@ -42,9 +46,35 @@ func (sk *SecureKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (s
 	return sk.key.Sign(nil, digest, opts)
 }
 
-// Close frees up resources associated with the underlying key.
-func (sk *SecureKey) Close() {
-	sk.key.Close()
+// Encrypt encrypts a plaintext msg into ciphertext, using the specified encrypt opts.
+func (sk *SecureKey) Encrypt(_ io.Reader, msg []byte, opts any) (ciphertext []byte, err error) {
+	return sk.key.Encrypt(msg, opts)
+}
+
+// Decrypt decrypts a ciphertext msg into plaintext, using the specified decrypter opts. Implements crypto.Decrypter interface.
+func (sk *SecureKey) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	return sk.key.Decrypt(msg, opts)
+}
+
+// WrapKey wraps a symmetric key with the public key using RSA-OAEP and the specified hash.
+func (sk *SecureKey) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	return sk.key.WrapKey(key, hash)
+}
+
+// UnwrapKey unwraps a symmetric key wrapped by WrapKey, using the private key.
+func (sk *SecureKey) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	return sk.key.UnwrapKey(wrappedKey, hash)
+}
+
+// KeyAgreement returns the ECDH shared secret of the EC private key and peer.
+func (sk *SecureKey) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	return sk.key.KeyAgreement(peer)
+}
+
+// Close frees up resources associated with the underlying key. It is safe to
+// call more than once. Operations on a closed SecureKey return an error.
+func (sk *SecureKey) Close() error {
+	return sk.key.Close()
 }
 
 // NewSecureKey returns a handle to the first available certificate and private key pair in
@@ -56,3 +86,9 @@ func NewSecureKey(issuer string, store string, provider string) (*SecureKey, err
 	}
 	return &SecureKey{key: k}, nil
 }
+
+// ImportPKCS12Cred imports a PKCS12 file containing a client certificate and private key into the
+// specified Windows key store.
+func ImportPKCS12Cred(credPath, password, store, provider string) error {
+	return ncrypt.ImportPKCS12Cred(credPath, []byte(password), store, provider)
+}
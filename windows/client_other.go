@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package windows
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"io"
+)
+
+// SecureKey is not available on this platform. Its constructors return
+// ErrUnsupportedPlatform.
+type SecureKey struct{}
+
+// CertificateChain returns nil.
+func (sk *SecureKey) CertificateChain() [][]byte {
+	return nil
+}
+
+// Public returns nil.
+func (sk *SecureKey) Public() crypto.PublicKey {
+	return nil
+}
+
+// Sign returns ErrUnsupportedPlatform.
+func (sk *SecureKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) (signed []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Encrypt returns ErrUnsupportedPlatform.
+func (sk *SecureKey) Encrypt(_ io.Reader, msg []byte, opts any) (ciphertext []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Decrypt returns ErrUnsupportedPlatform.
+func (sk *SecureKey) Decrypt(_ io.Reader, msg []byte, opts crypto.DecrypterOpts) (plaintext []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// WrapKey returns ErrUnsupportedPlatform.
+func (sk *SecureKey) WrapKey(key []byte, hash crypto.Hash) (wrappedKey []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// UnwrapKey returns ErrUnsupportedPlatform.
+func (sk *SecureKey) UnwrapKey(wrappedKey []byte, hash crypto.Hash) (key []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// KeyAgreement returns ErrUnsupportedPlatform.
+func (sk *SecureKey) KeyAgreement(peer *ecdsa.PublicKey) (secret []byte, err error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// Close is a no-op.
+func (sk *SecureKey) Close() error {
+	return nil
+}
+
+// NewSecureKey returns ErrUnsupportedPlatform.
+func NewSecureKey(issuer string, store string, provider string) (*SecureKey, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+// ImportPKCS12Cred returns ErrUnsupportedPlatform.
+func ImportPKCS12Cred(credPath, password, store, provider string) error {
+	return ErrUnsupportedPlatform
+}